@@ -0,0 +1,102 @@
+package gospider
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// TaskSubmission 可序列化的任务，用于控制接口提交、持久化或跨进程传输，见Spider.SerializeTask
+// Handlers为用Spider.RegisterHandler注册的处理方法的名字
+type TaskSubmission struct {
+	SerializedRequest
+	Meta      map[string]interface{} `json:"meta,omitempty"`
+	Handlers  []string               `json:"handlers,omitempty"`
+	NotBefore time.Time              `json:"not_before,omitempty"`
+	Render    bool                   `json:"render,omitempty"`
+	Depth     int                    `json:"depth,omitempty"`
+}
+
+// apiStatus 控制接口返回的状态
+type apiStatus struct {
+	*debugStatus
+	Paused bool `json:"paused"`
+}
+
+// WithControlAPI 在addr上启动控制爬虫的HTTP接口，Spider.Close时关闭，见ControlAPIHandler
+func WithControlAPI(addr string) Extension {
+	return func(s *Spider) {
+		s.useExtension(&httpService{addr: addr, kind: "control api server", handler: ControlAPIHandler})
+	}
+}
+
+// ControlAPIHandler 控制爬虫的HTTP接口，可以挂载到已有的HTTP服务上
+//
+//	POST /tasks  提交任务，请求体为JSON格式的TaskSubmission
+//	GET  /status 获取爬虫状态
+//	POST /pause  暂停爬虫
+//	POST /resume 恢复爬虫
+func ControlAPIHandler(s *Spider) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tasks", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeAPIError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		sub := &TaskSubmission{}
+		if err := json.NewDecoder(r.Body).Decode(sub); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := s.submitTask(sub); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeAPIJSON(w, http.StatusAccepted, map[string]interface{}{"accepted": true})
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeAPIError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, &apiStatus{debugStatus: newDebugStatus(s), Paused: s.IsPaused()})
+	})
+	mux.HandleFunc("/pause", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeAPIError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		s.Pause()
+		writeAPIJSON(w, http.StatusOK, map[string]interface{}{"paused": true})
+	})
+	mux.HandleFunc("/resume", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeAPIError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		s.Resume()
+		writeAPIJSON(w, http.StatusOK, map[string]interface{}{"paused": false})
+	})
+	return mux
+}
+
+// submitTask 将提交的任务作为种子任务加入爬虫
+func (s *Spider) submitTask(sub *TaskSubmission) error {
+	t, err := s.DeserializeTask(sub)
+	if err != nil {
+		return err
+	}
+	s.AddTask(t)
+	return nil
+}
+
+func writeAPIJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, code int, err error) {
+	writeAPIJSON(w, code, map[string]interface{}{"error": err.Error()})
+}
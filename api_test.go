@@ -0,0 +1,100 @@
+package gospider
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestControlAPI(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+
+	s := NewSpider()
+	s.Logging = false
+	count := int64(0)
+	s.RegisterHandler("count", func(ctx *Context) {
+		assert.Equal(t, "b", ctx.Meta["a"])
+		atomic.AddInt64(&count, 1)
+	})
+	api := httptest.NewServer(ControlAPIHandler(s))
+	defer api.Close()
+
+	resp := goreq.Post(api.URL + "/pause").Do()
+	assert.NoError(t, resp.Err)
+	assert.True(t, s.IsPaused())
+
+	for i := 0; i < 2; i++ {
+		resp = goreq.Post(api.URL + "/tasks").SetJsonBody(map[string]interface{}{
+			"url":      ts.URL,
+			"meta":     map[string]interface{}{"a": "b"},
+			"handlers": []string{"count"},
+		}).Do()
+		assert.NoError(t, resp.Err)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	}
+	resp = goreq.Post(api.URL + "/tasks").SetJsonBody(map[string]interface{}{
+		"url":      ts.URL,
+		"handlers": []string{"unknown"},
+	}).Do()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	j, err := goreq.Get(api.URL + "/status").Do().JSON()
+	assert.NoError(t, err)
+	assert.True(t, j.Get("paused").Bool())
+	assert.Equal(t, int64(2), j.Get("total_task").Int())
+	assert.Equal(t, int64(0), j.Get("finished_task").Int())
+	assert.Equal(t, int64(0), atomic.LoadInt64(&count))
+
+	resp = goreq.Post(api.URL + "/resume").Do()
+	assert.NoError(t, resp.Err)
+	s.Wait()
+	assert.Equal(t, int64(2), atomic.LoadInt64(&count))
+	assert.False(t, s.IsPaused())
+}
+
+func TestWithControlAPI_Close(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	s := NewSpider(WithSynchronousMode(), WithControlAPI("127.0.0.1:0"))
+	s.Logging = false
+	count := 0
+	s.RegisterHandler("count", func(ctx *Context) {
+		count++
+	})
+	exts := s.Extensions()
+	if !assert.Len(t, exts, 1) {
+		return
+	}
+	api := "http://" + exts[0].(*httpService).addr
+	submit := func() {
+		resp := goreq.Post(api + "/tasks").SetJsonBody(map[string]interface{}{
+			"url":      ts.URL,
+			"handlers": []string{"count"},
+		}).Do()
+		if assert.NoError(t, resp.Err) {
+			assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		}
+	}
+	submit()
+	s.Wait()
+	assert.Equal(t, 1, count)
+
+	// 服务在多次Wait之间保持运行
+	assert.Len(t, s.Extensions(), 1)
+	submit()
+	s.Wait()
+	assert.Equal(t, 2, count)
+
+	assert.NoError(t, s.Close())
+	assert.Empty(t, s.Extensions())
+	_, err := http.Get(api + "/status")
+	assert.Error(t, err)
+}
@@ -0,0 +1,162 @@
+package gospider
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zhshch2002/goreq"
+)
+
+// AutoThrottleConfig WithAutoThrottle的配置，零值字段使用默认值
+type AutoThrottleConfig struct {
+	StartDelay        time.Duration // 每个host初始的请求间隔，默认1s
+	MinDelay          time.Duration // 最小请求间隔，默认0
+	MaxDelay          time.Duration // 最大请求间隔，默认60s
+	TargetConcurrency float64       // 期望每个host同时进行的请求数，默认1
+	MaxConcurrency    int           // 每个host最大并发数，默认8
+}
+
+func (c *AutoThrottleConfig) setDefaults() {
+	if c.StartDelay == 0 {
+		c.StartDelay = time.Second
+	}
+	if c.MaxDelay == 0 {
+		c.MaxDelay = 60 * time.Second
+	}
+	if c.TargetConcurrency <= 0 {
+		c.TargetConcurrency = 1
+	}
+	if c.MaxConcurrency <= 0 {
+		c.MaxConcurrency = 8
+	}
+}
+
+// throttleHost 一个host的限速状态
+type throttleHost struct {
+	conf *AutoThrottleConfig
+
+	lock     sync.Mutex
+	delay    time.Duration // 当前请求间隔
+	limit    int           // 当前并发上限
+	active   int
+	next     time.Time     // 下一个请求最早的开始时间
+	released chan struct{} // 有请求结束时关闭并替换
+}
+
+func newThrottleHost(conf *AutoThrottleConfig) *throttleHost {
+	return &throttleHost{
+		conf:     conf,
+		delay:    conf.StartDelay,
+		limit:    1,
+		released: make(chan struct{}),
+	}
+}
+
+// acquire 等待直到并发数和请求间隔允许发起请求，ctx取消时返回其错误(此时没有占用并发数)
+func (h *throttleHost) acquire(ctx context.Context) error {
+	for {
+		h.lock.Lock()
+		if h.active < h.limit {
+			now := time.Now()
+			wait := h.next.Sub(now)
+			if wait <= 0 {
+				h.active++
+				h.next = now.Add(h.delay)
+				h.lock.Unlock()
+				return nil
+			}
+			h.lock.Unlock()
+			if err := sleepContext(ctx, wait); err != nil {
+				return err
+			}
+			continue
+		}
+		ch := h.released
+		h.lock.Unlock()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release 请求结束，根据延迟和结果调整请求间隔和并发上限
+// 算法与Scrapy的AutoThrottle相同：目标间隔为延迟/期望并发数，新的间隔取当前间隔和目标间隔的平均值，
+// 非2xx的响应不会使间隔变小；成功时并发上限加一，请求失败、429、503时间隔加倍、并发上限减半
+func (h *throttleHost) release(latency time.Duration, status int, failed bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.active--
+	close(h.released)
+	h.released = make(chan struct{})
+
+	if failed || status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+		if h.delay <= 0 {
+			h.delay = h.conf.StartDelay
+		} else {
+			h.delay *= 2
+		}
+		if h.delay > h.conf.MaxDelay {
+			h.delay = h.conf.MaxDelay
+		}
+		if h.limit = h.limit / 2; h.limit < 1 {
+			h.limit = 1
+		}
+		return
+	}
+
+	target := time.Duration(float64(latency) / h.conf.TargetConcurrency)
+	delay := (h.delay + target) / 2
+	if delay < h.conf.MinDelay {
+		delay = h.conf.MinDelay
+	}
+	if delay > h.conf.MaxDelay {
+		delay = h.conf.MaxDelay
+	}
+	ok := status >= 200 && status < 300
+	if ok || delay > h.delay {
+		h.delay = delay
+	}
+	if ok && h.limit < h.conf.MaxConcurrency {
+		h.limit++
+	}
+}
+
+// WithAutoThrottle 自适应限速，类似Scrapy的AUTOTHROTTLE
+// 按host统计响应延迟和错误(包括429、503)，动态调整每个host的请求间隔和并发数，在不被封禁的前提下保持吞吐量
+func WithAutoThrottle(conf AutoThrottleConfig) Extension {
+	conf.setDefaults()
+	return func(s *Spider) {
+		lock := sync.Mutex{}
+		hosts := map[string]*throttleHost{}
+		s.Client.Use(func(c *goreq.Client, next goreq.Handler) goreq.Handler {
+			return func(req *goreq.Request) *goreq.Response {
+				if req.Err != nil {
+					return next(req)
+				}
+				lock.Lock()
+				h, ok := hosts[req.URL.Host]
+				if !ok {
+					h = newThrottleHost(&conf)
+					hosts[req.URL.Host] = h
+				}
+				lock.Unlock()
+
+				if err := h.acquire(requestContext(req)); err != nil {
+					return &goreq.Response{Req: req, Err: err}
+				}
+				start := time.Now()
+				resp := next(req)
+				status, failed := 0, true
+				if resp != nil && resp.Err == nil && resp.Response != nil {
+					status, failed = resp.StatusCode, false
+				}
+				h.release(time.Since(start), status, failed)
+				return resp
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package gospider
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestThrottleHost_release(t *testing.T) {
+	conf := &AutoThrottleConfig{StartDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	conf.setDefaults()
+	h := newThrottleHost(conf)
+
+	_ = h.acquire(context.Background())
+	h.release(20*time.Millisecond, 200, false)
+	assert.Equal(t, 60*time.Millisecond, h.delay)
+	assert.Equal(t, 2, h.limit)
+
+	_ = h.acquire(context.Background())
+	h.release(300*time.Millisecond, 404, false)
+	assert.Equal(t, 180*time.Millisecond, h.delay)
+	_ = h.acquire(context.Background())
+	h.release(0, 404, false)
+	assert.Equal(t, 180*time.Millisecond, h.delay)
+	assert.Equal(t, 2, h.limit)
+
+	_ = h.acquire(context.Background())
+	h.release(0, 429, false)
+	assert.Equal(t, 360*time.Millisecond, h.delay)
+	assert.Equal(t, 1, h.limit)
+	for i := 0; i < 3; i++ {
+		h.next = time.Time{}
+		_ = h.acquire(context.Background())
+		h.release(0, 0, true)
+	}
+	assert.Equal(t, time.Second, h.delay)
+	assert.Equal(t, 1, h.limit)
+}
+
+func TestWithAutoThrottle(t *testing.T) {
+	var active, maxActive int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&active, 1)
+		defer atomic.AddInt64(&active, -1)
+		for {
+			m := atomic.LoadInt64(&maxActive)
+			if n <= m || atomic.CompareAndSwapInt64(&maxActive, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		_, _ = fmt.Fprint(w, "Hello")
+	}))
+	defer ts.Close()
+
+	s := NewSpider(WithAutoThrottle(AutoThrottleConfig{
+		StartDelay:     50 * time.Millisecond,
+		MaxConcurrency: 2,
+	}))
+	s.Logging = false
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		s.SeedTask(goreq.Get(ts.URL))
+	}
+	s.Wait()
+
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+	assert.True(t, atomic.LoadInt64(&maxActive) <= 2)
+	assert.Equal(t, int64(5), s.Status.FinishedTask)
+}
@@ -0,0 +1,166 @@
+package gospider
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zhshch2002/goreq"
+)
+
+// BackoffConfig WithHostBackoff的配置，零值字段使用默认值
+type BackoffConfig struct {
+	Threshold  int           // 连续多少个429之后开始退避，默认2
+	Initial    time.Duration // 开始退避时的请求间隔，默认1s
+	Multiplier float64       // 退避期间每个429使间隔乘以的倍数，默认2
+	Decay      float64       // 每个成功的响应使间隔乘以的倍数，默认0.5，间隔小于Initial时结束退避
+	Max        time.Duration // 最大请求间隔，默认5min
+}
+
+func (c *BackoffConfig) setDefaults() {
+	if c.Threshold <= 0 {
+		c.Threshold = 2
+	}
+	if c.Initial <= 0 {
+		c.Initial = time.Second
+	}
+	if c.Multiplier <= 1 {
+		c.Multiplier = 2
+	}
+	if c.Decay <= 0 || c.Decay >= 1 {
+		c.Decay = 0.5
+	}
+	if c.Max <= 0 {
+		c.Max = 5 * time.Minute
+	}
+}
+
+// backoffHost 一个host的退避状态
+type backoffHost struct {
+	throttled int           // 连续的429个数
+	penalty   time.Duration // 当前的请求间隔，0表示没有退避
+	next      time.Time     // 下一个请求最早的发出时间
+}
+
+// hostBackoff 按host的退避，见WithHostBackoff
+type hostBackoff struct {
+	conf BackoffConfig
+
+	lock  sync.Mutex
+	hosts map[string]*backoffHost
+}
+
+// wait 等待host的请求间隔，ctx取消时返回其错误
+func (b *hostBackoff) wait(ctx context.Context, host string) error {
+	b.lock.Lock()
+	h, ok := b.hosts[host]
+	if !ok || h.penalty == 0 {
+		b.lock.Unlock()
+		return nil
+	}
+	now := time.Now()
+	at := h.next
+	if at.Before(now) {
+		at = now
+	}
+	h.next = at.Add(h.penalty)
+	b.lock.Unlock()
+	return sleepContext(ctx, at.Sub(now))
+}
+
+// update 根据响应调整host的请求间隔，返回调整后的间隔以及是否有变化
+// retryAfter为响应的Retry-After，退避时间隔至少为retryAfter
+func (b *hostBackoff) update(host string, status int, retryAfter time.Duration) (time.Duration, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	h, ok := b.hosts[host]
+	if !ok {
+		h = &backoffHost{}
+		b.hosts[host] = h
+	}
+	old := h.penalty
+	switch {
+	case status == http.StatusTooManyRequests:
+		h.throttled++
+		if h.throttled < b.conf.Threshold {
+			break
+		}
+		if h.penalty == 0 {
+			h.penalty = b.conf.Initial
+		} else {
+			h.penalty = time.Duration(float64(h.penalty) * b.conf.Multiplier)
+		}
+		if h.penalty < retryAfter {
+			h.penalty = retryAfter
+		}
+		if h.penalty > b.conf.Max {
+			h.penalty = b.conf.Max
+		}
+		h.next = time.Now().Add(h.penalty)
+	case status >= 200 && status < 400:
+		h.throttled = 0
+		if h.penalty > 0 {
+			if h.penalty = time.Duration(float64(h.penalty) * b.conf.Decay); h.penalty < b.conf.Initial {
+				h.penalty = 0
+			}
+		}
+	}
+	return h.penalty, h.penalty != old
+}
+
+// penalties 正在退避的host及其请求间隔
+func (b *hostBackoff) penalties() map[string]time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	res := map[string]time.Duration{}
+	for host, h := range b.hosts {
+		if h.penalty > 0 {
+			res[host] = h.penalty
+		}
+	}
+	return res
+}
+
+// WithHostBackoff host连续返回429时按host退避：达到conf.Threshold个后该host的请求之间保持间隔，
+// 之后每个429使间隔乘以Multiplier(至少为Retry-After)，每个成功的响应使间隔乘以Decay，直到恢复正常。
+// 与单个任务的重试(如WithRetryAfter)相互独立，间隔变化时输出日志，当前的间隔见HostPenalties
+func WithHostBackoff(conf BackoffConfig) Extension {
+	conf.setDefaults()
+	return func(s *Spider) {
+		b := &hostBackoff{conf: conf, hosts: map[string]*backoffHost{}}
+		s.backoff = b
+		s.Client.Use(func(c *goreq.Client, next goreq.Handler) goreq.Handler {
+			return func(req *goreq.Request) *goreq.Response {
+				if req.Err != nil || req.Request == nil {
+					return next(req)
+				}
+				host := req.URL.Host
+				if err := b.wait(req.Context(), host); err != nil {
+					return &goreq.Response{Req: req, Err: err}
+				}
+				resp := next(req)
+				if resp == nil || resp.Err != nil || resp.Response == nil {
+					return resp
+				}
+				retryAfter, _ := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+				if penalty, changed := b.update(host, resp.StatusCode, retryAfter); changed {
+					if penalty > 0 {
+						s.writeLog(nil, LogWarn, "host backoff", "spider", s.Name, "host", host, "penalty", penalty)
+					} else {
+						s.writeLog(nil, LogInfo, "host backoff recovered", "spider", s.Name, "host", host)
+					}
+				}
+				return resp
+			}
+		})
+	}
+}
+
+// HostPenalties 使用WithHostBackoff时正在退避的host及其当前的请求间隔
+func (s *Spider) HostPenalties() map[string]time.Duration {
+	if s.backoff == nil {
+		return map[string]time.Duration{}
+	}
+	return s.backoff.penalties()
+}
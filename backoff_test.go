@@ -0,0 +1,95 @@
+package gospider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHostBackoff_update(t *testing.T) {
+	conf := BackoffConfig{Initial: 100 * time.Millisecond, Max: time.Second}
+	conf.setDefaults()
+	b := &hostBackoff{conf: conf, hosts: map[string]*backoffHost{}}
+
+	p, changed := b.update("a", http.StatusTooManyRequests, 0)
+	assert.Equal(t, time.Duration(0), p)
+	assert.False(t, changed)
+	p, changed = b.update("a", http.StatusTooManyRequests, 0)
+	assert.Equal(t, 100*time.Millisecond, p)
+	assert.True(t, changed)
+	p, _ = b.update("a", http.StatusTooManyRequests, 0)
+	assert.Equal(t, 200*time.Millisecond, p)
+	p, _ = b.update("a", http.StatusTooManyRequests, 700*time.Millisecond)
+	assert.Equal(t, 700*time.Millisecond, p)
+	p, _ = b.update("a", http.StatusTooManyRequests, 0)
+	assert.Equal(t, time.Second, p)
+	assert.Equal(t, map[string]time.Duration{"a": time.Second}, b.penalties())
+
+	// 其他host不受影响，404不改变间隔
+	b.update("b", http.StatusOK, 0)
+	p, changed = b.update("a", http.StatusNotFound, 0)
+	assert.Equal(t, time.Second, p)
+	assert.False(t, changed)
+
+	p, _ = b.update("a", http.StatusOK, 0)
+	assert.Equal(t, 500*time.Millisecond, p)
+	p, _ = b.update("a", http.StatusOK, 0)
+	assert.Equal(t, 250*time.Millisecond, p)
+	p, _ = b.update("a", http.StatusOK, 0)
+	assert.Equal(t, 125*time.Millisecond, p)
+	p, changed = b.update("a", http.StatusOK, 0)
+	assert.Equal(t, time.Duration(0), p)
+	assert.True(t, changed)
+	assert.Empty(t, b.penalties())
+
+	// 成功的响应重置连续的429个数
+	b.update("a", http.StatusTooManyRequests, 0)
+	b.update("a", http.StatusOK, 0)
+	p, _ = b.update("a", http.StatusTooManyRequests, 0)
+	assert.Equal(t, time.Duration(0), p)
+}
+
+func TestWithHostBackoff(t *testing.T) {
+	lock := sync.Mutex{}
+	var times []time.Time
+	n := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		n++
+		times = append(times, time.Now())
+		if n <= 3 {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer ts.Close()
+
+	s := NewSpider(WithSynchronousMode(), WithHostBackoff(BackoffConfig{Initial: 50 * time.Millisecond}))
+	s.Logging = false
+	var penalties []time.Duration
+	host := strings.TrimPrefix(ts.URL, "http://")
+	s.OnResp(func(ctx *Context) {
+		penalties = append(penalties, s.HostPenalties()[host])
+	})
+	for i := 0; i < 6; i++ {
+		s.SeedTask(goreq.Get(ts.URL + "/" + string(rune('a'+i))))
+	}
+	s.Wait()
+	assert.Equal(t, []time.Duration{
+		0,
+		50 * time.Millisecond,
+		100 * time.Millisecond,
+		50 * time.Millisecond,
+		0,
+		0,
+	}, penalties)
+	// 退避期间的请求之间保持间隔
+	assert.True(t, times[2].Sub(times[1]) >= 50*time.Millisecond)
+	assert.True(t, times[3].Sub(times[2]) >= 100*time.Millisecond)
+	assert.Empty(t, s.HostPenalties())
+}
@@ -0,0 +1,107 @@
+package gospider
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zhshch2002/goreq"
+)
+
+// BlockVendor 拦截请求的反爬服务
+type BlockVendor string
+
+const (
+	BlockCloudflare BlockVendor = "cloudflare"
+	BlockAkamai     BlockVendor = "akamai"
+	BlockUnknown    BlockVendor = "unknown" // 无法确定服务商的JS挑战页面
+)
+
+// blockRetryMetaKey 任务因被拦截改用备用Fetcher重试的标记
+const blockRetryMetaKey = "_block_retry"
+
+// DetectBlock 检查响应是否为反爬服务的挑战页面(如Cloudflare的cf_chl、Akamai的Access Denied)，不是时返回空字符串
+func DetectBlock(resp *goreq.Response) BlockVendor {
+	if resp == nil || resp.Response == nil {
+		return ""
+	}
+	body := resp.Text
+	if body == "" {
+		body = string(resp.Body)
+	}
+	code := resp.StatusCode
+	server := strings.ToLower(resp.Header.Get("Server"))
+
+	if resp.Header.Get("Cf-Mitigated") == "challenge" {
+		return BlockCloudflare
+	}
+	if code == http.StatusForbidden || code == http.StatusServiceUnavailable || code == http.StatusTooManyRequests {
+		if strings.Contains(body, "cf_chl") || strings.Contains(body, "cf-browser-verification") ||
+			strings.Contains(body, "/cdn-cgi/challenge-platform/") ||
+			(server == "cloudflare" && strings.Contains(body, "Just a moment...")) {
+			return BlockCloudflare
+		}
+	}
+	if code == http.StatusForbidden {
+		if server == "akamaighost" || strings.Contains(body, "errors.edgesuite.net") ||
+			(strings.Contains(body, "Access Denied") && strings.Contains(body, "Reference #")) {
+			return BlockAkamai
+		}
+		if strings.Contains(strings.ToLower(body), "enable javascript and cookies to continue") {
+			return BlockUnknown
+		}
+	}
+	return ""
+}
+
+// blockDetection 被拦截的host改用备用Fetcher，见WithBlockDetection
+type blockDetection struct {
+	alt       Fetcher
+	threshold int64
+
+	lock  sync.Mutex
+	count map[string]int64
+}
+
+// handle 记录host被拦截，达到阈值后将host切换到备用Fetcher，并用它重试任务，返回是否已重试
+func (b *blockDetection) handle(ctx *Context, t *Task) bool {
+	if b.alt == nil {
+		return false
+	}
+	s := ctx.s
+	host := ctx.Req.URL.Host
+	b.lock.Lock()
+	b.count[host]++
+	reached := b.count[host] == b.threshold
+	b.lock.Unlock()
+	if reached {
+		s.SetHostFetcher(host, b.alt)
+		s.writeLog(ctx, LogWarn, "host routed to alternate fetcher", "spider", s.Name, "host", host)
+	}
+	if _, retried := t.Meta[blockRetryMetaKey]; retried || s.HostFetcher(host) == nil {
+		return false
+	}
+	meta := make(map[string]interface{}, len(t.Meta)+1)
+	for k, v := range t.Meta {
+		meta[k] = v
+	}
+	meta[blockRetryMetaKey] = true
+	s.retryTask(t, t.Req, meta, time.Time{})
+	return true
+}
+
+// WithBlockDetection 检测反爬服务的挑战页面并调用OnBlocked，按host计数(见SpiderStatus.BlockedHosts)
+// alt不为nil时，host被拦截threshold次(至少为1)之后，该host之后的请求改用alt发送(如无头浏览器)，被拦截的任务也用alt重试一次
+func WithBlockDetection(alt Fetcher, threshold int) Extension {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return func(s *Spider) {
+		s.block = &blockDetection{
+			alt:       alt,
+			threshold: int64(threshold),
+			count:     map[string]int64{},
+		}
+	}
+}
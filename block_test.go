@@ -0,0 +1,76 @@
+package gospider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDetectBlock(t *testing.T) {
+	newResp := func(code int, server, body string) *goreq.Response {
+		return &goreq.Response{
+			Req:      goreq.Get("http://example.test/"),
+			Response: &http.Response{StatusCode: code, Header: http.Header{"Server": []string{server}}},
+			Text:     body,
+		}
+	}
+	assert.Equal(t, BlockCloudflare, DetectBlock(newResp(503, "cloudflare", "<title>Just a moment...</title>")))
+	assert.Equal(t, BlockCloudflare, DetectBlock(newResp(403, "", `<script src="/cdn-cgi/challenge-platform/h/b/orchestrate/jsch/v1"></script>`)))
+	assert.Equal(t, BlockAkamai, DetectBlock(newResp(403, "AkamaiGHost", "Access Denied")))
+	assert.Equal(t, BlockUnknown, DetectBlock(newResp(403, "", "Please enable JavaScript and cookies to continue")))
+	assert.Equal(t, BlockVendor(""), DetectBlock(newResp(200, "cloudflare", "Just a moment...")))
+	assert.Equal(t, BlockVendor(""), DetectBlock(newResp(403, "nginx", "Forbidden")))
+}
+
+func TestWithBlockDetection(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "cloudflare")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`<html><title>Just a moment...</title><script>window._cf_chl_opt={}</script></html>`))
+	}))
+	defer ts.Close()
+
+	var altCalls int64
+	alt := FetcherFunc(func(req *goreq.Request) *goreq.Response {
+		atomic.AddInt64(&altCalls, 1)
+		return &goreq.Response{
+			Req:      req,
+			Body:     []byte("rendered"),
+			Response: &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": []string{"text/html"}}, Request: req.Request},
+		}
+	})
+	s := NewSpider(WithBlockDetection(alt, 2))
+	s.Logging = false
+	lock := sync.Mutex{}
+	var vendors []BlockVendor
+	s.OnBlocked(func(ctx *Context, vendor BlockVendor) {
+		lock.Lock()
+		vendors = append(vendors, vendor)
+		lock.Unlock()
+	})
+	var texts []string
+	handler := func(ctx *Context) {
+		lock.Lock()
+		texts = append(texts, ctx.Resp.Text)
+		lock.Unlock()
+	}
+	for i := 0; i < 2; i++ {
+		s.SeedTask(goreq.Get(ts.URL+"/"), handler)
+		s.Wait()
+	}
+	s.SeedTask(goreq.Get(ts.URL+"/"), handler)
+	s.Wait()
+
+	assert.Equal(t, []BlockVendor{BlockCloudflare, BlockCloudflare}, vendors)
+	// 第一次被拦截时未达到阈值，按普通响应处理；第二次达到阈值后用alt重试；之后直接使用alt
+	assert.Equal(t, 3, len(texts))
+	assert.Equal(t, []string{"rendered", "rendered"}, texts[1:])
+	assert.Equal(t, int64(2), atomic.LoadInt64(&altCalls))
+	u := goreq.Get(ts.URL).URL.Host
+	assert.Equal(t, map[string]int64{u: 2}, s.Status.BlockedHosts())
+	assert.NotNil(t, s.HostFetcher(u))
+}
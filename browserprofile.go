@@ -0,0 +1,174 @@
+package gospider
+
+import (
+	"strings"
+)
+
+// HeaderField 有序的请求头
+type HeaderField struct {
+	Key   string
+	Value string
+}
+
+// BrowserProfile 浏览器请求头预设，包括User-Agent、Accept、Accept-Language、Client Hints等
+// Headers按浏览器发送的顺序排列；net/http会按字母顺序写出请求头，HeaderOrder供支持自定义顺序的传输层使用
+type BrowserProfile struct {
+	Name    string
+	Headers []HeaderField
+}
+
+// HeaderOrder 浏览器发送请求头的顺序，包括由WithBrowserProfile按任务生成的Sec-Fetch-*和Referer
+func (p *BrowserProfile) HeaderOrder() []string {
+	var res []string
+	for _, h := range p.Headers {
+		res = append(res, h.Key)
+		if h.Key == "Accept" {
+			res = append(res, "Sec-Fetch-Site", "Sec-Fetch-Mode", "Sec-Fetch-User", "Sec-Fetch-Dest", "Referer")
+		}
+	}
+	return res
+}
+
+const (
+	chromeAccept  = "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.9"
+	firefoxAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8"
+	safariAccept  = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+)
+
+var (
+	// ProfileChromeWin Windows上的Chrome
+	ProfileChromeWin = &BrowserProfile{
+		Name: "chrome-win",
+		Headers: []HeaderField{
+			{"sec-ch-ua", `" Not A;Brand";v="99", "Chromium";v="96", "Google Chrome";v="96"`},
+			{"sec-ch-ua-mobile", "?0"},
+			{"sec-ch-ua-platform", `"Windows"`},
+			{"Upgrade-Insecure-Requests", "1"},
+			{"User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/96.0.4664.110 Safari/537.36"},
+			{"Accept", chromeAccept},
+			{"Accept-Language", "en-US,en;q=0.9"},
+		},
+	}
+	// ProfileChromeMac macOS上的Chrome
+	ProfileChromeMac = &BrowserProfile{
+		Name: "chrome-mac",
+		Headers: []HeaderField{
+			{"sec-ch-ua", `" Not A;Brand";v="99", "Chromium";v="96", "Google Chrome";v="96"`},
+			{"sec-ch-ua-mobile", "?0"},
+			{"sec-ch-ua-platform", `"macOS"`},
+			{"Upgrade-Insecure-Requests", "1"},
+			{"User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/96.0.4664.110 Safari/537.36"},
+			{"Accept", chromeAccept},
+			{"Accept-Language", "en-US,en;q=0.9"},
+		},
+	}
+	// ProfileChromeAndroid Android上的Chrome
+	ProfileChromeAndroid = &BrowserProfile{
+		Name: "chrome-android",
+		Headers: []HeaderField{
+			{"sec-ch-ua", `" Not A;Brand";v="99", "Chromium";v="96", "Google Chrome";v="96"`},
+			{"sec-ch-ua-mobile", "?1"},
+			{"sec-ch-ua-platform", `"Android"`},
+			{"Upgrade-Insecure-Requests", "1"},
+			{"User-Agent", "Mozilla/5.0 (Linux; Android 11; Pixel 5) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/96.0.4664.104 Mobile Safari/537.36"},
+			{"Accept", chromeAccept},
+			{"Accept-Language", "en-US,en;q=0.9"},
+		},
+	}
+	// ProfileFirefoxWin Windows上的Firefox
+	ProfileFirefoxWin = &BrowserProfile{
+		Name: "firefox-win",
+		Headers: []HeaderField{
+			{"User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:95.0) Gecko/20100101 Firefox/95.0"},
+			{"Accept", firefoxAccept},
+			{"Accept-Language", "en-US,en;q=0.5"},
+			{"Upgrade-Insecure-Requests", "1"},
+		},
+	}
+	// ProfileFirefoxAndroid Android上的Firefox
+	ProfileFirefoxAndroid = &BrowserProfile{
+		Name: "firefox-android",
+		Headers: []HeaderField{
+			{"User-Agent", "Mozilla/5.0 (Android 11; Mobile; rv:95.0) Gecko/95.0 Firefox/95.0"},
+			{"Accept", firefoxAccept},
+			{"Accept-Language", "en-US,en;q=0.5"},
+			{"Upgrade-Insecure-Requests", "1"},
+		},
+	}
+	// ProfileSafariMac macOS上的Safari
+	ProfileSafariMac = &BrowserProfile{
+		Name: "safari-mac",
+		Headers: []HeaderField{
+			{"Accept", safariAccept},
+			{"User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/15.2 Safari/605.1.15"},
+			{"Accept-Language", "en-US,en;q=0.9"},
+		},
+	}
+	// ProfileSafariIOS iPhone上的Safari
+	ProfileSafariIOS = &BrowserProfile{
+		Name: "safari-ios",
+		Headers: []HeaderField{
+			{"Accept", safariAccept},
+			{"User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 15_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/15.2 Mobile/15E148 Safari/604.1"},
+			{"Accept-Language", "en-US,en;q=0.9"},
+		},
+	}
+)
+
+// secFetchSite 根据来源页面和目标URL的host计算Sec-Fetch-Site
+func secFetchSite(from, to string) string {
+	if from == "" {
+		return "none"
+	}
+	if from == to {
+		return "same-origin"
+	}
+	if siteOf(from) == siteOf(to) {
+		return "same-site"
+	}
+	return "cross-site"
+}
+
+// siteOf 粗略取host的最后两级域名
+func siteOf(host string) string {
+	if i := strings.LastIndex(host, ":"); i != -1 && !strings.Contains(host[i:], "]") {
+		host = host[:i]
+	}
+	parts := strings.Split(host, ".")
+	if len(parts) <= 2 {
+		return host
+	}
+	return strings.Join(parts[len(parts)-2:], ".")
+}
+
+// WithBrowserProfile 为每个任务设置与profile一致的请求头，已经设置的请求头不会被覆盖
+// Chrome和Firefox会按来源页面生成Sec-Fetch-*，子任务会带上来源页面作为Referer
+func WithBrowserProfile(profile *BrowserProfile) Extension {
+	return func(s *Spider) {
+		s.OnTask(func(ctx *Context, t *Task) *Task {
+			if t.Req.Request == nil {
+				return t
+			}
+			h := t.Req.Header
+			for _, f := range profile.Headers {
+				if h.Get(f.Key) == "" {
+					h.Set(f.Key, f.Value)
+				}
+			}
+			from := ""
+			if ctx != nil && ctx.Req != nil && ctx.Req.URL != nil {
+				from = ctx.Req.URL.Host
+				if h.Get("Referer") == "" {
+					h.Set("Referer", ctx.Req.URL.String())
+				}
+			}
+			if !strings.HasPrefix(profile.Name, "safari") && h.Get("Sec-Fetch-Site") == "" {
+				h.Set("Sec-Fetch-Site", secFetchSite(from, t.Req.URL.Host))
+				h.Set("Sec-Fetch-Mode", "navigate")
+				h.Set("Sec-Fetch-User", "?1")
+				h.Set("Sec-Fetch-Dest", "document")
+			}
+			return t
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package gospider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestWithBrowserProfile(t *testing.T) {
+	lock := sync.Mutex{}
+	headers := map[string]http.Header{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		headers[r.URL.Path] = r.Header.Clone()
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	s := NewSpider(WithBrowserProfile(ProfileChromeWin))
+	s.Logging = false
+	s.SeedTask(goreq.Get(ts.URL+"/seed").AddHeader("Accept-Language", "zh-CN"), func(ctx *Context) {
+		ctx.AddTask(goreq.Get(ts.URL+"/child"), func(ctx *Context) {})
+	})
+	s.Wait()
+
+	seed := headers["/seed"]
+	assert.Equal(t, ProfileChromeWin.Headers[4].Value, seed.Get("User-Agent"))
+	assert.Equal(t, "zh-CN", seed.Get("Accept-Language"))
+	assert.Equal(t, `"Windows"`, seed.Get("sec-ch-ua-platform"))
+	assert.Equal(t, "none", seed.Get("Sec-Fetch-Site"))
+	assert.Equal(t, "navigate", seed.Get("Sec-Fetch-Mode"))
+	assert.Equal(t, "", seed.Get("Referer"))
+
+	child := headers["/child"]
+	assert.Equal(t, "same-origin", child.Get("Sec-Fetch-Site"))
+	assert.Equal(t, ts.URL+"/seed", child.Get("Referer"))
+}
+
+func TestBrowserProfile_HeaderOrder(t *testing.T) {
+	order := ProfileFirefoxWin.HeaderOrder()
+	assert.Equal(t, []string{"User-Agent", "Accept", "Sec-Fetch-Site", "Sec-Fetch-Mode", "Sec-Fetch-User", "Sec-Fetch-Dest", "Referer", "Accept-Language", "Upgrade-Insecure-Requests"}, order)
+	assert.Equal(t, "cross-site", secFetchSite("a.com", "b.com"))
+	assert.Equal(t, "same-site", secFetchSite("www.a.com:80", "img.a.com"))
+}
@@ -0,0 +1,239 @@
+package gospider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/zhshch2002/goreq"
+)
+
+// CaptchaKind 验证码类型
+type CaptchaKind string
+
+const (
+	CaptchaReCaptcha CaptchaKind = "recaptcha" // Google reCAPTCHA
+	CaptchaHCaptcha  CaptchaKind = "hcaptcha"  // hCaptcha
+	CaptchaText      CaptchaKind = "text"      // 按CaptchaPatterns中的文本识别的人机验证页面
+)
+
+// CaptchaTokenMetaKey 解出验证码后重试的任务Meta中保存token的键
+const CaptchaTokenMetaKey = "_captcha_token"
+
+// captchaRetryMetaKey 任务因验证码重试的次数
+const captchaRetryMetaKey = "_captcha_retry"
+
+// CaptchaPatterns 识别人机验证页面的文本(不区分大小写)，可以按需追加
+var CaptchaPatterns = []string{
+	"verify you are human",
+	"are you a robot",
+	"unusual traffic from your computer",
+	"please complete the security check",
+}
+
+var captchaSiteKeyRe = regexp.MustCompile(`data-sitekey=["']([^"']+)["']`)
+
+// Captcha 检测到的验证码
+type Captcha struct {
+	Kind    CaptchaKind
+	SiteKey string // reCAPTCHA/hCaptcha的data-sitekey
+	PageURL string
+}
+
+// DetectCaptcha 检查响应是否为验证码页面，不是时返回nil
+func DetectCaptcha(resp *goreq.Response) *Captcha {
+	if resp == nil || resp.Response == nil {
+		return nil
+	}
+	body := resp.Text
+	if body == "" {
+		body = string(resp.Body)
+	}
+	c := &Captcha{PageURL: resp.Req.URL.String()}
+	if m := captchaSiteKeyRe.FindStringSubmatch(body); m != nil {
+		c.SiteKey = m[1]
+	}
+	lower := strings.ToLower(body)
+	switch {
+	case strings.Contains(lower, "hcaptcha.com") || strings.Contains(lower, "h-captcha"):
+		c.Kind = CaptchaHCaptcha
+	case strings.Contains(lower, "google.com/recaptcha") || strings.Contains(lower, "recaptcha.net") || strings.Contains(lower, "g-recaptcha"):
+		c.Kind = CaptchaReCaptcha
+	default:
+		for _, p := range CaptchaPatterns {
+			if strings.Contains(lower, strings.ToLower(p)) {
+				c.Kind = CaptchaText
+				break
+			}
+		}
+	}
+	if c.Kind == "" {
+		return nil
+	}
+	return c
+}
+
+// CaptchaSolver 验证码解决服务，返回提交给站点的token
+type CaptchaSolver interface {
+	Solve(c *Captcha) (string, error)
+}
+
+// CaptchaContextSolver 可以取消的CaptchaSolver，实现时爬虫用SolveContext解决验证码，Stop时ctx取消
+type CaptchaContextSolver interface {
+	SolveContext(ctx context.Context, c *Captcha) (string, error)
+}
+
+// ErrCaptchaUnsupported 解决服务不支持该类型的验证码
+var ErrCaptchaUnsupported = errors.New("captcha kind not supported by solver")
+
+// TwoCaptchaSolver 使用2captcha的in.php/res.php接口解决reCAPTCHA和hCaptcha
+// anti-captcha等兼容该接口的服务可以修改BaseURL使用
+type TwoCaptchaSolver struct {
+	APIKey       string
+	BaseURL      string        // 默认https://2captcha.com
+	PollInterval time.Duration // 查询结果的间隔，默认5s
+	Timeout      time.Duration // 等待结果的最长时间，默认3分钟
+	Client       *http.Client  // 默认http.DefaultClient
+}
+
+// NewTwoCaptchaSolver 创建使用apiKey的2captcha解决服务
+func NewTwoCaptchaSolver(apiKey string) *TwoCaptchaSolver {
+	return &TwoCaptchaSolver{
+		APIKey:       apiKey,
+		BaseURL:      "https://2captcha.com",
+		PollInterval: 5 * time.Second,
+		Timeout:      3 * time.Minute,
+		Client:       http.DefaultClient,
+	}
+}
+
+// twoCaptchaResult in.php/res.php的JSON响应
+type twoCaptchaResult struct {
+	Status  int    `json:"status"`
+	Request string `json:"request"`
+}
+
+func (sv *TwoCaptchaSolver) call(ctx context.Context, path string, params url.Values) (*twoCaptchaResult, error) {
+	params.Set("key", sv.APIKey)
+	params.Set("json", "1")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(sv.BaseURL, "/")+path, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := sv.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	res := &twoCaptchaResult{}
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Solve 提交验证码并轮询结果
+func (sv *TwoCaptchaSolver) Solve(c *Captcha) (string, error) {
+	return sv.SolveContext(context.Background(), c)
+}
+
+// SolveContext 提交验证码并轮询结果，ctx取消时返回其错误
+func (sv *TwoCaptchaSolver) SolveContext(ctx context.Context, c *Captcha) (string, error) {
+	params := url.Values{"pageurl": {c.PageURL}}
+	switch c.Kind {
+	case CaptchaReCaptcha:
+		params.Set("method", "userrecaptcha")
+		params.Set("googlekey", c.SiteKey)
+	case CaptchaHCaptcha:
+		params.Set("method", "hcaptcha")
+		params.Set("sitekey", c.SiteKey)
+	default:
+		return "", ErrCaptchaUnsupported
+	}
+	res, err := sv.call(ctx, "/in.php", params)
+	if err != nil {
+		return "", err
+	}
+	if res.Status != 1 {
+		return "", fmt.Errorf("2captcha: %s", res.Request)
+	}
+	id := res.Request
+	deadline := time.Now().Add(sv.Timeout)
+	for time.Now().Before(deadline) {
+		if err := sleepContext(ctx, sv.PollInterval); err != nil {
+			return "", err
+		}
+		res, err = sv.call(ctx, "/res.php", url.Values{"action": {"get"}, "id": {id}})
+		if err != nil {
+			return "", err
+		}
+		if res.Status == 1 {
+			return res.Request, nil
+		}
+		if res.Request != "CAPCHA_NOT_READY" {
+			return "", fmt.Errorf("2captcha: %s", res.Request)
+		}
+	}
+	return "", fmt.Errorf("2captcha: timeout waiting for %s", id)
+}
+
+// captchaSolving 解决验证码并重试，见WithCaptchaSolver
+type captchaSolving struct {
+	solver     CaptchaSolver
+	maxRetries int
+	submit     func(ctx *Context, c *Captcha, token string) *goreq.Request
+}
+
+// handle 解决验证码并重新加入任务，返回是否已处理
+func (cs *captchaSolving) handle(ctx *Context, t *Task, c *Captcha) bool {
+	count := ctx.GetInt(captchaRetryMetaKey)
+	if count >= cs.maxRetries {
+		return false
+	}
+	s := ctx.s
+	var token string
+	var err error
+	if cc, ok := cs.solver.(CaptchaContextSolver); ok {
+		token, err = cc.SolveContext(s.Context(), c)
+	} else {
+		token, err = cs.solver.Solve(c)
+	}
+	if err != nil {
+		s.writeLog(ctx, LogError, "captcha solve error", "error", err, "spider", s.Name, "context", ctx.String())
+		return false
+	}
+	req := t.Req
+	if cs.submit != nil {
+		if req = cs.submit(ctx, c, token); req == nil {
+			return false
+		}
+	}
+	meta := make(map[string]interface{}, len(t.Meta)+2)
+	for k, v := range t.Meta {
+		meta[k] = v
+	}
+	meta[captchaRetryMetaKey] = count + 1
+	meta[CaptchaTokenMetaKey] = token
+	s.retryTask(t, req, meta, time.Time{})
+	return true
+}
+
+// WithCaptchaSolver 检测到验证码时使用solver解决，并重新加入任务(不再经过OnTask)，token保存在Meta的CaptchaTokenMetaKey中
+// submit根据token构造重试的请求(如向站点的验证接口提交g-recaptcha-response)，为nil时重试原来的请求；
+// 每个任务最多重试maxRetries次，解决失败或超过次数时按普通响应处理
+func WithCaptchaSolver(solver CaptchaSolver, maxRetries int, submit func(ctx *Context, c *Captcha, token string) *goreq.Request) Extension {
+	return func(s *Spider) {
+		s.captcha = &captchaSolving{
+			solver:     solver,
+			maxRetries: maxRetries,
+			submit:     submit,
+		}
+	}
+}
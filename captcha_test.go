@@ -0,0 +1,131 @@
+package gospider
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testCaptchaSolver struct {
+	calls int64
+}
+
+func (sv *testCaptchaSolver) Solve(c *Captcha) (string, error) {
+	atomic.AddInt64(&sv.calls, 1)
+	return "solved-" + c.SiteKey, nil
+}
+
+func newTestCaptchaServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Query().Get("token") == "solved-key1" {
+			_, _ = fmt.Fprint(w, `<html><body>content</body></html>`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `<html><script src="https://www.google.com/recaptcha/api.js"></script>
+<div class="g-recaptcha" data-sitekey="key1"></div></html>`)
+	}))
+}
+
+func TestDetectCaptcha(t *testing.T) {
+	resp := &goreq.Response{
+		Req:      goreq.Get("http://example.test/"),
+		Response: &http.Response{StatusCode: http.StatusOK},
+		Text:     `<div class="h-captcha" data-sitekey='abc'></div>`,
+	}
+	c := DetectCaptcha(resp)
+	if assert.NotNil(t, c) {
+		assert.Equal(t, CaptchaHCaptcha, c.Kind)
+		assert.Equal(t, "abc", c.SiteKey)
+		assert.Equal(t, "http://example.test/", c.PageURL)
+	}
+	resp.Text = "Our systems have detected unusual traffic from your computer network."
+	c = DetectCaptcha(resp)
+	if assert.NotNil(t, c) {
+		assert.Equal(t, CaptchaText, c.Kind)
+	}
+	resp.Text = "hello"
+	assert.Nil(t, DetectCaptcha(resp))
+}
+
+func TestWithCaptchaSolver(t *testing.T) {
+	ts := newTestCaptchaServer()
+	defer ts.Close()
+
+	solver := &testCaptchaSolver{}
+	s := NewSpider(WithCaptchaSolver(solver, 1, func(ctx *Context, c *Captcha, token string) *goreq.Request {
+		return goreq.Get(c.PageURL + "?token=" + token)
+	}))
+	s.Logging = false
+	var captchas int64
+	s.OnCaptcha(func(ctx *Context, c *Captcha) {
+		atomic.AddInt64(&captchas, 1)
+	})
+	var text, token string
+	s.SeedTask(goreq.Get(ts.URL+"/"), func(ctx *Context) {
+		text = ctx.Resp.Text
+		token, _ = ctx.Meta[CaptchaTokenMetaKey].(string)
+	})
+	s.Wait()
+	assert.Equal(t, "<html><body>content</body></html>", text)
+	assert.Equal(t, "solved-key1", token)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&captchas))
+	assert.Equal(t, int64(1), atomic.LoadInt64(&solver.calls))
+}
+
+func TestOnCaptcha_Abort(t *testing.T) {
+	ts := newTestCaptchaServer()
+	defer ts.Close()
+
+	s := NewSpider()
+	s.Logging = false
+	s.OnCaptcha(func(ctx *Context, c *Captcha) {
+		ctx.Abort()
+	})
+	handled := false
+	s.SeedTask(goreq.Get(ts.URL+"/"), func(ctx *Context) {
+		handled = true
+	})
+	s.Wait()
+	assert.False(t, handled)
+}
+
+func TestTwoCaptchaSolver(t *testing.T) {
+	var polls int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		switch r.URL.Path {
+		case "/in.php":
+			if r.Form.Get("method") != "userrecaptcha" || r.Form.Get("googlekey") != "key1" || r.Form.Get("key") != "api" {
+				_, _ = fmt.Fprint(w, `{"status":0,"request":"ERROR_WRONG_USER_KEY"}`)
+				return
+			}
+			_, _ = fmt.Fprint(w, `{"status":1,"request":"42"}`)
+		case "/res.php":
+			if atomic.AddInt64(&polls, 1) < 2 {
+				_, _ = fmt.Fprint(w, `{"status":0,"request":"CAPCHA_NOT_READY"}`)
+				return
+			}
+			_, _ = fmt.Fprint(w, `{"status":1,"request":"token-`+r.Form.Get("id")+`"}`)
+		}
+	}))
+	defer ts.Close()
+
+	sv := NewTwoCaptchaSolver("api")
+	sv.BaseURL = ts.URL
+	sv.PollInterval = 10 * time.Millisecond
+	token, err := sv.Solve(&Captcha{Kind: CaptchaReCaptcha, SiteKey: "key1", PageURL: "http://example.test/"})
+	assert.NoError(t, err)
+	assert.Equal(t, "token-42", token)
+
+	_, err = sv.Solve(&Captcha{Kind: CaptchaText})
+	assert.Equal(t, ErrCaptchaUnsupported, err)
+	sv.APIKey = "wrong"
+	_, err = sv.Solve(&Captcha{Kind: CaptchaReCaptcha, SiteKey: "key1"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,227 @@
+package gospider
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// pendingTask 已加入但尚未完成的任务
+type pendingTask struct {
+	t         *Task
+	counted   bool       // 已计入TotalTask和HostTasks
+	started   bool       // 已开始执行，已计入FinishedTask
+	abandoned bool       // 爬虫停止后被放弃，已计入AbandonedTask
+	saved     *savedTask // 开始执行时的任务，执行中的任务会被修改，Checkpoint保存开始时的状态
+}
+
+// savedTask Checkpoint保存的任务
+type savedTask struct {
+	sub  *TaskSubmission
+	host string
+	url  string
+	err  error
+}
+
+// saveTask 序列化任务，Meta复制一份，之后任务的修改不影响结果
+func (s *Spider) saveTask(t *Task) *savedTask {
+	st := &savedTask{}
+	if t.Req.Request != nil {
+		st.host = t.Req.URL.Host
+		st.url = t.Req.URL.String()
+	}
+	st.sub, st.err = s.SerializeTask(t)
+	if st.sub != nil && st.sub.Meta != nil {
+		meta := make(map[string]interface{}, len(st.sub.Meta))
+		for k, v := range st.sub.Meta {
+			meta[k] = v
+		}
+		st.sub.Meta = meta
+	}
+	return st
+}
+
+// trackTask 记录加入的任务
+func (s *Spider) trackTask(p *pendingTask) *pendingTask {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+	if s.pending == nil {
+		s.pending = map[*pendingTask]struct{}{}
+	}
+	s.pending[p] = struct{}{}
+	return p
+}
+
+func (s *Spider) startTask(p *pendingTask) {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+	p.started = true
+	if s.checkpoint != "" {
+		p.saved = s.saveTask(p.t)
+	}
+}
+
+func (s *Spider) abandonTask(p *pendingTask) {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+	p.abandoned = true
+}
+
+// untrackTask 任务执行完成
+func (s *Spider) untrackTask(p *pendingTask) {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+	delete(s.pending, p)
+}
+
+// checkpointFile 检查点文件的内容
+type checkpointFile struct {
+	Time   time.Time         `json:"time"`
+	Tasks  []*TaskSubmission `json:"tasks"`
+	Seen   []string          `json:"seen,omitempty"` // WithDeduplicate记录的请求hash
+	Status StatusSnapshot    `json:"status"`
+}
+
+// Checkpoint 将尚未完成的任务(包括执行中和停止后放弃的任务)、WithDeduplicate的去重记录和统计保存到path
+// 任务按RegisterHandler注册的名字引用处理方法，处理方法未注册的任务无法保存，会被跳过；
+// 统计中不计入保存的任务，ResumeFrom重新加入这些任务后计数与中断前一致
+func (s *Spider) Checkpoint(path string) error {
+	cp := &checkpointFile{
+		Time:   time.Now(),
+		Tasks:  []*TaskSubmission{},
+		Status: s.Status.Snapshot(),
+	}
+	s.pendingLock.Lock()
+	for p := range s.pending {
+		st := p.saved
+		if st == nil {
+			// 尚未开始的任务不会被修改，开始执行前需要获取pendingLock
+			st = s.saveTask(p.t)
+		}
+		if st.err != nil {
+			s.writeLog(nil, LogWarn, "checkpoint skip task", "error", st.err, "spider", s.Name, "url", st.url)
+			continue
+		}
+		cp.Tasks = append(cp.Tasks, st.sub)
+		if p.counted {
+			cp.Status.TotalTask--
+			if st.host != "" {
+				cp.Status.HostTasks[st.host]--
+			}
+		}
+		if p.started {
+			cp.Status.FinishedTask--
+		}
+		if p.abandoned {
+			cp.Status.AbandonedTask--
+		}
+	}
+	s.pendingLock.Unlock()
+	if s.dedup != nil {
+		s.dedup.lock.Lock()
+		for h := range s.dedup.seen {
+			cp.Seen = append(cp.Seen, hex.EncodeToString(h[:]))
+		}
+		s.dedup.lock.Unlock()
+	}
+
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ResumeFrom 从Checkpoint保存的文件恢复统计和去重记录，并重新加入保存的任务(不经过OnTask)
+// 需要在注册处理方法和使用WithDeduplicate之后、加入种子任务之前调用；文件不存在时返回的错误满足os.IsNotExist
+func (s *Spider) ResumeFrom(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	cp := &checkpointFile{}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return err
+	}
+	s.Status.restore(cp.Status)
+	if s.dedup != nil {
+		for _, i := range cp.Seen {
+			b, err := hex.DecodeString(i)
+			if err != nil || len(b) != md5.Size {
+				continue
+			}
+			h := [md5.Size]byte{}
+			copy(h[:], b)
+			s.dedup.add(h)
+		}
+	}
+	for _, sub := range cp.Tasks {
+		t, err := s.DeserializeTask(sub)
+		if err != nil {
+			s.writeLog(nil, LogWarn, "resume skip task", "error", err, "spider", s.Name, "url", sub.URL)
+			continue
+		}
+		s.addTask(t)
+	}
+	s.writeLog(nil, LogInfo, "spider resumed", "spider", s.Name, "tasks", len(cp.Tasks), "checkpoint", cp.Time)
+	return nil
+}
+
+// WithCheckpoint 从第一次Wait开始每隔interval将爬取状态保存到path(见Checkpoint)，Stop后Wait返回前再保存一次
+// 重新启动时调用ResumeFrom(path)继续
+func WithCheckpoint(path string, interval time.Duration) Extension {
+	return func(s *Spider) {
+		s.useExtension(&checkpointer{path: path, interval: interval})
+	}
+}
+
+// checkpointer 定时保存检查点，见WithCheckpoint
+type checkpointer struct {
+	s        *Spider
+	path     string
+	interval time.Duration
+	done     chan struct{}
+}
+
+// Init 设置Stop后保存检查点的路径
+func (c *checkpointer) Init(s *Spider) error {
+	c.s = s
+	s.checkpoint = c.path
+	return nil
+}
+
+// Start 开始定时保存，ctx取消(Stop或关闭)时退出
+func (c *checkpointer) Start(ctx context.Context) {
+	c.done = make(chan struct{})
+	go func() {
+		defer close(c.done)
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := c.s.Checkpoint(c.path); err != nil {
+				c.s.writeLog(nil, LogError, "checkpoint error", "error", err, "spider", c.s.Name, "path", c.path)
+			}
+		}
+	}()
+}
+
+// Close 等待定时保存的goroutine退出
+func (c *checkpointer) Close() error {
+	if c.done != nil {
+		<-c.done
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package gospider
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSpider_Checkpoint(t *testing.T) {
+	lock := sync.Mutex{}
+	hits := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		hits[r.URL.Path]++
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "gospider-checkpoint")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "crawl.json")
+
+	newSpider := func(stopAt int) *Spider {
+		s := NewSpider(WithDeduplicate(), WithCheckpoint(path, time.Hour))
+		s.Logging = false
+		var page Handler
+		page = func(ctx *Context) {
+			n, _ := strconv.Atoi(strings.TrimPrefix(ctx.Req.URL.Path, "/"))
+			if n == stopAt {
+				ctx.s.Stop()
+			}
+			if n < 4 {
+				ctx.AddTask(goreq.Get(fmt.Sprintf("%s/%d", ts.URL, n+1)), page)
+			}
+		}
+		s.RegisterHandler("page", page)
+		return s
+	}
+
+	a := newSpider(2)
+	page, _ := a.GetHandler("page")
+	a.SeedTask(goreq.Get(ts.URL+"/0"), page)
+	a.Wait()
+	assert.Equal(t, int64(1), a.Status.AbandonedTask)
+
+	data, err := ioutil.ReadFile(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	cp := &checkpointFile{}
+	assert.NoError(t, json.Unmarshal(data, cp))
+	if assert.Len(t, cp.Tasks, 1) {
+		assert.Equal(t, ts.URL+"/3", cp.Tasks[0].URL)
+		assert.Equal(t, []string{"page"}, cp.Tasks[0].Handlers)
+	}
+	assert.Len(t, cp.Seen, 4)
+	assert.Equal(t, int64(0), cp.Status.AbandonedTask)
+
+	b := newSpider(-1)
+	assert.NoError(t, b.ResumeFrom(path))
+	page, _ = b.GetHandler("page")
+	b.SeedTask(goreq.Get(ts.URL+"/0"), page)
+	b.Wait()
+
+	assert.Equal(t, map[string]int{"/0": 1, "/1": 1, "/2": 1, "/3": 1, "/4": 1}, hits)
+	ss := b.Status.Snapshot()
+	assert.Equal(t, int64(5), ss.TotalTask)
+	assert.Equal(t, int64(5), ss.FinishedTask)
+	assert.Equal(t, int64(0), ss.AbandonedTask)
+	assert.Equal(t, int64(5), ss.HostTasks[strings.TrimPrefix(ts.URL, "http://")])
+	assert.Equal(t, int64(5), ss.StatusCodes[http.StatusOK])
+
+	assert.True(t, os.IsNotExist(NewSpider().ResumeFrom(filepath.Join(dir, "missing.json"))))
+}
+
+func TestWithCheckpoint_Close(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "gospider-checkpoint")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "crawl.json")
+
+	s := NewSpider(WithCheckpoint(path, 10*time.Millisecond))
+	s.Logging = false
+	exts := s.Extensions()
+	if !assert.Len(t, exts, 1) {
+		return
+	}
+	c := exts[0].(*checkpointer)
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {})
+	s.Wait()
+	assert.NoError(t, s.Close())
+
+	select {
+	case <-c.done:
+	default:
+		t.Fatal("checkpoint goroutine still running after Close")
+	}
+	_, err = os.Stat(path)
+	assert.NoError(t, err)
+}
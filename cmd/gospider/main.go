@@ -0,0 +1,187 @@
+// gospider 按配置文件运行爬虫，配置格式见gospider.SpiderConfig
+//
+//	gospider run [-o items.jsonl] [-stats 5s] config.yaml
+//
+// 内置的处理方法：
+//
+//	page   输出页面的url、状态码和标题
+//	follow 同page，并跟随页面中的链接(配置allowed_domains和max_depth限制范围)，为默认的处理方法
+//
+// 第一次SIGINT停止爬虫，取消正在进行的请求并等待已收到的响应处理完；第二次立即退出
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gotodown/gospider"
+	"github.com/zhshch2002/goreq"
+)
+
+func main() {
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, os.Interrupt)
+	os.Exit(run(os.Args[1:], os.Stderr, sig))
+}
+
+const usage = `usage: gospider run [flags] <config.yaml|config.toml|config.json>`
+
+// run 执行命令，返回退出码
+func run(args []string, stderr io.Writer, sig <-chan os.Signal) int {
+	if len(args) == 0 || args[0] != "run" {
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	output := fs.String("o", "", "save items to this file instead of the outputs in the config, format by extension (.csv or .jsonl)")
+	stats := fs.Duration("stats", 5*time.Second, "interval of the stats line, 0 to disable")
+	quiet := fs.Bool("q", false, "disable the spider log")
+	tui := fs.Bool("tui", false, "show a live progress panel instead of the stats lines, implies -q")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	s, err := newSpider(fs.Arg(0), *output, *quiet || *tui)
+	if err != nil {
+		fmt.Fprintln(stderr, "gospider:", err)
+		return 1
+	}
+	if *tui {
+		s.Use(gospider.WithTerminalUI(stderr))
+	} else if *stats > 0 {
+		s.Use(gospider.WithStatusReport(*stats, func(ss gospider.StatusSnapshot) {
+			printStats(stderr, s.Name, ss)
+		}))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-sig:
+		case <-done:
+			return
+		}
+		fmt.Fprintln(stderr, "gospider: stopping, canceling running requests (interrupt again to exit now)")
+		s.Stop()
+		select {
+		case <-sig:
+			fmt.Fprintln(stderr, "gospider: interrupted")
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+	s.Wait()
+	close(done)
+	if err := s.Close(); err != nil {
+		fmt.Fprintln(stderr, "gospider:", err)
+	}
+	printStats(stderr, s.Name, s.Status.Snapshot())
+	if s.IsStopped() {
+		return 130
+	}
+	return 0
+}
+
+// newSpider 按配置创建爬虫并加入种子任务，output不为空时替换配置中的输出
+func newSpider(path, output string, quiet bool) (*gospider.Spider, error) {
+	c, err := gospider.LoadSpiderConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if output != "" {
+		typ := strings.TrimPrefix(filepath.Ext(output), ".")
+		if typ != "csv" && typ != "jsonl" {
+			return nil, fmt.Errorf("unknown output format %q, use .csv or .jsonl", filepath.Ext(output))
+		}
+		c.Output = []gospider.OutputConfig{{Type: typ, Path: output}}
+	}
+	if c.Handler == "" {
+		c.Handler = "follow"
+	}
+	// csv输出只保存CsvItem，此时内置的处理方法输出CsvItem
+	csv := false
+	for _, o := range c.Output {
+		if o.Type == "csv" {
+			csv = true
+		}
+	}
+	page := func(ctx *gospider.Context) {
+		title := ""
+		if ctx.Resp.IsHTML() {
+			if doc, err := ctx.HTML(); err == nil {
+				title = strings.TrimSpace(doc.Find("title").First().Text())
+			}
+		}
+		if csv {
+			ctx.AddItem(gospider.CsvItem{ctx.Req.URL.String(), strconv.Itoa(ctx.Resp.StatusCode), title})
+		} else {
+			ctx.AddItem(map[string]interface{}{
+				"url":    ctx.Req.URL.String(),
+				"status": ctx.Resp.StatusCode,
+				"title":  title,
+			})
+		}
+	}
+	var follow gospider.Handler
+	follow = func(ctx *gospider.Context) {
+		page(ctx)
+		if !ctx.Resp.IsHTML() {
+			return
+		}
+		doc, err := ctx.HTML()
+		if err != nil {
+			return
+		}
+		for _, href := range doc.Find("a[href]").Map(func(i int, sel *goquery.Selection) string {
+			return sel.AttrOr("href", "")
+		}) {
+			u, err := ctx.Req.URL.Parse(href)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				continue
+			}
+			u.Fragment = ""
+			ctx.AddTask(goreq.Get(u.String()), follow)
+		}
+	}
+	s, err := c.NewSpider(map[string]gospider.Handler{
+		"page":   page,
+		"follow": follow,
+	}, func(s *gospider.Spider) {
+		s.Logging = !quiet
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Seed(s); err != nil {
+		if errors.Is(err, gospider.ErrUnregisteredHandler) {
+			return nil, fmt.Errorf("%v (built-in handlers are page and follow)", err)
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// printStats 输出一行状态
+func printStats(w io.Writer, name string, ss gospider.StatusSnapshot) {
+	fmt.Fprintf(w, "[%s] %s tasks %d/%d items %d errors %d %.1f tasks/s\n",
+		name, ss.Elapsed.Truncate(time.Second), ss.FinishedTask, ss.TotalTask, ss.TotalItem,
+		ss.ReqErrors+ss.RespErrors, ss.ExecRate)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSite(delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><head><title>Home</title></head><body><a href="/a">a</a><a href="/b#top">b</a><a href="mailto:x@example.com">mail</a><a href="http://example.invalid/">out</a></body></html>`)
+		case "/a":
+			fmt.Fprint(w, `<html><head><title>A</title></head><body><a href="/">home</a></body></html>`)
+		default:
+			fmt.Fprint(w, `<html><head><title>B</title></head></html>`)
+		}
+	}))
+}
+
+func writeConfig(t *testing.T, dir, url string) string {
+	path := filepath.Join(dir, "spider.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(fmt.Sprintf(`
+name: site
+allowed_domains: [127.0.0.1]
+deduplicate: true
+seeds:
+  - url: %s/
+`, url)), 0644))
+	return path
+}
+
+func TestRun(t *testing.T) {
+	ts := testSite(0)
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "gospider-cmd")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	config := writeConfig(t, dir, ts.URL)
+
+	out := filepath.Join(dir, "items.csv")
+	stderr := &bytes.Buffer{}
+	assert.Equal(t, 0, run([]string{"run", "-q", "-stats", "0", "-o", out, config}, stderr, nil))
+	data, err := ioutil.ReadFile(out)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	sort.Strings(lines)
+	assert.Equal(t, []string{
+		ts.URL + "/,200,Home",
+		ts.URL + "/a,200,A",
+		ts.URL + "/b,200,B",
+	}, lines)
+	assert.Contains(t, stderr.String(), "[site]")
+	assert.Contains(t, stderr.String(), "tasks 3/3 items 3")
+
+	out = filepath.Join(dir, "items.jsonl")
+	assert.Equal(t, 0, run([]string{"run", "-q", "-stats", "0", "-o", out, config}, ioutil.Discard, nil))
+	data, err = ioutil.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `{"status":200,"title":"Home","url":"`+ts.URL+`/"}`)
+
+	assert.Equal(t, 2, run(nil, ioutil.Discard, nil))
+	assert.Equal(t, 2, run([]string{"run"}, ioutil.Discard, nil))
+	assert.Equal(t, 1, run([]string{"run", "-o", "items.xml", config}, ioutil.Discard, nil))
+	assert.Equal(t, 1, run([]string{"run", filepath.Join(dir, "missing.yaml")}, ioutil.Discard, nil))
+}
+
+func TestRun_TUI(t *testing.T) {
+	ts := testSite(0)
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "gospider-cmd")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	config := writeConfig(t, dir, ts.URL)
+
+	stderr := &bytes.Buffer{}
+	assert.Equal(t, 0, run([]string{"run", "-tui", "-o", filepath.Join(dir, "items.csv"), config}, stderr, nil))
+	frames := strings.Split(stderr.String(), "\x1b[J")
+	if assert.True(t, len(frames) > 1) {
+		assert.Contains(t, frames[len(frames)-1], "100.0%  tasks 3/3")
+	}
+}
+
+func TestRun_Interrupt(t *testing.T) {
+	ts := testSite(100 * time.Millisecond)
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "gospider-cmd")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	config := writeConfig(t, dir, ts.URL)
+
+	sig := make(chan os.Signal, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		sig <- os.Interrupt
+	}()
+	stderr := &bytes.Buffer{}
+	assert.Equal(t, 130, run([]string{"run", "-q", "-stats", "0", "-o", filepath.Join(dir, "items.jsonl"), config}, stderr, sig))
+	assert.Contains(t, stderr.String(), "stopping")
+	// 正在进行的请求被取消，没有输出Item
+	assert.Contains(t, stderr.String(), "tasks 1/1 items 0")
+}
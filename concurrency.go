@@ -0,0 +1,84 @@
+package gospider
+
+import "sync"
+
+// taskLimiter 调度时的并发限制，见WithConcurrencyLimit、WithHostConcurrency
+type taskLimiter struct {
+	global  chan struct{} // 为nil时不限制
+	perHost int           // 为0时不限制
+
+	lock  sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+func (s *Spider) limiter() *taskLimiter {
+	if s.limit == nil {
+		s.limit = &taskLimiter{hosts: map[string]chan struct{}{}}
+	}
+	return s.limit
+}
+
+func (l *taskLimiter) host(host string) chan struct{} {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	ch, ok := l.hosts[host]
+	if !ok {
+		ch = make(chan struct{}, l.perHost)
+		l.hosts[host] = ch
+	}
+	return ch
+}
+
+// acquire 等待host和全局的并发数允许执行任务，先等待host再等待全局，避免占用全局配额等待繁忙的host
+// stop关闭时放弃等待并返回false
+func (l *taskLimiter) acquire(host string, stop <-chan struct{}) (func(), bool) {
+	if l == nil {
+		return func() {}, true
+	}
+	var hostCh chan struct{}
+	if l.perHost > 0 && host != "" {
+		hostCh = l.host(host)
+		select {
+		case hostCh <- struct{}{}:
+		case <-stop:
+			return nil, false
+		}
+	}
+	if l.global != nil {
+		select {
+		case l.global <- struct{}{}:
+		case <-stop:
+			if hostCh != nil {
+				<-hostCh
+			}
+			return nil, false
+		}
+	}
+	return func() {
+		if l.global != nil {
+			<-l.global
+		}
+		if hostCh != nil {
+			<-hostCh
+		}
+	}, true
+}
+
+// WithConcurrencyLimit 同时执行的任务数不超过n，超出的任务在调度时等待，不会发出请求
+// 等待中的任务在Stop后被放弃
+func WithConcurrencyLimit(n int) Extension {
+	return func(s *Spider) {
+		if n > 0 {
+			s.limiter().global = make(chan struct{}, n)
+		}
+	}
+}
+
+// WithHostConcurrency 每个host(含端口)同时执行的任务数不超过n，相当于在调度层面实现Crawl-delay式的礼貌爬取
+func WithHostConcurrency(n int) Extension {
+	return func(s *Spider) {
+		if n > 0 {
+			s.limiter().perHost = n
+		}
+	}
+}
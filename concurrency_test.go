@@ -0,0 +1,91 @@
+package gospider
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// concurrencyServer 记录同时处理的请求数的最大值，总数和按路径第一段分组
+type concurrencyServer struct {
+	*httptest.Server
+	lock      sync.Mutex
+	active    map[string]int
+	maxActive map[string]int
+}
+
+func newConcurrencyServer(delay time.Duration) *concurrencyServer {
+	c := &concurrencyServer{active: map[string]int{}, maxActive: map[string]int{}}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		group := strings.Split(r.URL.Path, "/")[1]
+		c.lock.Lock()
+		for _, k := range []string{"", group} {
+			c.active[k]++
+			if c.active[k] > c.maxActive[k] {
+				c.maxActive[k] = c.active[k]
+			}
+		}
+		c.lock.Unlock()
+		time.Sleep(delay)
+		c.lock.Lock()
+		c.active[""]--
+		c.active[group]--
+		c.lock.Unlock()
+	}))
+	return c
+}
+
+func TestWithConcurrencyLimit(t *testing.T) {
+	ts := newConcurrencyServer(20 * time.Millisecond)
+	defer ts.Close()
+
+	s := NewSpider(WithConcurrencyLimit(3))
+	s.Logging = false
+	for i := 0; i < 12; i++ {
+		s.SeedTask(goreq.Get(fmt.Sprintf("%s/a/%d", ts.URL, i)))
+	}
+	s.Wait()
+	assert.Equal(t, 3, ts.maxActive[""])
+	assert.Equal(t, int64(12), s.Status.FinishedTask)
+}
+
+func TestWithHostConcurrency(t *testing.T) {
+	a := newConcurrencyServer(20 * time.Millisecond)
+	defer a.Close()
+	b := newConcurrencyServer(20 * time.Millisecond)
+	defer b.Close()
+
+	s := NewSpider(WithHostConcurrency(2), WithConcurrencyLimit(3))
+	s.Logging = false
+	for i := 0; i < 8; i++ {
+		s.SeedTask(goreq.Get(fmt.Sprintf("%s/a/%d", a.URL, i)))
+		s.SeedTask(goreq.Get(fmt.Sprintf("%s/b/%d", b.URL, i)))
+	}
+	s.Wait()
+	assert.Equal(t, 2, a.maxActive[""])
+	assert.Equal(t, 2, b.maxActive[""])
+	assert.Equal(t, int64(16), s.Status.FinishedTask)
+}
+
+func TestWithConcurrencyLimit_Stop(t *testing.T) {
+	ts := newConcurrencyServer(50 * time.Millisecond)
+	defer ts.Close()
+
+	s := NewSpider(WithHostConcurrency(1))
+	s.Logging = false
+	for i := 0; i < 5; i++ {
+		s.SeedTask(goreq.Get(fmt.Sprintf("%s/a/%d", ts.URL, i)))
+	}
+	time.Sleep(20 * time.Millisecond)
+	s.Stop()
+	s.Wait()
+	// 正在进行的请求被取消，同样计为放弃
+	assert.Equal(t, int64(1), s.Status.FinishedTask)
+	assert.Equal(t, int64(5), s.Status.AbandonedTask)
+}
@@ -0,0 +1,254 @@
+package gospider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/zhshch2002/goreq"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrConfigFormat 不支持的配置文件格式
+	ErrConfigFormat = errors.New("unsupported config format")
+)
+
+// Duration 配置文件中的时间间隔，格式与time.ParseDuration相同，如"500ms"、"1m30s"
+type Duration time.Duration
+
+// UnmarshalText 解析时间间隔
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalText 输出时间间隔
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// SeedConfig 种子任务，Handler为RegisterHandler注册的名字，为空时使用SpiderConfig.Handler
+type SeedConfig struct {
+	URL     string `json:"url" yaml:"url" toml:"url"`
+	Handler string `json:"handler,omitempty" yaml:"handler,omitempty" toml:"handler,omitempty"`
+}
+
+// OutputConfig 保存Item的输出，Type为"csv"(保存CsvItem，见WithCsvItemSaver)或"jsonl"(见WithJSONLinesItemSaver)
+// 文件以追加方式打开，直到进程退出
+type OutputConfig struct {
+	Type string `json:"type" yaml:"type" toml:"type"`
+	Path string `json:"path" yaml:"path" toml:"path"`
+}
+
+// ProxyGroupConfig 代理组，匹配Hosts(语法同path.Match，如"*.example.com")的host只使用Proxies中的代理，见ProxyPool.Pin
+type ProxyGroupConfig struct {
+	Name    string   `json:"name" yaml:"name" toml:"name"`
+	Proxies []string `json:"proxies" yaml:"proxies" toml:"proxies"`
+	Hosts   []string `json:"hosts" yaml:"hosts" toml:"hosts"`
+}
+
+// SpiderConfig 声明式的爬虫配置，可以从YAML、TOML或JSON文件加载(见LoadSpiderConfig)，零值字段不启用对应的功能
+type SpiderConfig struct {
+	Name           string            `json:"name" yaml:"name" toml:"name"`
+	Seeds          []SeedConfig      `json:"seeds" yaml:"seeds" toml:"seeds"`
+	Handler        string            `json:"handler,omitempty" yaml:"handler,omitempty" toml:"handler,omitempty"`                         // 种子任务默认的处理方法
+	AllowedDomains []string          `json:"allowed_domains,omitempty" yaml:"allowed_domains,omitempty" toml:"allowed_domains,omitempty"` // 见WithAllowedDomains
+	MaxDepth       int               `json:"max_depth,omitempty" yaml:"max_depth,omitempty" toml:"max_depth,omitempty"`                   // 见WithDepthLimit
+	Deduplicate    bool              `json:"deduplicate,omitempty" yaml:"deduplicate,omitempty" toml:"deduplicate,omitempty"`             // 见WithDeduplicate
+	RobotsTxt      string            `json:"robots_txt,omitempty" yaml:"robots_txt,omitempty" toml:"robots_txt,omitempty"`                // 遵守robots.txt时使用的UA，见WithRobotsTxt
+	Concurrency    int               `json:"concurrency,omitempty" yaml:"concurrency,omitempty" toml:"concurrency,omitempty"`             // 同时进行的请求数上限
+	Delay          Duration          `json:"delay,omitempty" yaml:"delay,omitempty" toml:"delay,omitempty"`                               // 同一个host两次请求的间隔
+	RandomDelay    Duration          `json:"random_delay,omitempty" yaml:"random_delay,omitempty" toml:"random_delay,omitempty"`          // 在Delay之外随机增加的间隔上限
+	UserAgent      string            `json:"user_agent,omitempty" yaml:"user_agent,omitempty" toml:"user_agent,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty" yaml:"headers,omitempty" toml:"headers,omitempty"`
+	Proxies        []string          `json:"proxies,omitempty" yaml:"proxies,omitempty" toml:"proxies,omitempty"`
+	ProxyStrategy  string            `json:"proxy_strategy,omitempty" yaml:"proxy_strategy,omitempty" toml:"proxy_strategy,omitempty"` // "round_robin"(默认)、"random"或"sticky"，见WithProxyPool
+	Output         []OutputConfig    `json:"output,omitempty" yaml:"output,omitempty" toml:"output,omitempty"`
+
+	ProxyGroups []ProxyGroupConfig `json:"proxy_groups,omitempty" yaml:"proxy_groups,omitempty" toml:"proxy_groups,omitempty"` // 按host固定使用的代理组，其他host使用Proxies
+}
+
+// LoadSpiderConfig 从文件加载配置，按扩展名(.yaml/.yml、.toml、.json)选择格式
+func LoadSpiderConfig(path string) (*SpiderConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSpiderConfig(data, strings.TrimPrefix(filepath.Ext(path), "."))
+}
+
+// ParseSpiderConfig 按format("yaml"、"yml"、"toml"或"json")解析配置
+func ParseSpiderConfig(data []byte, format string) (*SpiderConfig, error) {
+	c := &SpiderConfig{}
+	var err error
+	switch strings.ToLower(format) {
+	case "yaml", "yml":
+		err = yaml.Unmarshal(data, c)
+	case "toml":
+		err = toml.Unmarshal(data, c)
+	case "json":
+		err = json.Unmarshal(data, c)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrConfigFormat, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Extensions 将配置转换为扩展和中间件，可以交给NewSpider或Spider.Use
+func (c *SpiderConfig) Extensions() ([]interface{}, error) {
+	var e []interface{}
+	if c.Name != "" {
+		name := c.Name
+		e = append(e, Extension(func(s *Spider) {
+			s.Name = name
+		}))
+	}
+	if len(c.AllowedDomains) > 0 {
+		e = append(e, WithAllowedDomains(c.AllowedDomains...))
+	}
+	if c.MaxDepth > 0 {
+		e = append(e, WithDepthLimit(c.MaxDepth))
+	}
+	if c.Deduplicate {
+		e = append(e, WithDeduplicate())
+	}
+	if c.RobotsTxt != "" {
+		e = append(e, WithRobotsTxt(c.RobotsTxt))
+	}
+	if c.UserAgent != "" || len(c.Headers) > 0 {
+		ua, headers := c.UserAgent, c.Headers
+		e = append(e, Extension(func(s *Spider) {
+			s.OnTask(func(ctx *Context, t *Task) *Task {
+				if t.Req.Request == nil {
+					return t
+				}
+				for k, v := range headers {
+					t.Req.Header.Set(k, v)
+				}
+				if ua != "" {
+					t.Req.Header.Set("User-Agent", ua)
+				}
+				return t
+			})
+		}))
+	}
+	if len(c.Proxies) > 0 || len(c.ProxyGroups) > 0 {
+		strategy := RoundRobin
+		switch c.ProxyStrategy {
+		case "", "round_robin":
+		case "random":
+			strategy = RandomProxy
+		case "sticky":
+			strategy = StickyPerHost
+		default:
+			return nil, fmt.Errorf("unknown proxy strategy %q", c.ProxyStrategy)
+		}
+		pool := NewProxyPool(c.Proxies, strategy)
+		for _, g := range c.ProxyGroups {
+			pool.AddGroup(g.Name, g.Proxies...)
+			for _, h := range g.Hosts {
+				pool.Pin(h, g.Name)
+			}
+		}
+		e = append(e, WithProxies(pool))
+	}
+	for _, o := range c.Output {
+		f, err := os.OpenFile(o.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		switch o.Type {
+		case "csv":
+			e = append(e, WithPipeline(&filePipeline{NewCsvPipeline(f), f}))
+		case "jsonl":
+			e = append(e, WithPipeline(&filePipeline{NewJSONLinesPipeline(f), f}))
+		default:
+			f.Close()
+			return nil, fmt.Errorf("unknown output type %q", o.Type)
+		}
+	}
+	// 限速的中间件在其他中间件之后加入，位于最外层
+	if c.Delay > 0 || c.RandomDelay > 0 {
+		e = append(e, goreq.WithDelayLimiter(true, &goreq.DelayLimiterOpinion{
+			LimiterMatcher: goreq.LimiterMatcher{Glob: "*"},
+			Delay:          time.Duration(c.Delay),
+			RandomDelay:    time.Duration(c.RandomDelay),
+		}))
+	}
+	if c.Concurrency > 0 {
+		e = append(e, goreq.WithParallelismLimiter(false, &goreq.ParallelismLimiterOpinion{
+			LimiterMatcher: goreq.LimiterMatcher{Glob: "*"},
+			Parallelism:    int64(c.Concurrency),
+		}))
+	}
+	return e, nil
+}
+
+// NewSpider 按配置创建爬虫，注册handlers中的处理方法，再使用e中的扩展(如OnItem等钩子)
+// 种子任务不会加入，设置完成后调用Seed
+func (c *SpiderConfig) NewSpider(handlers map[string]Handler, e ...interface{}) (*Spider, error) {
+	exts, err := c.Extensions()
+	if err != nil {
+		return nil, err
+	}
+	s := NewSpider(exts...)
+	for name, fn := range handlers {
+		s.RegisterHandler(name, fn)
+	}
+	s.Use(e...)
+	return s, nil
+}
+
+// Seed 加入配置中的种子任务，处理方法需已注册
+func (c *SpiderConfig) Seed(s *Spider) error {
+	var tasks []*Task
+	for _, seed := range c.Seeds {
+		name := seed.Handler
+		if name == "" {
+			name = c.Handler
+		}
+		var h []Handler
+		if name != "" {
+			fn, ok := s.GetHandler(name)
+			if !ok {
+				return fmt.Errorf("%w: %q", ErrUnregisteredHandler, name)
+			}
+			h = append(h, fn)
+		}
+		tasks = append(tasks, NewTask(goreq.Get(seed.URL), nil, h...))
+	}
+	for _, t := range tasks {
+		s.AddTask(t)
+	}
+	return nil
+}
+
+// NewSpiderFromConfig 从配置文件创建爬虫并加入种子任务，参数见SpiderConfig.NewSpider
+func NewSpiderFromConfig(path string, handlers map[string]Handler, e ...interface{}) (*Spider, error) {
+	c, err := LoadSpiderConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := c.NewSpider(handlers, e...)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Seed(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
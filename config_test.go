@@ -0,0 +1,137 @@
+package gospider
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseSpiderConfig(t *testing.T) {
+	c, err := ParseSpiderConfig([]byte(`
+name = "toml"
+handler = "page"
+max_depth = 2
+delay = "1.5s"
+proxies = ["http://127.0.0.1:8080"]
+proxy_strategy = "sticky"
+
+[[seeds]]
+url = "http://example.com/"
+
+[[seeds]]
+url = "http://example.com/list"
+handler = "list"
+
+[[output]]
+type = "csv"
+path = "items.csv"
+`), "toml")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "toml", c.Name)
+	assert.Equal(t, 2, c.MaxDepth)
+	assert.Equal(t, Duration(1500*time.Millisecond), c.Delay)
+	assert.Equal(t, []SeedConfig{{URL: "http://example.com/"}, {URL: "http://example.com/list", Handler: "list"}}, c.Seeds)
+	assert.Equal(t, []OutputConfig{{Type: "csv", Path: "items.csv"}}, c.Output)
+
+	c, err = ParseSpiderConfig([]byte(`{"name":"json","delay":"2s","seeds":[{"url":"http://example.com/"}]}`), "json")
+	assert.NoError(t, err)
+	assert.Equal(t, Duration(2*time.Second), c.Delay)
+
+	_, err = ParseSpiderConfig([]byte(`delay: soon`), "yaml")
+	assert.Error(t, err)
+	_, err = ParseSpiderConfig(nil, "ini")
+	assert.True(t, errors.Is(err, ErrConfigFormat))
+	_, err = (&SpiderConfig{ProxyStrategy: "best", Proxies: []string{"http://127.0.0.1:8080"}}).Extensions()
+	assert.Error(t, err)
+
+	c, err = ParseSpiderConfig([]byte(`
+proxies: ["http://dc:8080"]
+proxy_groups:
+  - name: residential
+    proxies: ["http://res:8080"]
+    hosts: ["*.example.com"]
+`), "yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, []ProxyGroupConfig{{Name: "residential", Proxies: []string{"http://res:8080"}, Hosts: []string{"*.example.com"}}}, c.ProxyGroups)
+	e, err := c.Extensions()
+	assert.NoError(t, err)
+	assert.Len(t, e, 1)
+}
+
+func TestNewSpiderFromConfig(t *testing.T) {
+	lock := sync.Mutex{}
+	var uas []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		uas = append(uas, r.Header.Get("User-Agent")+" "+r.Header.Get("X-Token"))
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "gospider-config")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "items.jsonl")
+	path := filepath.Join(dir, "spider.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(fmt.Sprintf(`
+name: yaml
+handler: page
+allowed_domains: [127.0.0.1]
+max_depth: 2
+deduplicate: true
+concurrency: 2
+delay: 10ms
+user_agent: config-bot
+headers:
+  X-Token: abc
+seeds:
+  - url: %s/0
+output:
+  - type: jsonl
+    path: %s
+`, ts.URL, out)), 0644))
+
+	var page Handler
+	page = func(ctx *Context) {
+		ctx.AddItem(ctx.Req.URL.Path)
+		ctx.AddTask(goreq.Get(ts.URL+"/1"), page)
+		ctx.AddTask(goreq.Get(ts.URL+"/1"), page)
+		ctx.AddTask(goreq.Get(strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)+"/2"), page)
+	}
+	s, err := NewSpiderFromConfig(path, map[string]Handler{"page": page}, func(s *Spider) {
+		s.Logging = false
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	s.Wait()
+
+	assert.Equal(t, "yaml", s.Name)
+	assert.Equal(t, []string{"config-bot abc", "config-bot abc"}, uas)
+	data, err := ioutil.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "\"/0\"\n\"/1\"\n", string(data))
+
+	c, err := LoadSpiderConfig(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	c.Handler = "missing"
+	s, err = c.NewSpider(nil)
+	assert.NoError(t, err)
+	assert.True(t, errors.Is(c.Seed(s), ErrUnregisteredHandler))
+}
@@ -0,0 +1,110 @@
+package gospider
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/zhshch2002/goreq"
+)
+
+// BinaryHeader WithContentTypeFilter在被识别为二进制内容的响应头中加入的标记，值为"1"
+const BinaryHeader = "X-Gospider-Binary"
+
+// mimeFilter 响应类型的过滤和二进制内容的识别
+type mimeFilter struct {
+	allow []string // 允许的类型，支持"text/*"这样的通配，为空时不过滤
+	sniff int      // 用于识别内容的字节数，0为不识别
+}
+
+// defaultSniffLen 默认用于识别内容的字节数，与http.DetectContentType相同
+const defaultSniffLen = 512
+
+func (s *Spider) contentFilter() *mimeFilter {
+	if s.ctFilter == nil {
+		s.ctFilter = &mimeFilter{sniff: defaultSniffLen}
+		s.Client.Use(s.ctFilter.middleware)
+		s.OnRespWithPriority(-100, s.ctFilter.check)
+	}
+	return s.ctFilter
+}
+
+// WithContentTypeFilter 只处理allow中的MIME类型(如"text/html"、"application/json"、"text/*")的响应，其他响应以"content type"为原因Abort
+// 同时识别响应开头的内容：没有Content-Type的响应使用识别出的类型；内容是二进制数据(图片、压缩包等http.DetectContentType不识别为文本的内容)时
+// 把Content-Type改为识别出的类型并加入BinaryHeader，避免把二进制数据当作文本解码到Resp.Text。allow为空时只识别不过滤
+func WithContentTypeFilter(allow ...string) Extension {
+	return func(s *Spider) {
+		f := s.contentFilter()
+		for _, a := range allow {
+			f.allow = append(f.allow, strings.ToLower(strings.TrimSpace(a)))
+		}
+	}
+}
+
+// WithContentSniffing 设置WithContentTypeFilter识别内容时读取的字节数，默认512，0为不识别内容，只按Content-Type过滤
+func WithContentSniffing(n int) Extension {
+	return func(s *Spider) {
+		s.contentFilter().sniff = n
+	}
+}
+
+// IsBinary 响应是否被WithContentTypeFilter识别为二进制内容
+func (c *Context) IsBinary() bool {
+	return c.Resp != nil && c.Resp.Response != nil && c.Resp.Header.Get(BinaryHeader) != ""
+}
+
+func (f *mimeFilter) middleware(c *goreq.Client, next goreq.Handler) goreq.Handler {
+	return func(req *goreq.Request) *goreq.Response {
+		resp := next(req)
+		if resp == nil || resp.Err != nil || resp.Response == nil || f.sniff <= 0 || len(resp.Body) == 0 {
+			return resp
+		}
+		prefix := resp.Body
+		if len(prefix) > f.sniff {
+			prefix = prefix[:f.sniff]
+		}
+		sniffed := http.DetectContentType(prefix)
+		binary := !strings.HasPrefix(sniffed, "text/")
+		declared := resp.Header.Get("Content-Type")
+		if declared == "" || binary && isTextType(mediaType(declared)) {
+			resp.Header.Set("Content-Type", sniffed)
+		}
+		if binary {
+			resp.Header.Set(BinaryHeader, "1")
+		}
+		return resp
+	}
+}
+
+func (f *mimeFilter) check(ctx *Context) {
+	if len(f.allow) == 0 {
+		return
+	}
+	if !matchMediaType(f.allow, mediaType(ctx.Resp.Header.Get("Content-Type"))) {
+		ctx.AbortWithReason("content type")
+	}
+}
+
+// matchMediaType mt是否在allow中，allow中的类型需为小写，支持"text/*"这样的通配
+func matchMediaType(allow []string, mt string) bool {
+	for _, a := range allow {
+		if a == mt || a == "*/*" || strings.HasSuffix(a, "/*") && strings.HasPrefix(mt, a[:len(a)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// mediaType Content-Type中的MIME类型，小写，不含参数
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mt = strings.TrimSpace(strings.Split(contentType, ";")[0])
+	}
+	return strings.ToLower(mt)
+}
+
+// isTextType 是否是goreq会解码为Resp.Text的类型
+func isTextType(mt string) bool {
+	return strings.HasPrefix(mt, "text/") || strings.Contains(mt, "/json")
+}
@@ -0,0 +1,78 @@
+package gospider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMediaType(t *testing.T) {
+	assert.Equal(t, "text/html", mediaType("Text/HTML; charset=utf-8"))
+	assert.Equal(t, "application/json", mediaType("application/json;;"))
+	assert.Equal(t, "", mediaType(""))
+}
+
+func TestWithContentTypeFilter(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html><p>hi</p></html>"))
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"a":1}`))
+		case "/fake":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write(png)
+		case "/untyped":
+			w.Header()["Content-Type"] = nil
+			w.Write([]byte("<!DOCTYPE html><html><p>hi</p></html>"))
+		case "/png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(png)
+		}
+	}))
+	defer ts.Close()
+
+	type result struct {
+		Text   string
+		Binary bool
+	}
+	run := func(e ...interface{}) (map[string]result, map[string]string) {
+		s := NewSpider(append([]interface{}{WithSynchronousMode()}, e...)...)
+		s.Logging = false
+		res := map[string]result{}
+		aborted := map[string]string{}
+		s.OnAbort(func(ctx *Context, reason string) {
+			aborted[ctx.Req.URL.Path] = reason
+		})
+		for _, p := range []string{"/html", "/json", "/fake", "/untyped", "/png"} {
+			s.SeedTask(goreq.Get(ts.URL+p), func(ctx *Context) {
+				res[ctx.Req.URL.Path] = result{ctx.Resp.Text, ctx.IsBinary()}
+			})
+		}
+		s.Wait()
+		return res, aborted
+	}
+
+	res, aborted := run(WithContentTypeFilter("text/*", "application/json"))
+	assert.Equal(t, map[string]result{
+		"/html":    {"<html><p>hi</p></html>", false},
+		"/json":    {`{"a":1}`, false},
+		"/untyped": {"<!DOCTYPE html><html><p>hi</p></html>", false},
+	}, res)
+	assert.Equal(t, map[string]string{"/fake": "content type", "/png": "content type"}, aborted)
+
+	res, aborted = run(WithContentTypeFilter())
+	assert.Len(t, res, 5)
+	assert.Empty(t, aborted)
+	assert.Equal(t, result{"", true}, res["/fake"])
+	assert.Equal(t, result{"", true}, res["/png"])
+
+	res, _ = run(WithContentTypeFilter(), WithContentSniffing(0))
+	assert.NotEmpty(t, res["/fake"].Text)
+	assert.False(t, res["/fake"].Binary)
+}
@@ -1,12 +1,23 @@
 package gospider
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
+	"github.com/PuerkitoBio/goquery"
 	"github.com/rs/zerolog"
+	"github.com/tidwall/gjson"
 	"github.com/zhshch2002/goreq"
 )
 
+var (
+	// ErrNoResponse Context中还没有响应，如在SeedTask、OnTask中
+	ErrNoResponse = errors.New("no response")
+)
+
 // Context 上下文， 包含爬虫， 请求， 相应， 元数据
 type Context struct {
 	s     *Spider
@@ -14,6 +25,21 @@ type Context struct {
 	Resp  *goreq.Response
 	Meta  map[string]interface{}
 	abort bool
+
+	abortReason string       // AbortWithReason给出的原因
+	metaLock    sync.RWMutex // 保护Meta，见SetMeta
+
+	traceCtx   context.Context // 当前任务span所在的context，见WithTracing
+	screenshot string          // 截图保存的路径，见WithScreenshots
+	task       *Task           // 正在执行的任务，SeedTask等没有任务时为nil
+	bodyHash   string          // 响应内容的哈希，见WithSkipUnchanged
+	timings    *taskTimings    // 各阶段的耗时，见WithSlowTaskWarning
+
+	parseLock sync.Mutex
+	parsed    *goreq.Response   // doc、json解析自的响应，Resp被替换后重新解析
+	doc       *goquery.Document // 解析过的HTML，见HTML
+	docErr    error
+	json      *gjson.Result // 解析过的JSON，见JSON
 }
 
 // Abort this context to break the handler chain and stop handling
@@ -21,24 +47,71 @@ func (c *Context) Abort() {
 	c.abort = true
 }
 
+// AbortWithReason 与Abort相同，并给出原因，任务结束后reason会交给OnAbort
+func (c *Context) AbortWithReason(reason string) {
+	c.abort = true
+	c.abortReason = reason
+}
+
+// AbortReason AbortWithReason给出的原因，使用Abort或没有中断时为空
+func (c *Context) AbortReason() string {
+	return c.abortReason
+}
+
 // IsAborted return was the context dropped
 func (c *Context) IsAborted() bool {
 	return c.abort
 }
 
 // AddTask add a task to new task list. After every handler func return,spider will collect these tasks
-// 使用Handler来处理这些请求， Handler可以为多个
+// 使用Handler来处理这些请求， Handler可以为多个；新任务的Meta是当前Meta的深拷贝，之后的修改互不影响，
+// 使用WithMetaInheritance时只复制指定的键
 func (c *Context) AddTask(req *goreq.Request, h ...Handler) {
+	c.addTask(req, c.childMeta(c.s.inheritMeta), time.Time{}, h...)
+}
+
+// AddTaskInherit 加入任务，新任务只继承Meta中keys指定的键(以及SessionMetaKey)，覆盖WithMetaInheritance的设置；keys为nil时继承全部
+func (c *Context) AddTaskInherit(keys []string, req *goreq.Request, h ...Handler) {
+	c.addTask(req, c.childMeta(keys), time.Time{}, h...)
+}
+
+// AddTaskAfter 加入一个在delay之后才执行的任务，如遵循Retry-After重试或错开后续请求
+// 任务仍会立即经过OnTask，OnTask中可以修改Task.NotBefore
+func (c *Context) AddTaskAfter(delay time.Duration, req *goreq.Request, h ...Handler) {
+	c.addTask(req, c.childMeta(c.s.inheritMeta), time.Now().Add(delay), h...)
+}
+
+func (c *Context) addTask(req *goreq.Request, meta map[string]interface{}, notBefore time.Time, h ...Handler) {
+	depth := 0
+	if c.task != nil {
+		depth = c.task.Depth + 1
+	}
+	c.addTaskAt(depth, req, meta, notBefore, h...)
+}
+
+// addTaskAt 加入深度为depth的任务，如重定向后的任务与原任务深度相同
+func (c *Context) addTaskAt(depth int, req *goreq.Request, meta map[string]interface{}, notBefore time.Time, h ...Handler) {
 	if !req.URL.IsAbs() {
 		req.URL = c.Req.URL.ResolveReference(req.URL)
 	}
-	t := c.s.handleOnTask(c, NewTask(req, c.Meta, h...))
+	t := NewTask(req, meta, h...)
+	t.NotBefore = notBefore
+	t.Depth = depth
+	t = c.s.handleOnTask(c, t)
 	if t == nil {
 		return
 	}
 	c.s.addTask(t)
 }
 
+// Depth 当前任务的爬取深度，种子任务为0，SeedTask等没有任务时为0，见Task.Depth
+func (c *Context) Depth() int {
+	if c.task == nil {
+		return 0
+	}
+	return c.task.Depth
+}
+
 // AddItem add an item to new item list. After every handler func return,
 // spider will collect these items and call OnItem handler func
 func (c *Context) AddItem(i interface{}) {
@@ -53,11 +126,17 @@ func (c *Context) IsDownloaded() bool {
 }
 
 func (c *Context) Println(v ...interface{}) {
-	log.Print(v...)
+	c.s.writeLog(c, LogDebug, fmt.Sprint(v...))
 }
 
+// Error 开始一条错误日志，Msg时经过OnLog输出到爬虫的Logger(见Spider.SetLogger)，日志关闭时不输出
 func (c *Context) Error() *zerolog.Event {
-	return log.Error()
+	if !c.s.logEnabled(LogError) {
+		l := zerolog.Nop()
+		return l.Error()
+	}
+	l := zerolog.New(contextLogWriter{c: c})
+	return l.Error()
 }
 
 func (c *Context) String() string {
@@ -71,3 +150,168 @@ func (c *Context) String() string {
 		return fmt.Sprint("["+c.Resp.Status+"] ", c.Req.URL)
 	}
 }
+
+// resetParsed 响应被替换(如重试、渲染)后丢弃之前的解析结果，需持有parseLock
+func (c *Context) resetParsed() {
+	if c.parsed != c.Resp {
+		c.parsed = c.Resp
+		c.doc, c.docErr, c.json = nil, nil, nil
+	}
+}
+
+// HTML 解析响应的HTML，结果缓存在Context中，OnHTML等多个处理方法共享同一次解析
+// 返回的文档是共享的，不要修改(如Remove)，需要修改时使用Clone或ctx.Resp.HTML()
+func (c *Context) HTML() (*goquery.Document, error) {
+	if c.Resp == nil {
+		return nil, ErrNoResponse
+	}
+	c.parseLock.Lock()
+	defer c.parseLock.Unlock()
+	c.resetParsed()
+	if c.doc == nil && c.docErr == nil {
+		c.doc, c.docErr = c.Resp.HTML()
+	}
+	return c.doc, c.docErr
+}
+
+// JSON 解析响应的JSON，结果缓存在Context中，OnJSON等多个处理方法共享同一次解析
+func (c *Context) JSON() (gjson.Result, error) {
+	if c.Resp == nil {
+		return gjson.Result{}, ErrNoResponse
+	}
+	if c.Resp.Err != nil {
+		return gjson.Result{}, c.Resp.Err
+	}
+	c.parseLock.Lock()
+	defer c.parseLock.Unlock()
+	c.resetParsed()
+	if c.json == nil {
+		j := gjson.Parse(c.Resp.Text)
+		c.json = &j
+	}
+	return *c.json, nil
+}
+
+// SetMeta 设置Meta中的值，Meta为nil时创建，可以在处理方法启动的goroutine中并发调用
+func (c *Context) SetMeta(k string, v interface{}) {
+	c.metaLock.Lock()
+	defer c.metaLock.Unlock()
+	if c.Meta == nil {
+		c.Meta = map[string]interface{}{}
+	}
+	c.Meta[k] = v
+}
+
+// GetMeta 读取Meta中的值，可以与SetMeta并发调用
+func (c *Context) GetMeta(k string) (interface{}, bool) {
+	c.metaLock.RLock()
+	defer c.metaLock.RUnlock()
+	v, ok := c.Meta[k]
+	return v, ok
+}
+
+// GetString 读取Meta中的字符串，不存在或不是字符串时返回""
+func (c *Context) GetString(k string) string {
+	v, _ := c.GetMeta(k)
+	s, _ := v.(string)
+	return s
+}
+
+// GetInt 读取Meta中的整数，支持各种整数类型和整数值的浮点数(如经过JSON序列化的任务)，不存在或类型不符时返回0
+func (c *Context) GetInt(k string) int {
+	v, _ := c.GetMeta(k)
+	switch n := v.(type) {
+	case int:
+		return n
+	case int8:
+		return int(n)
+	case int16:
+		return int(n)
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case uint:
+		return int(n)
+	case uint8:
+		return int(n)
+	case uint16:
+		return int(n)
+	case uint32:
+		return int(n)
+	case uint64:
+		return int(n)
+	case float32:
+		if float32(int(n)) == n {
+			return int(n)
+		}
+	case float64:
+		if float64(int(n)) == n {
+			return int(n)
+		}
+	}
+	return 0
+}
+
+// GetBool 读取Meta中的布尔值，不存在或不是布尔值时返回false
+func (c *Context) GetBool(k string) bool {
+	v, _ := c.GetMeta(k)
+	b, _ := v.(bool)
+	return b
+}
+
+// copyMeta 深拷贝Meta，嵌套的map[string]interface{}和[]interface{}也会复制，其他类型的值按原样复制
+func (c *Context) copyMeta() map[string]interface{} {
+	c.metaLock.RLock()
+	defer c.metaLock.RUnlock()
+	if c.Meta == nil {
+		return map[string]interface{}{}
+	}
+	return copyMetaValue(c.Meta).(map[string]interface{})
+}
+
+// childMeta 新任务继承的Meta：keys为nil时深拷贝全部，否则只复制keys和SessionMetaKey
+func (c *Context) childMeta(keys []string) map[string]interface{} {
+	if keys == nil {
+		return c.copyMeta()
+	}
+	c.metaLock.RLock()
+	defer c.metaLock.RUnlock()
+	meta := map[string]interface{}{}
+	for _, k := range keys {
+		if v, ok := c.Meta[k]; ok {
+			meta[k] = copyMetaValue(v)
+		}
+	}
+	if v, ok := c.Meta[SessionMetaKey]; ok {
+		meta[SessionMetaKey] = v
+	}
+	return meta
+}
+
+func copyMetaValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, i := range v {
+			m[k] = copyMetaValue(i)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for k, i := range v {
+			l[k] = copyMetaValue(i)
+		}
+		return l
+	default:
+		return v
+	}
+}
+
+// WithMetaInheritance ctx.AddTask和AddTaskAfter加入的新任务只继承Meta中keys指定的键，如深度、会话、标签等，
+// 不需要在每个处理方法中手动复制；SessionMetaKey总是会继承。没有使用时新任务继承全部Meta
+func WithMetaInheritance(keys ...string) Extension {
+	return func(s *Spider) {
+		s.inheritMeta = append([]string{}, keys...)
+	}
+}
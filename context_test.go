@@ -0,0 +1,144 @@
+package gospider
+
+import (
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestContext_Meta(t *testing.T) {
+	ctx := &Context{}
+	assert.Equal(t, "", ctx.GetString("missing"))
+	_, ok := ctx.GetMeta("missing")
+	assert.False(t, ok)
+
+	ctx.SetMeta("name", "a")
+	ctx.SetMeta("n", int64(3))
+	ctx.SetMeta("f", float64(4))
+	ctx.SetMeta("half", 1.5)
+	ctx.SetMeta("ok", true)
+	assert.Equal(t, "a", ctx.GetString("name"))
+	assert.Equal(t, 0, ctx.GetInt("name"))
+	assert.Equal(t, 3, ctx.GetInt("n"))
+	assert.Equal(t, 4, ctx.GetInt("f"))
+	assert.Equal(t, 0, ctx.GetInt("half"))
+	assert.True(t, ctx.GetBool("ok"))
+	assert.False(t, ctx.GetBool("name"))
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx.SetMeta("i", i)
+			ctx.GetInt("i")
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestContext_AddTask_CopyMeta(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	s := NewSpider(WithSynchronousMode())
+	s.Logging = false
+	var parentAfter, child map[string]interface{}
+	s.SeedTask(goreq.Get(ts.URL+"/parent"), func(ctx *Context) {
+		ctx.SetMeta("tags", []interface{}{"a"})
+		ctx.SetMeta("nested", map[string]interface{}{"k": "v"})
+		ctx.AddTask(goreq.Get(ts.URL+"/child"), func(ctx *Context) {
+			ctx.SetMeta("child", true)
+			ctx.Meta["tags"].([]interface{})[0] = "changed"
+			ctx.Meta["nested"].(map[string]interface{})["k"] = "changed"
+			child = ctx.Meta
+		})
+		parentAfter = ctx.Meta
+	})
+	s.Wait()
+
+	assert.Equal(t, map[string]interface{}{
+		"tags":   []interface{}{"a"},
+		"nested": map[string]interface{}{"k": "v"},
+	}, parentAfter)
+	assert.Equal(t, map[string]interface{}{
+		"tags":   []interface{}{"changed"},
+		"nested": map[string]interface{}{"k": "changed"},
+		"child":  true,
+	}, child)
+}
+
+func TestWithMetaInheritance(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	s := NewSpider(WithSynchronousMode(), WithMetaInheritance("depth", "labels"))
+	s.Logging = false
+	metas := map[string]map[string]interface{}{}
+	record := func(ctx *Context) {
+		metas[ctx.Req.URL.Path] = ctx.Meta
+	}
+	s.SeedTask(goreq.Get(ts.URL+"/"), func(ctx *Context) {
+		ctx.SetMeta("depth", 1)
+		ctx.SetMeta("labels", []interface{}{"news"})
+		ctx.SetMeta(SessionMetaKey, "user")
+		ctx.SetMeta("page", 3)
+		ctx.AddTask(goreq.Get(ts.URL+"/child"), record)
+		ctx.AddTaskInherit([]string{"page"}, goreq.Get(ts.URL+"/page"), record)
+		ctx.AddTaskInherit(nil, goreq.Get(ts.URL+"/all"), record)
+	})
+	s.Wait()
+
+	assert.Equal(t, map[string]interface{}{"depth": 1, "labels": []interface{}{"news"}, SessionMetaKey: "user"}, metas["/child"])
+	assert.Equal(t, map[string]interface{}{"page": 3, SessionMetaKey: "user"}, metas["/page"])
+	assert.Equal(t, map[string]interface{}{"depth": 1, "labels": []interface{}{"news"}, SessionMetaKey: "user", "page": 3}, metas["/all"])
+}
+
+func TestContext_HTML(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/json" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"a":{"b":1}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<ul><li>a</li><li>b</li></ul>`))
+	}))
+	defer ts.Close()
+
+	s := NewSpider(WithSynchronousMode())
+	s.Logging = false
+	var docs []interface{}
+	var items []string
+	s.OnHTML("li", func(ctx *Context, sel *goquery.Selection) {
+		items = append(items, sel.Text())
+	})
+	s.OnJSON("a.b", func(ctx *Context, j gjson.Result) {
+		items = append(items, j.String())
+	})
+	s.OnResp(func(ctx *Context) {
+		if ctx.Resp.IsHTML() {
+			d1, _ := ctx.HTML()
+			d2, _ := ctx.HTML()
+			assert.Same(t, d1, d2)
+			docs = append(docs, d1)
+			resp := *ctx.Resp
+			ctx.Resp = &resp
+			d3, _ := ctx.HTML()
+			assert.NotSame(t, d1, d3)
+		}
+	})
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		_, err := (&Context{}).HTML()
+		assert.Equal(t, ErrNoResponse, err)
+	})
+	s.SeedTask(goreq.Get(ts.URL + "/json"))
+	s.Wait()
+	assert.Equal(t, []string{"a", "b", "1"}, items)
+	assert.Len(t, docs, 1)
+}
@@ -0,0 +1,522 @@
+package gospider
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gotodown/gospider/gospiderpb"
+	"github.com/tidwall/gjson"
+	"github.com/zhshch2002/goreq"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Coordinator 分布式爬取的主节点(gospiderpb.Coordinator)，持有待爬队列和去重状态
+// 工作节点(CoordinatorWorker)通过gRPC租用任务，定期续约，完成时提交处理中发现的新任务；
+// 租约超过LeaseTimeout没有续约或完成时任务重新入队，工作节点崩溃不会丢失URL
+type Coordinator struct {
+	gospiderpb.UnimplementedCoordinatorServer
+	LeaseTimeout time.Duration // 租约的超时，默认1分钟
+
+	Fingerprint FingerprintFunc // 去重使用的请求指纹，为nil时使用GetRequestHash，见NewFingerprint
+
+	lock     sync.Mutex
+	queue    []*gospiderpb.CrawlTask
+	seen     map[[md5.Size]byte]struct{}
+	leases   map[string]*coordinatorLease
+	workers  map[string]time.Time // 工作节点最近一次请求的时间
+	nextID   int64
+	finished int64
+	failed   int64
+
+	onItemHandlers []func(worker string, item gjson.Result)
+}
+
+// coordinatorLease 分配给工作节点的任务
+type coordinatorLease struct {
+	task     *gospiderpb.CrawlTask
+	worker   string
+	deadline time.Time
+}
+
+// CoordinatorStatus 主节点的状态
+type CoordinatorStatus struct {
+	Pending  int      `json:"pending"`  // 等待租用的任务数
+	Leased   int      `json:"leased"`   // 已租出未完成的任务数
+	Finished int64    `json:"finished"` // 完成的任务数
+	Failed   int64    `json:"failed"`   // 工作节点无法执行的任务数
+	Workers  []string `json:"workers"`  // 一个租约超时内有请求的工作节点
+}
+
+// NewCoordinator 创建分布式爬取的主节点
+func NewCoordinator() *Coordinator {
+	return &Coordinator{
+		LeaseTimeout: time.Minute,
+		seen:         map[[md5.Size]byte]struct{}{},
+		leases:       map[string]*coordinatorLease{},
+		workers:      map[string]time.Time{},
+	}
+}
+
+// Serve 在lis上启动gRPC服务，阻塞直到服务停止
+func (c *Coordinator) Serve(lis net.Listener, opt ...grpc.ServerOption) error {
+	srv := grpc.NewServer(opt...)
+	gospiderpb.RegisterCoordinatorServer(srv, c)
+	return srv.Serve(lis)
+}
+
+// SeedTask 加入种子任务，handlers为工作节点上用Spider.RegisterHandler注册的处理方法的名字
+// 与已加入过的任务重复(按Fingerprint，默认为GetRequestHash)时忽略
+func (c *Coordinator) SeedTask(req *goreq.Request, handlers ...string) error {
+	if req.Err != nil {
+		return req.Err
+	}
+	if !req.URL.IsAbs() {
+		return fmt.Errorf("url %q is not absolute", req.URL)
+	}
+	ct := crawlTaskOf(&TaskSubmission{
+		SerializedRequest: *SerializeRequest(req),
+		Handlers:          handlers,
+	})
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.add(ct)
+	return nil
+}
+
+// OnItem 工作节点提交Item时的处理方法，Item为JSON编码
+func (c *Coordinator) OnItem(fn func(worker string, item gjson.Result)) {
+	c.onItemHandlers = append(c.onItemHandlers, fn)
+}
+
+// Status 获取主节点的状态
+func (c *Coordinator) Status() CoordinatorStatus {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := time.Now()
+	c.expire(now)
+	st := CoordinatorStatus{
+		Pending:  len(c.queue),
+		Leased:   len(c.leases),
+		Finished: c.finished,
+		Failed:   c.failed,
+		Workers:  []string{},
+	}
+	for w, t := range c.workers {
+		if now.Sub(t) <= c.LeaseTimeout {
+			st.Workers = append(st.Workers, w)
+		}
+	}
+	sort.Strings(st.Workers)
+	return st
+}
+
+// Wait 等待队列为空且所有租约都已完成
+func (c *Coordinator) Wait() {
+	for {
+		if st := c.Status(); st.Pending == 0 && st.Leased == 0 {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (c *Coordinator) fingerprint(req *goreq.Request) [md5.Size]byte {
+	if c.Fingerprint != nil {
+		return c.Fingerprint(req)
+	}
+	return GetRequestHash(req)
+}
+
+// add 去重后加入队列，调用时需持有锁
+func (c *Coordinator) add(ct *gospiderpb.CrawlTask) bool {
+	req := submissionOf(ct).Request()
+	if req.Err != nil {
+		return false
+	}
+	h := c.fingerprint(req)
+	if _, ok := c.seen[h]; ok {
+		return false
+	}
+	c.seen[h] = struct{}{}
+	c.queue = append(c.queue, ct)
+	return true
+}
+
+// expire 超时的租约重新放回队首，调用时需持有锁
+func (c *Coordinator) expire(now time.Time) {
+	for id, l := range c.leases {
+		if now.After(l.deadline) {
+			delete(c.leases, id)
+			c.queue = append([]*gospiderpb.CrawlTask{l.task}, c.queue...)
+		}
+	}
+}
+
+// Lease 租用任务
+func (c *Coordinator) Lease(ctx context.Context, req *gospiderpb.LeaseRequest) (*gospiderpb.LeaseResponse, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := time.Now()
+	c.expire(now)
+	c.workers[req.Worker] = now
+	max := int(req.Max)
+	if max < 1 {
+		max = 1
+	}
+	res := &gospiderpb.LeaseResponse{LeaseTimeoutMs: c.LeaseTimeout.Milliseconds()}
+	for len(res.Leases) < max && len(c.queue) > 0 {
+		t := c.queue[0]
+		c.queue = c.queue[1:]
+		c.nextID++
+		id := strconv.FormatInt(c.nextID, 10)
+		c.leases[id] = &coordinatorLease{
+			task:     t,
+			worker:   req.Worker,
+			deadline: now.Add(c.LeaseTimeout),
+		}
+		res.Leases = append(res.Leases, &gospiderpb.TaskLease{Id: id, Task: t})
+	}
+	res.Done = len(c.queue) == 0 && len(c.leases) == 0
+	return res, nil
+}
+
+// Complete 完成租约并加入发现的新任务；租约已过期时新任务仍会加入，但任务可能已经分配给其他工作节点
+func (c *Coordinator) Complete(ctx context.Context, req *gospiderpb.CompleteRequest) (*gospiderpb.CompleteResponse, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.workers[req.Worker] = time.Now()
+	for _, t := range req.Discovered {
+		c.add(t)
+	}
+	l, ok := c.leases[req.LeaseId]
+	if !ok || l.worker != req.Worker {
+		return nil, status.Errorf(codes.NotFound, "lease %s not found", req.LeaseId)
+	}
+	delete(c.leases, req.LeaseId)
+	if req.Error != "" {
+		c.failed++
+	} else {
+		c.finished++
+	}
+	return &gospiderpb.CompleteResponse{}, nil
+}
+
+// Heartbeat 续约工作节点持有的租约，返回已经过期的租约
+func (c *Coordinator) Heartbeat(ctx context.Context, req *gospiderpb.HeartbeatRequest) (*gospiderpb.HeartbeatResponse, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := time.Now()
+	c.expire(now)
+	c.workers[req.Worker] = now
+	res := &gospiderpb.HeartbeatResponse{}
+	for _, id := range req.LeaseIds {
+		if l, ok := c.leases[id]; ok && l.worker == req.Worker {
+			l.deadline = now.Add(c.LeaseTimeout)
+		} else {
+			res.LostLeaseIds = append(res.LostLeaseIds, id)
+		}
+	}
+	return res, nil
+}
+
+// PushItems 接收工作节点提交的Item
+func (c *Coordinator) PushItems(ctx context.Context, req *gospiderpb.PushItemsRequest) (*gospiderpb.PushItemsResponse, error) {
+	c.lock.Lock()
+	c.workers[req.Worker] = time.Now()
+	c.lock.Unlock()
+	for _, i := range req.Items {
+		item := gjson.ParseBytes(i)
+		for _, fn := range c.onItemHandlers {
+			fn(req.Worker, item)
+		}
+	}
+	return &gospiderpb.PushItemsResponse{}, nil
+}
+
+// CoordinatorWorker 分布式爬取的工作节点，从Coordinator租用任务交给Spider执行
+// 租用的任务的处理方法中用ctx.AddTask加入的任务(经过本地的OnTask后)提交给主节点，这些任务的处理方法需要用RegisterHandler注册，
+// 否则仍在本地执行；Meta中只有能转换为JSON的值会随任务提交，数字会变为float64。产出的Item在经过本地的OnItem时提交给主节点
+type CoordinatorWorker struct {
+	ID                string
+	Concurrency       int           // 同时执行的任务数，默认4
+	HeartbeatInterval time.Duration // 续约的间隔，应小于主节点的LeaseTimeout，默认10s
+	PollInterval      time.Duration // 暂时没有可租用的任务时的等待间隔，默认1s
+
+	s      *Spider
+	client gospiderpb.CoordinatorClient
+	hooks  sync.Once
+
+	lock   sync.Mutex
+	leases map[string]*workerLease
+}
+
+// leaseKey 请求context中租用的任务
+type leaseKey struct{}
+
+// workerLease 工作节点执行中的租约
+type workerLease struct {
+	id         string
+	lock       sync.Mutex
+	done       bool
+	discovered []*gospiderpb.CrawlTask
+}
+
+// leaseOf 请求所属的租约，没有时为nil
+func leaseOf(req *goreq.Request) *workerLease {
+	if req == nil || req.Request == nil {
+		return nil
+	}
+	l, _ := req.Context().Value(leaseKey{}).(*workerLease)
+	return l
+}
+
+// NewCoordinatorWorker 创建使用s执行任务的工作节点，conn为到主节点的gRPC连接
+func NewCoordinatorWorker(s *Spider, conn grpc.ClientConnInterface, id string) *CoordinatorWorker {
+	return &CoordinatorWorker{
+		ID:                id,
+		Concurrency:       4,
+		HeartbeatInterval: 10 * time.Second,
+		PollInterval:      time.Second,
+		s:                 s,
+		client:            gospiderpb.NewCoordinatorClient(conn),
+		leases:            map[string]*workerLease{},
+	}
+}
+
+// Run 持续租用并执行任务，直到主节点报告爬取结束、ctx取消或Spider停止
+// 需要在注册处理方法和OnTask、OnItem之后调用
+func (w *CoordinatorWorker) Run(ctx context.Context) error {
+	w.hooks.Do(w.hook)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go w.heartbeat(ctx)
+
+	concurrency := w.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	slots := make(chan struct{}, concurrency)
+	running := sync.WaitGroup{}
+	defer running.Wait()
+	for {
+		if w.s.IsStopped() {
+			return nil
+		}
+		w.s.waitResume()
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		res, err := w.client.Lease(ctx, &gospiderpb.LeaseRequest{
+			Worker: w.ID,
+			Max:    int32(1 + cap(slots) - len(slots)),
+		})
+		if err != nil {
+			<-slots
+			return err
+		}
+		if len(res.Leases) == 0 {
+			<-slots
+			if res.Done {
+				return nil
+			}
+			select {
+			case <-time.After(w.PollInterval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			continue
+		}
+		for i, l := range res.Leases {
+			if i > 0 {
+				slots <- struct{}{}
+			}
+			running.Add(1)
+			go func(l *gospiderpb.TaskLease) {
+				defer running.Done()
+				defer func() { <-slots }()
+				w.run(ctx, l)
+			}(l)
+		}
+	}
+}
+
+// run 执行租用的任务并完成租约
+func (w *CoordinatorWorker) run(ctx context.Context, l *gospiderpb.TaskLease) {
+	lease := &workerLease{id: l.Id}
+	t, err := w.s.DeserializeTask(submissionOf(l.Task))
+	if err != nil {
+		w.s.writeLog(nil, LogError, "coordinator task error", "error", err, "spider", w.s.Name, "lease", l.Id)
+		w.complete(ctx, lease, err)
+		return
+	}
+	t.Req.Request = t.Req.WithContext(context.WithValue(t.Req.Context(), leaseKey{}, lease))
+	w.lock.Lock()
+	w.leases[lease.id] = lease
+	w.lock.Unlock()
+	// 与本地任务一样经过开始时间、暂停和并发限制后执行；不加入Checkpoint，停止时由协调器在租约过期后重新分配
+	w.s.Status.AddTask()
+	if t.Req.Request != nil {
+		w.s.Status.AddHostTask(t.Req.URL.Host)
+	}
+	abandoned := w.s.runTask(&pendingTask{t: t, counted: true})
+	w.lock.Lock()
+	delete(w.leases, lease.id)
+	w.lock.Unlock()
+	if abandoned {
+		// 请求因Stop被取消，不完成租约，过期后由其他节点重新执行
+		return
+	}
+	w.complete(ctx, lease, nil)
+}
+
+// complete 完成租约，之后租约上再发现的任务(如重试)在本地执行
+func (w *CoordinatorWorker) complete(ctx context.Context, lease *workerLease, taskErr error) {
+	lease.lock.Lock()
+	lease.done = true
+	req := &gospiderpb.CompleteRequest{
+		Worker:     w.ID,
+		LeaseId:    lease.id,
+		Discovered: lease.discovered,
+	}
+	lease.lock.Unlock()
+	if taskErr != nil {
+		req.Error = taskErr.Error()
+	}
+	if _, err := w.client.Complete(ctx, req); err != nil {
+		w.s.writeLog(nil, LogWarn, "coordinator complete error", "error", err, "spider", w.s.Name, "lease", lease.id)
+	}
+}
+
+// heartbeat 定期续约执行中的租约
+func (w *CoordinatorWorker) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(w.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		w.lock.Lock()
+		ids := make([]string, 0, len(w.leases))
+		for id := range w.leases {
+			ids = append(ids, id)
+		}
+		w.lock.Unlock()
+		res, err := w.client.Heartbeat(ctx, &gospiderpb.HeartbeatRequest{Worker: w.ID, LeaseIds: ids})
+		if err != nil {
+			w.s.writeLog(nil, LogWarn, "coordinator heartbeat error", "error", err, "spider", w.s.Name)
+			continue
+		}
+		for _, id := range res.LostLeaseIds {
+			w.s.writeLog(nil, LogWarn, "coordinator lease lost", "spider", w.s.Name, "lease", id)
+		}
+	}
+}
+
+// hook 将租用的任务发现的新任务和产出的Item转交给主节点
+func (w *CoordinatorWorker) hook() {
+	w.s.OnTask(func(ctx *Context, t *Task) *Task {
+		lease := leaseOf(ctx.Req)
+		if lease == nil {
+			return t
+		}
+		sub, err := w.s.SerializeTask(t)
+		if err != nil {
+			w.s.writeLog(ctx, LogWarn, "task kept local", "error", err, "spider", w.s.Name, "context", ctx.String())
+			return t
+		}
+		lease.lock.Lock()
+		defer lease.lock.Unlock()
+		if lease.done {
+			return t
+		}
+		lease.discovered = append(lease.discovered, crawlTaskOf(sub))
+		return t.handOff()
+	})
+	w.s.OnItem(func(ctx *Context, i interface{}) interface{} {
+		if leaseOf(ctx.Req) == nil {
+			return i
+		}
+		data, err := json.Marshal(i)
+		if err == nil {
+			_, err = w.client.PushItems(context.Background(), &gospiderpb.PushItemsRequest{
+				Worker: w.ID,
+				Items:  [][]byte{data},
+			})
+		}
+		if err != nil {
+			w.s.writeLog(ctx, LogError, "coordinator push item error", "error", err, "spider", w.s.Name, "context", ctx.String())
+		}
+		return i
+	})
+}
+
+// crawlTaskOf 将TaskSubmission转换为gRPC消息，Meta中无法转换的值被忽略
+func crawlTaskOf(sub *TaskSubmission) *gospiderpb.CrawlTask {
+	ct := &gospiderpb.CrawlTask{
+		Method:   sub.Method,
+		Url:      sub.URL,
+		Body:     sub.Body,
+		Handlers: sub.Handlers,
+		Depth:    int32(sub.Depth),
+		Render:   sub.Render,
+	}
+	if !sub.NotBefore.IsZero() {
+		ct.NotBefore = sub.NotBefore.UnixNano()
+	}
+	if len(sub.Header) > 0 {
+		ct.Header = map[string]*gospiderpb.HeaderValues{}
+		for k, v := range sub.Header {
+			ct.Header[k] = &gospiderpb.HeaderValues{Values: v}
+		}
+	}
+	if len(sub.Meta) > 0 {
+		ct.Meta = &structpb.Struct{Fields: map[string]*structpb.Value{}}
+		for k, v := range sub.Meta {
+			if pv, err := structpb.NewValue(v); err == nil {
+				ct.Meta.Fields[k] = pv
+			}
+		}
+	}
+	return ct
+}
+
+// submissionOf 将gRPC消息还原为TaskSubmission
+func submissionOf(ct *gospiderpb.CrawlTask) *TaskSubmission {
+	sub := &TaskSubmission{
+		SerializedRequest: SerializedRequest{
+			Method: ct.Method,
+			URL:    ct.Url,
+			Body:   ct.Body,
+		},
+		Handlers: ct.Handlers,
+		Depth:    int(ct.Depth),
+		Render:   ct.Render,
+	}
+	if ct.NotBefore != 0 {
+		sub.NotBefore = time.Unix(0, ct.NotBefore)
+	}
+	if len(ct.Header) > 0 {
+		sub.Header = map[string][]string{}
+		for k, v := range ct.Header {
+			sub.Header[k] = v.Values
+		}
+	}
+	if ct.Meta != nil {
+		sub.Meta = ct.Meta.AsMap()
+	}
+	return sub
+}
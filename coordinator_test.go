@@ -0,0 +1,210 @@
+package gospider
+
+import (
+	"context"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gotodown/gospider/gospiderpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+	"github.com/zhshch2002/goreq"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCoordinator(t *testing.T) {
+	lock := sync.Mutex{}
+	hits := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		hits[r.URL.Path]++
+		lock.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		for _, p := range []string{"/a", "/b", "/c"} {
+			_, _ = fmt.Fprintf(w, `<a href="http://%s%s">%s</a>`, r.Host, p, p)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewCoordinator()
+	var items []string
+	c.OnItem(func(worker string, item gjson.Result) {
+		lock.Lock()
+		defer lock.Unlock()
+		items = append(items, item.Get("path").String())
+	})
+	assert.NoError(t, c.SeedTask(goreq.Get(ts.URL+"/"), "parse"))
+	assert.NoError(t, c.SeedTask(goreq.Get(ts.URL+"/"), "parse"))
+
+	lis := bufconn.Listen(1024 * 1024)
+	go func() {
+		_ = c.Serve(lis)
+	}()
+	dial := func() *grpc.ClientConn {
+		conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+			return lis.Dial()
+		}))
+		assert.NoError(t, err)
+		return conn
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		s := NewSpider()
+		s.Logging = false
+		var parse Handler
+		parse = func(ctx *Context) {
+			ctx.AddItem(map[string]string{"path": ctx.Req.URL.Path})
+			doc, err := ctx.Resp.HTML()
+			if !assert.NoError(t, err) {
+				return
+			}
+			doc.Find("a").Each(func(i int, sel *goquery.Selection) {
+				ctx.AddTask(goreq.Get(sel.AttrOr("href", "")), parse)
+			})
+		}
+		s.RegisterHandler("parse", parse)
+		conn := dial()
+		defer conn.Close()
+		w := NewCoordinatorWorker(s, conn, fmt.Sprintf("w%d", i))
+		w.PollInterval = 10 * time.Millisecond
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, w.Run(context.Background()))
+			s.Wait()
+		}()
+	}
+	wg.Wait()
+
+	st := c.Status()
+	assert.Equal(t, 0, st.Pending)
+	assert.Equal(t, 0, st.Leased)
+	assert.Equal(t, int64(4), st.Finished)
+	assert.Equal(t, []string{"w0", "w1"}, st.Workers)
+	assert.Equal(t, map[string]int{"/": 1, "/a": 1, "/b": 1, "/c": 1}, hits)
+	sort.Strings(items)
+	assert.Equal(t, []string{"/", "/a", "/b", "/c"}, items)
+}
+
+func TestCoordinator_LeaseTimeout(t *testing.T) {
+	c := NewCoordinator()
+	c.LeaseTimeout = 50 * time.Millisecond
+	assert.NoError(t, c.SeedTask(goreq.Get("http://example.com/"), "parse"))
+	ctx := context.Background()
+
+	res, err := c.Lease(ctx, &gospiderpb.LeaseRequest{Worker: "w1", Max: 2})
+	assert.NoError(t, err)
+	if !assert.Len(t, res.Leases, 1) {
+		return
+	}
+	assert.False(t, res.Done)
+	first := res.Leases[0]
+	assert.Equal(t, "http://example.com/", first.Task.Url)
+	assert.Equal(t, []string{"parse"}, first.Task.Handlers)
+
+	hb, err := c.Heartbeat(ctx, &gospiderpb.HeartbeatRequest{Worker: "w1", LeaseIds: []string{first.Id}})
+	assert.NoError(t, err)
+	assert.Empty(t, hb.LostLeaseIds)
+
+	time.Sleep(100 * time.Millisecond)
+	res, err = c.Lease(ctx, &gospiderpb.LeaseRequest{Worker: "w2", Max: 1})
+	assert.NoError(t, err)
+	if !assert.Len(t, res.Leases, 1) {
+		return
+	}
+	second := res.Leases[0]
+	assert.Equal(t, "http://example.com/", second.Task.Url)
+
+	hb, err = c.Heartbeat(ctx, &gospiderpb.HeartbeatRequest{Worker: "w1", LeaseIds: []string{first.Id}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{first.Id}, hb.LostLeaseIds)
+	_, err = c.Complete(ctx, &gospiderpb.CompleteRequest{Worker: "w1", LeaseId: first.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = c.Complete(ctx, &gospiderpb.CompleteRequest{Worker: "w2", LeaseId: second.Id, Discovered: []*gospiderpb.CrawlTask{
+		{Method: http.MethodGet, Url: "http://example.com/", Handlers: []string{"parse"}},
+	}})
+	assert.NoError(t, err)
+	res, err = c.Lease(ctx, &gospiderpb.LeaseRequest{Worker: "w2", Max: 1})
+	assert.NoError(t, err)
+	assert.Empty(t, res.Leases)
+	assert.True(t, res.Done)
+	assert.Equal(t, int64(1), c.Status().Finished)
+}
+
+func TestCoordinatorWorker_ConcurrencyLimit(t *testing.T) {
+	lock := sync.Mutex{}
+	running, maxRunning := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		lock.Lock()
+		running--
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	c := NewCoordinator()
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, c.SeedTask(goreq.Get(fmt.Sprintf("%s/%d", ts.URL, i)), "parse"))
+	}
+	lis := bufconn.Listen(1024 * 1024)
+	go func() {
+		_ = c.Serve(lis)
+	}()
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	s := NewSpider(WithConcurrencyLimit(1))
+	s.Logging = false
+	s.RegisterHandler("parse", func(ctx *Context) {})
+	w := NewCoordinatorWorker(s, conn, "w0")
+	w.PollInterval = 10 * time.Millisecond
+	assert.NoError(t, w.Run(context.Background()))
+	s.Wait()
+
+	assert.Equal(t, int64(4), c.Status().Finished)
+	assert.Equal(t, 1, maxRunning)
+	assert.Equal(t, int64(4), s.Status.Snapshot().FinishedTask)
+}
+
+func TestCrawlTaskOf(t *testing.T) {
+	sub := &TaskSubmission{
+		SerializedRequest: SerializedRequest{Method: "POST", URL: "http://example.com/a", Body: []byte("k=v")},
+		Meta:              map[string]interface{}{"k": "v"},
+		Handlers:          []string{"parse"},
+		Depth:             3,
+		NotBefore:         time.Unix(0, 1600000000123456789),
+		Render:            true,
+	}
+	data, err := proto.Marshal(crawlTaskOf(sub))
+	if !assert.NoError(t, err) {
+		return
+	}
+	ct := &gospiderpb.CrawlTask{}
+	if !assert.NoError(t, proto.Unmarshal(data, ct)) {
+		return
+	}
+	assert.Equal(t, sub, submissionOf(ct))
+}
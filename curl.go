@@ -0,0 +1,97 @@
+package gospider
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zhshch2002/goreq"
+)
+
+// CurlCommand 返回与req等价的curl命令，包括方法、请求头、由gospider的扩展(代理池、会话、Tor等)设置的代理和请求体
+// cookie jar中的cookie不在请求头中，不会包含在命令里
+func CurlCommand(req *goreq.Request) string {
+	if req == nil || req.Request == nil {
+		return ""
+	}
+	parts := []string{"curl"}
+	if req.Method != "" && req.Method != http.MethodGet {
+		parts = append(parts, "-X", shellQuote(req.Method))
+	}
+	parts = append(parts, shellQuote(req.URL.String()))
+	if req.Host != "" && req.Host != req.URL.Host {
+		parts = append(parts, "-H", shellQuote("Host: "+req.Host))
+	}
+	keys := make([]string, 0, len(req.Header))
+	for k := range req.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range req.Header[k] {
+			parts = append(parts, "-H", shellQuote(k+": "+v))
+		}
+	}
+	if proxy, ok := req.Context().Value(proxyKey{}).(string); ok && proxy != "" {
+		parts = append(parts, "--proxy", shellQuote(proxy))
+	}
+	if req.GetBody != nil {
+		if rc, err := req.GetBody(); err == nil {
+			body, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err == nil && len(body) > 0 {
+				parts = append(parts, "--data-binary", shellQuote(string(body)))
+			}
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// shellQuote 按POSIX shell的规则引用s；含不可打印字符时使用bash的$'...'形式
+func shellQuote(s string) string {
+	printable := utf8.ValidString(s)
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f {
+			printable = false
+			break
+		}
+	}
+	if printable {
+		return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+	}
+	b := &strings.Builder{}
+	b.WriteString("$'")
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\'' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteString("'")
+	return b.String()
+}
+
+// AsCurl 返回与当前请求等价的curl命令，见CurlCommand
+func (c *Context) AsCurl() string {
+	return CurlCommand(c.Req)
+}
+
+// WithCurlOnError 请求或响应出错时在日志中输出等价的curl命令(见Context.AsCurl)，便于在爬虫外复现
+func WithCurlOnError() Extension {
+	return func(s *Spider) {
+		logCurl := func(ctx *Context, err error) {
+			s.writeLog(ctx, LogWarn, "failed request as curl", "error", err, "spider", s.Name, "curl", ctx.AsCurl())
+		}
+		s.OnReqError(logCurl)
+		s.OnRespError(logCurl)
+	}
+}
@@ -0,0 +1,48 @@
+package gospider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCurlCommand(t *testing.T) {
+	req := goreq.Post("http://example.com/a?q=1").
+		AddHeader("X-B", "it's").
+		AddHeader("Accept", "text/html").
+		SetRawBody([]byte(`{"a":1}`))
+	setProxy(req, "http://127.0.0.1:8080")
+	assert.Equal(t, `curl -X 'POST' 'http://example.com/a?q=1' -H 'Accept: text/html' -H 'X-B: it'\''s' --proxy 'http://127.0.0.1:8080' --data-binary '{"a":1}'`, CurlCommand(req))
+
+	req = goreq.Get("http://example.com/")
+	req.Host = "other.example.com"
+	assert.Equal(t, `curl 'http://example.com/' -H 'Host: other.example.com'`, CurlCommand(req))
+
+	assert.Equal(t, `$'a\x00\'b'`, shellQuote("a\x00'b"))
+	assert.Equal(t, "", CurlCommand(nil))
+}
+
+func TestWithCurlOnError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	l := &testLogger{}
+	s := NewSpider(WithSynchronousMode(), WithHTTPStatusErrors(), WithCurlOnError())
+	s.SetLogger(l)
+	s.SeedTask(goreq.Get(ts.URL+"/fail").AddHeader("X-Token", "t"))
+	s.SeedTask(goreq.Get(ts.URL + "/other"))
+	s.Wait()
+
+	var curls []interface{}
+	for _, r := range l.records {
+		if r.Msg == "failed request as curl" {
+			curls = append(curls, r.Keyvals[5])
+		}
+	}
+	assert.Len(t, curls, 2)
+	assert.Contains(t, curls, `curl '`+ts.URL+`/fail' -H 'X-Token: t'`)
+}
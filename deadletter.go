@@ -0,0 +1,297 @@
+package gospider
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoDeadLetterQueue 未设置死信队列
+	ErrNoDeadLetterQueue = errors.New("dead letter queue not set")
+)
+
+// DeadLetterKind 死信类型
+type DeadLetterKind string
+
+const (
+	DeadLetterTask DeadLetterKind = "task" // 请求或响应最终失败的任务
+	DeadLetterItem DeadLetterKind = "item" // OnItem处理时panic的Item
+)
+
+// DeadLetter 死信，记录最终失败的任务或Item，以及错误和上下文
+type DeadLetter struct {
+	Kind   DeadLetterKind         `json:"kind"`
+	Spider string                 `json:"spider"`
+	Error  string                 `json:"error"`
+	Time   time.Time              `json:"time"`
+	Req    *SerializedRequest     `json:"req,omitempty"`
+	Meta   map[string]interface{} `json:"meta,omitempty"`
+	Item   interface{}            `json:"item,omitempty"`
+	// ItemType Item的类型用RegisterItemType注册的名字，重放时按名字还原类型
+	ItemType string `json:"item_type,omitempty"`
+}
+
+// DeadLetterQueue 死信队列的存储后端
+type DeadLetterQueue interface {
+	// Push 写入一条死信
+	Push(l *DeadLetter) error
+	// Drain 取出并清空队列中的所有死信
+	Drain() ([]*DeadLetter, error)
+}
+
+// MemoryDeadLetterQueue 内存中的死信队列
+type MemoryDeadLetterQueue struct {
+	lock    sync.Mutex
+	letters []*DeadLetter
+}
+
+// NewMemoryDeadLetterQueue 创建内存死信队列
+func NewMemoryDeadLetterQueue() *MemoryDeadLetterQueue {
+	return &MemoryDeadLetterQueue{}
+}
+
+// Push 写入一条死信
+func (q *MemoryDeadLetterQueue) Push(l *DeadLetter) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.letters = append(q.letters, l)
+	return nil
+}
+
+// Drain 取出并清空队列中的所有死信
+func (q *MemoryDeadLetterQueue) Drain() ([]*DeadLetter, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	res := q.letters
+	q.letters = nil
+	return res, nil
+}
+
+// Len 队列中死信的数量
+func (q *MemoryDeadLetterQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.letters)
+}
+
+// FileDeadLetterQueue 以JSON Lines格式保存在文件中的死信队列
+type FileDeadLetterQueue struct {
+	Path string
+	lock sync.Mutex
+}
+
+// NewFileDeadLetterQueue 创建文件死信队列，文件不存在时会在写入时创建
+func NewFileDeadLetterQueue(path string) *FileDeadLetterQueue {
+	return &FileDeadLetterQueue{Path: path}
+}
+
+// Push 追加一条死信到文件末尾
+// Meta或Item中无法编码为JSON的值(如函数、channel)以fmt的%v格式保存为字符串，不丢弃死信
+func (q *FileDeadLetterQueue) Push(l *DeadLetter) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		c := *l
+		if c.Meta != nil {
+			c.Meta = make(map[string]interface{}, len(l.Meta))
+			for k, v := range l.Meta {
+				c.Meta[k] = jsonOrString(v)
+			}
+		}
+		c.Item = jsonOrString(l.Item)
+		if data, err = json.Marshal(&c); err != nil {
+			return err
+		}
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	f, err := os.OpenFile(q.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Drain 读取文件中的所有死信并清空文件
+func (q *FileDeadLetterQueue) Drain() ([]*DeadLetter, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	f, err := os.Open(q.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var res []*DeadLetter
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 64*1024*1024)
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		l := &DeadLetter{}
+		if err := json.Unmarshal(sc.Bytes(), l); err != nil {
+			f.Close()
+			return nil, err
+		}
+		res = append(res, l)
+	}
+	f.Close()
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return res, os.Truncate(q.Path, 0)
+}
+
+// jsonOrString 无法编码为JSON的值转换为%v格式的字符串
+func jsonOrString(v interface{}) interface{} {
+	if _, err := json.Marshal(v); err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return v
+}
+
+// WithDeadLetterQueue 死信队列
+// 请求或响应最终失败(如goreq.WithRetry重试耗尽)的任务，以及OnItem处理中panic的Item，
+// 会连同错误和上下文写入q，之后可以用Spider.ReplayDeadLetters重新注入
+func WithDeadLetterQueue(q DeadLetterQueue) Extension {
+	return func(s *Spider) {
+		s.deadLetters = q
+		s.OnReqError(func(ctx *Context, err error) {
+			s.pushDeadLetter(DeadLetterTask, ctx, nil, err)
+		})
+		s.OnRespError(func(ctx *Context, err error) {
+			s.pushDeadLetter(DeadLetterTask, ctx, nil, err)
+		})
+	}
+}
+
+func (s *Spider) pushDeadLetter(kind DeadLetterKind, ctx *Context, item interface{}, err error) {
+	if s.deadLetters == nil {
+		return
+	}
+	l := &DeadLetter{
+		Kind:   kind,
+		Spider: s.Name,
+		Error:  err.Error(),
+		Time:   time.Now(),
+		Meta:   ctx.Meta,
+		Item:   item,
+	}
+	if item != nil {
+		l.ItemType = s.itemTypeName(reflect.TypeOf(item))
+	}
+	if ctx.Req != nil {
+		l.Req = SerializeRequest(ctx.Req)
+	}
+	if e := s.deadLetters.Push(l); e != nil {
+		s.writeLog(ctx, LogError, "push dead letter error", "error", e, "spider", s.Name, "context", ctx.String())
+	}
+}
+
+// RegisterItemType 以name注册Item的类型，sample为该类型的值(如Product{}或&Product{})
+// 死信队列记录已注册类型的名字，从FileDeadLetterQueue等序列化的队列重放时将Item还原为该类型
+func (s *Spider) RegisterItemType(name string, sample interface{}) {
+	s.handlerLock.Lock()
+	defer s.handlerLock.Unlock()
+	if s.itemTypes == nil {
+		s.itemTypes = map[string]reflect.Type{}
+	}
+	s.itemTypes[name] = reflect.TypeOf(sample)
+}
+
+func (s *Spider) itemTypeName(t reflect.Type) string {
+	s.handlerLock.RLock()
+	defer s.handlerLock.RUnlock()
+	for name, it := range s.itemTypes {
+		if it == t {
+			return name
+		}
+	}
+	return ""
+}
+
+// decodeItem 将重放的Item还原为注册的类型，类型未注册时原样返回
+func (s *Spider) decodeItem(l *DeadLetter) (interface{}, error) {
+	if l.ItemType == "" {
+		return l.Item, nil
+	}
+	s.handlerLock.RLock()
+	t, ok := s.itemTypes[l.ItemType]
+	s.handlerLock.RUnlock()
+	if !ok || reflect.TypeOf(l.Item) == t {
+		return l.Item, nil
+	}
+	data, err := json.Marshal(l.Item)
+	if err != nil {
+		return nil, err
+	}
+	if t.Kind() == reflect.Ptr {
+		v := reflect.New(t.Elem())
+		if err := json.Unmarshal(data, v.Interface()); err != nil {
+			return nil, err
+		}
+		return v.Interface(), nil
+	}
+	v := reflect.New(t)
+	if err := json.Unmarshal(data, v.Interface()); err != nil {
+		return nil, err
+	}
+	return v.Elem().Interface(), nil
+}
+
+// ReplayDeadLetters 取出死信队列中的所有死信并重新注入爬虫，返回注入的数量
+// 任务类型的死信以h作为处理方法重新加入任务(不再经过OnTask)，Item类型的死信重新进入OnItem流程
+// 从序列化的队列(如FileDeadLetterQueue)重放时，Item的类型用RegisterItemType注册后才能还原，
+// 否则为JSON解码的结果(如map[string]interface{})，只接收特定类型的OnItem不会处理；无法还原的Item记录日志后跳过
+func (s *Spider) ReplayDeadLetters(h ...Handler) (int, error) {
+	if s.deadLetters == nil {
+		return 0, ErrNoDeadLetterQueue
+	}
+	letters, err := s.deadLetters.Drain()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, l := range letters {
+		meta := l.Meta
+		if meta == nil {
+			meta = map[string]interface{}{}
+		}
+		switch l.Kind {
+		case DeadLetterTask:
+			if l.Req == nil {
+				continue
+			}
+			s.addTask(NewTask(l.Req.Request(), meta, h...))
+		case DeadLetterItem:
+			data, err := s.decodeItem(l)
+			if err != nil {
+				s.writeLog(nil, LogError, "replay dead letter error", "error", err, "spider", s.Name, "item_type", l.ItemType)
+				continue
+			}
+			ctx := &Context{
+				s:    s,
+				Meta: meta,
+			}
+			if l.Req != nil {
+				ctx.Req = l.Req.Request()
+			}
+			s.addItem(&Item{
+				Ctx:  ctx,
+				Data: data,
+			})
+		default:
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
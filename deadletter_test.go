@@ -0,0 +1,123 @@
+package gospider
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWithDeadLetterQueue(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+
+	q := NewMemoryDeadLetterQueue()
+	s := NewSpider(WithDeadLetterQueue(q))
+	s.Logging = false
+	items := int64(0)
+	s.OnItem(func(ctx *Context, i interface{}) interface{} {
+		if i == "bad" {
+			panic("bad item")
+		}
+		atomic.AddInt64(&items, 1)
+		return i
+	})
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		ctx.AddItem("bad")
+	})
+	s.SeedTask(goreq.Get("htps://127.0.0.1/"))
+	s.Wait()
+	assert.Equal(t, 2, q.Len())
+
+	got := int64(0)
+	n, err := s.ReplayDeadLetters(func(ctx *Context) {
+		atomic.AddInt64(&got, 1)
+	})
+	s.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, int64(0), got) // the task fails again
+	assert.Equal(t, 2, q.Len())    // and so does the item
+}
+
+func TestFileDeadLetterQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gospider")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	q := NewFileDeadLetterQueue(filepath.Join(dir, "dlq.jsonl"))
+	req := SerializeRequest(goreq.Post("http://127.0.0.1/a").SetRawBody([]byte("body")).AddHeader("X-Test", "1"))
+	assert.NoError(t, q.Push(&DeadLetter{Kind: DeadLetterTask, Error: "e", Req: req}))
+	assert.NoError(t, q.Push(&DeadLetter{Kind: DeadLetterItem, Error: "e", Item: "data"}))
+	assert.NoError(t, q.Push(&DeadLetter{Kind: DeadLetterTask, Error: "e", Req: req, Meta: map[string]interface{}{
+		"k":  "v",
+		"ch": make(chan int),
+	}}))
+
+	letters, err := q.Drain()
+	assert.NoError(t, err)
+	assert.Len(t, letters, 3)
+	assert.Equal(t, req, letters[0].Req)
+	assert.Equal(t, "1", letters[0].Req.Request().Header.Get("X-Test"))
+	assert.Equal(t, "data", letters[1].Item)
+	assert.Equal(t, "v", letters[2].Meta["k"])
+	assert.IsType(t, "", letters[2].Meta["ch"])
+
+	letters, err = q.Drain()
+	assert.NoError(t, err)
+	assert.Len(t, letters, 0)
+}
+
+type dlqProduct struct {
+	Name  string
+	Price float64
+}
+
+func TestReplayDeadLetters_ItemType(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "gospider")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	q := NewFileDeadLetterQueue(filepath.Join(dir, "dlq.jsonl"))
+	s := NewSpider(WithSynchronousMode(), WithDeadLetterQueue(q))
+	s.Logging = false
+	s.RegisterItemType("product", &dlqProduct{})
+	fail := true
+	var got []*dlqProduct
+	var untyped []interface{}
+	s.OnItem(func(ctx *Context, i interface{}) interface{} {
+		if fail {
+			panic("pipeline down")
+		}
+		if p, ok := i.(*dlqProduct); ok {
+			got = append(got, p)
+		} else {
+			untyped = append(untyped, i)
+		}
+		return i
+	})
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		ctx.AddItem(&dlqProduct{Name: "a", Price: 1.5})
+		ctx.AddItem(map[string]interface{}{"name": "b"})
+	})
+	s.Wait()
+
+	fail = false
+	n, err := s.ReplayDeadLetters()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	s.Wait()
+	assert.Equal(t, []*dlqProduct{{Name: "a", Price: 1.5}}, got)
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "b"}}, untyped)
+}
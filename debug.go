@@ -0,0 +1,174 @@
+package gospider
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	debugLock        sync.Mutex
+	debugSpiders     = map[*Spider]int64{} // 调试服务运行中的爬虫 -> 加入的顺序
+	debugSeq         int64
+	debugExpvarsOnce sync.Once
+)
+
+func registerDebugSpider(s *Spider) {
+	debugLock.Lock()
+	defer debugLock.Unlock()
+	debugSeq++
+	debugSpiders[s] = debugSeq
+}
+
+func unregisterDebugSpider(s *Spider) {
+	debugLock.Lock()
+	defer debugLock.Unlock()
+	delete(debugSpiders, s)
+}
+
+// debugVars expvar中输出的各爬虫的状态，与先加入的爬虫重名时名字加上"#2"、"#3"等后缀
+func debugVars() map[string]*debugStatus {
+	debugLock.Lock()
+	spiders := make([]*Spider, 0, len(debugSpiders))
+	for s := range debugSpiders {
+		spiders = append(spiders, s)
+	}
+	sort.Slice(spiders, func(i, j int) bool {
+		return debugSpiders[spiders[i]] < debugSpiders[spiders[j]]
+	})
+	debugLock.Unlock()
+	res := map[string]*debugStatus{}
+	for _, s := range spiders {
+		st := newDebugStatus(s)
+		name := st.Spider
+		for i := 2; res[name] != nil; i++ {
+			name = fmt.Sprintf("%s#%d", st.Spider, i)
+		}
+		res[name] = st
+	}
+	return res
+}
+
+// debugStatus 状态接口和expvar中输出的爬虫状态
+type debugStatus struct {
+	Spider       string `json:"spider"`
+	TotalTask    int64  `json:"total_task"`
+	FinishedTask int64  `json:"finished_task"`
+	TotalItem    int64  `json:"total_item"`
+	ExecSpeed    int64  `json:"exec_speed"`
+
+	Handlers map[string]HandlerStats `json:"handlers,omitempty"` // 各处理方法的执行统计
+}
+
+func newDebugStatus(s *Spider) *debugStatus {
+	ss := s.Status.Snapshot()
+	return &debugStatus{
+		Spider:       s.Name,
+		TotalTask:    ss.TotalTask,
+		FinishedTask: ss.FinishedTask,
+		TotalItem:    ss.TotalItem,
+		ExecSpeed:    int64(ss.ExecRate),
+		Handlers:     ss.Handlers,
+	}
+}
+
+// WithDebugServer 在addr上启动调试用的HTTP服务，Spider.Close时关闭
+// /debug/pprof/ 为pprof性能分析，/debug/vars 为expvar(其中gospider为各爬虫的状态，同名的爬虫加上"#2"等后缀)，
+// /debug/status 为JSON格式的爬虫状态
+func WithDebugServer(addr string) Extension {
+	return func(s *Spider) {
+		s.useExtension(&debugServer{httpService{addr: addr, kind: "debug server", handler: newDebugMux}})
+	}
+}
+
+// debugServer 调试服务，关闭前在expvar中输出爬虫的状态
+type debugServer struct {
+	httpService
+}
+
+// Init 在expvar中加入爬虫并开始服务
+func (d *debugServer) Init(s *Spider) error {
+	if err := d.httpService.Init(s); err != nil {
+		return err
+	}
+	registerDebugSpider(s)
+	return nil
+}
+
+// Close 关闭服务并从expvar中移除爬虫
+func (d *debugServer) Close() error {
+	unregisterDebugSpider(d.s)
+	return d.httpService.Close()
+}
+
+func newDebugMux(s *Spider) http.Handler {
+	debugExpvarsOnce.Do(func() {
+		expvar.Publish("gospider", expvar.Func(func() interface{} {
+			return debugVars()
+		}))
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(newDebugStatus(s))
+	})
+	return mux
+}
+
+// httpServiceShutdown 关闭HTTP服务时等待请求完成的最长时间，超时后直接断开连接
+const httpServiceShutdown = 5 * time.Second
+
+// httpService 加入时开始服务，Close时用Shutdown关闭的HTTP服务
+type httpService struct {
+	s       *Spider
+	addr    string
+	kind    string // 日志中的服务名
+	handler func(s *Spider) http.Handler
+	srv     *http.Server
+	done    chan struct{}
+}
+
+// Init 监听addr并开始服务
+func (h *httpService) Init(s *Spider) error {
+	l, err := net.Listen("tcp", h.addr)
+	if err != nil {
+		return err
+	}
+	h.s = s
+	h.addr = l.Addr().String()
+	h.srv = &http.Server{Handler: h.handler(s)}
+	h.done = make(chan struct{})
+	go func() {
+		defer close(h.done)
+		if err := h.srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			s.writeLog(nil, LogError, h.kind+" error", "error", err, "spider", s.Name, "addr", h.addr)
+		}
+	}()
+	return nil
+}
+
+// Close 等待处理中的请求完成后关闭服务，超时后直接断开连接
+func (h *httpService) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), httpServiceShutdown)
+	defer cancel()
+	err := h.srv.Shutdown(ctx)
+	if err != nil {
+		_ = h.srv.Close()
+	}
+	<-h.done
+	return err
+}
@@ -0,0 +1,82 @@
+package gospider
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugServer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+
+	s := NewSpider()
+	s.Name = "debug"
+	s.Logging = false
+	registerDebugSpider(s)
+	defer unregisterDebugSpider(s)
+	other := NewSpider()
+	other.Name = "debug"
+	registerDebugSpider(other)
+	defer unregisterDebugSpider(other)
+	debug := httptest.NewServer(newDebugMux(s))
+	defer debug.Close()
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		ctx.AddItem("item")
+	})
+	s.Wait()
+
+	j, err := goreq.Get(debug.URL + "/debug/status").Do().JSON()
+	assert.NoError(t, err)
+	assert.Equal(t, "debug", j.Get("spider").String())
+	assert.Equal(t, int64(1), j.Get("total_task").Int())
+	assert.Equal(t, int64(1), j.Get("total_item").Int())
+
+	j, err = goreq.Get(debug.URL + "/debug/vars").Do().JSON()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), j.Get("gospider.debug.total_task").Int())
+	assert.Equal(t, "debug", j.Get(`gospider.debug\#2.spider`).String())
+	assert.Equal(t, int64(0), j.Get(`gospider.debug\#2.total_task`).Int())
+
+	resp, err := goreq.Get(debug.URL + "/debug/pprof/").Do().Resp()
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
+func TestWithDebugServer_Close(t *testing.T) {
+	s := NewSpider(WithSynchronousMode(), WithDebugServer("127.0.0.1:0"))
+	s.Logging = false
+	exts := s.Extensions()
+	if !assert.Len(t, exts, 1) {
+		return
+	}
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	url := "http://" + exts[0].(*debugServer).addr + "/debug/status"
+	resp, err := client.Get(url)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	debugLock.Lock()
+	_, ok := debugSpiders[s]
+	debugLock.Unlock()
+	assert.True(t, ok)
+
+	s.Wait()
+	resp, err = client.Get(url)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+	assert.NoError(t, s.Close())
+	_, err = client.Get(url)
+	assert.Error(t, err)
+	debugLock.Lock()
+	_, ok = debugSpiders[s]
+	debugLock.Unlock()
+	assert.False(t, ok)
+}
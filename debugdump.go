@@ -0,0 +1,64 @@
+package gospider
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// debugDump 将请求和响应报文写入目录，见WithDebugDump
+type debugDump struct {
+	dir  string
+	pred func(ctx *Context) bool
+	seq  uint64
+}
+
+// WithDebugDump 任务执行完(包括处理方法panic或Abort)后，pred返回true时将原始的请求和响应报文(头和响应体)写入dir，
+// 便于离线复现解析失败的页面；pred为nil时写入所有任务。文件名为时间、序号和host，如
+// 20060102-150405.000-1-example.com.request.http 和对应的 .response.http，请求出错时响应文件中为错误信息
+// pred在处理方法之后调用，可以根据处理方法在Meta中留下的标记判断是否需要保存
+func WithDebugDump(dir string, pred func(ctx *Context) bool) Extension {
+	return func(s *Spider) {
+		s.dump = &debugDump{dir: dir, pred: pred}
+	}
+}
+
+// write 保存ctx的请求和响应
+func (d *debugDump) write(s *Spider, ctx *Context) {
+	if d.pred != nil && !d.pred(ctx) {
+		return
+	}
+	if err := os.MkdirAll(d.dir, 0755); err != nil {
+		s.writeLog(ctx, LogError, "debug dump error", "error", err, "spider", s.Name, "dir", d.dir)
+		return
+	}
+	host := strings.NewReplacer(":", "_", "/", "_").Replace(ctx.Req.URL.Host)
+	name := fmt.Sprintf("%s-%d-%s", time.Now().Format("20060102-150405.000"), atomic.AddUint64(&d.seq, 1), host)
+	base := filepath.Join(d.dir, name)
+
+	req, err := warcRequestBlock(ctx.Req)
+	if err != nil {
+		req = []byte(fmt.Sprintf("error: %v\n", err))
+	}
+	var resp []byte
+	if ctx.Resp == nil || ctx.Resp.Err != nil || ctx.Resp.Response == nil {
+		var respErr error = ErrNoResponse
+		if ctx.Resp != nil && ctx.Resp.Err != nil {
+			respErr = ctx.Resp.Err
+		}
+		resp = []byte(fmt.Sprintf("error: %v\n", respErr))
+	} else {
+		resp, _ = warcResponseBlock(ctx.Resp)
+	}
+	for ext, data := range map[string][]byte{".request.http": req, ".response.http": resp} {
+		if err := ioutil.WriteFile(base+ext, data, 0644); err != nil {
+			s.writeLog(ctx, LogError, "debug dump error", "error", err, "spider", s.Name, "path", base+ext)
+			return
+		}
+	}
+	s.writeLog(ctx, LogDebug, "debug dump", "spider", s.Name, "url", ctx.Req.URL.String(), "path", base)
+}
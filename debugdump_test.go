@@ -0,0 +1,63 @@
+package gospider
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestWithDebugDump(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Page", r.URL.Path)
+		_, _ = fmt.Fprintf(w, "body of %s", r.URL.Path)
+	}))
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "gospider-dump")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewSpider(WithSynchronousMode(), WithDebugDump(dir, func(ctx *Context) bool {
+		_, failed := ctx.GetMeta("failed")
+		return failed
+	}))
+	s.Logging = false
+	parse := func(ctx *Context) {
+		if ctx.Req.URL.Path == "/bad" {
+			ctx.SetMeta("failed", true)
+		}
+	}
+	s.SeedTask(goreq.Get(ts.URL+"/good"), parse)
+	s.SeedTask(goreq.Get(ts.URL+"/bad").AddHeader("X-Test", "1"), parse)
+	s.Wait()
+
+	files, err := ioutil.ReadDir(dir)
+	if !assert.NoError(t, err) || !assert.Len(t, files, 2) {
+		return
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	sort.Strings(names)
+	host := strings.Replace(strings.TrimPrefix(ts.URL, "http://"), ":", "_", 1)
+	assert.True(t, strings.HasSuffix(names[0], "-1-"+host+".request.http"))
+	assert.True(t, strings.HasSuffix(names[1], "-1-"+host+".response.http"))
+
+	req, _ := ioutil.ReadFile(filepath.Join(dir, names[0]))
+	assert.Contains(t, string(req), "GET /bad HTTP/1.1\r\n")
+	assert.Contains(t, string(req), "X-Test: 1\r\n")
+	resp, _ := ioutil.ReadFile(filepath.Join(dir, names[1]))
+	assert.Contains(t, string(resp), "200 OK\r\n")
+	assert.Contains(t, string(resp), "X-Page: /bad\r\n")
+	assert.True(t, strings.HasSuffix(string(resp), "body of /bad"))
+}
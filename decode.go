@@ -0,0 +1,100 @@
+package gospider
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// OnXMLDecode 将XML响应(Content-Type包含xml，如SOAP、RSS)解码为newVal返回的值后调用fn，用于SOAP和旧式的XML接口
+// match为元素名(不含命名空间前缀)时，文档中每个该名字的元素分别解码并调用一次fn，match为空时解码整个文档；
+// 解码失败时记录错误日志并跳过该元素
+//
+//	s.OnXMLDecode("item", func() interface{} { return &Item{} }, func(ctx *gospider.Context, v interface{}) {
+//		ctx.AddItem(v.(*Item))
+//	})
+func (s *Spider) OnXMLDecode(match string, newVal func() interface{}, fn func(ctx *Context, v interface{})) HookID {
+	return s.OnResp(func(ctx *Context) {
+		if !isXMLResponse(ctx) {
+			return
+		}
+		d := xml.NewDecoder(bytes.NewReader(ctx.Resp.Body))
+		d.CharsetReader = charset.NewReaderLabel
+		if strings.HasPrefix(mediaType(ctx.Resp.Header.Get("Content-Type")), "text/") {
+			// goreq已按Content-Type将text/*的响应体转换为UTF-8，忽略XML声明中的编码
+			d.CharsetReader = func(label string, r io.Reader) (io.Reader, error) {
+				return r, nil
+			}
+		}
+		if match == "" {
+			v := newVal()
+			if err := d.Decode(v); err != nil {
+				s.writeLog(ctx, LogError, "xml decode error", "error", err, "spider", s.Name, "context", ctx.String())
+				return
+			}
+			fn(ctx, v)
+			return
+		}
+		for !ctx.IsAborted() {
+			tok, err := d.Token()
+			if err != nil {
+				if err != io.EOF {
+					s.writeLog(ctx, LogError, "xml decode error", "error", err, "spider", s.Name, "context", ctx.String())
+				}
+				return
+			}
+			se, ok := tok.(xml.StartElement)
+			if !ok || se.Name.Local != match {
+				continue
+			}
+			v := newVal()
+			if err := d.DecodeElement(v, &se); err != nil {
+				s.writeLog(ctx, LogError, "xml decode error", "error", err, "spider", s.Name, "context", ctx.String(), "element", match)
+				continue
+			}
+			fn(ctx, v)
+		}
+	})
+}
+
+// OnJSONDecode 将JSON响应中path(gjson路径，为空时为整个响应)的值json.Unmarshal为newVal返回的值后调用fn，与OnXMLDecode对应
+// path不存在时不调用；解码失败时记录错误日志
+func (s *Spider) OnJSONDecode(path string, newVal func() interface{}, fn func(ctx *Context, v interface{})) HookID {
+	return s.OnResp(func(ctx *Context) {
+		if !ctx.Resp.IsJSON() {
+			return
+		}
+		raw := ctx.Resp.Body
+		if path != "" {
+			j, err := ctx.JSON()
+			if err != nil {
+				return
+			}
+			res := j.Get(path)
+			if !res.Exists() {
+				return
+			}
+			raw = []byte(res.Raw)
+		}
+		v := newVal()
+		if err := json.Unmarshal(raw, v); err != nil {
+			s.writeLog(ctx, LogError, "json decode error", "error", err, "spider", s.Name, "context", ctx.String())
+			return
+		}
+		fn(ctx, v)
+	})
+}
+
+// isXMLResponse 响应是否是XML，没有Content-Type时检查是否以XML声明开头
+func isXMLResponse(ctx *Context) bool {
+	ct := ctx.Resp.Header.Get("Content-Type")
+	if ct == "" {
+		return bytes.HasPrefix(bytes.TrimSpace(ctx.Resp.Body), []byte("<?xml"))
+	}
+	mt := mediaType(ct)
+	return strings.HasSuffix(mt, "/xml") || strings.HasSuffix(mt, "+xml")
+}
@@ -0,0 +1,63 @@
+package gospider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type decodeBook struct {
+	ID    int    `xml:"id,attr" json:"id"`
+	Title string `xml:"title" json:"title"`
+}
+
+func TestSpider_OnXMLDecode(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/soap":
+			w.Header().Set("Content-Type", "application/soap+xml; charset=utf-8")
+			w.Write([]byte(`<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope"><soap:Body>
+<m:books xmlns:m="urn:books"><m:book id="1"><m:title>Go</m:title></m:book><m:book id="2"><m:title>XML</m:title></m:book></m:books>
+</soap:Body></soap:Envelope>`))
+		case "/gbk":
+			w.Header().Set("Content-Type", "application/xml")
+			// "书"的GBK编码
+			w.Write([]byte("<?xml version=\"1.0\" encoding=\"gbk\"?><book id=\"3\"><title>\xca\xe9</title></book>"))
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"data":{"books":[{"id":4,"title":"JSON"}]}}`))
+		}
+	}))
+	defer ts.Close()
+
+	s := NewSpider(WithSynchronousMode())
+	s.Logging = false
+	var books []decodeBook
+	add := func(ctx *Context, v interface{}) {
+		books = append(books, *v.(*decodeBook))
+	}
+	s.OnXMLDecode("book", func() interface{} { return &decodeBook{} }, add)
+	var whole []string
+	s.OnXMLDecode("", func() interface{} { return &decodeBook{} }, func(ctx *Context, v interface{}) {
+		whole = append(whole, v.(*decodeBook).Title)
+	})
+	var list []decodeBook
+	s.OnJSONDecode("data.books", func() interface{} { return &[]decodeBook{} }, func(ctx *Context, v interface{}) {
+		list = append(list, *v.(*[]decodeBook)...)
+	})
+	s.OnJSONDecode("missing", func() interface{} { return &[]decodeBook{} }, func(ctx *Context, v interface{}) {
+		t.Error("missing path decoded")
+	})
+	for _, p := range []string{"/soap", "/gbk", "/json"} {
+		s.SeedTask(goreq.Get(ts.URL + p))
+	}
+	s.Wait()
+
+	assert.Equal(t, []decodeBook{{1, "Go"}, {2, "XML"}, {3, "书"}}, books)
+	// decodeBook没有XMLName，SOAP文档的根元素也会解码(没有匹配的字段)
+	assert.Equal(t, []string{"", "书"}, whole)
+	assert.Equal(t, []decodeBook{{4, "JSON"}}, list)
+}
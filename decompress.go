@@ -0,0 +1,179 @@
+package gospider
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+var (
+	// ErrDecompressionBomb 解压后的响应超过WithDecompressionLimit的限制，具体信息见DecompressionError
+	ErrDecompressionBomb = errors.New("decompression bomb")
+)
+
+// DecompressionError 解压后的响应超过限制时的错误，errors.Is(err, ErrDecompressionBomb)和errors.Is(err, ErrBodyTooLarge)为true
+type DecompressionError struct {
+	Encoding     string // Content-Encoding
+	Compressed   int64  // 已读取的压缩数据的字节数
+	Decompressed int64  // 已解压的字节数
+}
+
+func (e *DecompressionError) Error() string {
+	return fmt.Sprintf("%v: %s response expanded from %d to more than %d bytes", ErrDecompressionBomb, e.Encoding, e.Compressed, e.Decompressed)
+}
+
+// Unwrap 返回ErrDecompressionBomb
+func (e *DecompressionError) Unwrap() error {
+	return ErrDecompressionBomb
+}
+
+// Is 解压后的响应属于ErrBodyTooLarge
+func (e *DecompressionError) Is(target error) bool {
+	return target == ErrBodyTooLarge
+}
+
+// inflateRatioFloor 解压后的大小超过此值才检查压缩比，避免小而高度重复的正常页面被误判
+const inflateRatioFloor = 1 << 20
+
+// inflateLimit 解压的限制，见WithDecompressionLimit
+type inflateLimit struct {
+	maxSize  int64   // 解压后的大小上限，0不限制
+	maxRatio float64 // 解压后与压缩数据的大小比例上限，0不限制
+}
+
+// WithDecompressionLimit 限制gzip、deflate和brotli响应解压后的大小，防止很小的恶意响应在内存中解压为几个GB
+// 解压后超过maxSize字节，或超过1MB后与已读取的压缩数据之比超过maxRatio时停止读取，请求以*DecompressionError失败(见OnRespError)；0为不限制
+// 使用Spider自定义的transport(见WithTLSFingerprint等)，由gospider声明Accept-Encoding并解压，请求已设置Accept-Encoding时不处理
+func WithDecompressionLimit(maxSize int64, maxRatio float64) Extension {
+	return func(s *Spider) {
+		s.inflate = &inflateLimit{maxSize: maxSize, maxRatio: maxRatio}
+		t := s.transport
+		if t == nil {
+			t = newHTTPTransport()
+		}
+		s.useTransport(t)
+	}
+}
+
+// inflateTransport 声明支持压缩并在限制内解压响应
+type inflateTransport struct {
+	next  http.RoundTripper
+	limit *inflateLimit
+}
+
+func (it *inflateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept-Encoding") != "" || req.Header.Get("Range") != "" {
+		return it.next.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+	resp, err := it.next.RoundTrip(req)
+	if err != nil || req.Method == http.MethodHead {
+		return resp, err
+	}
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding != "gzip" && encoding != "deflate" && encoding != "br" {
+		return resp, nil
+	}
+	resp.Body = &inflateReader{
+		raw:      resp.Body,
+		counter:  &countReader{r: resp.Body},
+		encoding: encoding,
+		limit:    it.limit,
+	}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// countReader 记录读取的字节数
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// inflateReader 第一次读取时创建解压器，解压后的数据超过限制时返回*DecompressionError
+type inflateReader struct {
+	raw      io.ReadCloser
+	counter  *countReader
+	encoding string
+	limit    *inflateLimit
+
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (ir *inflateReader) init() error {
+	switch ir.encoding {
+	case "gzip":
+		r, err := gzip.NewReader(ir.counter)
+		if err != nil {
+			return err
+		}
+		ir.r = r
+	case "deflate":
+		// 按标准应为zlib格式，部分服务器发送的是没有zlib头的原始deflate数据
+		br := bufio.NewReader(ir.counter)
+		if h, err := br.Peek(2); err == nil && h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0 {
+			r, err := zlib.NewReader(br)
+			if err != nil {
+				return err
+			}
+			ir.r = r
+		} else {
+			ir.r = flate.NewReader(br)
+		}
+	case "br":
+		ir.r = brotli.NewReader(ir.counter)
+	}
+	return nil
+}
+
+func (ir *inflateReader) Read(p []byte) (int, error) {
+	if ir.err != nil {
+		return 0, ir.err
+	}
+	if ir.r == nil {
+		if ir.err = ir.init(); ir.err != nil {
+			return 0, ir.err
+		}
+	}
+	n, err := ir.r.Read(p)
+	ir.n += int64(n)
+	if ir.exceeded() {
+		ir.err = &DecompressionError{Encoding: ir.encoding, Compressed: ir.counter.n, Decompressed: ir.n}
+		return 0, ir.err
+	}
+	return n, err
+}
+
+func (ir *inflateReader) exceeded() bool {
+	if ir.limit.maxSize > 0 && ir.n > ir.limit.maxSize {
+		return true
+	}
+	return ir.limit.maxRatio > 0 && ir.n > inflateRatioFloor && float64(ir.n) > ir.limit.maxRatio*float64(ir.counter.n)
+}
+
+func (ir *inflateReader) Close() error {
+	if c, ok := ir.r.(io.Closer); ok {
+		c.Close()
+	}
+	return ir.raw.Close()
+}
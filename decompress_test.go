@@ -0,0 +1,95 @@
+package gospider
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithDecompressionLimit(t *testing.T) {
+	compress := func(encoding string, data []byte) []byte {
+		buf := &bytes.Buffer{}
+		var w interface {
+			Write([]byte) (int, error)
+			Close() error
+		}
+		switch encoding {
+		case "gzip":
+			w = gzip.NewWriter(buf)
+		case "deflate":
+			w, _ = flate.NewWriter(buf, flate.BestCompression)
+		case "br":
+			w = brotli.NewWriter(buf)
+		}
+		w.Write(data)
+		w.Close()
+		return buf.Bytes()
+	}
+	page := []byte(strings.Repeat("<p>hello</p>", 100))
+	random := make([]byte, 2<<20)
+	rand.Read(random)
+	bodies := map[string][]byte{
+		"/gzip":    compress("gzip", page),
+		"/deflate": compress("deflate", page),
+		"/br":      compress("br", page),
+		"/bomb":    compress("gzip", make([]byte, 8<<20)),
+		"/random":  compress("gzip", random),
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "gzip, deflate, br", r.Header.Get("Accept-Encoding"))
+		encoding := strings.TrimPrefix(r.URL.Path, "/")
+		if encoding == "bomb" || encoding == "random" {
+			encoding = "gzip"
+		}
+		if r.URL.Path == "/random" {
+			w.Header().Set("Content-Type", "application/octet-stream")
+		} else {
+			w.Header().Set("Content-Type", "text/html")
+		}
+		w.Header().Set("Content-Encoding", encoding)
+		w.Write(bodies[r.URL.Path])
+	}))
+	defer ts.Close()
+
+	run := func(limit Extension, path string) (body []byte, err error) {
+		s := NewSpider(WithSynchronousMode(), limit)
+		s.Logging = false
+		s.OnRespError(func(ctx *Context, e error) {
+			err = e
+		})
+		s.SeedTask(goreq.Get(ts.URL+path), func(ctx *Context) {
+			body = ctx.Resp.Body
+		})
+		s.Wait()
+		return
+	}
+
+	for _, p := range []string{"/gzip", "/deflate", "/br"} {
+		body, err := run(WithDecompressionLimit(1<<20, 100), p)
+		assert.NoError(t, err, p)
+		assert.Equal(t, page, body, p)
+	}
+
+	_, err := run(WithDecompressionLimit(1<<20, 0), "/bomb")
+	assert.True(t, errors.Is(err, ErrDecompressionBomb), "%v", err)
+	de := &DecompressionError{}
+	assert.True(t, errors.As(err, &de))
+	assert.Equal(t, "gzip", de.Encoding)
+	assert.Greater(t, de.Decompressed, int64(1<<20))
+
+	_, err = run(WithDecompressionLimit(0, 100), "/bomb")
+	assert.True(t, errors.Is(err, ErrDecompressionBomb), "%v", err)
+
+	body, err := run(WithDecompressionLimit(0, 100), "/random")
+	assert.NoError(t, err)
+	assert.Equal(t, random, body)
+}
@@ -0,0 +1,83 @@
+package gospider
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/zhshch2002/goreq"
+)
+
+// randomDuration 返回[min, max]之间的随机时长
+func randomDuration(min, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	return min + time.Duration(rand.Int63n(int64(max-min)+1))
+}
+
+// sleepContext 等待d，ctx取消时提前返回ctx的错误
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// requestContext 请求的context，Stop时取消(见Spider.Context)
+func requestContext(req *goreq.Request) context.Context {
+	if req.Request == nil {
+		return context.Background()
+	}
+	return req.Context()
+}
+
+// WithRandomDelay 每个请求发出前等待min到max之间的随机时长，避免完全规律的请求间隔触发反爬检测
+// 各请求独立等待，不限制并发；需要同一个host的请求之间保持间隔时使用WithHostRandomDelay
+func WithRandomDelay(min, max time.Duration) Extension {
+	return func(s *Spider) {
+		s.Client.Use(func(c *goreq.Client, next goreq.Handler) goreq.Handler {
+			return func(req *goreq.Request) *goreq.Response {
+				if err := sleepContext(requestContext(req), randomDuration(min, max)); err != nil {
+					return &goreq.Response{Req: req, Err: err}
+				}
+				return next(req)
+			}
+		})
+	}
+}
+
+// WithHostRandomDelay 同一个host(含端口)相邻两个请求的发出时间间隔为min到max之间的随机时长
+func WithHostRandomDelay(min, max time.Duration) Extension {
+	return func(s *Spider) {
+		lock := sync.Mutex{}
+		nextTime := map[string]time.Time{} // host -> 下一个请求最早的发出时间
+		s.Client.Use(func(c *goreq.Client, next goreq.Handler) goreq.Handler {
+			return func(req *goreq.Request) *goreq.Response {
+				if req.Request == nil {
+					return next(req)
+				}
+				now := time.Now()
+				lock.Lock()
+				at := nextTime[req.URL.Host]
+				if at.Before(now) {
+					at = now
+				}
+				nextTime[req.URL.Host] = at.Add(randomDuration(min, max))
+				lock.Unlock()
+				if err := sleepContext(req.Context(), at.Sub(now)); err != nil {
+					return &goreq.Response{Req: req, Err: err}
+				}
+				return next(req)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package gospider
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRandomDuration(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		d := randomDuration(10*time.Millisecond, 20*time.Millisecond)
+		assert.True(t, d >= 10*time.Millisecond && d <= 20*time.Millisecond)
+	}
+	assert.Equal(t, time.Second, randomDuration(time.Second, 0))
+}
+
+func TestWithRandomDelay(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	s := NewSpider(WithRandomDelay(30*time.Millisecond, 40*time.Millisecond))
+	s.Logging = false
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		s.SeedTask(goreq.Get(fmt.Sprintf("%s/%d", ts.URL, i)))
+	}
+	s.Wait()
+	// 请求各自等待，并发执行
+	elapsed := time.Since(start)
+	assert.True(t, elapsed >= 30*time.Millisecond, elapsed)
+	assert.True(t, elapsed < 150*time.Millisecond, elapsed)
+}
+
+func TestWithHostRandomDelay(t *testing.T) {
+	lock := sync.Mutex{}
+	var times []time.Time
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		times = append(times, time.Now())
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	s := NewSpider(WithHostRandomDelay(20*time.Millisecond, 30*time.Millisecond))
+	s.Logging = false
+	for i := 0; i < 5; i++ {
+		s.SeedTask(goreq.Get(fmt.Sprintf("%s/%d", ts.URL, i)))
+	}
+	s.Wait()
+	sort.Slice(times, func(i, j int) bool {
+		return times[i].Before(times[j])
+	})
+	if assert.Len(t, times, 5) {
+		for i := 1; i < len(times); i++ {
+			assert.True(t, times[i].Sub(times[i-1]) >= 15*time.Millisecond, times[i].Sub(times[i-1]))
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package gospider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// 常用的DoH服务，使用IP地址访问，解析DoH服务本身的域名也不会经过本地DNS
+const (
+	DoHCloudflare = "https://1.1.1.1/dns-query"
+	DoHGoogle     = "https://8.8.8.8/dns-query"
+)
+
+// ErrDoHNoAnswer DoH查询没有返回地址
+var ErrDoHNoAnswer = errors.New("doh: no answer")
+
+// dohEntry 解析结果的缓存
+type dohEntry struct {
+	ips    []net.IP
+	expire time.Time
+}
+
+// DoHResolver 通过DNS-over-HTTPS(RFC 8484)解析域名，结果按TTL缓存
+type DoHResolver struct {
+	Endpoint string       // DoH服务地址，如DoHCloudflare
+	Client   *http.Client // 访问DoH服务的客户端，默认不使用代理、超时10s
+
+	lock  sync.Mutex
+	cache map[string]*dohEntry
+}
+
+// NewDoHResolver 创建使用endpoint的解析器
+func NewDoHResolver(endpoint string) *DoHResolver {
+	return &DoHResolver{
+		Endpoint: endpoint,
+		Client:   &http.Client{Timeout: 10 * time.Second},
+		cache:    map[string]*dohEntry{},
+	}
+}
+
+// LookupIP 解析host的IPv4和IPv6地址，IPv4在前
+func (r *DoHResolver) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	r.lock.Lock()
+	if e, ok := r.cache[host]; ok && time.Now().Before(e.expire) {
+		r.lock.Unlock()
+		return e.ips, nil
+	}
+	r.lock.Unlock()
+
+	var ips []net.IP
+	var ttl uint32
+	var lastErr error
+	for _, typ := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		res, t, err := r.query(ctx, host, typ)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		ips = append(ips, res...)
+		if len(res) > 0 && (ttl == 0 || t < ttl) {
+			ttl = t
+		}
+	}
+	if len(ips) == 0 {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, fmt.Errorf("%w: %s", ErrDoHNoAnswer, host)
+	}
+	r.lock.Lock()
+	r.cache[host] = &dohEntry{ips: ips, expire: time.Now().Add(time.Duration(ttl) * time.Second)}
+	r.lock.Unlock()
+	return ips, nil
+}
+
+// query 发送一个DoH查询，返回地址和最小的TTL
+func (r *DoHResolver) query(ctx context.Context, host string, typ dnsmessage.Type) ([]net.IP, uint32, error) {
+	name, err := dnsmessage.NewName(host + ".")
+	if err != nil {
+		return nil, 0, err
+	}
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: typ, Class: dnsmessage.ClassINET}},
+	}
+	body, err := msg.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, r.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("doh: %s returned %s", r.Endpoint, resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := msg.Unpack(data); err != nil {
+		return nil, 0, err
+	}
+	if msg.RCode != dnsmessage.RCodeSuccess {
+		return nil, 0, fmt.Errorf("doh: %s: %s", host, msg.RCode)
+	}
+	var ips []net.IP
+	var ttl uint32
+	for _, a := range msg.Answers {
+		var ip net.IP
+		switch b := a.Body.(type) {
+		case *dnsmessage.AResource:
+			ip = net.IP(b.A[:])
+		case *dnsmessage.AAAAResource:
+			ip = net.IP(b.AAAA[:])
+		default:
+			continue
+		}
+		ips = append(ips, ip)
+		if ttl == 0 || a.Header.TTL < ttl {
+			ttl = a.Header.TTL
+		}
+	}
+	return ips, ttl, nil
+}
+
+// WithDoH 通过DoH服务endpoint解析域名，如DoHCloudflare、DoHGoogle或自建的服务
+func WithDoH(endpoint string) Extension {
+	return WithDoHResolver(NewDoHResolver(endpoint))
+}
+
+// WithDoHResolver 使用r解析请求的域名，依次尝试解析到的地址建立连接
+// 适合本地DNS不可靠、被污染或不希望DNS查询泄露的情况；使用代理时解析的是代理的域名
+func WithDoHResolver(r *DoHResolver) Extension {
+	return func(s *Spider) {
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}
+		s.httpTransport().DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, port, err := net.SplitHostPort(addr)
+			if err != nil || net.ParseIP(host) != nil {
+				return dialer.DialContext(ctx, network, addr)
+			}
+			ips, err := r.LookupIP(ctx, host)
+			if err != nil {
+				return nil, err
+			}
+			for _, ip := range ips {
+				var conn net.Conn
+				conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+				if err == nil {
+					return conn, nil
+				}
+			}
+			return nil, err
+		}
+	}
+}
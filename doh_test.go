@@ -0,0 +1,63 @@
+package gospider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"golang.org/x/net/dns/dnsmessage"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestDoHServer 将example.test解析到127.0.0.1的DoH服务
+func newTestDoHServer(t *testing.T, queries *int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(queries, 1)
+		data, _ := ioutil.ReadAll(r.Body)
+		var msg dnsmessage.Message
+		if !assert.NoError(t, msg.Unpack(data)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		q := msg.Questions[0]
+		msg.Header.Response = true
+		if q.Name.String() == "example.test." && q.Type == dnsmessage.TypeA {
+			msg.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: q.Class, TTL: 60},
+				Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+			}}
+		}
+		res, _ := msg.Pack()
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(res)
+	}))
+}
+
+func TestWithDoH(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host))
+	}))
+	defer ts.Close()
+	var queries int64
+	doh := newTestDoHServer(t, &queries)
+	defer doh.Close()
+
+	s := NewSpider(WithDoH(doh.URL))
+	s.Logging = false
+	u := strings.Replace(ts.URL, "127.0.0.1", "example.test", 1)
+	for i := 0; i < 2; i++ {
+		resp, err := s.Client.Do(goreq.Get(u)).Resp()
+		if assert.NoError(t, err) {
+			assert.True(t, strings.HasPrefix(resp.Text, "example.test:"))
+		}
+		s.httpTransport().CloseIdleConnections()
+	}
+	// A和AAAA各查询一次，之后使用缓存
+	assert.Equal(t, int64(2), atomic.LoadInt64(&queries))
+
+	_, err := s.Client.Do(goreq.Get("http://missing.test/")).Resp()
+	assert.Error(t, err)
+}
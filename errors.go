@@ -0,0 +1,115 @@
+package gospider
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+var (
+	// ErrTimeout 请求超时，包括连接、TLS握手、读取响应超时和context超时
+	ErrTimeout = errors.New("timeout")
+	// ErrDNS 域名解析失败
+	ErrDNS = errors.New("dns error")
+	// ErrTLS TLS握手或证书验证失败
+	ErrTLS = errors.New("tls error")
+	// ErrBodyTooLarge 响应体超过限制，如WithDecompressionLimit
+	ErrBodyTooLarge = errors.New("body too large")
+)
+
+// FetchError OnReqError、OnRespError收到的可以分类的错误，errors.Is(err, ErrTimeout)等判断分类，
+// errors.As可以取得原始的错误(如*net.DNSError、*url.Error)
+type FetchError struct {
+	Class error // ErrTimeout、ErrDNS、ErrTLS或ErrBodyTooLarge
+	Err   error // 原始的错误
+}
+
+func (e *FetchError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap 返回原始的错误
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Is 与Class比较
+func (e *FetchError) Is(target error) bool {
+	return target == e.Class
+}
+
+// ErrHTTPStatus 响应的状态码表示失败，使用WithHTTPStatusErrors时交给OnRespError，用errors.As取得状态码
+type ErrHTTPStatus struct {
+	Code   int
+	Status string // 如"404 Not Found"
+	URL    string
+}
+
+func (e *ErrHTTPStatus) Error() string {
+	return fmt.Sprintf("http status %s: %s", e.Status, e.URL)
+}
+
+// ClassifyError 判断请求错误的分类，返回ErrTimeout、ErrDNS、ErrTLS、ErrBodyTooLarge之一，无法分类时返回nil
+func ClassifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, ErrBodyTooLarge) {
+		return ErrBodyTooLarge
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ErrDNS
+	}
+	var timeout interface{ Timeout() bool }
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &timeout) && timeout.Timeout() {
+		return ErrTimeout
+	}
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		header           tls.RecordHeaderError
+	)
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) || errors.As(err, &header) ||
+		strings.Contains(err.Error(), "tls: ") { // 握手失败的alert没有导出的类型
+		return ErrTLS
+	}
+	return nil
+}
+
+// classifyError 可以分类的错误包装为FetchError，否则原样返回
+func classifyError(err error) error {
+	if c := ClassifyError(err); c != nil {
+		var fe *FetchError
+		if errors.As(err, &fe) {
+			return err
+		}
+		return &FetchError{Class: c, Err: err}
+	}
+	return err
+}
+
+// WithHTTPStatusErrors 响应的状态码在codes中时(codes为空时为400及以上)，作为ErrHTTPStatus交给OnRespError，
+// 不再执行OnResp和任务的处理方法；在重试(Retry-After)、反爬和验证码检测之后判断
+func WithHTTPStatusErrors(codes ...int) Extension {
+	return func(s *Spider) {
+		if len(codes) == 0 {
+			s.errStatus = func(code int) bool {
+				return code >= 400
+			}
+			return
+		}
+		set := map[int]bool{}
+		for _, c := range codes {
+			set[c] = true
+		}
+		s.errStatus = func(code int) bool {
+			return set[code]
+		}
+	}
+}
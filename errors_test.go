@@ -0,0 +1,95 @@
+package gospider
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer ts.Close()
+	_, err := (&http.Client{Timeout: 10 * time.Millisecond}).Get(ts.URL)
+	assert.Equal(t, ErrTimeout, ClassifyError(err))
+
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsServer.Close()
+	_, err = http.Get(tlsServer.URL)
+	assert.Equal(t, ErrTLS, ClassifyError(err))
+
+	dnsErr := fmt.Errorf("dial: %w", &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true})
+	assert.Equal(t, ErrDNS, ClassifyError(dnsErr))
+	assert.Equal(t, ErrBodyTooLarge, ClassifyError(&DecompressionError{Encoding: "gzip"}))
+	assert.Nil(t, ClassifyError(errors.New("other")))
+	assert.Nil(t, ClassifyError(nil))
+
+	err = classifyError(dnsErr)
+	assert.True(t, errors.Is(err, ErrDNS))
+	var de *net.DNSError
+	assert.True(t, errors.As(err, &de))
+	assert.Equal(t, "example.invalid", de.Name)
+	assert.Equal(t, dnsErr.Error(), err.Error())
+}
+
+func TestSpider_OnRespErrorClass(t *testing.T) {
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsServer.Close()
+
+	s := NewSpider(WithSynchronousMode())
+	s.Logging = false
+	var errs []error
+	s.OnRespError(func(ctx *Context, err error) {
+		errs = append(errs, err)
+	})
+	s.SeedTask(goreq.Get(tlsServer.URL))
+	s.Wait()
+	if assert.Len(t, errs, 1) {
+		assert.True(t, errors.Is(errs[0], ErrTLS))
+		var fe *FetchError
+		assert.True(t, errors.As(errs[0], &fe))
+	}
+}
+
+func TestWithHTTPStatusErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/gone":
+			w.WriteHeader(http.StatusGone)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer ts.Close()
+
+	s := NewSpider(WithSynchronousMode(), WithHTTPStatusErrors(http.StatusNotFound))
+	s.Logging = false
+	var codes []int
+	s.OnRespError(func(ctx *Context, err error) {
+		var se *ErrHTTPStatus
+		if assert.True(t, errors.As(err, &se)) {
+			codes = append(codes, se.Code)
+			assert.Equal(t, ts.URL+"/missing", se.URL)
+		}
+	})
+	var handled []string
+	s.OnResp(func(ctx *Context) {
+		handled = append(handled, ctx.Req.URL.Path)
+	})
+	s.SeedTask(goreq.Get(ts.URL + "/missing"))
+	s.SeedTask(goreq.Get(ts.URL + "/gone"))
+	s.SeedTask(goreq.Get(ts.URL + "/"))
+	s.Wait()
+	assert.Equal(t, []int{http.StatusNotFound}, codes)
+	assert.Equal(t, []string{"/gone", "/"}, handled)
+	assert.Equal(t, int64(1), s.Status.RespErrors)
+}
@@ -0,0 +1,36 @@
+package gospider
+
+import (
+	"context"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+	"github.com/tidwall/gjson"
+)
+
+// Eval 在渲染后的页面中执行js表达式，返回值按JSON解析，如ctx.Eval("window.__INITIAL_STATE__")
+// 表达式的值为Promise时等待其完成；只能在ChromeRenderer渲染的任务的处理方法中调用
+func (c *Context) Eval(js string) (gjson.Result, error) {
+	p := renderedPageOf(c.Req)
+	if p == nil {
+		return gjson.Result{}, ErrNotRendered
+	}
+	ctx, cancel := context.WithTimeout(p.ctx, pageTimeout)
+	defer cancel()
+	var res []byte
+	err := chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		v, exp, err := runtime.Evaluate(js).WithReturnByValue(true).WithAwaitPromise(true).Do(ctx)
+		if err != nil {
+			return err
+		}
+		if exp != nil {
+			return exp
+		}
+		res = v.Value
+		return nil
+	}))
+	if err != nil {
+		return gjson.Result{}, err
+	}
+	return gjson.ParseBytes(res), nil
+}
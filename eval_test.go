@@ -0,0 +1,57 @@
+package gospider
+
+import (
+	"github.com/chromedp/chromedp"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContext_Eval_NotRendered(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	s := NewSpider()
+	s.Logging = false
+	var evalErr error
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		_, evalErr = ctx.Eval("1+1")
+	})
+	s.Wait()
+	assert.Equal(t, ErrNotRendered, evalErr)
+}
+
+func TestContext_Eval(t *testing.T) {
+	path := testChromePath(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<html><script>window.__INITIAL_STATE__ = {"user": {"name": "gospider"}, "items": [1, 2, 3]}</script></html>`))
+	}))
+	defer ts.Close()
+
+	r := NewChromeRenderer(1, chromedp.ExecPath(path), chromedp.NoSandbox)
+	defer r.Close()
+	s := NewSpider(WithRender(r, `.*`))
+	s.Logging = false
+	var state, promise gjson.Result
+	var errs []error
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		var err error
+		state, err = ctx.Eval("window.__INITIAL_STATE__")
+		errs = append(errs, err)
+		promise, err = ctx.Eval("Promise.resolve(42)")
+		errs = append(errs, err)
+		_, err = ctx.Eval("undefinedVariable.foo")
+		errs = append(errs, err)
+	})
+	s.Wait()
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.Error(t, errs[2])
+	assert.Equal(t, "gospider", state.Get("user.name").String())
+	assert.Equal(t, int64(3), state.Get("items.#").Int())
+	assert.Equal(t, int64(42), promise.Int())
+}
@@ -1,14 +1,17 @@
 package gospider
 
 import (
-	"context"
+	"bufio"
+	"bytes"
 	"crypto/md5"
-	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/slyrz/robots"
@@ -16,27 +19,41 @@ import (
 )
 
 // WithDeduplicate 删除重复数据
-// Hash标签去重
+// Hash标签去重，请求的指纹默认为GetRequestHash，可以用WithRequestFingerprint自定义；Monitor的重复访问不去重
 func WithDeduplicate() Extension {
 	return func(s *Spider) {
-		CrawledHash := map[[md5.Size]byte]struct{}{}
-		lock := sync.Mutex{}
+		s.dedup = &dedupSet{seen: map[[md5.Size]byte]struct{}{}}
 		s.OnTask(func(ctx *Context, t *Task) *Task {
-			has := GetRequestHash(t.Req)
-			lock.Lock()
-			defer lock.Unlock()
-			// 当CrawledHash中有 has时， 返回nil，
-			if _, ok := CrawledHash[has]; ok {
-				return nil
+			if t.noDedup {
+				return t
+			}
+			// 请求已经加入过时返回nil，否则记录这个请求
+			if !s.dedup.add(s.RequestFingerprint(t.Req)) {
+				return t.Skip(SkipDuplicate)
 			}
-			// 否则， 将has值作为键， 记录这个请求
-			CrawledHash[has] = struct{}{}
 			return t
 		})
 	}
 
 }
 
+// dedupSet WithDeduplicate记录的请求hash，可以通过Checkpoint保存
+type dedupSet struct {
+	lock sync.Mutex
+	seen map[[md5.Size]byte]struct{}
+}
+
+// add 记录h，已经存在时返回false
+func (d *dedupSet) add(h [md5.Size]byte) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, ok := d.seen[h]; ok {
+		return false
+	}
+	d.seen[h] = struct{}{}
+	return true
+}
+
 // WithRobotsTxt 遵守Robots协议
 func WithRobotsTxt(ua string) Extension {
 	return func(s *Spider) {
@@ -55,7 +72,7 @@ func WithRobotsTxt(ua string) Extension {
 			}
 			if r != nil {
 				if !r.Allow(t.Req.URL.Path) {
-					return nil
+					return t.Skip(SkipRobots)
 				}
 			}
 			return t
@@ -63,63 +80,152 @@ func WithRobotsTxt(ua string) Extension {
 	}
 }
 
-// WithDepthLimit 爬取深度限制
-func WithDepthLimit(max int) Extension {
+// WithAllowedDomains 只加入指定域名及其子域名下的任务，如"example.com"允许"www.example.com"
+func WithAllowedDomains(domains ...string) Extension {
 	return func(s *Spider) {
 		s.OnTask(func(ctx *Context, t *Task) *Task {
-			// 当前请求为空或 当前请求上下文中记录的字段"depth" 为空时设置value的值为1
-			if ctx.Req == nil || ctx.Req.Context().Value("depth") == nil {
-				t.Req.Request = t.Req.WithContext(context.WithValue(t.Req.Context(), "depth", 1))
+			if t.Req.Request == nil {
 				return t
 			}
-			// 否则， 获取上下文中的"depth"值，
-			depth := ctx.Req.Context().Value("depth").(int)
-			// 判断 depth的值是否小于max
-			if depth < max {
-				// 当depth小于max值时，将depth +1，并保存
-				t.Req.Request = t.Req.WithContext(context.WithValue(t.Req.Context(), "depth", depth+1))
-				return t
+			host := strings.ToLower(t.Req.URL.Hostname())
+			for _, d := range domains {
+				d = strings.ToLower(d)
+				if host == d || strings.HasSuffix(host, "."+d) {
+					return t
+				}
 			}
-			// 否则， 返回空， 即爬取深度已达到最大值
-			return nil
+			return t.Skip(SkipDomain)
+		})
+	}
+}
 
+// WithDepthLimit 爬取深度限制，丢弃深度(见Task.Depth)达到max的任务，即max为1时只爬取种子任务，为2时爬取种子任务和其中加入的任务
+func WithDepthLimit(max int) Extension {
+	return func(s *Spider) {
+		s.OnTask(func(ctx *Context, t *Task) *Task {
+			if t.Depth >= max {
+				return t.Skip(SkipDepth)
+			}
+			return t
 		})
 	}
 }
 
-// WithMaxReqLimit 记录在内存中，进行同步
-func WithMaxReqLimit(max int64) Extension {
+// WithMaxReqLimit 最多加入max个任务，之后的任务被丢弃(原因为SkipLimit，数量见Status.SkippedTasks)
+// 第max个任务加入时依次调用onReached，只调用一次；并发加入任务时同样精确
+// 需要在达到限制后停止爬虫时在onReached中调用Spider.GracefulStop，不会中止正在进行的请求
+func WithMaxReqLimit(max int64, onReached ...func(s *Spider)) Extension {
 	return func(s *Spider) {
 		count := int64(0)
 		s.OnTask(func(ctx *Context, t *Task) *Task {
-			if count < max {
-				atomic.AddInt64(&count, 1)
-				return t
+			c := atomic.AddInt64(&count, 1)
+			if c > max {
+				return t.Skip(SkipLimit)
+			}
+			if c == max {
+				s.writeLog(nil, LogInfo, "max requests reached", "spider", s.Name, "requests", max)
+				for _, fn := range onReached {
+					fn(s)
+				}
+			}
+			return t
+		})
+	}
+}
+
+// WithMaxDuration 爬取时间预算，从第一个任务加入开始计时，超过d后停止爬虫(见Spider.GracefulStop)
+// 正在进行的请求、处理和Item会完成，尚未执行的任务被放弃，放弃的数量在Wait返回时输出
+func WithMaxDuration(d time.Duration) Extension {
+	return func(s *Spider) {
+		once := sync.Once{}
+		s.OnTask(func(ctx *Context, t *Task) *Task {
+			once.Do(func() {
+				time.AfterFunc(d, func() {
+					s.writeLog(nil, LogInfo, "max duration reached", "spider", s.Name, "duration", d)
+					s.GracefulStop()
+				})
+			})
+			return t
+		})
+	}
+}
+
+// ErrMaxBytesExceeded 超过WithMaxBytes的流量预算后发起的请求返回的错误
+var ErrMaxBytesExceeded = errors.New("max bytes exceeded")
+
+// WithMaxBytes 流量预算，累计的响应体大小超过n字节后停止爬虫(见Spider.GracefulStop)
+// 之后不再发起新的请求(返回ErrMaxBytesExceeded)，适用于按流量计费的出口或代理
+func WithMaxBytes(n int64) Extension {
+	return func(s *Spider) {
+		total := int64(0)
+		s.Client.Use(func(c *goreq.Client, next goreq.Handler) goreq.Handler {
+			return func(req *goreq.Request) *goreq.Response {
+				if atomic.LoadInt64(&total) >= n {
+					return &goreq.Response{Req: req, Err: ErrMaxBytesExceeded}
+				}
+				resp := next(req)
+				if resp != nil && resp.Err == nil {
+					if atomic.AddInt64(&total, int64(len(resp.Body))) >= n {
+						s.writeLog(nil, LogInfo, "max bytes reached", "spider", s.Name, "bytes", n)
+						s.GracefulStop()
+					}
+				}
+				return resp
 			}
-			return nil
 		})
 	}
 }
 
-// WithErrorLog 打印errorlog
+// WithMaxItems 最多产出n个Item，达到n个后停止爬虫(见Spider.GracefulStop)并调用onReached(可以为nil)
+// 超出的Item会被丢弃，不再进入之后注册的OnItem
+func WithMaxItems(n int64, onReached func(s *Spider)) Extension {
+	return func(s *Spider) {
+		count := int64(0)
+		s.OnItem(func(ctx *Context, i interface{}) interface{} {
+			c := atomic.AddInt64(&count, 1)
+			if c > n {
+				return nil
+			}
+			if c == n {
+				s.writeLog(nil, LogInfo, "max items reached", "spider", s.Name, "items", n)
+				s.GracefulStop()
+				if onReached != nil {
+					onReached(s)
+				}
+			}
+			return i
+		})
+	}
+}
+
+// WithErrorLog 将错误Item、处理方法的panic、请求和响应错误以JSON写入f，每行一条
+// 每条记录包含type(item、OnRecover、OnReqError、OnRespError)、错误、URL、状态码、调用栈，
+// 以及序列化的任务task(见TaskSubmission，处理方法未注册时不含handlers)，修复解析后可以用ReplayErrors只重新执行失败的请求
 func WithErrorLog(f io.Writer) Extension {
 	return func(s *Spider) {
+		lock := sync.Mutex{}
 		l := zerolog.New(f).With().Timestamp().Logger()
 		send := func(ctx *Context, err error, t, stack string) {
+			lock.Lock()
+			defer lock.Unlock()
 			event := l.Err(err).
 				Str("spider", s.Name).
-				Str("type", "item").
-				Str("ctx", fmt.Sprint(ctx)).
-				Str("url", ctx.Req.URL.String()).
-				AnErr("req err", ctx.Req.Err).
-				AnErr("resp err", ctx.Resp.Err)
+				Str("type", t).
+				Str("ctx", fmt.Sprint(ctx))
+			if ctx.Req != nil {
+				event.Str("url", ctx.Req.URL.String()).AnErr("req_err", ctx.Req.Err)
+				event.Interface("task", s.errorLogTask(ctx))
+			}
 			if ctx.Resp != nil {
-				event.Int("resp code", ctx.Resp.StatusCode)
+				event.AnErr("resp_err", ctx.Resp.Err)
+				if ctx.Resp.Response != nil {
+					event.Int("resp_code", ctx.Resp.StatusCode)
+				}
 				if ctx.Resp.Text != "" {
 					event.Str("text", ctx.Resp.Text)
 				}
 			}
-			event.Str("stack", SprintStack()).Send()
+			event.Str("stack", stack).Send()
 		}
 
 		s.OnItem(func(ctx *Context, i interface{}) interface{} {
@@ -140,25 +246,119 @@ func WithErrorLog(f io.Writer) Extension {
 	}
 }
 
+// errorLogTask 错误记录中的任务，处理方法未注册时只包含请求和Meta
+func (s *Spider) errorLogTask(ctx *Context) *TaskSubmission {
+	if ctx.task != nil {
+		if sub, err := s.SerializeTask(ctx.task); err == nil {
+			return sub
+		}
+	}
+	return &TaskSubmission{
+		SerializedRequest: *SerializeRequest(ctx.Req),
+		Meta:              ctx.Meta,
+		Depth:             ctx.Depth(),
+	}
+}
+
+// errorLogRecord WithErrorLog写入的记录中ReplayErrors使用的字段
+type errorLogRecord struct {
+	Type string          `json:"type"`
+	Task *TaskSubmission `json:"task"`
+}
+
+// ReplayErrors 读取WithErrorLog写入的记录，将其中失败的任务重新加入爬虫(不经过OnTask，因此不会被去重丢弃)，返回加入的任务数
+// 同一个请求(按RequestFingerprint)的多条记录只加入一次；记录中没有处理方法的任务以h作为处理方法，
+// 无法解析或还原的记录被跳过并记录日志
+func (s *Spider) ReplayErrors(r io.Reader, h ...Handler) (int, error) {
+	seen := map[[md5.Size]byte]bool{}
+	n := 0
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		rec := &errorLogRecord{}
+		if err := json.Unmarshal(line, rec); err != nil {
+			s.writeLog(nil, LogWarn, "replay skip error record", "error", err, "spider", s.Name)
+			continue
+		}
+		if rec.Task == nil {
+			continue
+		}
+		t, err := s.DeserializeTask(rec.Task)
+		if err != nil {
+			s.writeLog(nil, LogWarn, "replay skip error record", "error", err, "spider", s.Name, "url", rec.Task.URL)
+			continue
+		}
+		key := s.RequestFingerprint(t.Req)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if len(t.Handlers) == 0 {
+			t.Handlers = h
+		}
+		t.NotBefore = time.Time{}
+		s.addTask(t)
+		n++
+	}
+	return n, sc.Err()
+}
+
 // CsvItem Csv格式的数据
 type CsvItem []string
 
-// WithCsvItemSaver 将以csv格式保存
+// WithCsvItemSaver 将CsvItem以csv格式保存，见CsvPipeline
 func WithCsvItemSaver(f io.Writer) Extension {
-	lock := sync.Mutex{}
-	w := csv.NewWriter(f)
+	return WithPipeline(NewCsvPipeline(f))
+}
+
+// WithJSONLinesItemSaver 将Item编码为JSON，每行一个，见JSONLinesPipeline
+func WithJSONLinesItemSaver(f io.Writer) Extension {
+	return WithPipeline(NewJSONLinesPipeline(f))
+}
+
+// WithStatusReport 每隔interval将爬虫状态的快照交给sink处理，sink为nil时打印状态日志，Spider.Close时停止
+func WithStatusReport(interval time.Duration, sink func(ss StatusSnapshot)) Extension {
 	return func(s *Spider) {
-		s.OnItem(func(ctx *Context, i interface{}) interface{} {
-			if data, ok := i.(CsvItem); ok {
-				lock.Lock()
-				defer lock.Unlock()
-				err := w.Write(data)
-				if err != nil {
-					log.Err(err).Msg("WithCsvItemSaver Error")
-				}
-				w.Flush()
-			}
-			return i
-		})
+		s.useExtension(&statusReporter{interval: interval, sink: sink})
 	}
 }
+
+// statusReporter 定期报告爬虫状态
+type statusReporter struct {
+	interval time.Duration
+	sink     func(ss StatusSnapshot)
+	stop     chan struct{}
+}
+
+// Init 开始报告
+func (r *statusReporter) Init(s *Spider) error {
+	if r.sink == nil {
+		r.sink = func(ss StatusSnapshot) {
+			printStatusLine(s.logger, s.Name, ss)
+		}
+	}
+	r.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+			}
+			r.sink(s.Status.Snapshot())
+		}
+	}()
+	return nil
+}
+
+// Close 停止报告
+func (r *statusReporter) Close() error {
+	close(r.stop)
+	return nil
+}
@@ -2,12 +2,18 @@ package gospider
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/zhshch2002/goreq"
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestWithDeduplicate(t *testing.T) {
@@ -46,46 +52,251 @@ func TestWithRobotsTxt(t *testing.T) {
 }
 
 func TestWithDepthLimit(t *testing.T) {
-	s := NewSpider(WithDepthLimit(2))
-	s.SeedTask(goreq.Get("https://httpbin.org/get"), func(ctx *Context) {
-		ctx.Println("Depth", ctx.Req.Context().Value("depth")) // 1
-		ctx.AddTask(goreq.Get("https://httpbin.org/get"), func(ctx *Context) {
-			ctx.Println("Depth", ctx.Req.Context().Value("depth")) // 2
-			ctx.AddTask(goreq.Get("https://httpbin.org/get"), func(ctx *Context) {
-				ctx.Println("Depth", ctx.Req.Context().Value("depth")) // 3
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	s := NewSpider(WithSynchronousMode(), WithDepthLimit(2))
+	s.Logging = false
+	var depths []int
+	s.SeedTask(goreq.Get(ts.URL+"/0"), func(ctx *Context) {
+		depths = append(depths, ctx.Depth()) // 0
+		// 处理方法中新建的请求同样按当前任务计算深度
+		ctx.AddTask(goreq.Get(ts.URL+"/1"), func(ctx *Context) {
+			depths = append(depths, ctx.Depth()) // 1
+			ctx.AddTask(goreq.Get(ts.URL+"/2"), func(ctx *Context) {
 				t.Error("Limiter error")
 			})
 		})
 	})
 	s.Wait()
+	assert.Equal(t, []int{0, 1}, depths)
+	assert.Equal(t, map[SkipReason]int64{SkipDepth: 1}, s.Status.SkippedTasks())
 }
 
 func TestWithMaxReqLimit(t *testing.T) {
-	s := NewSpider(WithMaxReqLimit(2))
-	count := 0
-	s.SeedTask(goreq.Get("https://httpbin.org/get"), func(ctx *Context) {
-		count += 1
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	reached := int32(0)
+	s := NewSpider(WithMaxReqLimit(5, func(s *Spider) {
+		atomic.AddInt32(&reached, 1)
+	}))
+	s.Logging = false
+	count := int32(0)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+				atomic.AddInt32(&count, 1)
+			})
+		}()
+	}
+	wg.Wait()
+	s.Wait()
+	assert.Equal(t, int32(5), count)
+	assert.Equal(t, int32(1), reached)
+	assert.Equal(t, int64(15), s.Status.SkippedTasks()[SkipLimit])
+
+	s = NewSpider(WithSynchronousMode(), WithMaxReqLimit(2))
+	s.Logging = false
+	count = 0
+	for i := 0; i < 3; i++ {
+		s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+			count++
+		})
+	}
+	s.Wait()
+	assert.Equal(t, int32(2), count)
+}
+
+func TestWithMaxDuration(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+
+	s := NewSpider(WithMaxDuration(300 * time.Millisecond))
+	s.Logging = false
+	var handled int64
+	var h Handler
+	h = func(ctx *Context) {
+		atomic.AddInt64(&handled, 1)
+		ctx.AddTaskAfter(100*time.Millisecond, goreq.Get(ts.URL), h)
+	}
+	start := time.Now()
+	s.SeedTask(goreq.Get(ts.URL), h)
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		ctx.AddTaskAfter(time.Hour, goreq.Get(ts.URL))
 	})
-	s.SeedTask(goreq.Get("https://httpbin.org/get"), func(ctx *Context) {
-		count += 1
+	s.Wait()
+
+	assert.True(t, s.IsStopped())
+	assert.True(t, time.Since(start) < time.Second)
+	n := atomic.LoadInt64(&handled)
+	assert.True(t, n >= 2 && n <= 5, n)
+	assert.Equal(t, int64(2), s.Status.AbandonedTask)
+	assert.Equal(t, int64(0), s.Status.Snapshot().PendingTask)
+
+	s.SeedTask(goreq.Get(ts.URL), h)
+	s.Wait()
+	assert.Equal(t, n, atomic.LoadInt64(&handled))
+	assert.Equal(t, int64(3), s.Status.AbandonedTask)
+}
+
+func TestWithMaxDuration_InFlight(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+
+	s := NewSpider(WithMaxDuration(50 * time.Millisecond))
+	s.Logging = false
+	var handled, respErrors int32
+	s.OnRespError(func(ctx *Context, err error) {
+		atomic.AddInt32(&respErrors, 1)
 	})
-	s.SeedTask(goreq.Get("https://httpbin.org/get"), func(ctx *Context) {
-		count += 1
+	for i := 0; i < 3; i++ {
+		s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+			atomic.AddInt32(&handled, 1)
+		})
+	}
+	s.Wait()
+
+	assert.True(t, s.IsStopped())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&handled))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&respErrors))
+	assert.Equal(t, int64(0), s.Status.AbandonedTask)
+	assert.NoError(t, s.Context().Err())
+}
+
+func TestWithMaxBytes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "0123456789")
+	}))
+	defer ts.Close()
+
+	s := NewSpider(WithMaxBytes(25))
+	s.Logging = false
+	var handled int64
+	var h Handler
+	h = func(ctx *Context) {
+		atomic.AddInt64(&handled, 1)
+		ctx.AddTask(goreq.Get(ts.URL), h)
+	}
+	s.SeedTask(goreq.Get(ts.URL), h)
+	s.Wait()
+
+	assert.True(t, s.IsStopped())
+	assert.Equal(t, int64(3), atomic.LoadInt64(&handled))
+	assert.Equal(t, int64(30), s.Status.BytesDownloaded)
+
+	_, err := s.Client.Do(goreq.Get(ts.URL)).Resp()
+	assert.Equal(t, ErrMaxBytesExceeded, err)
+}
+
+func TestWithMaxItems(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+
+	var reached, saved int64
+	s := NewSpider(WithMaxItems(10, func(s *Spider) {
+		atomic.AddInt64(&reached, 1)
+	}))
+	s.Logging = false
+	s.OnItem(func(ctx *Context, i interface{}) interface{} {
+		atomic.AddInt64(&saved, 1)
+		return i
 	})
+	var h Handler
+	h = func(ctx *Context) {
+		for i := 0; i < 3; i++ {
+			ctx.AddItem(i)
+		}
+		ctx.AddTask(goreq.Get(ts.URL), h)
+	}
+	s.SeedTask(goreq.Get(ts.URL), h)
 	s.Wait()
-	assert.Equal(t, 2, count)
+
+	assert.True(t, s.IsStopped())
+	assert.Equal(t, int64(1), atomic.LoadInt64(&reached))
+	assert.Equal(t, int64(10), atomic.LoadInt64(&saved))
 }
 
 func TestWithErrorLog(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
 	buf := bytes.NewBuffer([]byte{})
-	s := NewSpider(WithErrorLog(buf))
-	s.SeedTask(goreq.Get("https://httpbin.org/get"), func(ctx *Context) {
+	s := NewSpider(WithSynchronousMode(), WithErrorLog(buf), WithHTTPStatusErrors())
+	s.Logging = false
+	s.RegisterHandler("parse", func(ctx *Context) {
 		ctx.AddItem(errors.New("test item error"))
 		panic("test panic error")
 	})
+	parse, _ := s.GetHandler("parse")
+	s.SeedTask(goreq.Get(ts.URL+"/a"), parse)
+	s.SeedTask(goreq.Get("http://127.0.0.1:1/b"))
 	s.Wait()
-	fmt.Println(buf.String())
-	assert.True(t, buf.Len() > 0)
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		r := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &r))
+		records = append(records, r)
+	}
+	if !assert.Len(t, records, 3) {
+		return
+	}
+	assert.Equal(t, "item", records[0]["type"])
+	assert.Equal(t, "test item error", records[0]["error"])
+	assert.Equal(t, "OnRecover", records[1]["type"])
+	assert.Equal(t, ts.URL+"/a", records[1]["url"])
+	assert.Equal(t, []interface{}{"parse"}, records[1]["task"].(map[string]interface{})["handlers"])
+	assert.Equal(t, "OnRespError", records[2]["type"])
+	assert.Equal(t, "http://127.0.0.1:1/b", records[2]["task"].(map[string]interface{})["url"])
+}
+
+func TestSpider_ReplayErrors(t *testing.T) {
+	var fixed int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" && atomic.LoadInt32(&fixed) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	buf := bytes.NewBuffer([]byte{})
+	broken := true
+	s := NewSpider(WithSynchronousMode(), WithErrorLog(buf), WithHTTPStatusErrors(), WithDeduplicate())
+	s.Logging = false
+	var parsed []string
+	s.RegisterHandler("parse", func(ctx *Context) {
+		if broken && ctx.Req.URL.Path == "/bad" {
+			ctx.AddItem(errors.New("parse failed"))
+			panic("parse failed")
+		}
+		parsed = append(parsed, ctx.Req.URL.Path)
+	})
+	parse, _ := s.GetHandler("parse")
+	for _, p := range []string{"/ok", "/bad", "/down"} {
+		s.SeedTask(goreq.Get(ts.URL+p), parse)
+	}
+	s.Wait()
+	assert.Equal(t, []string{"/ok"}, parsed)
+
+	// 修复解析和服务后只重新执行失败的请求
+	broken = false
+	atomic.StoreInt32(&fixed, 1)
+	n, err := s.ReplayErrors(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	s.Wait()
+	assert.Equal(t, []string{"/ok", "/bad", "/down"}, parsed)
 }
 
 func TestWithCsvItemSaver(t *testing.T) {
@@ -98,3 +309,21 @@ func TestWithCsvItemSaver(t *testing.T) {
 	fmt.Println(buf.String())
 	assert.True(t, buf.Len() > 0)
 }
+
+func TestWithStatusReport(t *testing.T) {
+	c := make(chan StatusSnapshot, 1)
+	s := NewSpider(WithStatusReport(10*time.Millisecond, func(ss StatusSnapshot) {
+		if ss.FinishedTask > 0 {
+			select {
+			case c <- ss:
+			default:
+			}
+		}
+	}))
+	s.Status.AddTask()
+	s.Status.FinishTask()
+	defer s.Status.stop()
+	ss := <-c
+	assert.Equal(t, int64(1), ss.TotalTask)
+	assert.Equal(t, int64(1), ss.FinishedTask)
+}
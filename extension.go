@@ -0,0 +1,130 @@
+package gospider
+
+import (
+	"context"
+	"fmt"
+)
+
+// LifecycleExtension 有状态的扩展(如缓存、数据库连接、指标服务)，与Extension一样传给NewSpider或Use
+// Init在加入时调用，返回错误时记录日志，扩展不会加入(需要处理错误时使用AddExtension)
+// 可以同时实现ExtensionStarter、ExtensionFlusher和ExtensionCloser获得确定的启动、每次Wait结束和关闭时机
+// 扩展在多次Wait之间保持运行，直到Spider.Close或Stop之后的Wait关闭
+type LifecycleExtension interface {
+	Init(s *Spider) error
+}
+
+// ExtensionStarter Start在第一次Wait开始时调用一次(之后加入的扩展在加入时调用)，
+// ctx派生自爬虫的根context(见Context)，Stop时或扩展关闭前取消，扩展启动的goroutine应在ctx取消时退出
+type ExtensionStarter interface {
+	Start(ctx context.Context)
+}
+
+// ExtensionFlusher Flush在每次Wait返回前按加入的相反顺序调用，在ItemPipeline Flush之后，用于输出每次爬取的结果(如报告)
+type ExtensionFlusher interface {
+	Flush() error
+}
+
+// ExtensionCloser Close在Spider.Close或Stop之后的Wait返回前按加入的相反顺序调用，在ItemPipeline关闭之后
+type ExtensionCloser interface {
+	Close() error
+}
+
+// AddExtension 初始化e并加入爬虫，Init出错时不加入，返回错误
+func (s *Spider) AddExtension(e LifecycleExtension) error {
+	if err := e.Init(s); err != nil {
+		return err
+	}
+	s.extLock.Lock()
+	s.exts = append(s.exts, e)
+	ctx := s.extCtx
+	s.extLock.Unlock()
+	if st, ok := e.(ExtensionStarter); ok && ctx != nil {
+		st.Start(ctx)
+	}
+	return nil
+}
+
+// Extensions 加入的LifecycleExtension
+func (s *Spider) Extensions() []LifecycleExtension {
+	s.extLock.Lock()
+	defer s.extLock.Unlock()
+	return append([]LifecycleExtension(nil), s.exts...)
+}
+
+// useExtension Use中加入LifecycleExtension，Init出错时记录日志
+func (s *Spider) useExtension(e LifecycleExtension) {
+	if err := s.AddExtension(e); err != nil {
+		s.writeLog(nil, LogError, "extension init error", "error", err, "spider", s.Name, "extension", fmt.Sprintf("%T", e))
+	}
+}
+
+// startExtensions Wait开始时启动已加入的扩展
+func (s *Spider) startExtensions() {
+	s.extLock.Lock()
+	if s.extCtx != nil {
+		s.extLock.Unlock()
+		return
+	}
+	s.extCtx, s.extCancel = context.WithCancel(s.rootCtx)
+	ctx, exts := s.extCtx, append([]LifecycleExtension(nil), s.exts...)
+	s.extLock.Unlock()
+	for _, e := range exts {
+		if st, ok := e.(ExtensionStarter); ok {
+			st.Start(ctx)
+		}
+	}
+}
+
+// cancelExtensions 取消Start的ctx，Stop时调用
+func (s *Spider) cancelExtensions() {
+	s.extLock.Lock()
+	cancel := s.extCancel
+	s.extLock.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// flushExtensions 按加入的相反顺序Flush所有扩展，返回第一个错误
+func (s *Spider) flushExtensions() error {
+	exts := s.Extensions()
+	var first error
+	for i := len(exts) - 1; i >= 0; i-- {
+		f, ok := exts[i].(ExtensionFlusher)
+		if !ok {
+			continue
+		}
+		if err := f.Flush(); err != nil {
+			s.writeLog(nil, LogError, "extension flush error", "error", err, "spider", s.Name, "extension", fmt.Sprintf("%T", exts[i]))
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// closeExtensions 取消Start的ctx，按加入的相反顺序Close并移除所有扩展，返回第一个错误
+func (s *Spider) closeExtensions() error {
+	s.extLock.Lock()
+	exts, cancel := s.exts, s.extCancel
+	s.exts, s.extCtx, s.extCancel = nil, nil, nil
+	s.extLock.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	var first error
+	for i := len(exts) - 1; i >= 0; i-- {
+		c, ok := exts[i].(ExtensionCloser)
+		if !ok {
+			continue
+		}
+		if err := c.Close(); err != nil {
+			s.writeLog(nil, LogError, "extension close error", "error", err, "spider", s.Name, "extension", fmt.Sprintf("%T", exts[i]))
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
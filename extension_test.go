@@ -0,0 +1,117 @@
+package gospider
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordExtension 记录生命周期方法的调用
+type recordExtension struct {
+	name    string
+	lock    *sync.Mutex
+	calls   *[]string
+	initErr error
+	stopped chan struct{}
+}
+
+func (e *recordExtension) record(call string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	*e.calls = append(*e.calls, e.name+" "+call)
+}
+
+func (e *recordExtension) Init(s *Spider) error {
+	e.record("init")
+	return e.initErr
+}
+
+func (e *recordExtension) Start(ctx context.Context) {
+	e.record("start")
+	e.stopped = make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		close(e.stopped)
+	}()
+}
+
+func (e *recordExtension) Flush() error {
+	e.record("flush")
+	return nil
+}
+
+func (e *recordExtension) Close() error {
+	e.record("close")
+	return nil
+}
+
+func TestLifecycleExtension(t *testing.T) {
+	lock := &sync.Mutex{}
+	calls := []string{}
+	a := &recordExtension{name: "a", lock: lock, calls: &calls}
+	b := &recordExtension{name: "b", lock: lock, calls: &calls}
+	bad := &recordExtension{name: "bad", lock: lock, calls: &calls, initErr: errors.New("init failed")}
+	s := NewSpider(WithSynchronousMode(), a, bad, b)
+	s.Logging = false
+	assert.Equal(t, []LifecycleExtension{a, b}, s.Extensions())
+	assert.Equal(t, []string{"a init", "bad init", "b init"}, calls)
+	assert.Error(t, s.AddExtension(bad))
+
+	s.Wait()
+	s.Wait()
+	assert.Equal(t, []string{"a init", "bad init", "b init", "bad init", "a start", "b start", "b flush", "a flush", "b flush", "a flush"}, calls)
+	assert.Equal(t, []LifecycleExtension{a, b}, s.Extensions())
+	select {
+	case <-a.stopped:
+		t.Fatal("start context canceled by Wait")
+	default:
+	}
+
+	assert.NoError(t, s.Close())
+	assert.Equal(t, []string{"b close", "a close"}, calls[len(calls)-2:])
+	select {
+	case <-a.stopped:
+	case <-time.After(time.Second):
+		t.Fatal("start context not canceled")
+	}
+	assert.Empty(t, s.Extensions())
+}
+
+func TestLifecycleExtension_Stop(t *testing.T) {
+	lock := &sync.Mutex{}
+	calls := []string{}
+	a := &recordExtension{name: "a", lock: lock, calls: &calls}
+	s := NewSpider(WithSynchronousMode(), a)
+	s.Logging = false
+	s.Stop()
+	s.Wait()
+	assert.Equal(t, []string{"a init", "a start", "a flush", "a close"}, calls)
+	assert.Empty(t, s.Extensions())
+}
+
+func TestWithPrometheus_Close(t *testing.T) {
+	s := NewSpider(WithSynchronousMode(), WithPrometheus("127.0.0.1:0"))
+	s.Logging = false
+	exts := s.Extensions()
+	if !assert.Len(t, exts, 1) {
+		return
+	}
+	url := "http://" + exts[0].(*prometheusServer).addr + "/metrics"
+	resp, err := http.Get(url)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	s.Wait()
+	resp, err = http.Get(url)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+	assert.NoError(t, s.Close())
+	_, err = http.Get(url)
+	assert.Error(t, err)
+}
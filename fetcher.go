@@ -0,0 +1,204 @@
+package gospider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/valyala/fasthttp"
+	"github.com/zhshch2002/goreq"
+)
+
+// Fetcher 发送请求并读取完整的响应体，请求错误记录在Response.Err中
+// Spider的中间件(去重、代理、缓存等)仍然生效，Fetcher只替换最终发送请求的部分
+type Fetcher interface {
+	Do(req *goreq.Request) *goreq.Response
+}
+
+// FetcherFunc 将函数作为Fetcher，便于在测试中注入模拟的响应
+type FetcherFunc func(req *goreq.Request) *goreq.Response
+
+// Do 调用f
+func (f FetcherFunc) Do(req *goreq.Request) *goreq.Response {
+	return f(req)
+}
+
+// SetFetcher 设置发送请求的Fetcher，为nil时使用goreq内置的客户端
+func (s *Spider) SetFetcher(f Fetcher) {
+	s.fetcher = f
+}
+
+// Fetcher 当前的Fetcher，使用goreq内置的客户端时为nil
+func (s *Spider) Fetcher() Fetcher {
+	return s.fetcher
+}
+
+// WithFetcher 使用f发送请求
+func WithFetcher(f Fetcher) Extension {
+	return func(s *Spider) {
+		s.SetFetcher(f)
+	}
+}
+
+// SetHostFetcher 指定host(含端口)的请求使用f发送，优先于会话和SetFetcher，f为nil时取消
+func (s *Spider) SetHostFetcher(host string, f Fetcher) {
+	if f == nil {
+		s.hostFetch.Delete(host)
+		return
+	}
+	s.hostFetch.Store(host, f)
+}
+
+// HostFetcher host使用的Fetcher，没有指定时为nil
+func (s *Spider) HostFetcher(host string) Fetcher {
+	if f, ok := s.hostFetch.Load(host); ok {
+		return f.(Fetcher)
+	}
+	return nil
+}
+
+// sentKey 请求context中标记请求已经发送过的键
+type sentKey struct{}
+
+// markSent 标记请求已经发送过，返回之前是否已经标记
+func markSent(req *goreq.Request) bool {
+	if req.Request == nil {
+		return false
+	}
+	if req.Context().Value(sentKey{}) != nil {
+		return true
+	}
+	req.Request = req.WithContext(context.WithValue(req.Context(), sentKey{}, true))
+	return false
+}
+
+// fetcherMiddleware 最内层的中间件，依次使用渲染器(需要渲染的请求)、host指定的Fetcher、请求所属会话的Fetcher、SetFetcher设置的Fetcher，都没有时交给goreq
+// 同一个请求再次经过时(如goreq.WithRetry重试、重新加入的任务，见retryTask)记录一次重试
+func (s *Spider) fetcherMiddleware(c *goreq.Client, next goreq.Handler) goreq.Handler {
+	return func(req *goreq.Request) *goreq.Response {
+		if markSent(req) {
+			s.Status.AddRetry()
+		}
+		if _, ok := GetRenderParams(req); ok && s.renderer != nil {
+			return s.renderer.Do(req)
+		}
+		if req.Request != nil {
+			if f := s.HostFetcher(req.URL.Host); f != nil {
+				return f.Do(req)
+			}
+		}
+		if se := requestSession(req); se != nil {
+			return s.sessionFetcher(se).Do(req)
+		}
+		if s.fetcher == nil {
+			return next(req)
+		}
+		return s.fetcher.Do(req)
+	}
+}
+
+// HTTPFetcher 使用net/http的Fetcher
+type HTTPFetcher struct {
+	Client *http.Client
+}
+
+// NewHTTPFetcher 使用cli发送请求，cli为nil时使用http.DefaultClient
+func NewHTTPFetcher(cli *http.Client) *HTTPFetcher {
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	return &HTTPFetcher{Client: cli}
+}
+
+// Do 发送请求
+func (f *HTTPFetcher) Do(req *goreq.Request) *goreq.Response {
+	resp := &goreq.Response{
+		Req:  req,
+		Body: []byte{},
+	}
+	resp.Response, resp.Err = f.Client.Do(req.Request)
+	if resp.Err != nil {
+		return resp
+	}
+	defer resp.Response.Body.Close()
+	if sink := streamRequest(req); sink != nil {
+		if ok, err := sink(resp.Response); ok {
+			resp.Err = err
+			return resp
+		}
+	}
+	resp.Body, resp.Err = ioutil.ReadAll(resp.Response.Body)
+	return resp
+}
+
+// FastHTTPFetcher 使用fasthttp的Fetcher，适合大量小请求的场景
+// fasthttp不读取请求context，goreq的SetProxy、SetTimeout、SetCheckRedirect对它无效，
+// 超时和代理需要在Client中配置(如Client.ReadTimeout、fasthttpproxy)，重定向不会自动跟随
+type FastHTTPFetcher struct {
+	Client *fasthttp.Client
+}
+
+// NewFastHTTPFetcher 使用cli发送请求，cli为nil时使用默认配置的fasthttp.Client
+func NewFastHTTPFetcher(cli *fasthttp.Client) *FastHTTPFetcher {
+	if cli == nil {
+		cli = &fasthttp.Client{}
+	}
+	return &FastHTTPFetcher{Client: cli}
+}
+
+// Do 发送请求，将fasthttp的响应转换为http.Response
+func (f *FastHTTPFetcher) Do(req *goreq.Request) *goreq.Response {
+	resp := &goreq.Response{
+		Req:  req,
+		Body: []byte{},
+	}
+	freq := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(freq)
+	fresp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(fresp)
+
+	freq.SetRequestURI(req.URL.String())
+	freq.Header.SetMethod(req.Method)
+	for k, vs := range req.Header {
+		for _, v := range vs {
+			freq.Header.Add(k, v)
+		}
+	}
+	if req.Host != "" {
+		freq.SetHost(req.Host)
+	}
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			resp.Err = err
+			return resp
+		}
+		freq.SetBody(body)
+	}
+	// fasthttp不会自动解压，不声明Accept-Encoding以获得未压缩的响应体
+	freq.Header.Del("Accept-Encoding")
+
+	if resp.Err = f.Client.Do(freq, fresp); resp.Err != nil {
+		return resp
+	}
+	resp.Body = append([]byte(nil), fresp.Body()...)
+	header := http.Header{}
+	fresp.Header.VisitAll(func(k, v []byte) {
+		header.Add(string(k), string(v))
+	})
+	resp.Response = &http.Response{
+		Status:        fmt.Sprintf("%d %s", fresp.StatusCode(), http.StatusText(fresp.StatusCode())),
+		StatusCode:    fresp.StatusCode(),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(resp.Body)),
+		ContentLength: int64(len(resp.Body)),
+		Request:       req.Request,
+	}
+	return resp
+}
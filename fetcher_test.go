@@ -0,0 +1,96 @@
+package gospider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithFetcher(t *testing.T) {
+	var urls []string
+	s := NewSpider(WithFetcher(FetcherFunc(func(req *goreq.Request) *goreq.Response {
+		urls = append(urls, req.URL.String())
+		return &goreq.Response{
+			Req:  req,
+			Body: []byte("mock"),
+			Response: &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"text/plain"}},
+				Request:    req.Request,
+			},
+		}
+	})))
+	s.Logging = false
+	var text string
+	s.SeedTask(goreq.Get("http://example.test/"), func(ctx *Context) {
+		text = ctx.Resp.Text
+	})
+	s.Wait()
+	assert.Equal(t, []string{"http://example.test/"}, urls)
+	assert.Equal(t, "mock", text)
+	assert.NotNil(t, s.Fetcher())
+}
+
+func TestWithFetcher_Transport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("id"); err == nil {
+			_, _ = w.Write([]byte(c.Value))
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "id", Value: "1"})
+	}))
+	defer ts.Close()
+
+	// WithFetcher设置的Fetcher不会被需要自定义transport的扩展替换
+	f := FetcherFunc(func(req *goreq.Request) *goreq.Response {
+		return &goreq.Response{Req: req, Body: []byte("mock"), Response: &http.Response{StatusCode: 200, Header: http.Header{}}}
+	})
+	l := &testLogger{}
+	s := NewSpider()
+	s.SetLogger(l)
+	s.Use(WithFetcher(f), WithDecompressionLimit(1<<20, 0))
+	_, ok := s.Fetcher().(FetcherFunc)
+	assert.True(t, ok)
+	if assert.Len(t, l.records, 1) {
+		assert.Equal(t, "error", l.records[0].Level)
+	}
+
+	// 多次替换transport时沿用同一个cookie jar
+	s = NewSpider(WithSynchronousMode(), WithHTMLStreaming())
+	s.Logging = false
+	var bodies []string
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {})
+	s.Wait()
+	s.Use(WithDecompressionLimit(1<<20, 0))
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		bodies = append(bodies, ctx.Resp.Text)
+	})
+	s.Wait()
+	assert.Equal(t, []string{"1"}, bodies)
+}
+
+func TestHTTPFetcherAndFastHTTPFetcher(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Test", r.Header.Get("X-Test"))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(r.Method + " " + string(body)))
+	}))
+	defer ts.Close()
+
+	for _, f := range []Fetcher{NewHTTPFetcher(nil), NewFastHTTPFetcher(nil)} {
+		s := NewSpider(WithFetcher(f))
+		s.Logging = false
+		req := goreq.Post(ts.URL).SetBody(strings.NewReader("hello")).AddHeader("X-Test", "yes")
+		resp, err := s.Client.Do(req).Resp()
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusCreated, resp.StatusCode)
+			assert.Equal(t, "yes", resp.Header.Get("X-Test"))
+			assert.Equal(t, "POST hello", resp.Text)
+		}
+	}
+}
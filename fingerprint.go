@@ -0,0 +1,122 @@
+package gospider
+
+import (
+	"crypto/md5"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/zhshch2002/goreq"
+)
+
+// FingerprintFunc 计算请求的指纹，指纹相同的请求视为重复，见WithRequestFingerprint
+type FingerprintFunc func(req *goreq.Request) [md5.Size]byte
+
+// WithRequestFingerprint 使用fn代替GetRequestHash计算去重(WithDeduplicate)使用的请求指纹，
+// 如忽略跟踪参数、会话cookie或请求体；可以用NewFingerprint按FingerprintOptions生成
+// 与WithDeduplicate的顺序无关；更换指纹后，已保存的检查点中的去重记录不再匹配
+func WithRequestFingerprint(fn FingerprintFunc) Extension {
+	return func(s *Spider) {
+		s.fingerprint = fn
+	}
+}
+
+// RequestFingerprint 请求的指纹，使用WithRequestFingerprint设置的方法，没有设置时为GetRequestHash
+func (s *Spider) RequestFingerprint(req *goreq.Request) [md5.Size]byte {
+	if s.fingerprint != nil {
+		return s.fingerprint(req)
+	}
+	return GetRequestHash(req)
+}
+
+// FingerprintOptions NewFingerprint的选项，零值时包括请求方法、URL(不含片段)、全部请求头(含Cookie)和请求体
+type FingerprintOptions struct {
+	Headers       []string // 只包括这些请求头，为nil时包括全部请求头
+	IgnoreHeaders []string // 不包括的请求头，如"Cookie"、"User-Agent"
+	IgnoreQuery   []string // 不包括的查询参数，支持path.Match通配符，如"utm_*"、"sessionid"
+	IgnoreBody    bool     // 不包括请求体
+	IgnoreMethod  bool     // 不包括请求方法，GET和HEAD等视为同一个请求
+	KeepFragment  bool     // 包括URL的#片段，默认与GetRequestHash一样不包括
+}
+
+// NewFingerprint 按o生成FingerprintFunc，查询参数、请求头按名字排序，参数的顺序不影响指纹
+func NewFingerprint(o FingerprintOptions) FingerprintFunc {
+	include := map[string]bool{}
+	for _, h := range o.Headers {
+		include[http.CanonicalHeaderKey(h)] = true
+	}
+	exclude := map[string]bool{}
+	for _, h := range o.IgnoreHeaders {
+		exclude[http.CanonicalHeaderKey(h)] = true
+	}
+	return func(r *goreq.Request) [md5.Size]byte {
+		var b strings.Builder
+		if !o.IgnoreMethod {
+			b.WriteString(r.Method + " ")
+		}
+		u := *r.URL
+		u.Host = strings.ToLower(u.Host)
+		u.RawQuery = canonicalQuery(u.Query(), o.IgnoreQuery)
+		u.ForceQuery = false
+		if !o.KeepFragment {
+			u.Fragment = ""
+		}
+		b.WriteString(u.String())
+
+		var keys []string
+		for k := range r.Header {
+			k = http.CanonicalHeaderKey(k)
+			if (o.Headers == nil || include[k]) && !exclude[k] {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			vals := append([]string(nil), r.Header.Values(k)...)
+			sort.Strings(vals)
+			for _, v := range vals {
+				b.WriteString("\n" + k + ": " + v)
+			}
+		}
+
+		data := []byte(b.String())
+		if !o.IgnoreBody && r.GetBody != nil {
+			if br, err := r.GetBody(); err == nil {
+				if body, err := ioutil.ReadAll(br); err == nil {
+					data = append(append(data, "\n\n"...), body...)
+				}
+			}
+		}
+		return md5.Sum(data)
+	}
+}
+
+// canonicalQuery 去掉匹配ignore的参数后按名字和值排序的查询字符串
+func canonicalQuery(q url.Values, ignore []string) string {
+	var keys []string
+	for k := range q {
+		ignored := false
+		for _, pattern := range ignore {
+			if ok, _ := path.Match(pattern, k); ok {
+				ignored = true
+				break
+			}
+		}
+		if !ignored {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string(nil), q[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,52 @@
+package gospider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewFingerprint(t *testing.T) {
+	fp := NewFingerprint(FingerprintOptions{})
+	assert.Equal(t, fp(goreq.Get("http://Example.com/a?b=2&a=1#top")), fp(goreq.Get("http://example.com/a?a=1&b=2")))
+	assert.NotEqual(t, fp(goreq.Get("http://example.com/a")), fp(goreq.Head("http://example.com/a")))
+	assert.NotEqual(t, fp(goreq.Get("http://example.com/a")), fp(goreq.Get("http://example.com/a").AddHeader("Cookie", "sid=1")))
+	assert.NotEqual(t, fp(goreq.Post("http://example.com/a").SetRawBody([]byte("x"))), fp(goreq.Post("http://example.com/a").SetRawBody([]byte("y"))))
+
+	fp = NewFingerprint(FingerprintOptions{
+		IgnoreQuery:   []string{"utm_*", "sid"},
+		IgnoreHeaders: []string{"cookie"},
+		IgnoreBody:    true,
+		IgnoreMethod:  true,
+	})
+	assert.Equal(t, fp(goreq.Get("http://example.com/a?id=1")), fp(goreq.Get("http://example.com/a?utm_source=x&id=1&sid=abc")))
+	assert.NotEqual(t, fp(goreq.Get("http://example.com/a?id=1")), fp(goreq.Get("http://example.com/a?id=2")))
+	assert.Equal(t, fp(goreq.Get("http://example.com/a")), fp(goreq.Get("http://example.com/a").AddHeader("Cookie", "sid=1")))
+	assert.Equal(t, fp(goreq.Get("http://example.com/a")), fp(goreq.Head("http://example.com/a")))
+	assert.Equal(t, fp(goreq.Post("http://example.com/a").SetRawBody([]byte("x"))), fp(goreq.Post("http://example.com/a").SetRawBody([]byte("y"))))
+
+	fp = NewFingerprint(FingerprintOptions{Headers: []string{"accept-language"}, KeepFragment: true})
+	assert.Equal(t, fp(goreq.Get("http://example.com/a").AddHeader("User-Agent", "x")), fp(goreq.Get("http://example.com/a")))
+	assert.NotEqual(t, fp(goreq.Get("http://example.com/a").AddHeader("Accept-Language", "en")), fp(goreq.Get("http://example.com/a")))
+	assert.NotEqual(t, fp(goreq.Get("http://example.com/a#x")), fp(goreq.Get("http://example.com/a")))
+}
+
+func TestWithRequestFingerprint(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	s := NewSpider(WithSynchronousMode(), WithDeduplicate(), WithRequestFingerprint(NewFingerprint(FingerprintOptions{IgnoreQuery: []string{"ref"}})))
+	s.Logging = false
+	var got []string
+	s.OnResp(func(ctx *Context) {
+		got = append(got, ctx.Req.URL.RawQuery)
+	})
+	s.SeedTask(goreq.Get(ts.URL + "/p?id=1&ref=a"))
+	s.SeedTask(goreq.Get(ts.URL + "/p?ref=b&id=1"))
+	s.SeedTask(goreq.Get(ts.URL + "/p?id=2&ref=a"))
+	s.Wait()
+	assert.Equal(t, []string{"id=1&ref=a", "id=2&ref=a"}, got)
+	assert.Equal(t, GetRequestHash(goreq.Get(ts.URL)), NewSpider().RequestFingerprint(goreq.Get(ts.URL)))
+}
@@ -0,0 +1,4 @@
+// Package gospiderpb gRPC控制面和分布式协调的协议定义，由control.proto、coordinator.proto生成
+package gospiderpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative control.proto coordinator.proto
@@ -0,0 +1,208 @@
+// Package gospidertest 爬虫的测试工具：在进程内启动模拟的网站，同步运行爬虫并检查输出的Item和任务
+//
+//	srv := gospidertest.NewServer(gospidertest.Routes{
+//		"/":  gospidertest.HTML(`<a href="/a">a</a>`),
+//		"/a": gospidertest.JSON(`{"id":1}`),
+//	})
+//	defer srv.Close()
+//	r := gospidertest.Run(s, func(s *gospider.Spider) {
+//		s.SeedTask(goreq.Get(srv.URL+"/"), parse)
+//	})
+//	r.AssertItems(t, 1)
+package gospidertest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+
+	"github.com/gotodown/gospider"
+	"github.com/stretchr/testify/assert"
+)
+
+// Routes 路径到处理方法的映射，键为请求路径，也可以包含查询参数(如"/list?page=2")，包含查询参数的键优先
+type Routes map[string]http.Handler
+
+// HTML 返回HTML页面
+func HTML(body string) http.Handler {
+	return Response(http.StatusOK, "text/html; charset=utf-8", body)
+}
+
+// JSON 返回JSON
+func JSON(body string) http.Handler {
+	return Response(http.StatusOK, "application/json", body)
+}
+
+// Response 返回指定状态码、Content-Type和响应体
+func Response(status int, contentType, body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	})
+}
+
+// Redirect 重定向到url
+func Redirect(url string, status int) http.Handler {
+	return http.RedirectHandler(url, status)
+}
+
+// Server 模拟的网站，记录收到的请求
+type Server struct {
+	*httptest.Server
+
+	lock sync.Mutex
+	hits map[string]int // RequestURI -> 请求次数
+}
+
+// NewServer 按路由启动模拟的网站，没有匹配的路由时返回404
+func NewServer(routes Routes) *Server {
+	return newServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h, ok := routes[r.URL.RequestURI()]; ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if h, ok := routes[r.URL.Path]; ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+}
+
+// NewFixtureServer 以目录中的文件作为网站，"/"对应index.html，Content-Type按扩展名确定
+func NewFixtureServer(dir string) *Server {
+	return newServer(http.FileServer(http.Dir(dir)))
+}
+
+func newServer(h http.Handler) *Server {
+	s := &Server{hits: map[string]int{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		s.hits[r.URL.RequestURI()]++
+		s.lock.Unlock()
+		h.ServeHTTP(w, r)
+	}))
+	return s
+}
+
+// Hits 请求uri(路径和查询参数)的次数
+func (s *Server) Hits(uri string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.hits[uri]
+}
+
+// Requests 收到的所有请求的uri，已排序，重复请求会出现多次
+func (s *Server) Requests() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var res []string
+	for uri, n := range s.hits {
+		for i := 0; i < n; i++ {
+			res = append(res, uri)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Recorder 记录爬虫输出的Item、加入的任务和错误
+// 只记录在它之前注册的OnItem、OnTask没有丢弃的Item和任务
+type Recorder struct {
+	lock   sync.Mutex
+	items  []interface{}
+	tasks  []*gospider.Task
+	errors []error
+}
+
+// Record 开始记录s的输出，需要在加入任务之前调用
+func Record(s *gospider.Spider) *Recorder {
+	r := &Recorder{}
+	s.OnTask(func(ctx *gospider.Context, t *gospider.Task) *gospider.Task {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		r.tasks = append(r.tasks, t)
+		return t
+	})
+	s.OnItem(func(ctx *gospider.Context, i interface{}) interface{} {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		r.items = append(r.items, i)
+		return i
+	})
+	addErr := func(ctx *gospider.Context, err error) {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		r.errors = append(r.errors, err)
+	}
+	s.OnReqError(addErr)
+	s.OnRespError(addErr)
+	s.OnRecover(addErr)
+	return r
+}
+
+// Run 记录s的输出，调用seed加入种子任务，等待爬虫完成后返回记录
+func Run(s *gospider.Spider, seed func(s *gospider.Spider)) *Recorder {
+	r := Record(s)
+	seed(s)
+	s.Wait()
+	return r
+}
+
+// Items 记录的Item，顺序与加入的顺序相同，并发执行的任务之间的顺序不确定
+func (r *Recorder) Items() []interface{} {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]interface{}(nil), r.items...)
+}
+
+// Tasks 记录的任务
+func (r *Recorder) Tasks() []*gospider.Task {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]*gospider.Task(nil), r.tasks...)
+}
+
+// URLs 记录的任务请求的URL，已排序
+func (r *Recorder) URLs() []string {
+	var res []string
+	for _, t := range r.Tasks() {
+		if t.Req.Request != nil {
+			res = append(res, t.Req.URL.String())
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Errors 请求错误、响应错误和处理方法中的panic
+func (r *Recorder) Errors() []error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]error(nil), r.errors...)
+}
+
+// AssertItems 检查记录的Item与expected相同，不比较顺序
+func (r *Recorder) AssertItems(t assert.TestingT, expected ...interface{}) bool {
+	if expected == nil {
+		expected = []interface{}{}
+	}
+	return assert.ElementsMatch(t, expected, r.Items())
+}
+
+// AssertURLs 检查记录的任务的URL与expected相同，不比较顺序
+func (r *Recorder) AssertURLs(t assert.TestingT, expected ...string) bool {
+	if expected == nil {
+		expected = []string{}
+	}
+	return assert.ElementsMatch(t, expected, r.URLs())
+}
+
+// AssertNoErrors 检查没有记录到错误
+func (r *Recorder) AssertNoErrors(t assert.TestingT) bool {
+	return assert.Empty(t, r.Errors())
+}
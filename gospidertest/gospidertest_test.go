@@ -0,0 +1,94 @@
+package gospidertest
+
+import (
+	"errors"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gotodown/gospider"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"testing"
+)
+
+func TestNewServer(t *testing.T) {
+	srv := NewServer(Routes{
+		"/":            HTML(`<a href="/list">list</a>`),
+		"/list":        JSON(`{"next":"/list?page=2","items":[1,2]}`),
+		"/list?page=2": JSON(`{"items":[3]}`),
+		"/gone":        Response(http.StatusGone, "text/plain", "gone"),
+		"/old":         Redirect("/list?page=2", http.StatusMovedPermanently),
+		"/panic":       HTML(`<p>panic</p>`),
+	})
+	defer srv.Close()
+
+	s := gospider.NewSpider(gospider.WithDeduplicate())
+	s.Logging = false
+	var list gospider.Handler
+	list = func(ctx *gospider.Context) {
+		j, err := ctx.Resp.JSON()
+		if err != nil {
+			return
+		}
+		for _, i := range j.Get("items").Array() {
+			ctx.AddItem(i.Int())
+		}
+		if next := j.Get("next").String(); next != "" {
+			ctx.AddTask(goreq.Get(srv.URL+next), list)
+		}
+	}
+	r := Run(s, func(s *gospider.Spider) {
+		s.SeedTask(goreq.Get(srv.URL+"/"), func(ctx *gospider.Context) {
+			if h, err := ctx.Resp.HTML(); err == nil {
+				h.Find("a").Each(func(i int, sel *goquery.Selection) {
+					ctx.AddTask(goreq.Get(srv.URL+sel.AttrOr("href", "")), list)
+				})
+			}
+		})
+		s.SeedTask(goreq.Get(srv.URL+"/old"), list)
+		s.SeedTask(goreq.Get(srv.URL+"/gone"), func(ctx *gospider.Context) {
+			ctx.AddItem(ctx.Resp.StatusCode)
+		})
+		s.SeedTask(goreq.Get(srv.URL+"/panic"), func(ctx *gospider.Context) {
+			panic(errors.New("boom"))
+		})
+	})
+
+	r.AssertItems(t, int64(1), int64(2), int64(3), int64(3), http.StatusGone)
+	r.AssertURLs(t, srv.URL+"/", srv.URL+"/gone", srv.URL+"/list", srv.URL+"/list?page=2", srv.URL+"/old", srv.URL+"/panic")
+	assert.Len(t, r.Tasks(), 6)
+	if assert.Len(t, r.Errors(), 1) {
+		assert.EqualError(t, r.Errors()[0], "boom")
+	}
+	assert.Equal(t, 2, srv.Hits("/list?page=2"))
+	assert.Equal(t, 1, srv.Hits("/old"))
+	assert.Equal(t, []string{"/", "/gone", "/list", "/list?page=2", "/list?page=2", "/old", "/panic"}, srv.Requests())
+}
+
+func TestNewFixtureServer(t *testing.T) {
+	srv := NewFixtureServer("testdata/site")
+	defer srv.Close()
+
+	s := gospider.NewSpider(gospider.WithDeduplicate())
+	s.Logging = false
+	var page gospider.Handler
+	page = func(ctx *gospider.Context) {
+		h, err := ctx.Resp.HTML()
+		if err != nil {
+			return
+		}
+		if title := h.Find("title").Text(); title != "" {
+			ctx.AddItem(title)
+		}
+		h.Find("a").Each(func(i int, sel *goquery.Selection) {
+			ctx.AddTask(goreq.Get(srv.URL+sel.AttrOr("href", "")), page)
+		})
+	}
+	r := Run(s, func(s *gospider.Spider) {
+		s.SeedTask(goreq.Get(srv.URL+"/"), page)
+	})
+
+	r.AssertNoErrors(t)
+	r.AssertItems(t, "Index", "A", "B")
+	r.AssertURLs(t, srv.URL+"/", srv.URL+"/a.html", srv.URL+"/b.html", srv.URL+"/missing.html")
+	assert.Equal(t, 1, srv.Hits("/missing.html"))
+}
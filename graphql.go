@@ -0,0 +1,125 @@
+package gospider
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/zhshch2002/goreq"
+)
+
+// ErrNotGraphQL 任务的请求不是由NewGraphQLRequest构造的
+var ErrNotGraphQL = errors.New("request is not a graphql query")
+
+// GraphQLQuery GraphQL请求体
+type GraphQLQuery struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+}
+
+// GraphQLError GraphQL响应errors中的一项
+type GraphQLError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// GraphQLErrors 响应中的errors，作为error返回
+type GraphQLErrors []GraphQLError
+
+func (e GraphQLErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, i := range e {
+		msgs = append(msgs, i.Message)
+	}
+	return "graphql: " + strings.Join(msgs, "; ")
+}
+
+// NewGraphQLRequest 构造向endpoint以POST提交query和variables的请求
+func NewGraphQLRequest(endpoint, query string, variables map[string]interface{}) *goreq.Request {
+	return goreq.Post(endpoint).SetJsonBody(&GraphQLQuery{
+		Query:     query,
+		Variables: variables,
+	}).AddHeader("Accept", "application/json")
+}
+
+// NewGraphQLTask 构造GraphQL查询的任务，用Spider.AddTask加入；处理方法中用ctx.GraphQL读取data
+func NewGraphQLTask(endpoint, query string, variables map[string]interface{}, h ...Handler) *Task {
+	return NewTask(NewGraphQLRequest(endpoint, query, variables), map[string]interface{}{}, h...)
+}
+
+// graphQLQueryOf 从请求体中读取GraphQL查询
+func graphQLQueryOf(req *goreq.Request) (*GraphQLQuery, error) {
+	if req == nil || req.Request == nil || req.GetBody == nil {
+		return nil, ErrNotGraphQL
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	q := &GraphQLQuery{}
+	if err := json.Unmarshal(data, q); err != nil || q.Query == "" {
+		return nil, ErrNotGraphQL
+	}
+	return q, nil
+}
+
+// GraphQL 解析GraphQL响应，返回其中的data；响应包含errors时同时返回GraphQLErrors，此时data可能只有部分结果
+func (c *Context) GraphQL() (gjson.Result, error) {
+	if c.Resp == nil {
+		return gjson.Result{}, ErrNotGraphQL
+	}
+	if !gjson.ValidBytes(c.Resp.Body) {
+		return gjson.Result{}, ErrNotGraphQL
+	}
+	res := gjson.ParseBytes(c.Resp.Body)
+	data := res.Get("data")
+	if e := res.Get("errors"); e.IsArray() && len(e.Array()) > 0 {
+		var errs GraphQLErrors
+		if err := json.Unmarshal([]byte(e.Raw), &errs); err != nil {
+			return data, err
+		}
+		return data, errs
+	}
+	return data, nil
+}
+
+// GraphQLNextPage 按Relay的游标分页加入下一页的任务，返回是否有下一页
+// pageInfo为data中pageInfo对象的路径(如"repository.issues.pageInfo")，读取其中的hasNextPage和endCursor，
+// 以相同的查询和变量请求下一页，只将变量cursorVar设为endCursor，用h处理
+func (c *Context) GraphQLNextPage(pageInfo, cursorVar string, h ...Handler) bool {
+	data, _ := c.GraphQL()
+	info := data.Get(pageInfo)
+	cursor := info.Get("endCursor")
+	if !info.Get("hasNextPage").Bool() || !cursor.Exists() || cursor.Type == gjson.Null {
+		return false
+	}
+	q, err := graphQLQueryOf(c.Req)
+	if err != nil {
+		return false
+	}
+	vars := make(map[string]interface{}, len(q.Variables)+1)
+	for k, v := range q.Variables {
+		vars[k] = v
+	}
+	vars[cursorVar] = cursor.Value()
+	req := goreq.Post(c.Req.URL.String()).SetJsonBody(&GraphQLQuery{
+		Query:         q.Query,
+		Variables:     vars,
+		OperationName: q.OperationName,
+	})
+	for k, v := range c.Req.Header {
+		if k != "Content-Type" && k != "Content-Length" {
+			req.Header[k] = v
+		}
+	}
+	c.AddTask(req, h...)
+	return true
+}
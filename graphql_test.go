@@ -0,0 +1,80 @@
+package gospider
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestNewGraphQLTask(t *testing.T) {
+	pages := map[string]string{
+		"":   `{"data":{"items":{"nodes":["a","b"],"pageInfo":{"hasNextPage":true,"endCursor":"c1"}}}}`,
+		"c1": `{"data":{"items":{"nodes":["c"],"pageInfo":{"hasNextPage":false,"endCursor":"c2"}}}}`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		q := &GraphQLQuery{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(q))
+		assert.Equal(t, "query($after: String) { items(after: $after) { nodes } }", q.Query)
+		assert.Equal(t, float64(10), q.Variables["first"])
+		after, _ := q.Variables["after"].(string)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(pages[after]))
+	}))
+	defer ts.Close()
+
+	s := NewSpider()
+	s.Logging = false
+	lock := sync.Mutex{}
+	var nodes []string
+	var handle Handler
+	handle = func(ctx *Context) {
+		data, err := ctx.GraphQL()
+		assert.NoError(t, err)
+		lock.Lock()
+		for _, n := range data.Get("items.nodes").Array() {
+			nodes = append(nodes, n.String())
+		}
+		lock.Unlock()
+		ctx.GraphQLNextPage("items.pageInfo", "after", handle)
+	}
+	s.AddTask(NewGraphQLTask(ts.URL, "query($after: String) { items(after: $after) { nodes } }",
+		map[string]interface{}{"first": 10}, handle))
+	s.Wait()
+	sort.Strings(nodes)
+	assert.Equal(t, []string{"a", "b", "c"}, nodes)
+}
+
+func TestContext_GraphQL_Errors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":{"a":1,"b":null},"errors":[{"message":"b failed","path":["b"]}]}`))
+	}))
+	defer ts.Close()
+
+	s := NewSpider()
+	s.Logging = false
+	var err error
+	var next bool
+	var a int64
+	s.SeedTask(NewGraphQLRequest(ts.URL, "{ a b }", nil), func(ctx *Context) {
+		res, e := ctx.GraphQL()
+		a, err = res.Get("a").Int(), e
+	})
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		next = ctx.GraphQLNextPage("a", "after")
+	})
+	s.Wait()
+	assert.Equal(t, int64(1), a)
+	if assert.IsType(t, GraphQLErrors{}, err) {
+		assert.Equal(t, "graphql: b failed", err.Error())
+		assert.Equal(t, []interface{}{"b"}, err.(GraphQLErrors)[0].Path)
+	}
+	assert.False(t, next)
+}
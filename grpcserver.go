@@ -0,0 +1,163 @@
+package gospider
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gotodown/gospider/gospiderpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCControlServer gRPC控制面(gospiderpb.Control)的服务端实现，可以同时管理一个进程中的多个爬虫
+type GRPCControlServer struct {
+	gospiderpb.UnimplementedControlServer
+	lock    sync.RWMutex
+	spiders []*Spider
+}
+
+// NewGRPCControlServer 创建gRPC控制面服务端
+func NewGRPCControlServer(spiders ...*Spider) *GRPCControlServer {
+	return &GRPCControlServer{spiders: spiders}
+}
+
+// Add 添加受管理的爬虫
+func (g *GRPCControlServer) Add(s *Spider) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.spiders = append(g.spiders, s)
+}
+
+// Serve 在lis上启动gRPC服务，阻塞直到服务停止
+func (g *GRPCControlServer) Serve(lis net.Listener, opt ...grpc.ServerOption) error {
+	srv := grpc.NewServer(opt...)
+	gospiderpb.RegisterControlServer(srv, g)
+	return srv.Serve(lis)
+}
+
+// spider 按名字查找爬虫，只有一个爬虫时名字可以为空
+func (g *GRPCControlServer) spider(name string) (*Spider, error) {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	if name == "" && len(g.spiders) == 1 {
+		return g.spiders[0], nil
+	}
+	for _, s := range g.spiders {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "spider %q not found", name)
+}
+
+func grpcSpiderStatus(s *Spider) *gospiderpb.SpiderStatus {
+	st := newDebugStatus(s)
+	return &gospiderpb.SpiderStatus{
+		Spider:       st.Spider,
+		TotalTask:    st.TotalTask,
+		FinishedTask: st.FinishedTask,
+		TotalItem:    st.TotalItem,
+		ExecSpeed:    st.ExecSpeed,
+		Paused:       s.IsPaused(),
+	}
+}
+
+// SubmitTask 向爬虫提交一个种子任务
+func (g *GRPCControlServer) SubmitTask(ctx context.Context, req *gospiderpb.SubmitTaskRequest) (*gospiderpb.SubmitTaskResponse, error) {
+	s, err := g.spider(req.Spider)
+	if err != nil {
+		return nil, err
+	}
+	sub := &TaskSubmission{
+		SerializedRequest: SerializedRequest{
+			Method: req.Method,
+			URL:    req.Url,
+			Body:   req.Body,
+		},
+		Handlers: req.Handlers,
+	}
+	if len(req.Header) > 0 {
+		sub.Header = map[string][]string{}
+		for k, v := range req.Header {
+			sub.Header[k] = v.Values
+		}
+	}
+	if req.Meta != nil {
+		sub.Meta = req.Meta.AsMap()
+	}
+	if err := s.submitTask(sub); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &gospiderpb.SubmitTaskResponse{}, nil
+}
+
+// GetStatus 获取爬虫状态
+func (g *GRPCControlServer) GetStatus(ctx context.Context, req *gospiderpb.GetStatusRequest) (*gospiderpb.SpiderStatus, error) {
+	s, err := g.spider(req.Spider)
+	if err != nil {
+		return nil, err
+	}
+	return grpcSpiderStatus(s), nil
+}
+
+// WatchStatus 按间隔持续推送爬虫状态，直到客户端断开
+func (g *GRPCControlServer) WatchStatus(req *gospiderpb.WatchStatusRequest, stream gospiderpb.Control_WatchStatusServer) error {
+	s, err := g.spider(req.Spider)
+	if err != nil {
+		return err
+	}
+	interval := time.Duration(req.IntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := stream.Send(grpcSpiderStatus(s)); err != nil {
+			return err
+		}
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Pause 暂停爬虫
+func (g *GRPCControlServer) Pause(ctx context.Context, req *gospiderpb.PauseRequest) (*gospiderpb.PauseResponse, error) {
+	s, err := g.spider(req.Spider)
+	if err != nil {
+		return nil, err
+	}
+	s.Pause()
+	return &gospiderpb.PauseResponse{}, nil
+}
+
+// Resume 恢复爬虫
+func (g *GRPCControlServer) Resume(ctx context.Context, req *gospiderpb.ResumeRequest) (*gospiderpb.ResumeResponse, error) {
+	s, err := g.spider(req.Spider)
+	if err != nil {
+		return nil, err
+	}
+	s.Resume()
+	return &gospiderpb.ResumeResponse{}, nil
+}
+
+// ListSpiders 列出所有爬虫及其状态，按名字排序
+func (g *GRPCControlServer) ListSpiders(ctx context.Context, req *gospiderpb.ListSpidersRequest) (*gospiderpb.ListSpidersResponse, error) {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	res := &gospiderpb.ListSpidersResponse{}
+	for _, s := range g.spiders {
+		res.Spiders = append(res.Spiders, grpcSpiderStatus(s))
+	}
+	sort.Slice(res.Spiders, func(i, j int) bool {
+		return res.Spiders[i].Spider < res.Spiders[j].Spider
+	})
+	return res, nil
+}
@@ -0,0 +1,82 @@
+package gospider
+
+import (
+	"context"
+	"fmt"
+	"github.com/gotodown/gospider/gospiderpb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGRPCControlServer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+
+	a, b := NewSpider(), NewSpider()
+	a.Name, b.Name = "a", "b"
+	a.Logging = false
+	count := int64(0)
+	a.RegisterHandler("count", func(ctx *Context) {
+		assert.Equal(t, "v", ctx.Meta["k"])
+		atomic.AddInt64(&count, 1)
+	})
+
+	lis := bufconn.Listen(1024 * 1024)
+	go func() {
+		_ = NewGRPCControlServer(a, b).Serve(lis)
+	}()
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	assert.NoError(t, err)
+	defer conn.Close()
+	cli := gospiderpb.NewControlClient(conn)
+	ctx := context.Background()
+
+	_, err = cli.Pause(ctx, &gospiderpb.PauseRequest{Spider: "a"})
+	assert.NoError(t, err)
+	meta, _ := structpb.NewStruct(map[string]interface{}{"k": "v"})
+	_, err = cli.SubmitTask(ctx, &gospiderpb.SubmitTaskRequest{Spider: "a", Url: ts.URL, Meta: meta, Handlers: []string{"count"}})
+	assert.NoError(t, err)
+	_, err = cli.SubmitTask(ctx, &gospiderpb.SubmitTaskRequest{Spider: "c", Url: ts.URL})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	st, err := cli.GetStatus(ctx, &gospiderpb.GetStatusRequest{Spider: "a"})
+	assert.NoError(t, err)
+	assert.True(t, st.Paused)
+	assert.Equal(t, int64(1), st.TotalTask)
+
+	list, err := cli.ListSpiders(ctx, &gospiderpb.ListSpidersRequest{})
+	assert.NoError(t, err)
+	if assert.Len(t, list.Spiders, 2) {
+		assert.Equal(t, "a", list.Spiders[0].Spider)
+		assert.Equal(t, "b", list.Spiders[1].Spider)
+	}
+
+	_, err = cli.Resume(ctx, &gospiderpb.ResumeRequest{Spider: "a"})
+	assert.NoError(t, err)
+	a.Wait()
+	assert.Equal(t, int64(1), atomic.LoadInt64(&count))
+
+	wctx, cancel := context.WithCancel(ctx)
+	stream, err := cli.WatchStatus(wctx, &gospiderpb.WatchStatusRequest{Spider: "a", IntervalMs: 10})
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		st, err = stream.Recv()
+		assert.NoError(t, err)
+		assert.False(t, st.Paused)
+		assert.Equal(t, int64(1), st.FinishedTask)
+	}
+	cancel()
+}
@@ -0,0 +1,391 @@
+package gospider
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/zhshch2002/goreq"
+)
+
+// HAROptions WithHARWriter的配置
+type HAROptions struct {
+	Sample  float64                       // 抽样记录的请求比例，取值(0, 1]，默认为1即全部记录
+	Filter  func(req *goreq.Request) bool // 只记录Filter返回true的请求，在抽样之前判断，为nil时不过滤
+	Max     int                           // 最多记录的条目数，0为不限制
+	Content bool                          // 记录响应体(content.text，非UTF-8的内容以base64编码)，默认只记录大小
+}
+
+// WithHARWriter 以HAR 1.2格式记录抽样的请求：请求和响应头、cookie、大小和各阶段耗时(排队、DNS、连接、TLS、发送、等待、接收)，
+// 可以用浏览器开发者工具或HAR分析工具打开，用于性能分析或向目标网站提供复现信息
+// 条目保存在内存中，Spider.Close或Stop之后的Wait返回前写入w(w由调用者关闭)；请求出错的条目状态码为0，错误在response._error中。
+// 耗时通过net/http的httptrace获取，不经过net/http的请求(如缓存命中)只有总耗时；重定向的多次请求计为一个条目
+func WithHARWriter(w io.Writer, opts ...HAROptions) Extension {
+	return func(s *Spider) {
+		h := &harWriter{w: w}
+		if len(opts) > 0 {
+			h.opts = opts[0]
+		}
+		if h.opts.Sample <= 0 || h.opts.Sample > 1 {
+			h.opts.Sample = 1
+		}
+		s.Client.Use(func(c *goreq.Client, next goreq.Handler) goreq.Handler {
+			return func(req *goreq.Request) *goreq.Response {
+				if req.Request == nil || !h.sample(req) {
+					return next(req)
+				}
+				tr := &harTrace{}
+				req.Request = req.WithContext(httptrace.WithClientTrace(req.Context(), tr.clientTrace()))
+				start := time.Now()
+				resp := next(req)
+				h.add(newHAREntry(req, resp, start, time.Now(), tr, h.opts.Content))
+				return resp
+			}
+		})
+		s.useExtension(h)
+	}
+}
+
+// harWriter 记录HAR条目，见WithHARWriter
+type harWriter struct {
+	w    io.Writer
+	opts HAROptions
+
+	lock    sync.Mutex
+	entries []*harEntry
+	taken   int // 抽中的请求数，包括尚未完成的
+}
+
+// sample 判断是否记录req
+func (h *harWriter) sample(req *goreq.Request) bool {
+	if h.opts.Filter != nil && !h.opts.Filter(req) {
+		return false
+	}
+	if h.opts.Sample < 1 && rand.Float64() >= h.opts.Sample {
+		return false
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.opts.Max > 0 && h.taken >= h.opts.Max {
+		return false
+	}
+	h.taken++
+	return true
+}
+
+func (h *harWriter) add(e *harEntry) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.entries = append(h.entries, e)
+}
+
+// Init 没有需要初始化的状态
+func (h *harWriter) Init(s *Spider) error {
+	return nil
+}
+
+// Close 按开始时间排序后写入HAR
+func (h *harWriter) Close() error {
+	h.lock.Lock()
+	entries := h.entries
+	h.entries = nil
+	h.lock.Unlock()
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].start.Before(entries[j].start)
+	})
+	if entries == nil {
+		entries = []*harEntry{}
+	}
+	log := &harLog{}
+	log.Log.Version = "1.2"
+	log.Log.Creator = harCreator{Name: "gospider", Version: "1.0"}
+	log.Log.Entries = entries
+	enc := json.NewEncoder(h.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
+
+type harLog struct {
+	Log struct {
+		Version string      `json:"version"`
+		Creator harCreator  `json:"creator"`
+		Entries []*harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	start           time.Time
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+	Error       string         `json:"_error,omitempty"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// harTimings 各阶段耗时(毫秒)，不适用的阶段为-1
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// harTrace httptrace记录的时间点，回调可能在不同的goroutine中调用
+type harTrace struct {
+	lock                    sync.Mutex
+	getConn, gotConn        time.Time
+	dnsStart, dnsDone       time.Time
+	connStart, connDone     time.Time
+	tlsStart, tlsDone       time.Time
+	wroteRequest, firstByte time.Time
+	remote                  string
+}
+
+func (tr *harTrace) mark(t *time.Time) {
+	tr.lock.Lock()
+	*t = time.Now()
+	tr.lock.Unlock()
+}
+
+func (tr *harTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(string) {
+			tr.lock.Lock()
+			if tr.getConn.IsZero() {
+				tr.getConn = time.Now()
+			}
+			tr.lock.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			tr.lock.Lock()
+			tr.gotConn = time.Now()
+			if info.Conn != nil {
+				if host, _, err := net.SplitHostPort(info.Conn.RemoteAddr().String()); err == nil {
+					tr.remote = host
+				}
+			}
+			tr.lock.Unlock()
+		},
+		DNSStart:             func(httptrace.DNSStartInfo) { tr.mark(&tr.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { tr.mark(&tr.dnsDone) },
+		ConnectStart:         func(string, string) { tr.mark(&tr.connStart) },
+		ConnectDone:          func(string, string, error) { tr.mark(&tr.connDone) },
+		TLSHandshakeStart:    func() { tr.mark(&tr.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { tr.mark(&tr.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { tr.mark(&tr.wroteRequest) },
+		GotFirstResponseByte: func() { tr.mark(&tr.firstByte) },
+	}
+}
+
+// harMillis a到b的毫秒数，任一时间点缺失时为-1
+func harMillis(a, b time.Time) float64 {
+	if a.IsZero() || b.IsZero() || b.Before(a) {
+		return -1
+	}
+	return float64(b.Sub(a)) / float64(time.Millisecond)
+}
+
+// timings 按HAR的定义计算各阶段耗时，connect包含ssl
+func (tr *harTrace) timings(start, end time.Time) harTimings {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	t := harTimings{
+		Blocked: -1,
+		DNS:     harMillis(tr.dnsStart, tr.dnsDone),
+		Connect: harMillis(tr.connStart, tr.connDone),
+		SSL:     harMillis(tr.tlsStart, tr.tlsDone),
+	}
+	if t.Connect >= 0 && t.SSL >= 0 {
+		t.Connect += t.SSL
+	}
+	if tr.gotConn.IsZero() || tr.wroteRequest.IsZero() || tr.firstByte.IsZero() {
+		// 没有经过net/http，只有总耗时
+		t.Send, t.Wait, t.Receive = 0, harMillis(start, end), 0
+		return t
+	}
+	blockedEnd := tr.gotConn
+	for _, p := range []time.Time{tr.connStart, tr.dnsStart} {
+		if !p.IsZero() && p.Before(blockedEnd) {
+			blockedEnd = p
+		}
+	}
+	getConn := tr.getConn
+	if getConn.IsZero() {
+		getConn = start
+	}
+	t.Blocked = harMillis(getConn, blockedEnd)
+	t.Send = harMillis(tr.gotConn, tr.wroteRequest)
+	t.Wait = harMillis(tr.wroteRequest, tr.firstByte)
+	t.Receive = harMillis(tr.firstByte, end)
+	for _, p := range []*float64{&t.Send, &t.Wait, &t.Receive} {
+		if *p < 0 {
+			*p = 0
+		}
+	}
+	return t
+}
+
+// harHeaders 按名字排序的头
+func harHeaders(h http.Header) []harNameValue {
+	l := []harNameValue{}
+	for k, vs := range h {
+		for _, v := range vs {
+			l = append(l, harNameValue{Name: k, Value: v})
+		}
+	}
+	sort.SliceStable(l, func(i, j int) bool { return l[i].Name < l[j].Name })
+	return l
+}
+
+func harCookies(cs []*http.Cookie) []harNameValue {
+	l := []harNameValue{}
+	for _, c := range cs {
+		l = append(l, harNameValue{Name: c.Name, Value: c.Value})
+	}
+	return l
+}
+
+// newHAREntry 由一次请求生成HAR条目
+func newHAREntry(req *goreq.Request, resp *goreq.Response, start, end time.Time, tr *harTrace, content bool) *harEntry {
+	e := &harEntry{
+		start:           start,
+		StartedDateTime: start.Format("2006-01-02T15:04:05.000Z07:00"),
+		Time:            harMillis(start, end),
+		Timings:         tr.timings(start, end),
+	}
+	tr.lock.Lock()
+	e.ServerIPAddress = tr.remote
+	tr.lock.Unlock()
+
+	query := []harNameValue{}
+	for k, vs := range req.URL.Query() {
+		for _, v := range vs {
+			query = append(query, harNameValue{Name: k, Value: v})
+		}
+	}
+	sort.SliceStable(query, func(i, j int) bool { return query[i].Name < query[j].Name })
+	e.Request = harRequest{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     harCookies(req.Cookies()),
+		Headers:     harHeaders(req.Header),
+		QueryString: query,
+		HeadersSize: -1,
+	}
+	if req.GetBody != nil {
+		if rc, err := req.GetBody(); err == nil {
+			body, _ := ioutil.ReadAll(rc)
+			rc.Close()
+			e.Request.BodySize = len(body)
+			if len(body) > 0 {
+				e.Request.PostData = &harPostData{MimeType: req.Header.Get("Content-Type"), Text: string(body)}
+			}
+		}
+	}
+
+	e.Response = harResponse{
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []harNameValue{},
+		Headers:     []harNameValue{},
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	if resp == nil || resp.Err != nil || resp.Response == nil {
+		var err error = ErrNoResponse
+		if resp != nil && resp.Err != nil {
+			err = resp.Err
+		}
+		e.Response.Error = err.Error()
+		return e
+	}
+	r := &e.Response
+	r.Status = resp.StatusCode
+	r.StatusText = strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode)+" ")
+	if resp.Proto != "" {
+		r.HTTPVersion = resp.Proto
+		e.Request.HTTPVersion = resp.Proto
+	}
+	r.Cookies = harCookies(resp.Cookies())
+	r.Headers = harHeaders(resp.Header)
+	r.RedirectURL = resp.Header.Get("Location")
+	r.Content = harContent{Size: len(resp.Body), MimeType: resp.Header.Get("Content-Type")}
+	if !resp.Uncompressed {
+		r.BodySize = len(resp.Body)
+	} else if resp.ContentLength >= 0 {
+		r.BodySize = int(resp.ContentLength)
+	}
+	if content && len(resp.Body) > 0 {
+		if utf8.Valid(resp.Body) {
+			r.Content.Text = string(resp.Body)
+		} else {
+			r.Content.Text = base64.StdEncoding.EncodeToString(resp.Body)
+			r.Content.Encoding = "base64"
+		}
+	}
+	return e
+}
@@ -0,0 +1,126 @@
+package gospider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type harTestLog struct {
+	Log struct {
+		Version string
+		Entries []struct {
+			Time    float64
+			Request struct {
+				Method      string
+				URL         string
+				Headers     []harNameValue
+				QueryString []harNameValue
+				PostData    *harPostData
+				BodySize    int
+			}
+			Response struct {
+				Status  int
+				Cookies []harNameValue
+				Headers []harNameValue
+				Content harContent
+				Error   string `json:"_error"`
+			}
+			Timings         harTimings
+			ServerIPAddress string
+		}
+	}
+}
+
+func TestWithHARWriter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: "1"})
+		w.Header().Set("X-Page", r.URL.Path)
+		_, _ = fmt.Fprintf(w, "body of %s", r.URL.Path)
+	}))
+	defer ts.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	buf := &bytes.Buffer{}
+	s := NewSpider(WithSynchronousMode(), WithHARWriter(buf))
+	s.Logging = false
+	s.SeedTask(goreq.Get(ts.URL+"/a?q=1").AddHeader("X-Test", "1"), func(ctx *Context) {})
+	s.SeedTask(goreq.Post(ts.URL+"/b").SetRawBody([]byte("k=v")), func(ctx *Context) {})
+	s.SeedTask(goreq.Get(dead.URL+"/c"), func(ctx *Context) {})
+	s.Wait()
+	assert.NoError(t, s.Close())
+
+	log := &harTestLog{}
+	if !assert.NoError(t, json.Unmarshal(buf.Bytes(), log)) {
+		return
+	}
+	assert.Equal(t, "1.2", log.Log.Version)
+	if !assert.Len(t, log.Log.Entries, 3) {
+		return
+	}
+
+	a := log.Log.Entries[0]
+	assert.Equal(t, "GET", a.Request.Method)
+	assert.Equal(t, ts.URL+"/a?q=1", a.Request.URL)
+	assert.Contains(t, a.Request.Headers, harNameValue{Name: "X-Test", Value: "1"})
+	assert.Equal(t, []harNameValue{{Name: "q", Value: "1"}}, a.Request.QueryString)
+	assert.Equal(t, 200, a.Response.Status)
+	assert.Contains(t, a.Response.Headers, harNameValue{Name: "X-Page", Value: "/a"})
+	assert.Equal(t, []harNameValue{{Name: "sid", Value: "1"}}, a.Response.Cookies)
+	assert.Equal(t, len("body of /a"), a.Response.Content.Size)
+	assert.Empty(t, a.Response.Content.Text)
+	assert.Equal(t, "127.0.0.1", a.ServerIPAddress)
+	assert.True(t, a.Timings.Wait >= 0)
+	assert.True(t, a.Time >= a.Timings.Send+a.Timings.Wait+a.Timings.Receive-0.001)
+
+	b := log.Log.Entries[1]
+	assert.Equal(t, "POST", b.Request.Method)
+	assert.Equal(t, 3, b.Request.BodySize)
+	if assert.NotNil(t, b.Request.PostData) {
+		assert.Equal(t, "k=v", b.Request.PostData.Text)
+	}
+
+	c := log.Log.Entries[2]
+	assert.Equal(t, 0, c.Response.Status)
+	assert.NotEmpty(t, c.Response.Error)
+}
+
+func TestWithHARWriter_Sample(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "body of %s", r.URL.Path)
+	}))
+	defer ts.Close()
+
+	buf := &bytes.Buffer{}
+	s := NewSpider(WithSynchronousMode(), WithHARWriter(buf, HAROptions{
+		Filter: func(req *goreq.Request) bool {
+			return strings.HasPrefix(req.URL.Path, "/keep")
+		},
+		Max:     2,
+		Content: true,
+	}))
+	s.Logging = false
+	for i := 0; i < 3; i++ {
+		s.SeedTask(goreq.Get(fmt.Sprintf("%s/keep/%d", ts.URL, i)), func(ctx *Context) {})
+		s.SeedTask(goreq.Get(fmt.Sprintf("%s/drop/%d", ts.URL, i)), func(ctx *Context) {})
+	}
+	s.Wait()
+	assert.NoError(t, s.Close())
+
+	log := &harTestLog{}
+	if !assert.NoError(t, json.Unmarshal(buf.Bytes(), log)) {
+		return
+	}
+	if assert.Len(t, log.Log.Entries, 2) {
+		assert.Equal(t, ts.URL+"/keep/0", log.Log.Entries[0].Request.URL)
+		assert.Equal(t, ts.URL+"/keep/1", log.Log.Entries[1].Request.URL)
+		assert.Equal(t, "body of /keep/1", log.Log.Entries[1].Response.Content.Text)
+	}
+}
@@ -0,0 +1,114 @@
+package gospider
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// HookID 注册OnTask、OnResp、OnItem时返回的标识，用于RemoveHook
+type HookID uint64
+
+// hookEntry 一个注册的钩子
+type hookEntry struct {
+	id       HookID
+	priority int
+	fn       interface{}
+}
+
+// hookList 按优先级排序的钩子，优先级小的先执行，优先级相同时按注册顺序执行
+// 修改时替换整个切片，执行中的钩子列表不受并发的注册和删除影响
+type hookList struct {
+	lock    sync.Mutex
+	entries atomic.Value // []hookEntry
+}
+
+func (l *hookList) list() []hookEntry {
+	entries, _ := l.entries.Load().([]hookEntry)
+	return entries
+}
+
+func (l *hookList) add(id HookID, priority int, fn interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	old := l.list()
+	// 插入到优先级不大于priority的钩子之后
+	i := sort.Search(len(old), func(i int) bool {
+		return old[i].priority > priority
+	})
+	entries := make([]hookEntry, 0, len(old)+1)
+	entries = append(entries, old[:i]...)
+	entries = append(entries, hookEntry{id: id, priority: priority, fn: fn})
+	entries = append(entries, old[i:]...)
+	l.entries.Store(entries)
+}
+
+func (l *hookList) remove(id HookID) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	old := l.list()
+	for i, e := range old {
+		if e.id == id {
+			entries := make([]hookEntry, 0, len(old)-1)
+			entries = append(entries, old[:i]...)
+			entries = append(entries, old[i+1:]...)
+			l.entries.Store(entries)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Spider) nextHookID() HookID {
+	return HookID(atomic.AddUint64(&s.hookSeq, 1))
+}
+
+// OnTaskWithPriority 以指定的优先级注册OnTask，优先级小的先执行，OnTask的优先级为0
+// 扩展可以用优先级保证执行顺序，如去重在限速之前
+func (s *Spider) OnTaskWithPriority(priority int, fn func(ctx *Context, t *Task) *Task) HookID {
+	id := s.nextHookID()
+	s.onTaskHooks.add(id, priority, fn)
+	return id
+}
+
+// OnRespWithPriority 以指定的优先级注册OnResp，优先级小的先执行，OnResp的优先级为0
+func (s *Spider) OnRespWithPriority(priority int, fn Handler) HookID {
+	id := s.nextHookID()
+	s.onRespHooks.add(id, priority, fn)
+	return id
+}
+
+// OnItemWithPriority 以指定的优先级注册OnItem，优先级小的先执行，OnItem的优先级为0
+func (s *Spider) OnItemWithPriority(priority int, fn func(ctx *Context, i interface{}) interface{}) HookID {
+	id := s.nextHookID()
+	s.onItemHooks.add(id, priority, fn)
+	return id
+}
+
+// RemoveHook 删除注册的OnTask、OnResp或OnItem，已开始执行的任务和Item不受影响；id不存在时返回false
+func (s *Spider) RemoveHook(id HookID) bool {
+	return s.onTaskHooks.remove(id) || s.onRespHooks.remove(id) || s.onItemHooks.remove(id)
+}
+
+// OnRespOnce 注册只执行一次的OnResp，第一次执行后自动删除；并发的任务中只有一个会执行fn
+func (s *Spider) OnRespOnce(fn Handler) HookID {
+	var done int32
+	id := s.nextHookID()
+	s.onRespHooks.add(id, 0, Handler(func(ctx *Context) {
+		if !atomic.CompareAndSwapInt32(&done, 0, 1) {
+			return
+		}
+		s.RemoveHook(id)
+		fn(ctx)
+	}))
+	return id
+}
+
+// OnRespIf 注册只对pred返回true的响应执行的OnResp
+func (s *Spider) OnRespIf(pred func(ctx *Context) bool, fn Handler) HookID {
+	return s.OnResp(func(ctx *Context) {
+		if pred(ctx) {
+			fn(ctx)
+		}
+	})
+}
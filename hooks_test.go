@@ -0,0 +1,98 @@
+package gospider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSpider_HookPriority(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	s := NewSpider(WithSynchronousMode())
+	s.Logging = false
+	var events []string
+	record := func(name string) {
+		events = append(events, name)
+	}
+	s.OnTask(func(ctx *Context, t *Task) *Task {
+		record("task 0a")
+		return t
+	})
+	s.OnTaskWithPriority(-10, func(ctx *Context, t *Task) *Task {
+		record("task -10")
+		return t
+	})
+	s.OnTask(func(ctx *Context, t *Task) *Task {
+		record("task 0b")
+		return t
+	})
+	removed := s.OnTaskWithPriority(5, func(ctx *Context, t *Task) *Task {
+		record("task removed")
+		return nil
+	})
+	s.OnRespWithPriority(10, func(ctx *Context) {
+		record("resp 10")
+	})
+	s.OnResp(func(ctx *Context) {
+		record("resp 0")
+	})
+	s.OnItem(func(ctx *Context, i interface{}) interface{} {
+		record("item 0")
+		return i
+	})
+	first := s.OnItemWithPriority(-1, func(ctx *Context, i interface{}) interface{} {
+		record("item -1")
+		return i
+	})
+
+	assert.True(t, s.RemoveHook(removed))
+	assert.False(t, s.RemoveHook(removed))
+	assert.False(t, s.RemoveHook(HookID(1000)))
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		ctx.AddItem(1)
+		assert.True(t, s.RemoveHook(first))
+		ctx.AddItem(2)
+	})
+	s.Wait()
+
+	assert.Equal(t, []string{
+		"task -10", "task 0a", "task 0b",
+		"resp 0", "resp 10",
+		"item -1", "item 0",
+		"item 0",
+	}, events)
+}
+
+func TestSpider_OnRespOnce(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/json" {
+			w.Header().Set("Content-Type", "application/json")
+		}
+	}))
+	defer ts.Close()
+
+	s := NewSpider()
+	s.Logging = false
+	var once, json []string
+	id := s.OnRespOnce(func(ctx *Context) {
+		once = append(once, ctx.Req.URL.Path)
+	})
+	s.OnRespIf(func(ctx *Context) bool {
+		return ctx.Resp.IsJSON()
+	}, func(ctx *Context) {
+		json = append(json, ctx.Req.URL.Path)
+	})
+	// 并发的任务中只有一个执行OnRespOnce，OnRespIf只对JSON执行，不需要加锁
+	for _, p := range []string{"/a", "/b", "/c", "/json"} {
+		s.SeedTask(goreq.Get(ts.URL + p))
+	}
+	s.Wait()
+
+	assert.Len(t, once, 1)
+	assert.False(t, s.RemoveHook(id))
+	assert.Equal(t, []string{"/json"}, json)
+}
@@ -0,0 +1,280 @@
+package gospider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zhshch2002/goreq"
+)
+
+// CacheHeader WithHTTPCache在响应头中标记缓存命中情况，值为CacheHit或CacheRevalidated
+const (
+	CacheHeader      = "X-Gospider-Cache"
+	CacheHit         = "hit"         // 未过期，直接使用缓存
+	CacheRevalidated = "revalidated" // 已过期，条件请求得到304后使用缓存
+)
+
+// CacheStore HTTP缓存的存储后端，可以基于磁盘、LevelDB、Redis等实现
+type CacheStore interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, data []byte)
+	Delete(key string)
+}
+
+// MemoryCacheStore 内存中的缓存
+type MemoryCacheStore struct {
+	data sync.Map
+}
+
+// NewMemoryCacheStore 创建内存缓存
+func NewMemoryCacheStore() *MemoryCacheStore {
+	return &MemoryCacheStore{}
+}
+
+// Get 读取缓存
+func (m *MemoryCacheStore) Get(key string) ([]byte, bool) {
+	v, ok := m.data.Load(key)
+	if !ok {
+		return nil, false
+	}
+	return v.([]byte), true
+}
+
+// Set 写入缓存
+func (m *MemoryCacheStore) Set(key string, data []byte) {
+	m.data.Store(key, data)
+}
+
+// Delete 删除缓存
+func (m *MemoryCacheStore) Delete(key string) {
+	m.data.Delete(key)
+}
+
+// DiskCacheStore 磁盘上的缓存，每个key保存为Dir下以其sha256命名的文件
+type DiskCacheStore struct {
+	Dir string
+}
+
+// NewDiskCacheStore 创建磁盘缓存，目录不存在时会在写入时创建
+func NewDiskCacheStore(dir string) *DiskCacheStore {
+	return &DiskCacheStore{Dir: dir}
+}
+
+func (d *DiskCacheStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.Dir, hex.EncodeToString(sum[:]))
+}
+
+// Get 读取缓存
+func (d *DiskCacheStore) Get(key string) ([]byte, bool) {
+	data, err := ioutil.ReadFile(d.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// Set 写入缓存，先写临时文件再重命名，避免读到写了一半的内容
+func (d *DiskCacheStore) Set(key string, data []byte) {
+	if err := os.MkdirAll(d.Dir, 0755); err != nil {
+		return
+	}
+	f, err := ioutil.TempFile(d.Dir, "tmp-")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return
+	}
+	if err := os.Rename(f.Name(), d.path(key)); err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// Delete 删除缓存
+func (d *DiskCacheStore) Delete(key string) {
+	os.Remove(d.path(key))
+}
+
+// cachedResponse 缓存中保存的响应
+type cachedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Proto      string      `json:"proto"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	Time       time.Time   `json:"time"` // 收到响应(或304)的时间
+}
+
+// response 由保存的响应构造goreq.Response，响应头中加入header: state
+func (c *cachedResponse) response(req *goreq.Request, header, state string) *goreq.Response {
+	h := c.Header.Clone()
+	h.Set(header, state)
+	return &goreq.Response{
+		Response: &http.Response{
+			Status:        strconv.Itoa(c.StatusCode) + " " + http.StatusText(c.StatusCode),
+			StatusCode:    c.StatusCode,
+			Proto:         c.Proto,
+			Header:        h,
+			ContentLength: int64(len(c.Body)),
+			Request:       req.Request,
+		},
+		Body: c.Body,
+		Req:  req,
+	}
+}
+
+// parseCacheControl 解析Cache-Control头，指令名转为小写
+func parseCacheControl(h http.Header) map[string]string {
+	cc := map[string]string{}
+	for _, v := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(v, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			if i := strings.Index(part, "="); i >= 0 {
+				cc[strings.ToLower(strings.TrimSpace(part[:i]))] = strings.Trim(strings.TrimSpace(part[i+1:]), `"`)
+			} else {
+				cc[strings.ToLower(part)] = ""
+			}
+		}
+	}
+	return cc
+}
+
+// freshnessLifetime 响应的有效期(RFC 7234 4.2.1)，依次使用max-age、Expires、Last-Modified的启发式估计
+func (c *cachedResponse) freshnessLifetime() time.Duration {
+	cc := parseCacheControl(c.Header)
+	if _, ok := cc["no-cache"]; ok {
+		return 0
+	}
+	if v, ok := cc["max-age"]; ok {
+		if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Duration(sec) * time.Second
+		}
+		return 0
+	}
+	date, err := http.ParseTime(c.Header.Get("Date"))
+	if err != nil {
+		date = c.Time
+	}
+	if v := c.Header.Get("Expires"); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil {
+			return 0
+		}
+		return expires.Sub(date)
+	}
+	if lm, err := http.ParseTime(c.Header.Get("Last-Modified")); err == nil && date.After(lm) {
+		return date.Sub(lm) / 10
+	}
+	return 0
+}
+
+// age 响应当前的年龄(RFC 7234 4.2.3)
+func (c *cachedResponse) age(now time.Time) time.Duration {
+	age := now.Sub(c.Time)
+	if v, err := strconv.ParseInt(c.Header.Get("Age"), 10, 64); err == nil && v > 0 {
+		age += time.Duration(v) * time.Second
+	}
+	return age
+}
+
+func (c *cachedResponse) fresh(now time.Time) bool {
+	return c.freshnessLifetime() > c.age(now)
+}
+
+// cacheableStatus 默认可缓存的状态码(RFC 7231 6.1)
+var cacheableStatus = map[int]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true, 404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+// WithHTTPCache 按RFC 7234缓存GET和HEAD请求的响应
+// 未过期的响应直接从store返回；已过期但带有ETag或Last-Modified的响应会发送条件请求，得到304时继续使用缓存。
+// 请求或响应带有Cache-Control: no-store时不使用缓存，从缓存返回的响应头中带有CacheHeader
+func WithHTTPCache(store CacheStore) Extension {
+	return func(s *Spider) {
+		s.Client.Use(func(c *goreq.Client, next goreq.Handler) goreq.Handler {
+			return func(req *goreq.Request) *goreq.Response {
+				if req.Err != nil || (req.Method != http.MethodGet && req.Method != http.MethodHead) {
+					return next(req)
+				}
+				reqCC := parseCacheControl(req.Header)
+				if _, ok := reqCC["no-store"]; ok {
+					return next(req)
+				}
+				key := req.Method + " " + req.URL.String()
+
+				var cached *cachedResponse
+				if data, ok := store.Get(key); ok {
+					cached = &cachedResponse{}
+					if json.Unmarshal(data, cached) != nil {
+						cached = nil
+					}
+				}
+				if cached != nil {
+					_, noCache := reqCC["no-cache"]
+					if !noCache && cached.fresh(time.Now()) {
+						return cached.response(req, CacheHeader, CacheHit)
+					}
+					if etag := cached.Header.Get("ETag"); etag != "" && req.Header.Get("If-None-Match") == "" {
+						req.Header.Set("If-None-Match", etag)
+					}
+					if lm := cached.Header.Get("Last-Modified"); lm != "" && req.Header.Get("If-Modified-Since") == "" {
+						req.Header.Set("If-Modified-Since", lm)
+					}
+				}
+
+				resp := next(req)
+				if resp == nil || resp.Err != nil || resp.Response == nil {
+					return resp
+				}
+				if cached != nil && resp.StatusCode == http.StatusNotModified {
+					for k, v := range resp.Header {
+						cached.Header[k] = v
+					}
+					cached.Time = time.Now()
+					if data, err := json.Marshal(cached); err == nil {
+						store.Set(key, data)
+					}
+					return cached.response(req, CacheHeader, CacheRevalidated)
+				}
+
+				respCC := parseCacheControl(resp.Header)
+				if _, ok := respCC["no-store"]; ok || !cacheableStatus[resp.StatusCode] {
+					if cached != nil {
+						store.Delete(key)
+					}
+					return resp
+				}
+				entry := &cachedResponse{
+					StatusCode: resp.StatusCode,
+					Proto:      resp.Proto,
+					Header:     resp.Header.Clone(),
+					Body:       resp.Body,
+					Time:       time.Now(),
+				}
+				if resp.Uncompressed {
+					entry.Header.Del("Content-Encoding")
+					entry.Header.Del("Content-Length")
+				}
+				if data, err := json.Marshal(entry); err == nil {
+					store.Set(key, data)
+				}
+				return resp
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package gospider
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithHTTPCache(t *testing.T) {
+	var fresh, etag, nostore, notModified int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fresh":
+			atomic.AddInt64(&fresh, 1)
+			w.Header().Set("Cache-Control", "max-age=60")
+		case "/etag":
+			atomic.AddInt64(&etag, 1)
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				atomic.AddInt64(&notModified, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/nostore":
+			atomic.AddInt64(&nostore, 1)
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		_, _ = fmt.Fprint(w, "Hello ", r.URL.Path)
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "gospider-cache")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	for _, store := range []CacheStore{NewMemoryCacheStore(), NewDiskCacheStore(dir)} {
+		atomic.StoreInt64(&fresh, 0)
+		atomic.StoreInt64(&etag, 0)
+		atomic.StoreInt64(&nostore, 0)
+		atomic.StoreInt64(&notModified, 0)
+		s := NewSpider(WithHTTPCache(store))
+
+		for i := 0; i < 3; i++ {
+			resp, err := s.Client.Do(goreq.Get(ts.URL + "/fresh")).Resp()
+			if assert.NoError(t, err) {
+				assert.Equal(t, "Hello /fresh", resp.Text)
+				if i > 0 {
+					assert.Equal(t, CacheHit, resp.Header.Get(CacheHeader))
+				}
+			}
+
+			resp, err = s.Client.Do(goreq.Get(ts.URL + "/etag")).Resp()
+			if assert.NoError(t, err) {
+				assert.Equal(t, 200, resp.StatusCode)
+				assert.Equal(t, "Hello /etag", resp.Text)
+				if i > 0 {
+					assert.Equal(t, CacheRevalidated, resp.Header.Get(CacheHeader))
+				}
+			}
+
+			resp, err = s.Client.Do(goreq.Get(ts.URL + "/nostore")).Resp()
+			if assert.NoError(t, err) {
+				assert.Equal(t, "", resp.Header.Get(CacheHeader))
+			}
+		}
+		assert.Equal(t, int64(1), atomic.LoadInt64(&fresh))
+		assert.Equal(t, int64(3), atomic.LoadInt64(&etag))
+		assert.Equal(t, int64(2), atomic.LoadInt64(&notModified))
+		assert.Equal(t, int64(3), atomic.LoadInt64(&nostore))
+	}
+}
+
+func TestCachedResponse_freshnessLifetime(t *testing.T) {
+	c := &cachedResponse{Header: http.Header{}}
+	c.Header.Set("Date", "Mon, 02 Jan 2006 15:04:05 GMT")
+	c.Header.Set("Expires", "Mon, 02 Jan 2006 15:14:05 GMT")
+	assert.Equal(t, 10*time.Minute, c.freshnessLifetime())
+
+	c.Header.Set("Cache-Control", "public, max-age=30")
+	assert.Equal(t, 30*time.Second, c.freshnessLifetime())
+
+	c.Header.Set("Cache-Control", "no-cache, max-age=30")
+	assert.Equal(t, time.Duration(0), c.freshnessLifetime())
+
+	c.Header = http.Header{}
+	c.Header.Set("Date", "Mon, 12 Jan 2006 15:04:05 GMT")
+	c.Header.Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+	assert.Equal(t, 24*time.Hour, c.freshnessLifetime())
+}
@@ -0,0 +1,280 @@
+package gospider
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // 注册GIF解码器
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrUnsupportedImage 不支持的图片格式，支持jpeg、png、gif和webp(webp只读取尺寸)
+	ErrUnsupportedImage = errors.New("unsupported image format")
+)
+
+// ImageInfo 图片的元数据，WithImageMetadata将其作为Item输出
+type ImageInfo struct {
+	URL    string            `json:"url,omitempty"`
+	Format string            `json:"format"` // jpeg、png、gif或webp
+	Width  int               `json:"width"`
+	Height int               `json:"height"`
+	Size   int               `json:"size"`            // 字节数
+	EXIF   map[string]string `json:"exif,omitempty"`  // JPEG的EXIF信息，如Make、Model、DateTimeOriginal、GPSLatitude
+	PHash  uint64            `json:"phash,omitempty"` // 感知哈希(dHash)，相似图片的海明距离小(见HammingDistance)，需要解码完整图片
+}
+
+// ParseImage 读取图片的格式、尺寸和EXIF，phash为true时计算感知哈希
+func ParseImage(data []byte, phash bool) (*ImageInfo, error) {
+	info := &ImageInfo{Size: len(data)}
+	if w, h, ok := webpSize(data); ok {
+		info.Format, info.Width, info.Height = "webp", w, h
+		return info, nil
+	}
+	conf, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		if err == image.ErrFormat {
+			return nil, ErrUnsupportedImage
+		}
+		return nil, err
+	}
+	info.Format, info.Width, info.Height = format, conf.Width, conf.Height
+	if format == "jpeg" {
+		info.EXIF = jpegEXIF(data)
+	}
+	if phash {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		info.PHash = dHash(img)
+	}
+	return info, nil
+}
+
+// WithImageMetadata 将图片响应(Content-Type为image/*或内容可识别为图片)的元数据作为ImageInfo输出为Item，用于统计和去重图片
+// phash为true时计算感知哈希，需要解码完整图片
+func WithImageMetadata(phash bool) Extension {
+	return func(s *Spider) {
+		s.OnResp(func(ctx *Context) {
+			if len(ctx.Resp.Body) == 0 {
+				return
+			}
+			if !strings.HasPrefix(mediaType(ctx.Resp.Header.Get("Content-Type")), "image/") &&
+				!strings.HasPrefix(http.DetectContentType(ctx.Resp.Body), "image/") {
+				return
+			}
+			info, err := ParseImage(ctx.Resp.Body, phash)
+			if err != nil {
+				if err != ErrUnsupportedImage {
+					s.writeLog(ctx, LogError, "image parse error", "error", err, "spider", s.Name, "context", ctx.String())
+				}
+				return
+			}
+			info.URL = ctx.Req.URL.String()
+			ctx.AddItem(*info)
+		})
+	}
+}
+
+// webpSize 读取WebP的尺寸
+func webpSize(b []byte) (int, int, bool) {
+	if len(b) < 30 || string(b[0:4]) != "RIFF" || string(b[8:12]) != "WEBP" {
+		return 0, 0, false
+	}
+	switch string(b[12:16]) {
+	case "VP8 ":
+		if b[23] != 0x9d || b[24] != 0x01 || b[25] != 0x2a {
+			return 0, 0, false
+		}
+		return int(binary.LittleEndian.Uint16(b[26:28]) & 0x3fff), int(binary.LittleEndian.Uint16(b[28:30]) & 0x3fff), true
+	case "VP8L":
+		if b[20] != 0x2f {
+			return 0, 0, false
+		}
+		v := binary.LittleEndian.Uint32(b[21:25])
+		return int(v&0x3fff) + 1, int(v>>14&0x3fff) + 1, true
+	case "VP8X":
+		w := int(b[24]) | int(b[25])<<8 | int(b[26])<<16
+		h := int(b[27]) | int(b[28])<<8 | int(b[29])<<16
+		return w + 1, h + 1, true
+	}
+	return 0, 0, false
+}
+
+// exifTags 读取的EXIF标签
+var exifTags = map[uint16]string{
+	0x010f: "Make",
+	0x0110: "Model",
+	0x0112: "Orientation",
+	0x0131: "Software",
+	0x0132: "DateTime",
+	0x013b: "Artist",
+	0x8298: "Copyright",
+	0x9003: "DateTimeOriginal",
+	0xa002: "PixelXDimension",
+	0xa003: "PixelYDimension",
+}
+
+// gpsTags 读取的GPS标签
+var gpsTags = map[uint16]string{
+	0x0001: "GPSLatitudeRef",
+	0x0002: "GPSLatitude",
+	0x0003: "GPSLongitudeRef",
+	0x0004: "GPSLongitude",
+}
+
+// jpegEXIF 从JPEG的APP1段读取EXIF，没有或无法解析时为nil
+func jpegEXIF(b []byte) map[string]string {
+	for i := 2; i+4 <= len(b) && b[i] == 0xff; {
+		marker := b[i+1]
+		if marker == 0xda || marker == 0xd9 { // 图像数据开始
+			break
+		}
+		n := int(binary.BigEndian.Uint16(b[i+2 : i+4]))
+		if i+2+n > len(b) {
+			break
+		}
+		seg := b[i+4 : i+2+n]
+		if marker == 0xe1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return parseTIFF(seg[6:])
+		}
+		i += 2 + n
+	}
+	return nil
+}
+
+// parseTIFF 解析EXIF的TIFF结构，读取IFD0、Exif IFD和GPS IFD中的常用标签
+func parseTIFF(t []byte) map[string]string {
+	if len(t) < 8 {
+		return nil
+	}
+	var bo binary.ByteOrder
+	switch string(t[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return nil
+	}
+	res := map[string]string{}
+	var readIFD func(off uint32, tags map[uint16]string, depth int)
+	readIFD = func(off uint32, tags map[uint16]string, depth int) {
+		if depth > 2 || int(off)+2 > len(t) {
+			return
+		}
+		count := int(bo.Uint16(t[off:]))
+		for i := 0; i < count; i++ {
+			e := int(off) + 2 + i*12
+			if e+12 > len(t) {
+				return
+			}
+			tag, typ, n := bo.Uint16(t[e:]), bo.Uint16(t[e+2:]), bo.Uint32(t[e+4:])
+			switch tag {
+			case 0x8769:
+				readIFD(bo.Uint32(t[e+8:]), exifTags, depth+1)
+				continue
+			case 0x8825:
+				readIFD(bo.Uint32(t[e+8:]), gpsTags, depth+1)
+				continue
+			}
+			name, ok := tags[tag]
+			if !ok {
+				continue
+			}
+			if v, ok := tiffValue(t, bo, typ, n, t[e+8:e+12]); ok {
+				res[name] = v
+			}
+		}
+	}
+	readIFD(bo.Uint32(t[4:]), exifTags, 0)
+	if len(res) == 0 {
+		return nil
+	}
+	return res
+}
+
+// tiffValue 将ASCII、SHORT、LONG和RATIONAL类型的值格式化为字符串，多个值以逗号分隔
+func tiffValue(t []byte, bo binary.ByteOrder, typ uint16, n uint32, inline []byte) (string, bool) {
+	size := map[uint16]uint32{2: 1, 3: 2, 4: 4, 5: 8}[typ]
+	if size == 0 || n == 0 || n > 1024 {
+		return "", false
+	}
+	data := inline
+	if size*n > 4 {
+		off := bo.Uint32(inline)
+		if uint64(off)+uint64(size*n) > uint64(len(t)) {
+			return "", false
+		}
+		data = t[off : off+size*n]
+	}
+	if typ == 2 {
+		return strings.TrimRight(string(data[:n]), "\x00 "), true
+	}
+	var parts []string
+	for i := uint32(0); i < n; i++ {
+		switch typ {
+		case 3:
+			parts = append(parts, fmt.Sprint(bo.Uint16(data[i*2:])))
+		case 4:
+			parts = append(parts, fmt.Sprint(bo.Uint32(data[i*4:])))
+		case 5:
+			num, den := bo.Uint32(data[i*8:]), bo.Uint32(data[i*8+4:])
+			if den == 0 {
+				parts = append(parts, "0")
+			} else {
+				parts = append(parts, fmt.Sprint(float64(num)/float64(den)))
+			}
+		}
+	}
+	return strings.Join(parts, ","), true
+}
+
+// dHash 差值哈希：缩小为9x8的灰度图，比较每行相邻像素的亮度
+func dHash(img image.Image) uint64 {
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return 0
+	}
+	var gray [8][9]float64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 9; x++ {
+			// 对应区域内像素的平均亮度
+			x0, x1 := b.Min.X+x*b.Dx()/9, b.Min.X+(x+1)*b.Dx()/9
+			y0, y1 := b.Min.Y+y*b.Dy()/8, b.Min.Y+(y+1)*b.Dy()/8
+			if x1 == x0 {
+				x1++
+			}
+			if y1 == y0 {
+				y1++
+			}
+			sum, cnt := 0.0, 0
+			for py := y0; py < y1 && py < b.Max.Y; py++ {
+				for px := x0; px < x1 && px < b.Max.X; px++ {
+					sum += float64(color.GrayModel.Convert(img.At(px, py)).(color.Gray).Y)
+					cnt++
+				}
+			}
+			if cnt > 0 {
+				gray[y][x] = sum / float64(cnt)
+			}
+		}
+	}
+	var h uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			h <<= 1
+			if gray[y][x] < gray[y][x+1] {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
@@ -0,0 +1,128 @@
+package gospider
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// testImage 生成左暗右亮的渐变图片
+func testImage(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(x * 255 / w)
+			img.Set(x, y, color.RGBA{v, uint8(y * 255 / h), v, 255})
+		}
+	}
+	return img
+}
+
+// testJPEG 生成带有EXIF(Make、Orientation、DateTimeOriginal)的JPEG
+func testJPEG(t *testing.T) []byte {
+	buf := &bytes.Buffer{}
+	assert.NoError(t, jpeg.Encode(buf, testImage(40, 30), nil))
+
+	le := binary.LittleEndian
+	tiff := &bytes.Buffer{}
+	tiff.WriteString("II*\x00")
+	binary.Write(tiff, le, uint32(8))
+	// IFD0：3个条目，从8开始，长度2+3*12+4=42，数据区从50开始
+	binary.Write(tiff, le, uint16(3))
+	binary.Write(tiff, le, []uint16{0x010f, 2})
+	binary.Write(tiff, le, []uint32{6, 50})
+	binary.Write(tiff, le, []uint16{0x0112, 3})
+	binary.Write(tiff, le, []uint32{1, 6})
+	binary.Write(tiff, le, []uint16{0x8769, 4})
+	binary.Write(tiff, le, []uint32{1, 56})
+	binary.Write(tiff, le, uint32(0))
+	tiff.WriteString("Canon\x00")
+	// Exif IFD：1个条目，从56开始，长度18，数据区从74开始
+	binary.Write(tiff, le, uint16(1))
+	binary.Write(tiff, le, []uint16{0x9003, 2})
+	binary.Write(tiff, le, []uint32{20, 74})
+	binary.Write(tiff, le, uint32(0))
+	tiff.WriteString("2020:01:02 03:04:05\x00")
+
+	app1 := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	seg := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(app1)+2))
+	data := buf.Bytes()
+	return append(append(append([]byte{}, data[:2]...), append(seg, app1...)...), data[2:]...)
+}
+
+func TestParseImage(t *testing.T) {
+	info, err := ParseImage(testJPEG(t), true)
+	assert.NoError(t, err)
+	assert.Equal(t, "jpeg", info.Format)
+	assert.Equal(t, 40, info.Width)
+	assert.Equal(t, 30, info.Height)
+	assert.Equal(t, map[string]string{
+		"Make":             "Canon",
+		"Orientation":      "6",
+		"DateTimeOriginal": "2020:01:02 03:04:05",
+	}, info.EXIF)
+	assert.NotZero(t, info.PHash)
+
+	// 同一张图片缩放后感知哈希相近
+	buf := &bytes.Buffer{}
+	assert.NoError(t, png.Encode(buf, testImage(200, 150)))
+	big, err := ParseImage(buf.Bytes(), true)
+	assert.NoError(t, err)
+	assert.Equal(t, "png", big.Format)
+	assert.Nil(t, big.EXIF)
+	assert.LessOrEqual(t, HammingDistance(info.PHash, big.PHash), 6)
+
+	webp := []byte("RIFF\x00\x00\x00\x00WEBPVP8X\x0a\x00\x00\x00\x00\x00\x00\x00\x3f\x00\x00\x1f\x00\x00")
+	info, err = ParseImage(webp, true)
+	assert.NoError(t, err)
+	assert.Equal(t, &ImageInfo{Format: "webp", Width: 64, Height: 32, Size: len(webp)}, info)
+
+	_, err = ParseImage([]byte("<html></html>"), false)
+	assert.Equal(t, ErrUnsupportedImage, err)
+}
+
+func TestWithImageMetadata(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.NoError(t, png.Encode(buf, testImage(8, 4)))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(buf.Bytes())
+		case "/download":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(testJPEG(t))
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<p>hi</p>"))
+		}
+	}))
+	defer ts.Close()
+
+	s := NewSpider(WithSynchronousMode(), WithImageMetadata(false))
+	s.Logging = false
+	var items []ImageInfo
+	s.OnItem(func(ctx *Context, i interface{}) interface{} {
+		items = append(items, i.(ImageInfo))
+		return i
+	})
+	s.SeedTask(goreq.Get(ts.URL + "/a.png"))
+	s.SeedTask(goreq.Get(ts.URL + "/download"))
+	s.SeedTask(goreq.Get(ts.URL + "/page"))
+	s.Wait()
+	if assert.Len(t, items, 2) {
+		assert.Equal(t, ImageInfo{URL: ts.URL + "/a.png", Format: "png", Width: 8, Height: 4, Size: buf.Len()}, items[0])
+		assert.Equal(t, "jpeg", items[1].Format)
+		assert.Equal(t, "Canon", items[1].EXIF["Make"])
+		assert.Zero(t, items[1].PHash)
+	}
+}
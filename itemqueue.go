@@ -0,0 +1,92 @@
+package gospider
+
+import "sync"
+
+// itemQueue 有界的Item队列，由固定数量的worker执行OnItem
+type itemQueue struct {
+	ch      chan *Item
+	workers int
+	shed    bool
+
+	lock    sync.Mutex
+	running bool
+	done    chan struct{} // 关闭时worker退出
+}
+
+// WithItemQueue AddItem将Item放入容量为size的队列，由workers个goroutine执行OnItem(及ItemPipeline)，
+// 代替每个Item启动一个goroutine。队列已满时AddItem阻塞直到有空位，产生Item的速度因此受保存速度限制；
+// shed为true时不阻塞，丢弃该Item并调用OnItemShed。同步模式下Item仍在AddItem时直接处理
+// OnItem中再调用AddItem时，队列已满且不丢弃可能导致所有worker互相等待
+func WithItemQueue(size, workers int, shed bool) Extension {
+	if workers < 1 {
+		workers = 1
+	}
+	return func(s *Spider) {
+		q := &itemQueue{
+			ch:      make(chan *Item, size),
+			workers: workers,
+			shed:    shed,
+		}
+		s.items = q
+		s.useExtension(q)
+	}
+}
+
+// Init 无操作，worker在第一个Item加入时启动
+func (q *itemQueue) Init(s *Spider) error {
+	return nil
+}
+
+// Close 停止worker，队列此时已经为空(Wait等待所有Item处理完)，之后加入Item时重新启动
+func (q *itemQueue) Close() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.running {
+		close(q.done)
+		q.running = false
+	}
+	return nil
+}
+
+// start 启动worker
+func (q *itemQueue) start(s *Spider) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.running {
+		return
+	}
+	q.running = true
+	q.done = make(chan struct{})
+	for i := 0; i < q.workers; i++ {
+		go q.work(s, q.done)
+	}
+}
+
+func (q *itemQueue) work(s *Spider, done chan struct{}) {
+	for {
+		select {
+		case i := <-q.ch:
+			s.handleOnItem(i)
+			s.wg.Done()
+		case <-done:
+			return
+		}
+	}
+}
+
+// push 加入Item，丢弃时返回false
+func (q *itemQueue) push(s *Spider, i *Item) bool {
+	q.start(s)
+	s.wg.Add(1)
+	if !q.shed {
+		q.ch <- i
+		return true
+	}
+	select {
+	case q.ch <- i:
+		return true
+	default:
+		s.wg.Done()
+		return false
+	}
+}
@@ -0,0 +1,80 @@
+package gospider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithItemQueue(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	release := make(chan struct{})
+	s := NewSpider(WithItemQueue(1, 1, false))
+	s.Logging = false
+	var active, maxActive, processed int32
+	s.OnItem(func(ctx *Context, i interface{}) interface{} {
+		n := atomic.AddInt32(&active, 1)
+		if n > atomic.LoadInt32(&maxActive) {
+			atomic.StoreInt32(&maxActive, n)
+		}
+		<-release
+		atomic.AddInt32(&active, -1)
+		atomic.AddInt32(&processed, 1)
+		return i
+	})
+	var added int32
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		for i := 0; i < 4; i++ {
+			ctx.AddItem(i)
+			atomic.AddInt32(&added, 1)
+		}
+	})
+	time.Sleep(100 * time.Millisecond)
+	// 一个Item在处理，一个在队列中，第三个AddItem阻塞
+	assert.Equal(t, int32(2), atomic.LoadInt32(&added))
+	close(release)
+	s.Wait()
+	assert.Equal(t, int32(4), atomic.LoadInt32(&added))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&processed))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&maxActive))
+	assert.Equal(t, int64(4), s.Status.TotalItem)
+}
+
+func TestWithItemQueue_Shed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	s := NewSpider(WithItemQueue(1, 1, true))
+	s.Logging = false
+	var processed int32
+	s.OnItem(func(ctx *Context, i interface{}) interface{} {
+		started <- struct{}{}
+		<-release
+		atomic.AddInt32(&processed, 1)
+		return i
+	})
+	var shed []interface{}
+	s.OnItemShed(func(ctx *Context, i interface{}) {
+		shed = append(shed, i)
+	})
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		ctx.AddItem(0)
+		<-started
+		for i := 1; i < 5; i++ {
+			ctx.AddItem(i)
+		}
+		close(release)
+	})
+	s.Wait()
+	assert.Equal(t, []interface{}{2, 3, 4}, shed)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&processed))
+	assert.Equal(t, int64(2), s.Status.TotalItem)
+}
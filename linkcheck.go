@@ -0,0 +1,176 @@
+package gospider
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/zhshch2002/goreq"
+)
+
+// linkCheckMetaKey 死链检查任务的类型：page(站内页面，GET并提取链接)、head(只检查状态)、get(HEAD失败后用GET重新检查)
+const linkCheckMetaKey = "_link_check"
+
+// LinkResult 死链检查的结果，失效的链接(状态码>=400或请求失败)会作为Item输出
+type LinkResult struct {
+	URL        string   `json:"url"`
+	StatusCode int      `json:"status_code,omitempty"` // 跟随重定向后的状态码，请求失败时为0
+	Error      string   `json:"error,omitempty"`       // 请求失败的原因
+	Referers   []string `json:"referers"`              // 包含该链接的页面，作为Item输出时只包含检查时已发现的页面
+}
+
+// Broken 链接是否失效
+func (r LinkResult) Broken() bool {
+	return r.Error != "" || r.StatusCode >= 400
+}
+
+// linkChecker 死链检查的状态
+type linkChecker struct {
+	lock    sync.Mutex
+	hosts   map[string]bool        // 需要爬取的站点，即种子的host
+	results map[string]*LinkResult // 已发现的链接
+}
+
+// WithLinkChecker 死链检查模式，使用CheckLinks加入种子页面
+// 从种子页面开始爬取同一站点(host相同)的页面，页面中的链接(a、link、img、script、iframe等)都会被检查：
+// 站内的a链接使用GET请求并继续提取链接，其他链接先发送HEAD请求，失败或状态码>=400时改用GET再检查一次；
+// 失效的链接以LinkResult输出为Item，全部结果在Wait之后由LinkResults获得
+func WithLinkChecker() Extension {
+	return func(s *Spider) {
+		l := &linkChecker{hosts: map[string]bool{}, results: map[string]*LinkResult{}}
+		s.linkCheck = l
+		onErr := func(ctx *Context, err error) {
+			if mode, _ := ctx.Meta[linkCheckMetaKey].(string); mode != "" {
+				l.finish(ctx, mode, 0, err)
+			}
+		}
+		s.OnReqError(onErr)
+		s.OnRespError(onErr)
+	}
+}
+
+// CheckLinks 加入死链检查的种子页面，需先使用WithLinkChecker
+func (s *Spider) CheckLinks(seeds ...string) {
+	l := s.linkCheck
+	if l == nil {
+		panic("gospider: CheckLinks requires WithLinkChecker")
+	}
+	for _, seed := range seeds {
+		req := goreq.Get(seed)
+		if req.Err == nil {
+			l.lock.Lock()
+			l.hosts[strings.ToLower(req.URL.Host)] = true
+			l.lock.Unlock()
+			l.found(req.URL.String(), "")
+		}
+		s.AddTask(NewTask(req, map[string]interface{}{linkCheckMetaKey: "page"}, l.handle))
+	}
+}
+
+// LinkResults 所有已检查的链接的结果，按URL排序
+func (s *Spider) LinkResults() []LinkResult {
+	l := s.linkCheck
+	if l == nil {
+		return nil
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	res := make([]LinkResult, 0, len(l.results))
+	for _, r := range l.results {
+		i := *r
+		i.Referers = append([]string(nil), r.Referers...)
+		res = append(res, i)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].URL < res[j].URL
+	})
+	return res
+}
+
+// found 记录链接和引用它的页面，返回是否第一次发现
+func (l *linkChecker) found(link, referer string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	r, ok := l.results[link]
+	if !ok {
+		r = &LinkResult{URL: link, Referers: []string{}}
+		l.results[link] = r
+	}
+	if referer != "" {
+		for _, i := range r.Referers {
+			if i == referer {
+				return !ok
+			}
+		}
+		r.Referers = append(r.Referers, referer)
+	}
+	return !ok
+}
+
+// handle 死链检查任务的处理方法
+func (l *linkChecker) handle(ctx *Context) {
+	mode, _ := ctx.Meta[linkCheckMetaKey].(string)
+	if !l.finish(ctx, mode, ctx.Resp.StatusCode, nil) || mode != "page" || !ctx.Resp.IsHTML() {
+		return
+	}
+	doc, err := ctx.HTML()
+	if err != nil {
+		return
+	}
+	page := ctx.Req.URL.String()
+	base := ctx.FinalURL()
+	doc.Find("a[href], area[href], link[href], img[src], script[src], iframe[src], source[src]").Each(func(i int, sel *goquery.Selection) {
+		href, ok := sel.Attr("href")
+		if !ok {
+			href = sel.AttrOr("src", "")
+		}
+		u, err := base.Parse(strings.TrimSpace(href))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return
+		}
+		u.Fragment = ""
+		link := u.String()
+		if !l.found(link, page) {
+			return
+		}
+		l.lock.Lock()
+		internal := l.hosts[strings.ToLower(u.Host)]
+		l.lock.Unlock()
+		if internal && (goquery.NodeName(sel) == "a" || goquery.NodeName(sel) == "area") {
+			ctx.addTask(goreq.Get(link), map[string]interface{}{linkCheckMetaKey: "page"}, time.Time{}, l.handle)
+		} else {
+			ctx.addTask(goreq.Head(link), map[string]interface{}{linkCheckMetaKey: "head"}, time.Time{}, l.handle)
+		}
+	})
+}
+
+// finish 记录检查结果，HEAD检查失败时改用GET重新检查(不再经过OnTask)；返回链接是否有效
+func (l *linkChecker) finish(ctx *Context, mode string, status int, err error) bool {
+	link := ctx.Req.URL.String()
+	if mode == "head" && (err != nil || status >= 400) {
+		get := NewTask(goreq.Get(link), map[string]interface{}{linkCheckMetaKey: "get"}, l.handle)
+		get.Depth = ctx.Depth()
+		ctx.s.addTask(get)
+		return false
+	}
+	l.lock.Lock()
+	r, ok := l.results[link]
+	if !ok {
+		r = &LinkResult{URL: link, Referers: []string{}}
+		l.results[link] = r
+	}
+	r.StatusCode = status
+	if err != nil {
+		r.Error = err.Error()
+	}
+	res := *r
+	res.Referers = append([]string(nil), r.Referers...)
+	l.lock.Unlock()
+	if res.Broken() {
+		ctx.AddItem(res)
+		return false
+	}
+	return true
+}
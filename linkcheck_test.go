@@ -0,0 +1,72 @@
+package gospider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWithLinkChecker(t *testing.T) {
+	lock := sync.Mutex{}
+	methods := map[string][]string{}
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		methods[r.Host+r.URL.Path] = append(methods[r.Host+r.URL.Path], r.Method)
+		lock.Unlock()
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			external := strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)
+			w.Write([]byte(`<a href="/a">a</a><a href="/missing">x</a><img src="/logo.png"><a href="` + external + `/ok">ext</a>`))
+		case "/a":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<a href="/">home</a><a href="/missing#top">x</a><script src="/nohead.js"></script>`))
+		case "/logo.png", "/ok":
+		case "/nohead.js":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+	external := strings.Replace(host, "127.0.0.1", "localhost", 1)
+
+	s := NewSpider(WithLinkChecker())
+	s.Logging = false
+	var items []interface{}
+	s.OnItem(func(ctx *Context, i interface{}) interface{} {
+		lock.Lock()
+		defer lock.Unlock()
+		items = append(items, i)
+		return i
+	})
+	s.CheckLinks(ts.URL + "/")
+	s.Wait()
+
+	res := map[string]LinkResult{}
+	for _, r := range s.LinkResults() {
+		res[strings.TrimPrefix(r.URL, ts.URL)] = r
+	}
+	assert.Len(t, res, 6)
+	assert.Equal(t, http.StatusNotFound, res["/missing"].StatusCode)
+	assert.True(t, res["/missing"].Broken())
+	assert.ElementsMatch(t, []string{ts.URL + "/", ts.URL + "/a"}, res["/missing"].Referers)
+	assert.Equal(t, http.StatusOK, res["/nohead.js"].StatusCode)
+	assert.False(t, res["/nohead.js"].Broken())
+	assert.Equal(t, []string{ts.URL + "/"}, res["/logo.png"].Referers)
+
+	assert.Len(t, items, 1)
+	assert.Equal(t, ts.URL+"/missing", items[0].(LinkResult).URL)
+
+	assert.Equal(t, []string{"GET"}, methods[host+"/a"])
+	assert.Equal(t, []string{"HEAD"}, methods[host+"/logo.png"])
+	assert.Equal(t, []string{"HEAD", "GET"}, methods[host+"/nohead.js"])
+	assert.Equal(t, []string{"HEAD"}, methods[external+"/ok"])
+}
@@ -0,0 +1,203 @@
+package gospider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+)
+
+// Logger 日志接口，keyvals为交替的键值对，如 "spider", s.Name, "error", err
+// *slog.Logger可以直接作为Logger使用，zap、logrus等可以简单包装后使用
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+// NewZerologLogger 将zerolog.Logger包装为Logger，爬虫默认使用输出到标准输出的zerolog
+func NewZerologLogger(l zerolog.Logger) Logger {
+	return &zerologLogger{l: l}
+}
+
+type zerologLogger struct {
+	l zerolog.Logger
+}
+
+func (z *zerologLogger) Debug(msg string, keyvals ...interface{}) {
+	z.l.Debug().Fields(keyvalsMap(keyvals)).Msg(msg)
+}
+
+func (z *zerologLogger) Info(msg string, keyvals ...interface{}) {
+	z.l.Info().Fields(keyvalsMap(keyvals)).Msg(msg)
+}
+
+func (z *zerologLogger) Warn(msg string, keyvals ...interface{}) {
+	z.l.Warn().Fields(keyvalsMap(keyvals)).Msg(msg)
+}
+
+func (z *zerologLogger) Error(msg string, keyvals ...interface{}) {
+	z.l.Error().Fields(keyvalsMap(keyvals)).Msg(msg)
+}
+
+// keyvalsMap 将键值对转换为map，缺少值的键对应"!MISSING"
+func keyvalsMap(keyvals []interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(keyvals)/2)
+	for i := 0; i < len(keyvals); i += 2 {
+		k, ok := keyvals[i].(string)
+		if !ok {
+			k = fmt.Sprint(keyvals[i])
+		}
+		if i+1 < len(keyvals) {
+			m[k] = keyvals[i+1]
+		} else {
+			m[k] = "!MISSING"
+		}
+	}
+	return m
+}
+
+// contextLogWriter 将zerolog输出的JSON日志转为键值对交给爬虫的Logger(见Context.Error)
+type contextLogWriter struct {
+	c *Context
+}
+
+func (w contextLogWriter) Write(p []byte) (int, error) {
+	fields := map[string]interface{}{}
+	d := json.NewDecoder(bytes.NewReader(p))
+	d.UseNumber()
+	if err := d.Decode(&fields); err != nil {
+		return 0, err
+	}
+	msg, _ := fields[zerolog.MessageFieldName].(string)
+	delete(fields, zerolog.MessageFieldName)
+	delete(fields, zerolog.LevelFieldName)
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	keyvals := make([]interface{}, 0, len(keys)*2)
+	for _, k := range keys {
+		keyvals = append(keyvals, k, fields[k])
+	}
+	w.c.s.writeLog(w.c, LogError, msg, keyvals...)
+	return len(p), nil
+}
+
+// LogLevel 日志级别
+type LogLevel int8
+
+const (
+	LogDebug    LogLevel = iota // 调试日志，如任务完成
+	LogInfo                     // 一般信息
+	LogWarn                     // 警告
+	LogError                    // 错误，如请求错误、handler panic
+	LogDisabled                 // 关闭所有日志
+)
+
+// String 日志级别的名称
+func (l LogLevel) String() string {
+	switch l {
+	case LogDebug:
+		return "debug"
+	case LogInfo:
+		return "info"
+	case LogWarn:
+		return "warn"
+	case LogError:
+		return "error"
+	case LogDisabled:
+		return "disabled"
+	}
+	return fmt.Sprintf("LogLevel(%d)", int8(l))
+}
+
+// LogEvent 框架输出的一条日志，可以在OnLog中修改
+type LogEvent struct {
+	Level   LogLevel
+	Msg     string
+	Keyvals []interface{} // 交替的键值对
+}
+
+// Set 向日志追加一个字段
+func (e *LogEvent) Set(key string, value interface{}) *LogEvent {
+	e.Keyvals = append(e.Keyvals, key, value)
+	return e
+}
+
+// Get 返回日志中key对应的值，有重复的键时返回最后一个
+func (e *LogEvent) Get(key string) (interface{}, bool) {
+	for i := len(e.Keyvals) - 2; i >= 0; i -= 2 {
+		if k, ok := e.Keyvals[i].(string); ok && k == key {
+			return e.Keyvals[i+1], true
+		}
+	}
+	return nil, false
+}
+
+// SetLogger 设置爬虫使用的日志
+func (s *Spider) SetLogger(l Logger) {
+	s.logger = l
+}
+
+// Logger 爬虫使用的日志
+func (s *Spider) Logger() Logger {
+	return s.logger
+}
+
+// SetLogLevel 设置爬虫的日志级别，低于level的日志不会输出，默认为LogDebug
+func (s *Spider) SetLogLevel(level LogLevel) {
+	s.logLevel = level
+}
+
+// LogLevel 爬虫的日志级别
+func (s *Spider) LogLevel() LogLevel {
+	return s.logLevel
+}
+
+// SetLogSampling 设置成功任务日志的采样，每n个成功完成的任务只输出一条"Finish"日志
+// n小于等于1时不采样，错误日志不受采样影响
+func (s *Spider) SetLogSampling(n uint64) {
+	atomic.StoreUint64(&s.logSampling, n)
+}
+
+// logEnabled 是否输出level级别的日志
+func (s *Spider) logEnabled(level LogLevel) bool {
+	return s.Logging && s.logger != nil && level >= s.logLevel && level < LogDisabled
+}
+
+// logSampled 按采样设置判断本次是否输出
+func (s *Spider) logSampled() bool {
+	n := atomic.LoadUint64(&s.logSampling)
+	if n <= 1 {
+		return true
+	}
+	return atomic.AddUint64(&s.logSampleCount, 1)%n == 1
+}
+
+// writeLog 按日志级别输出框架日志，ctx不为nil时先经过OnLog
+func (s *Spider) writeLog(ctx *Context, level LogLevel, msg string, keyvals ...interface{}) {
+	if !s.logEnabled(level) {
+		return
+	}
+	if ctx != nil && len(s.onLogHandlers) > 0 {
+		e := &LogEvent{Level: level, Msg: msg, Keyvals: keyvals}
+		s.handleOnLog(ctx, e)
+		level, msg, keyvals = e.Level, e.Msg, e.Keyvals
+	}
+	switch level {
+	case LogDebug:
+		s.logger.Debug(msg, keyvals...)
+	case LogInfo:
+		s.logger.Info(msg, keyvals...)
+	case LogWarn:
+		s.logger.Warn(msg, keyvals...)
+	default:
+		s.logger.Error(msg, keyvals...)
+	}
+}
@@ -0,0 +1,191 @@
+package gospider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type testLogRecord struct {
+	Level   string
+	Msg     string
+	Keyvals []interface{}
+}
+
+type testLogger struct {
+	lock    sync.Mutex
+	records []testLogRecord
+}
+
+func (l *testLogger) log(level, msg string, keyvals []interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.records = append(l.records, testLogRecord{Level: level, Msg: msg, Keyvals: keyvals})
+}
+
+func (l *testLogger) Debug(msg string, keyvals ...interface{}) { l.log("debug", msg, keyvals) }
+func (l *testLogger) Info(msg string, keyvals ...interface{})  { l.log("info", msg, keyvals) }
+func (l *testLogger) Warn(msg string, keyvals ...interface{})  { l.log("warn", msg, keyvals) }
+func (l *testLogger) Error(msg string, keyvals ...interface{}) { l.log("error", msg, keyvals) }
+
+func TestSpider_SetLogger(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+
+	l := &testLogger{}
+	s := NewSpider()
+	s.SetLogger(l)
+	assert.Equal(t, l, s.Logger())
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		ctx.Println("hello")
+	})
+	s.SeedTask(goreq.Get("http://127.0.0.1:1/"))
+	s.Wait()
+
+	msgs := map[string]testLogRecord{}
+	for _, r := range l.records {
+		msgs[r.Msg] = r
+	}
+	assert.Equal(t, "debug", msgs["hello"].Level)
+	assert.Equal(t, "error", msgs["resp error"].Level)
+	assert.Equal(t, "spider", msgs["resp error"].Keyvals[2])
+	assert.Equal(t, "debug", msgs["Finish"].Level)
+}
+
+func TestContext_Error(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+
+	l := &testLogger{}
+	s := NewSpider(WithSynchronousMode())
+	s.SetLogger(l)
+	s.SetLogLevel(LogError)
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		ctx.Error().Str("url", ctx.Req.URL.String()).Int("count", 2).Msg("parse failed")
+	})
+	s.Wait()
+
+	if assert.Len(t, l.records, 1) {
+		assert.Equal(t, "error", l.records[0].Level)
+		assert.Equal(t, "parse failed", l.records[0].Msg)
+		assert.Equal(t, []interface{}{"count", json.Number("2"), "url", ts.URL}, l.records[0].Keyvals)
+	}
+
+	s.Logging = false
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		ctx.Error().Msg("parse failed")
+	})
+	s.Wait()
+	assert.Len(t, l.records, 1)
+}
+
+func TestNewZerologLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := NewZerologLogger(zerolog.New(buf))
+	l.Info("hello", "spider", "test", "count", 1, "odd")
+
+	m := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &m))
+	assert.Equal(t, "info", m["level"])
+	assert.Equal(t, "hello", m["message"])
+	assert.Equal(t, "test", m["spider"])
+	assert.Equal(t, float64(1), m["count"])
+	assert.Equal(t, "!MISSING", m["odd"])
+}
+
+func TestSpider_SetLogLevel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+
+	l := &testLogger{}
+	s := NewSpider()
+	s.SetLogger(l)
+	s.SetLogLevel(LogError)
+	assert.Equal(t, LogError, s.LogLevel())
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		ctx.Println("hello")
+	})
+	s.SeedTask(goreq.Get("http://127.0.0.1:1/"))
+	s.Wait()
+
+	if assert.Len(t, l.records, 1) {
+		assert.Equal(t, "resp error", l.records[0].Msg)
+	}
+}
+
+func TestSpider_SetLogSampling(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+
+	l := &testLogger{}
+	s := NewSpider()
+	s.SetLogger(l)
+	s.SetLogSampling(5)
+	for i := 0; i < 10; i++ {
+		s.SeedTask(goreq.Get(ts.URL))
+	}
+	for i := 0; i < 3; i++ {
+		s.SeedTask(goreq.Get("http://127.0.0.1:1/"))
+	}
+	s.Wait()
+
+	count := map[string]int{}
+	for _, r := range l.records {
+		count[r.Msg]++
+	}
+	assert.Equal(t, 2, count["Finish"])
+	assert.Equal(t, 3, count["resp error"])
+}
+
+func TestSpider_OnLog(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+
+	l := &testLogger{}
+	s := NewSpider()
+	s.SetLogger(l)
+	s.OnLog(func(ctx *Context, e *LogEvent) {
+		if job, ok := ctx.Meta["job"]; ok {
+			e.Set("job", job)
+		}
+	})
+	s.OnLog(func(ctx *Context, e *LogEvent) {
+		if v, ok := e.Get("job"); ok && e.Msg == "Finish" {
+			e.Msg = fmt.Sprint("Finish ", v)
+		}
+	})
+	s.SeedTask(goreq.Get(ts.URL))
+	s.OnTask(func(ctx *Context, t *Task) *Task {
+		t.Meta["job"] = "j1"
+		return t
+	})
+	s.SeedTask(goreq.Get(ts.URL))
+	s.Wait()
+
+	msgs := map[string]testLogRecord{}
+	for _, r := range l.records {
+		msgs[r.Msg] = r
+	}
+	assert.Contains(t, msgs, "Finish")
+	if assert.Contains(t, msgs, "Finish j1") {
+		kv := msgs["Finish j1"].Keyvals
+		assert.Equal(t, []interface{}{"job", "j1"}, kv[len(kv)-2:])
+	}
+}
@@ -0,0 +1,157 @@
+package gospider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/zhshch2002/goreq"
+)
+
+var (
+	// ErrLoginFormNotFound 登录页中没有找到表单
+	ErrLoginFormNotFound = errors.New("login form not found")
+	// ErrLoginFailed 提交表单后没有通过登录成功的检查
+	ErrLoginFailed = errors.New("login failed")
+)
+
+// LoginForm Login的配置
+type LoginForm struct {
+	URL             string            // 登录页地址
+	FormSelector    string            // 表单的选择器，为空时使用第一个包含密码输入框的表单
+	Fields          map[string]string // 提交的字段，如用户名和密码，覆盖表单中的同名字段
+	SuccessSelector string            // 提交后的页面中存在匹配的元素视为登录成功
+	SuccessURL      string            // 提交后(跟随重定向)的最终URL包含该字符串视为登录成功
+}
+
+// Login 访问登录页，提取表单(包括隐藏的CSRF字段)，填入Fields提交，并按SuccessSelector和SuccessURL检查是否登录成功
+// 两者都为空时响应状态码小于400即视为成功。登录得到的Cookie保存在Spider的客户端中，之后的任务会自动带上
+func (s *Spider) Login(form LoginForm) error {
+	return s.login(nil, form)
+}
+
+// Login 以该会话登录，得到的Cookie只用于该会话的任务
+func (se *Session) Login(form LoginForm) error {
+	return se.s.login(se, form)
+}
+
+func (s *Spider) login(se *Session, form LoginForm) error {
+	do := func(req *goreq.Request) (*goreq.Response, error) {
+		if se != nil && req.Request != nil {
+			req.Request = req.WithContext(context.WithValue(req.Context(), sessionKey{}, se))
+			if proxy := se.Proxy(); proxy != "" {
+				setProxy(req, proxy)
+			}
+		}
+		return s.Client.Do(req).Resp()
+	}
+	page, err := do(goreq.Get(form.URL))
+	if err != nil {
+		return err
+	}
+	doc, err := page.HTML()
+	if err != nil {
+		return err
+	}
+	var sel *goquery.Selection
+	if form.FormSelector != "" {
+		sel = doc.Find(form.FormSelector).First()
+	} else {
+		sel = doc.Find("form").FilterFunction(func(i int, f *goquery.Selection) bool {
+			return f.Find(`input[type="password"]`).Length() > 0
+		}).First()
+	}
+	if sel.Length() == 0 {
+		return ErrLoginFormNotFound
+	}
+
+	base := page.Request.URL
+	if page.Response != nil && page.Response.Request != nil {
+		base = page.Response.Request.URL
+	}
+	action, err := base.Parse(sel.AttrOr("action", ""))
+	if err != nil {
+		return err
+	}
+	values := loginFormValues(sel)
+	for k, v := range form.Fields {
+		values.Set(k, v)
+	}
+
+	var req *goreq.Request
+	if strings.EqualFold(sel.AttrOr("method", "GET"), http.MethodPost) {
+		req = goreq.Post(action.String()).SetRawBody([]byte(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		action.RawQuery = values.Encode()
+		req = goreq.Get(action.String())
+	}
+	req.Header.Set("Referer", base.String())
+	resp, err := do(req)
+	if err != nil {
+		return err
+	}
+	return checkLogin(resp, form)
+}
+
+// loginFormValues 表单中会随提交发送的字段
+func loginFormValues(form *goquery.Selection) url.Values {
+	values := url.Values{}
+	form.Find("input[name]").Each(func(i int, in *goquery.Selection) {
+		name := in.AttrOr("name", "")
+		switch strings.ToLower(in.AttrOr("type", "text")) {
+		case "submit", "button", "image", "reset", "file":
+			return
+		case "checkbox", "radio":
+			if _, ok := in.Attr("checked"); !ok {
+				return
+			}
+			values.Add(name, in.AttrOr("value", "on"))
+			return
+		}
+		values.Add(name, in.AttrOr("value", ""))
+	})
+	form.Find("select[name]").Each(func(i int, sel *goquery.Selection) {
+		opt := sel.Find("option[selected]").First()
+		if opt.Length() == 0 {
+			opt = sel.Find("option").First()
+		}
+		if opt.Length() > 0 {
+			values.Add(sel.AttrOr("name", ""), opt.AttrOr("value", opt.Text()))
+		}
+	})
+	form.Find("textarea[name]").Each(func(i int, ta *goquery.Selection) {
+		values.Add(ta.AttrOr("name", ""), ta.Text())
+	})
+	return values
+}
+
+// checkLogin 检查提交表单后的响应是否表示登录成功
+func checkLogin(resp *goreq.Response, form LoginForm) error {
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("%w: status %d", ErrLoginFailed, resp.StatusCode)
+	}
+	if form.SuccessURL != "" {
+		u := resp.Request.URL
+		if resp.Response.Request != nil {
+			u = resp.Response.Request.URL
+		}
+		if !strings.Contains(u.String(), form.SuccessURL) {
+			return fmt.Errorf("%w: ended at %s", ErrLoginFailed, u)
+		}
+	}
+	if form.SuccessSelector != "" {
+		doc, err := resp.HTML()
+		if err != nil {
+			return err
+		}
+		if doc.Find(form.SuccessSelector).Length() == 0 {
+			return fmt.Errorf("%w: %q not found", ErrLoginFailed, form.SuccessSelector)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package gospider
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestLoginServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = fmt.Fprint(w, `<html><body>
+<form action="/search"><input name="q"></form>
+<form method="post" action="/session">
+<input type="hidden" name="csrf" value="token123">
+<input name="user"><input type="password" name="pass">
+<input type="checkbox" name="remember" checked>
+<input type="submit" name="go" value="Login">
+</form></body></html>`)
+		case "/session":
+			_ = r.ParseForm()
+			if r.PostForm.Get("csrf") != "token123" || r.PostForm.Get("remember") != "on" || r.PostForm.Get("pass") != "secret" {
+				http.Redirect(w, r, "/login?failed=1", http.StatusFound)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: r.PostForm.Get("user"), Path: "/"})
+			http.Redirect(w, r, "/home", http.StatusFound)
+		case "/home":
+			w.Header().Set("Content-Type", "text/html")
+			c, err := r.Cookie("sid")
+			if err != nil {
+				_, _ = fmt.Fprint(w, `<html><body>anonymous</body></html>`)
+				return
+			}
+			_, _ = fmt.Fprintf(w, `<html><body><a class="logout">%s</a></body></html>`, c.Value)
+		}
+	}))
+}
+
+func TestSpider_Login(t *testing.T) {
+	ts := newTestLoginServer()
+	defer ts.Close()
+
+	s := NewSpider()
+	s.Logging = false
+	err := s.Login(LoginForm{
+		URL:             ts.URL + "/login",
+		Fields:          map[string]string{"user": "alice", "pass": "wrong"},
+		SuccessSelector: ".logout",
+	})
+	assert.True(t, errors.Is(err, ErrLoginFailed))
+
+	assert.NoError(t, s.Login(LoginForm{
+		URL:             ts.URL + "/login",
+		Fields:          map[string]string{"user": "alice", "pass": "secret"},
+		SuccessSelector: ".logout",
+		SuccessURL:      "/home",
+	}))
+	var text string
+	s.SeedTask(goreq.Get(ts.URL+"/home"), func(ctx *Context) {
+		text = ctx.Resp.Text
+	})
+	s.Wait()
+	assert.Contains(t, text, "alice")
+
+	assert.Equal(t, ErrLoginFormNotFound, s.Login(LoginForm{URL: ts.URL + "/home"}))
+}
+
+func TestSession_Login(t *testing.T) {
+	ts := newTestLoginServer()
+	defer ts.Close()
+
+	s := NewSpider(WithSessions(false))
+	s.Logging = false
+	assert.NoError(t, s.Session("bob").Login(LoginForm{
+		URL:    ts.URL + "/login",
+		Fields: map[string]string{"user": "bob", "pass": "secret"},
+	}))
+	res := map[string]string{}
+	s.Session("bob").SeedTask(goreq.Get(ts.URL+"/home"), func(ctx *Context) {
+		res["bob"] = ctx.Resp.Text
+	})
+	s.Wait()
+	s.SeedTask(goreq.Get(ts.URL+"/home"), func(ctx *Context) {
+		res[""] = ctx.Resp.Text
+	})
+	s.Wait()
+	assert.Contains(t, res["bob"], "bob")
+	assert.Contains(t, res[""], "anonymous")
+}
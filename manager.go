@@ -0,0 +1,222 @@
+package gospider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zhshch2002/goreq"
+)
+
+var (
+	// ErrDuplicateSpider Manager中已有同名的爬虫
+	ErrDuplicateSpider = errors.New("duplicate spider name")
+)
+
+// ManagerConfig Manager的配置，零值字段不限制
+type ManagerConfig struct {
+	MaxConcurrency      int     // 所有爬虫同时进行的请求数上限
+	MaxRate             float64 // 所有爬虫每秒发出的请求数上限
+	MaxIdleConnsPerHost int     // 共享连接池中每个host保持的空闲连接数，默认为net/http的默认值
+}
+
+// Manager 在一个进程中同时运行多个爬虫，共享连接池、全局的并发数和请求速率限制，并汇总各爬虫的状态
+// 限制作用于实际发出的请求(在Fetcher之前)，请求等待时不占用其他爬虫的配额
+// 修改transport的扩展(如WithTLSFingerprint、WithDoH)会作用于所有爬虫共享的连接池
+type Manager struct {
+	conf      ManagerConfig
+	transport *http.Transport
+	sem       chan struct{} // 并发限制，MaxConcurrency为0时为nil
+
+	rateLock sync.Mutex
+	next     time.Time // 下一个请求最早的发出时间
+
+	lock    sync.Mutex
+	spiders []*Spider
+}
+
+// NewManager 创建Manager
+func NewManager(conf ManagerConfig) *Manager {
+	m := &Manager{
+		conf:      conf,
+		transport: newHTTPTransport(),
+	}
+	if conf.MaxIdleConnsPerHost > 0 {
+		m.transport.MaxIdleConnsPerHost = conf.MaxIdleConnsPerHost
+	}
+	if conf.MaxConcurrency > 0 {
+		m.sem = make(chan struct{}, conf.MaxConcurrency)
+	}
+	return m
+}
+
+// NewSpider 创建由Manager管理的爬虫，参数e与gospider.NewSpider相同
+// 名字在Manager中必须唯一，重复时panic(ErrDuplicateSpider)
+func (m *Manager) NewSpider(name string, e ...interface{}) *Spider {
+	s := NewSpider()
+	s.Name = name
+	if err := m.Add(s); err != nil {
+		panic(err)
+	}
+	s.Use(e...)
+	return s
+}
+
+// Add 将已创建的爬虫交给Manager管理，爬虫改为使用共享的连接池(见useTransport，WithFetcher设置的Fetcher不会被替换)，之后发出的请求受全局限制
+// 应在加入任务之前调用；同名的爬虫已存在时返回ErrDuplicateSpider
+func (m *Manager) Add(s *Spider) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, i := range m.spiders {
+		if i.Name == s.Name {
+			return ErrDuplicateSpider
+		}
+	}
+	m.spiders = append(m.spiders, s)
+	s.useTransport(m.transport)
+	s.Client.Use(m.limitMiddleware)
+	return nil
+}
+
+// Spider 按名字获取爬虫
+func (m *Manager) Spider(name string) (*Spider, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, s := range m.spiders {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// Spiders 所有的爬虫，按加入的顺序
+func (m *Manager) Spiders() []*Spider {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]*Spider(nil), m.spiders...)
+}
+
+// Wait 等待所有爬虫完成
+func (m *Manager) Wait() {
+	wg := sync.WaitGroup{}
+	for _, s := range m.Spiders() {
+		wg.Add(1)
+		go func(s *Spider) {
+			defer wg.Done()
+			s.Wait()
+		}(s)
+	}
+	wg.Wait()
+}
+
+// Stop 停止所有爬虫，见Spider.Stop
+func (m *Manager) Stop() {
+	for _, s := range m.Spiders() {
+		s.Stop()
+	}
+}
+
+// ManagerStatus 所有爬虫的状态
+type ManagerStatus struct {
+	Spiders map[string]StatusSnapshot // 各爬虫的状态
+	Total   StatusSnapshot            // 所有爬虫的计数之和，速度为各爬虫速度之和，耗时取最长的
+	Active  int                       // 正在进行的请求数，没有设置MaxConcurrency时为0
+}
+
+// Status 返回所有爬虫状态的汇总
+func (m *Manager) Status() ManagerStatus {
+	ms := ManagerStatus{
+		Spiders: map[string]StatusSnapshot{},
+		Total: StatusSnapshot{
+			Time:         time.Now(),
+			StatusCodes:  map[int]int64{},
+			HostTasks:    map[string]int64{},
+			BlockedHosts: map[string]int64{},
+			SkippedTasks: map[SkipReason]int64{},
+		},
+	}
+	for _, s := range m.Spiders() {
+		ss := s.Status.Snapshot()
+		ms.Spiders[s.Name] = ss
+		t := &ms.Total
+		t.TotalTask += ss.TotalTask
+		t.FinishedTask += ss.FinishedTask
+		t.PendingTask += ss.PendingTask
+		t.TotalItem += ss.TotalItem
+		t.BytesDownloaded += ss.BytesDownloaded
+		t.ReqErrors += ss.ReqErrors
+		t.RespErrors += ss.RespErrors
+		t.Retries += ss.Retries
+		t.AbandonedTask += ss.AbandonedTask
+		t.ExecRate += ss.ExecRate
+		t.ItemRate += ss.ItemRate
+		if ss.Elapsed > t.Elapsed {
+			t.Elapsed = ss.Elapsed
+		}
+		for k, v := range ss.StatusCodes {
+			t.StatusCodes[k] += v
+		}
+		for k, v := range ss.HostTasks {
+			t.HostTasks[k] += v
+		}
+		for k, v := range ss.BlockedHosts {
+			t.BlockedHosts[k] += v
+		}
+		for k, v := range ss.SkippedTasks {
+			t.SkippedTasks[k] += v
+		}
+	}
+	ms.Total.Progress = progress(ms.Total.FinishedTask, ms.Total.TotalTask)
+	if ms.Total.ExecRate > 0 {
+		ms.Total.ETA = time.Duration(float64(ms.Total.PendingTask) / ms.Total.ExecRate * float64(time.Second))
+	}
+	ms.Active = len(m.sem)
+	return ms
+}
+
+// acquire 等待全局的并发数和请求速率允许发出请求，返回释放并发配额的方法；ctx取消时返回其错误，不占用配额
+func (m *Manager) acquire(ctx context.Context) (func(), error) {
+	release := func() {
+		if m.sem != nil {
+			<-m.sem
+		}
+	}
+	if m.sem != nil {
+		select {
+		case m.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if m.conf.MaxRate > 0 {
+		interval := time.Duration(float64(time.Second) / m.conf.MaxRate)
+		m.rateLock.Lock()
+		now := time.Now()
+		if m.next.Before(now) {
+			m.next = now
+		}
+		wait := m.next.Sub(now)
+		m.next = m.next.Add(interval)
+		m.rateLock.Unlock()
+		if err := sleepContext(ctx, wait); err != nil {
+			release()
+			return nil, err
+		}
+	}
+	return release, nil
+}
+
+// limitMiddleware 在Fetcher之前等待全局限制
+func (m *Manager) limitMiddleware(c *goreq.Client, next goreq.Handler) goreq.Handler {
+	return func(req *goreq.Request) *goreq.Response {
+		release, err := m.acquire(requestContext(req))
+		if err != nil {
+			return &goreq.Response{Req: req, Err: err}
+		}
+		defer release()
+		return next(req)
+	}
+}
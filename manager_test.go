@@ -0,0 +1,83 @@
+package gospider
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestManager(t *testing.T) {
+	lock := sync.Mutex{}
+	active, maxActive := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		lock.Unlock()
+		time.Sleep(30 * time.Millisecond)
+		lock.Lock()
+		active--
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	m := NewManager(ManagerConfig{MaxConcurrency: 2})
+	items := map[string]int{}
+	for _, name := range []string{"a", "b"} {
+		s := m.NewSpider(name)
+		s.Logging = false
+		s.OnItem(func(ctx *Context, i interface{}) interface{} {
+			lock.Lock()
+			items[ctx.s.Name]++
+			lock.Unlock()
+			return i
+		})
+		for i := 0; i < 5; i++ {
+			s.SeedTask(goreq.Get(fmt.Sprintf("%s/%s/%d", ts.URL, name, i)), func(ctx *Context) {
+				ctx.AddItem(ctx.Req.URL.Path)
+			})
+		}
+	}
+	assert.Panics(t, func() {
+		m.NewSpider("a")
+	})
+	m.Wait()
+
+	assert.Equal(t, 2, maxActive)
+	assert.Equal(t, map[string]int{"a": 5, "b": 5}, items)
+	a, _ := m.Spider("a")
+	b, _ := m.Spider("b")
+	assert.Equal(t, a.transport, b.transport)
+	ms := m.Status()
+	assert.Equal(t, 0, ms.Active)
+	assert.Equal(t, int64(5), ms.Spiders["a"].FinishedTask)
+	assert.Equal(t, int64(10), ms.Total.TotalTask)
+	assert.Equal(t, int64(10), ms.Total.TotalItem)
+	assert.Equal(t, int64(10), ms.Total.StatusCodes[200])
+	assert.Equal(t, 1.0, ms.Total.Progress)
+}
+
+func TestManager_MaxRate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	m := NewManager(ManagerConfig{MaxRate: 20})
+	s := NewSpider()
+	s.Logging = false
+	assert.NoError(t, m.Add(s))
+	assert.Equal(t, ErrDuplicateSpider, m.Add(NewSpider()))
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		s.SeedTask(goreq.Get(fmt.Sprintf("%s/%d", ts.URL, i)))
+	}
+	m.Wait()
+	assert.True(t, time.Since(start) >= 250*time.Millisecond)
+	assert.Equal(t, int64(6), m.Status().Total.StatusCodes[200])
+}
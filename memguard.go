@@ -0,0 +1,234 @@
+package gospider
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryGuardOptions WithMemoryGuard的配置
+type MemoryGuardOptions struct {
+	Interval    time.Duration          // 检查内存的间隔，默认为1秒
+	ResumeRatio float64                // 内存降到maxRSS*ResumeRatio以下时恢复，默认为0.9
+	GC          bool                   // 超过阈值时调用debug.FreeOSMemory强制GC并归还内存
+	Spill       TaskQueue              // 超过阈值时新加入的任务写入Spill而不留在内存中，恢复后取回执行，如OpenFileTaskQueue
+	RSS         func() (uint64, error) // 读取内存占用，默认为ProcessRSS
+}
+
+// ProcessRSS 进程的常驻内存(RSS)字节数，在Linux上读取/proc/self/statm，其他系统上使用Go运行时从系统获取的内存
+func ProcessRSS() (uint64, error) {
+	data, err := ioutil.ReadFile("/proc/self/statm")
+	if err != nil {
+		ms := runtime.MemStats{}
+		runtime.ReadMemStats(&ms)
+		return ms.Sys, nil
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0, os.ErrInvalid
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return pages * uint64(os.Getpagesize()), nil
+}
+
+// memoryGuard 内存超过阈值时暂停取出任务
+type memoryGuard struct {
+	s    *Spider
+	max  uint64
+	opts MemoryGuardOptions
+
+	lock    sync.Mutex
+	over    bool
+	spilled int // 写入Spill尚未取回的任务数，大于0时占用WaitGroup使Wait不返回
+}
+
+// WithMemoryGuard 每隔一段时间检查进程内存，超过maxRSS字节时暂停取出任务(与Pause独立，正在执行的任务继续)，
+// 降到maxRSS*ResumeRatio以下时恢复；没有正在执行的任务时内存无法通过暂停降低，此时同样恢复以免爬虫停滞
+// 配置Spill时，超过阈值期间新加入的任务(处理方法需要用RegisterHandler注册)写入Spill，恢复后取回，
+// Stop时仍在Spill中的任务留在其中。在第一次Wait开始时启动，Stop或Spider.Close时停止
+func WithMemoryGuard(maxRSS uint64, opts ...MemoryGuardOptions) Extension {
+	return func(s *Spider) {
+		g := &memoryGuard{max: maxRSS}
+		if len(opts) > 0 {
+			g.opts = opts[0]
+		}
+		if g.opts.Interval <= 0 {
+			g.opts.Interval = time.Second
+		}
+		if g.opts.ResumeRatio <= 0 || g.opts.ResumeRatio > 1 {
+			g.opts.ResumeRatio = 0.9
+		}
+		if g.opts.RSS == nil {
+			g.opts.RSS = ProcessRSS
+		}
+		s.memGuard = g
+		s.useExtension(g)
+	}
+}
+
+// Init 记录爬虫
+func (g *memoryGuard) Init(s *Spider) error {
+	g.s = s
+	return nil
+}
+
+// Start 开始检查内存，ctx取消时恢复并停止
+func (g *memoryGuard) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(g.opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				g.stop()
+				return
+			case <-ticker.C:
+			}
+			g.check()
+		}
+	}()
+}
+
+// check 检查一次内存
+func (g *memoryGuard) check() {
+	s := g.s
+	rss, err := g.opts.RSS()
+	if err != nil {
+		s.writeLog(nil, LogWarn, "memory guard read error", "error", err, "spider", s.Name)
+		return
+	}
+	g.lock.Lock()
+	over := g.over
+	g.lock.Unlock()
+	if rss > g.max && g.opts.GC {
+		debug.FreeOSMemory()
+		if rss, err = g.opts.RSS(); err != nil {
+			return
+		}
+	}
+	switch {
+	case !over && rss > g.max:
+		g.setOver(true)
+		s.hold(true)
+		s.writeLog(nil, LogWarn, "memory guard paused", "spider", s.Name, "rss", rss, "max", g.max)
+	case over && (float64(rss) < float64(g.max)*g.opts.ResumeRatio || s.runningTasks() == 0):
+		g.setOver(false)
+		s.hold(false)
+		s.writeLog(nil, LogInfo, "memory guard resumed", "spider", s.Name, "rss", rss, "max", g.max)
+		g.drain()
+	}
+}
+
+// MemoryPaused 是否因内存超过WithMemoryGuard的阈值暂停取出任务
+func (s *Spider) MemoryPaused() bool {
+	if s.memGuard == nil {
+		return false
+	}
+	s.memGuard.lock.Lock()
+	defer s.memGuard.lock.Unlock()
+	return s.memGuard.over
+}
+
+func (g *memoryGuard) setOver(over bool) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.over = over
+}
+
+// stop 恢复取出任务，释放Spill占用的WaitGroup，仍在Spill中的任务(只在Stop后出现)留在其中
+func (g *memoryGuard) stop() {
+	g.setOver(false)
+	g.s.hold(false)
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.spilled > 0 {
+		g.s.writeLog(nil, LogInfo, "memory guard tasks left in spill", "spider", g.s.Name, "tasks", g.spilled)
+		g.spilled = 0
+		g.s.wg.Done()
+	}
+}
+
+// spill 超过阈值时将t写入Spill，返回是否写入
+func (g *memoryGuard) spill(t *Task) bool {
+	if g.opts.Spill == nil {
+		return false
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if !g.over {
+		return false
+	}
+	sub, err := g.s.SerializeTask(t)
+	if err != nil {
+		return false
+	}
+	if err := g.opts.Spill.Push(sub); err != nil {
+		g.s.writeLog(nil, LogError, "memory guard spill error", "error", err, "spider", g.s.Name, "url", sub.URL)
+		return false
+	}
+	if g.spilled == 0 {
+		g.s.wg.Add(1)
+	}
+	g.spilled++
+	return true
+}
+
+// drain 取回Spill中的任务
+func (g *memoryGuard) drain() {
+	if g.opts.Spill == nil {
+		return
+	}
+	s := g.s
+	for {
+		g.lock.Lock()
+		if g.over || g.spilled == 0 {
+			g.lock.Unlock()
+			return
+		}
+		g.lock.Unlock()
+		qt, err := g.opts.Spill.Lease(time.Minute)
+		if err != nil || qt == nil {
+			if err != nil {
+				s.writeLog(nil, LogError, "memory guard spill lease error", "error", err, "spider", s.Name)
+			}
+			return
+		}
+		t, err := s.DeserializeTask(qt.Task)
+		if err != nil {
+			s.writeLog(nil, LogWarn, "memory guard skip spilled task", "error", err, "spider", s.Name, "url", qt.Task.URL)
+		} else {
+			s.addTask(t)
+		}
+		if err := g.opts.Spill.Ack(qt.ID); err != nil {
+			s.writeLog(nil, LogWarn, "memory guard spill ack error", "error", err, "spider", s.Name)
+		}
+		g.lock.Lock()
+		g.spilled--
+		if g.spilled == 0 {
+			s.wg.Done()
+		}
+		g.lock.Unlock()
+	}
+}
+
+// runningTasks 正在执行的任务数
+func (s *Spider) runningTasks() int {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+	n := 0
+	for p := range s.pending {
+		if p.started && !p.abandoned {
+			n++
+		}
+	}
+	return n
+}
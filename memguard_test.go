@@ -0,0 +1,131 @@
+package gospider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProcessRSS(t *testing.T) {
+	rss, err := ProcessRSS()
+	assert.NoError(t, err)
+	assert.True(t, rss > 0)
+}
+
+func TestWithMemoryGuard(t *testing.T) {
+	var requests int32
+	slow := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-slow
+		}
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer ts.Close()
+
+	var rss uint64 = 50
+	s := NewSpider(WithMemoryGuard(100, MemoryGuardOptions{
+		Interval: time.Hour,
+		RSS: func() (uint64, error) {
+			return atomic.LoadUint64(&rss), nil
+		},
+	}))
+	s.Logging = false
+	s.SeedTask(goreq.Get(ts.URL + "/slow"))
+	time.Sleep(20 * time.Millisecond)
+	atomic.StoreUint64(&rss, 200)
+	s.memGuard.check()
+	assert.True(t, s.MemoryPaused())
+	assert.False(t, s.IsPaused())
+	s.SeedTask(goreq.Get(ts.URL + "/fast"))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&requests))
+
+	// 回落到阈值*ResumeRatio以下时恢复
+	atomic.StoreUint64(&rss, 95)
+	s.memGuard.check()
+	assert.True(t, s.MemoryPaused())
+	atomic.StoreUint64(&rss, 80)
+	s.memGuard.check()
+	assert.False(t, s.MemoryPaused())
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	close(slow)
+	s.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestWithMemoryGuard_Idle(t *testing.T) {
+	s := NewSpider(WithMemoryGuard(100, MemoryGuardOptions{
+		RSS: func() (uint64, error) {
+			return 200, nil
+		},
+	}))
+	s.Logging = false
+	s.memGuard.check()
+	assert.True(t, s.MemoryPaused())
+	// 没有正在执行的任务时恢复
+	s.memGuard.check()
+	assert.False(t, s.MemoryPaused())
+}
+
+func TestWithMemoryGuard_Spill(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	var rss uint64 = 200
+	q := NewMemoryTaskQueue()
+	s := NewSpider(WithMemoryGuard(100, MemoryGuardOptions{
+		Spill: q,
+		RSS: func() (uint64, error) {
+			return atomic.LoadUint64(&rss), nil
+		},
+	}))
+	s.Logging = false
+	var handled int32
+	h := func(ctx *Context) {
+		atomic.AddInt32(&handled, 1)
+	}
+	s.RegisterHandler("h", h)
+	s.memGuard.check()
+	s.SeedTask(goreq.Get(ts.URL), h)
+	pending, _, _ := q.Len()
+	assert.Equal(t, 1, pending)
+	assert.Equal(t, int64(0), s.Status.TotalTask)
+
+	atomic.StoreUint64(&rss, 50)
+	s.memGuard.check()
+	s.Wait()
+	pending, _, _ = q.Len()
+	assert.Equal(t, 0, pending)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&handled))
+	assert.Equal(t, int64(1), s.Status.TotalTask)
+}
+
+func TestWithMemoryGuard_SpillStop(t *testing.T) {
+	q := NewMemoryTaskQueue()
+	s := NewSpider(WithMemoryGuard(100, MemoryGuardOptions{
+		Interval: time.Hour,
+		Spill:    q,
+		RSS: func() (uint64, error) {
+			return 200, nil
+		},
+	}))
+	s.Logging = false
+	s.memGuard.check()
+	s.SeedTask(goreq.Get("http://127.0.0.1/a"))
+	pending, _, _ := q.Len()
+	assert.Equal(t, 1, pending)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		s.Stop()
+	}()
+	s.Wait()
+	pending, _, _ = q.Len()
+	assert.Equal(t, 1, pending)
+}
@@ -0,0 +1,165 @@
+package gospider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/zhshch2002/goreq"
+)
+
+// monitorRecord 监控存储中记录的一个URL的内容
+type monitorRecord struct {
+	Hash    string    `json:"hash"`
+	Content string    `json:"content"`
+	Time    time.Time `json:"time"`
+}
+
+// monitorTarget 一个监控的URL
+type monitorTarget struct {
+	url      string
+	interval time.Duration
+	selector string
+	stop     chan struct{}
+}
+
+// Monitor 页面变化监控
+// 按间隔重复访问注册的URL，记录规范化内容(或选择器范围内的文本)的哈希，内容变化时调用OnChange
+type Monitor struct {
+	s     *Spider
+	store CacheStore
+
+	lock     sync.Mutex
+	targets  map[string]*monitorTarget
+	onChange []func(ctx *Context, old, new string)
+}
+
+// NewMonitor 创建使用s爬取、在store中记录内容的监控，使用持久化的store可以在多次运行之间比较
+func NewMonitor(s *Spider, store CacheStore) *Monitor {
+	return &Monitor{
+		s:       s,
+		store:   store,
+		targets: map[string]*monitorTarget{},
+	}
+}
+
+// OnChange 注册内容变化时的回调，old和new为规范化后的内容
+// 第一次访问某个URL时只记录内容，不会调用
+func (m *Monitor) OnChange(fn func(ctx *Context, old, new string)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.onChange = append(m.onChange, fn)
+}
+
+// Watch 开始以interval为间隔监控url，立即进行第一次访问
+// selector不为空时只比较HTML中匹配选择器的元素的文本，重复Watch同一个url会替换之前的设置
+func (m *Monitor) Watch(url string, interval time.Duration, selector string) {
+	t := &monitorTarget{
+		url:      url,
+		interval: interval,
+		selector: selector,
+		stop:     make(chan struct{}),
+	}
+	m.lock.Lock()
+	if old, ok := m.targets[url]; ok {
+		close(old.stop)
+	}
+	m.targets[url] = t
+	m.lock.Unlock()
+
+	m.check(t)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.stop:
+				return
+			case <-ticker.C:
+				m.check(t)
+			}
+		}
+	}()
+}
+
+// Unwatch 停止监控url
+func (m *Monitor) Unwatch(url string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if t, ok := m.targets[url]; ok {
+		close(t.stop)
+		delete(m.targets, url)
+	}
+}
+
+// Stop 停止所有监控，已经加入的任务仍会执行完
+func (m *Monitor) Stop() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for url, t := range m.targets {
+		close(t.stop)
+		delete(m.targets, url)
+	}
+}
+
+// check 访问一次t，每次访问都是同一个请求，不经过WithDeduplicate去重
+func (m *Monitor) check(t *monitorTarget) {
+	task := NewTask(goreq.Get(t.url), nil, func(ctx *Context) {
+		content := monitorContent(ctx, t.selector)
+		sum := sha256.Sum256([]byte(content))
+		rec := &monitorRecord{
+			Hash:    hex.EncodeToString(sum[:]),
+			Content: content,
+			Time:    time.Now(),
+		}
+		key := "monitor " + t.url + " " + t.selector
+
+		var old *monitorRecord
+		if data, ok := m.store.Get(key); ok {
+			old = &monitorRecord{}
+			if json.Unmarshal(data, old) != nil {
+				old = nil
+			}
+		}
+		if old != nil && old.Hash == rec.Hash {
+			return
+		}
+		if data, err := json.Marshal(rec); err == nil {
+			m.store.Set(key, data)
+		}
+		if old == nil {
+			return
+		}
+		m.lock.Lock()
+		fns := m.onChange
+		m.lock.Unlock()
+		for _, fn := range fns {
+			fn(ctx, old.Content, rec.Content)
+		}
+	})
+	task.noDedup = true
+	m.s.AddTask(task)
+}
+
+// monitorContent 规范化页面内容，合并连续的空白字符
+func monitorContent(ctx *Context, selector string) string {
+	text := ctx.Resp.Text
+	if text == "" {
+		text = string(ctx.Resp.Body)
+	}
+	if selector != "" {
+		text = ""
+		if h, err := ctx.HTML(); err == nil {
+			var parts []string
+			h.Find(selector).Each(func(i int, sel *goquery.Selection) {
+				parts = append(parts, sel.Text())
+			})
+			text = strings.Join(parts, "\n")
+		}
+	}
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,73 @@
+package gospider
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMonitor(t *testing.T) {
+	var version int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = fmt.Fprintf(w, `<html><body><p class="price">%d</p><p>%d</p></body></html>`,
+			atomic.LoadInt64(&version)/2, time.Now().UnixNano())
+	}))
+	defer ts.Close()
+
+	s := NewSpider()
+	s.Logging = false
+	m := NewMonitor(s, NewMemoryCacheStore())
+	changes := make(chan [2]string, 10)
+	m.OnChange(func(ctx *Context, old, new string) {
+		changes <- [2]string{old, new}
+	})
+	m.Watch(ts.URL, time.Hour, ".price")
+	s.Wait()
+	for i := 0; i < 4; i++ {
+		atomic.AddInt64(&version, 1)
+		m.check(m.targets[ts.URL])
+		s.Wait()
+	}
+	m.Stop()
+	close(changes)
+
+	var res [][2]string
+	for c := range changes {
+		res = append(res, c)
+	}
+	assert.Equal(t, [][2]string{{"0", "1"}, {"1", "2"}}, res)
+	assert.Len(t, m.targets, 0)
+}
+
+func TestMonitor_Deduplicate(t *testing.T) {
+	var version int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%d", atomic.LoadInt64(&version))
+	}))
+	defer ts.Close()
+
+	s := NewSpider(WithDeduplicate())
+	s.Logging = false
+	m := NewMonitor(s, NewMemoryCacheStore())
+	var changes int32
+	m.OnChange(func(ctx *Context, old, new string) {
+		atomic.AddInt32(&changes, 1)
+	})
+	m.Watch(ts.URL, time.Hour, "")
+	s.Wait()
+	for i := 0; i < 2; i++ {
+		atomic.AddInt64(&version, 1)
+		m.check(m.targets[ts.URL])
+		s.Wait()
+	}
+	m.Stop()
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&changes))
+	assert.Equal(t, int64(3), s.Status.FinishedTask)
+	assert.Empty(t, s.Status.SkippedTasks())
+}
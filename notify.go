@@ -0,0 +1,312 @@
+package gospider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NotifyEvent 通知的事件
+type NotifyEvent string
+
+const (
+	NotifyFinished   NotifyEvent = "finished"    // 爬取结束(包括被Stop停止)
+	NotifyErrorRate  NotifyEvent = "error_rate"  // 错误率超过阈值
+	NotifyHostBanned NotifyEvent = "host_banned" // host封禁了爬虫
+)
+
+// Notification 发送给NotificationSink的通知
+type Notification struct {
+	Spider string
+	Event  NotifyEvent
+	Title  string // 一行的标题
+	Text   string // 详细内容，可以有多行
+	Time   time.Time
+	Host   string  // NotifyHostBanned的host
+	Report *Report // NotifyFinished的总结报告
+}
+
+// NotificationSink 通知的发送方式，见SlackWebhook、DiscordWebhook、EmailSink
+type NotificationSink interface {
+	Notify(n *Notification) error
+}
+
+// NotificationFunc 将函数作为NotificationSink
+type NotificationFunc func(n *Notification) error
+
+// Notify 调用f
+func (f NotificationFunc) Notify(n *Notification) error {
+	return f(n)
+}
+
+// WebhookSink 以JSON POST发送通知的webhook
+type WebhookSink struct {
+	URL    string
+	Body   func(n *Notification) interface{} // 请求体，编码为JSON
+	Client *http.Client                      // 为nil时使用10秒超时的http.Client
+}
+
+// Notify 发送通知，响应的状态码不是2xx时返回错误
+func (w *WebhookSink) Notify(n *Notification) error {
+	data, err := json.Marshal(w.Body(n))
+	if err != nil {
+		return err
+	}
+	c := w.Client
+	if c == nil {
+		c = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := c.Post(w.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook status %s", resp.Status)
+	}
+	return nil
+}
+
+// SlackWebhook 发送到Slack的Incoming Webhook
+func SlackWebhook(url string) *WebhookSink {
+	return &WebhookSink{URL: url, Body: func(n *Notification) interface{} {
+		return map[string]string{"text": "*" + n.Title + "*\n" + n.Text}
+	}}
+}
+
+// discordMaxContent Discord消息的最大长度
+const discordMaxContent = 2000
+
+// DiscordWebhook 发送到Discord的Webhook，超过2000个字符的内容被截断
+func DiscordWebhook(url string) *WebhookSink {
+	return &WebhookSink{URL: url, Body: func(n *Notification) interface{} {
+		content := []rune("**" + n.Title + "**\n" + n.Text)
+		if len(content) > discordMaxContent {
+			content = append(content[:discordMaxContent-1], '…')
+		}
+		return map[string]string{"content": string(content)}
+	}}
+}
+
+// EmailSink 通过SMTP发送纯文本邮件
+type EmailSink struct {
+	Addr string    // SMTP服务器，如"smtp.example.com:587"
+	Auth smtp.Auth // 为nil时不认证
+	From string
+	To   []string
+}
+
+// Notify 发送邮件
+func (e *EmailSink) Notify(n *Notification) error {
+	return smtp.SendMail(e.Addr, e.Auth, e.From, e.To, e.message(n))
+}
+
+// message 邮件的内容，标题按RFC 2047编码
+func (e *EmailSink) message(n *Notification) []byte {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "From: %s\r\n", e.From)
+	fmt.Fprintf(buf, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", n.Title))
+	fmt.Fprintf(buf, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	buf.WriteString(strings.Replace(n.Text, "\n", "\r\n", -1))
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+// NotificationRules WithNotifications发送通知的条件
+type NotificationRules struct {
+	Finished        bool          // 每次Wait返回前发送爬取结束的通知，包含总结报告(见Spider.Report)
+	ErrorRate       float64       // 一个周期内请求和响应错误占执行的任务的比例超过ErrorRate时通知，0为不检查
+	ErrorRateWindow time.Duration // 检查错误率的周期，默认为1分钟
+	MinTasks        int64         // 一个周期内执行的任务少于MinTasks时不检查错误率，默认为10
+	Cooldown        time.Duration // 两次错误率通知的最短间隔，默认为10分钟
+	HostBanned      int           // host被反爬拦截(见OnBlocked)或返回403、429达到HostBanned次时通知，每个host只通知一次，0为不检查
+}
+
+// WithNotifications 按rules通过sink发送通知，如爬取结束、错误率过高、host封禁了爬虫，无人值守时及时发现问题
+// 爬取中的通知在后台发送，不阻塞任务；结束的通知在Wait返回前发送，发送失败时记录日志
+func WithNotifications(sink NotificationSink, rules NotificationRules) Extension {
+	if rules.ErrorRateWindow <= 0 {
+		rules.ErrorRateWindow = time.Minute
+	}
+	if rules.MinTasks <= 0 {
+		rules.MinTasks = 10
+	}
+	if rules.Cooldown <= 0 {
+		rules.Cooldown = 10 * time.Minute
+	}
+	return func(s *Spider) {
+		s.useExtension(&notifier{sink: sink, rules: rules})
+	}
+}
+
+// notifier 按规则发送通知，见WithNotifications
+type notifier struct {
+	s     *Spider
+	sink  NotificationSink
+	rules NotificationRules
+	loop  sync.WaitGroup // 检查错误率的goroutine
+	wg    sync.WaitGroup // 后台发送的通知
+
+	lock   sync.Mutex
+	bans   map[string]int
+	lastAt time.Time // 上一次错误率通知的时间
+}
+
+// Init 注册检测host封禁的回调
+func (n *notifier) Init(s *Spider) error {
+	n.s = s
+	n.bans = map[string]int{}
+	if n.rules.HostBanned <= 0 {
+		return nil
+	}
+	s.OnBlocked(func(ctx *Context, vendor BlockVendor) {
+		n.addBan(ctx, "blocked by "+string(vendor))
+	})
+	s.OnResp(func(ctx *Context) {
+		if isBanStatus(ctx.Resp.StatusCode) && DetectBlock(ctx.Resp) == "" {
+			n.addBan(ctx, ctx.Resp.Status)
+		}
+	})
+	s.OnRespError(func(ctx *Context, err error) {
+		var se *ErrHTTPStatus
+		if errors.As(err, &se) && isBanStatus(se.Code) && DetectBlock(ctx.Resp) == "" {
+			n.addBan(ctx, se.Status)
+		}
+	})
+	return nil
+}
+
+func isBanStatus(code int) bool {
+	return code == http.StatusForbidden || code == http.StatusTooManyRequests
+}
+
+// addBan 记录host的一次封禁，达到阈值时通知
+func (n *notifier) addBan(ctx *Context, reason string) {
+	host := ctx.Req.URL.Host
+	n.lock.Lock()
+	n.bans[host]++
+	reached := n.bans[host] == n.rules.HostBanned
+	n.lock.Unlock()
+	if reached {
+		n.send(&Notification{
+			Event: NotifyHostBanned,
+			Host:  host,
+			Title: fmt.Sprintf("[%s] host %s banned the spider", n.s.Name, host),
+			Text:  fmt.Sprintf("%d responses blocked, last: %s %s", n.rules.HostBanned, reason, ctx.Req.URL),
+		})
+	}
+}
+
+// Start 开始检查错误率
+func (n *notifier) Start(ctx context.Context) {
+	if n.rules.ErrorRate <= 0 {
+		return
+	}
+	n.loop.Add(1)
+	go func() {
+		defer n.loop.Done()
+		ticker := time.NewTicker(n.rules.ErrorRateWindow)
+		defer ticker.Stop()
+		last := n.s.Status.Snapshot()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			cur := n.s.Status.Snapshot()
+			n.checkErrorRate(last, cur)
+			last = cur
+		}
+	}()
+}
+
+// checkErrorRate 比较两次快照之间的错误率
+func (n *notifier) checkErrorRate(last, cur StatusSnapshot) {
+	tasks := cur.FinishedTask - last.FinishedTask
+	errs := cur.ReqErrors + cur.RespErrors - last.ReqErrors - last.RespErrors
+	if tasks < n.rules.MinTasks {
+		return
+	}
+	rate := float64(errs) / float64(tasks)
+	if rate <= n.rules.ErrorRate {
+		return
+	}
+	n.lock.Lock()
+	if !n.lastAt.IsZero() && cur.Time.Sub(n.lastAt) < n.rules.Cooldown {
+		n.lock.Unlock()
+		return
+	}
+	n.lastAt = cur.Time
+	n.lock.Unlock()
+	text := fmt.Sprintf("%d errors in %d tasks during the last %s", errs, tasks, n.rules.ErrorRateWindow)
+	for _, e := range n.s.Status.TopErrors(3) {
+		text += fmt.Sprintf("\n%d× %s (e.g. %s)", e.Count, e.Error, e.Example)
+	}
+	n.send(&Notification{
+		Event: NotifyErrorRate,
+		Title: fmt.Sprintf("[%s] error rate %.1f%% above %.1f%%", n.s.Name, rate*100, n.rules.ErrorRate*100),
+		Text:  text,
+	})
+}
+
+// send 在后台发送通知
+func (n *notifier) send(msg *Notification) {
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		n.notify(msg)
+	}()
+}
+
+func (n *notifier) notify(msg *Notification) {
+	msg.Spider = n.s.Name
+	msg.Time = time.Now()
+	if err := n.sink.Notify(msg); err != nil {
+		n.s.writeLog(nil, LogError, "notification error", "error", err, "spider", n.s.Name, "event", string(msg.Event))
+	}
+}
+
+// Close 等待检查错误率的goroutine退出和后台的通知发送完
+func (n *notifier) Close() error {
+	n.loop.Wait()
+	n.wg.Wait()
+	return nil
+}
+
+// Flush 等待后台的通知发送完，再发送爬取结束的通知
+func (n *notifier) Flush() error {
+	n.wg.Wait()
+	if !n.rules.Finished {
+		return nil
+	}
+	r := n.s.Report()
+	title := fmt.Sprintf("[%s] crawl finished", n.s.Name)
+	if r.Stopped {
+		title = fmt.Sprintf("[%s] crawl stopped", n.s.Name)
+	}
+	n.notify(&Notification{Event: NotifyFinished, Title: title, Text: reportSummary(r), Report: r})
+	return nil
+}
+
+// reportSummary 报告的文本摘要
+func reportSummary(r *Report) string {
+	text := fmt.Sprintf("duration %s, tasks %d/%d, items %d, errors %d (request %d, response %d), abandoned %d",
+		r.Duration.Round(time.Millisecond), r.FinishedTask, r.TotalTask, r.TotalItem,
+		r.ReqErrors+r.RespErrors, r.ReqErrors, r.RespErrors, r.AbandonedTask)
+	for _, e := range r.TopErrors {
+		text += fmt.Sprintf("\n%d× %s (e.g. %s)", e.Count, e.Error, e.Example)
+	}
+	return text
+}
@@ -0,0 +1,139 @@
+package gospider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newWebhookServer 记录收到的JSON请求体
+func newWebhookServer() (*httptest.Server, func() []map[string]string) {
+	lock := sync.Mutex{}
+	var bodies []map[string]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := map[string]string{}
+		_ = json.NewDecoder(r.Body).Decode(&b)
+		lock.Lock()
+		bodies = append(bodies, b)
+		lock.Unlock()
+	}))
+	return ts, func() []map[string]string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]map[string]string(nil), bodies...)
+	}
+}
+
+func TestWithNotifications(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/ban") {
+			w.WriteHeader(http.StatusForbidden)
+		}
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+	hook, bodies := newWebhookServer()
+	defer hook.Close()
+
+	s := NewSpider(WithSynchronousMode(), WithNotifications(SlackWebhook(hook.URL), NotificationRules{
+		Finished:   true,
+		HostBanned: 2,
+	}))
+	s.Logging = false
+	s.SeedTask(goreq.Get(ts.URL+"/a"), func(ctx *Context) {})
+	for i := 0; i < 3; i++ {
+		s.SeedTask(goreq.Get(fmt.Sprintf("%s/ban/%d", ts.URL, i)), func(ctx *Context) {})
+	}
+	s.Wait()
+
+	b := bodies()
+	if assert.Len(t, b, 2) {
+		assert.Contains(t, b[0]["text"], "banned the spider")
+		assert.Contains(t, b[0]["text"], ts.URL+"/ban/1")
+		assert.Contains(t, b[1]["text"], "crawl finished")
+		assert.Contains(t, b[1]["text"], "tasks 4/4")
+	}
+}
+
+func TestWithNotifications_ErrorRate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+	var got []*Notification
+	lock := sync.Mutex{}
+	sink := NotificationFunc(func(n *Notification) error {
+		lock.Lock()
+		defer lock.Unlock()
+		got = append(got, n)
+		return nil
+	})
+
+	s := NewSpider(WithSynchronousMode(), WithHTTPStatusErrors(), WithNotifications(sink, NotificationRules{
+		ErrorRate:       0.5,
+		ErrorRateWindow: 50 * time.Millisecond,
+		MinTasks:        1,
+	}))
+	s.Logging = false
+	for i := 0; i < 10; i++ {
+		s.SeedTask(goreq.Get(fmt.Sprintf("%s/%d", ts.URL, i)), func(ctx *Context) {})
+	}
+	s.Wait()
+
+	lock.Lock()
+	defer lock.Unlock()
+	if assert.Len(t, got, 1) {
+		assert.Equal(t, NotifyErrorRate, got[0].Event)
+		assert.Contains(t, got[0].Title, "error rate 100.0%")
+		assert.Contains(t, got[0].Text, "http status 500 Internal Server Error: <url>")
+	}
+}
+
+func TestWithNotifications_SinkError(t *testing.T) {
+	s := NewSpider(WithSynchronousMode(), WithNotifications(NotificationFunc(func(n *Notification) error {
+		return errors.New("unreachable")
+	}), NotificationRules{Finished: true}))
+	l := &testLogger{}
+	s.SetLogger(l)
+	s.Wait()
+	var logs []string
+	for _, r := range l.records {
+		logs = append(logs, r.Msg)
+	}
+	assert.Contains(t, logs, "notification error")
+}
+
+func TestDiscordWebhook(t *testing.T) {
+	hook, bodies := newWebhookServer()
+	defer hook.Close()
+	err := DiscordWebhook(hook.URL).Notify(&Notification{Title: "title", Text: strings.Repeat("x", 3000)})
+	assert.NoError(t, err)
+	if b := bodies(); assert.Len(t, b, 1) {
+		content := []rune(b[0]["content"])
+		assert.Len(t, content, discordMaxContent)
+		assert.True(t, strings.HasPrefix(string(content), "**title**\nxxx"))
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer failing.Close()
+	assert.Error(t, SlackWebhook(failing.URL).Notify(&Notification{Title: "title"}))
+}
+
+func TestEmailSink_Message(t *testing.T) {
+	e := &EmailSink{From: "spider@example.com", To: []string{"a@example.com", "b@example.com"}}
+	msg := string(e.message(&Notification{Title: "爬虫 finished", Text: "line1\nline2", Time: time.Unix(0, 0).UTC()}))
+	assert.Contains(t, msg, "To: a@example.com, b@example.com\r\n")
+	assert.Contains(t, msg, "Subject: =?utf-8?q?")
+	assert.True(t, strings.HasSuffix(msg, "\r\n\r\nline1\r\nline2\r\n"))
+}
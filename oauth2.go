@@ -0,0 +1,52 @@
+package gospider
+
+import (
+	"context"
+
+	"github.com/zhshch2002/goreq"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// WithOAuth2 为请求加上OAuth2的Bearer令牌，令牌过期前自动刷新
+// 传入tok时使用refresh token流程(cfg.TokenSource)，否则使用cfg的ClientID、ClientSecret、Endpoint.TokenURL和Scopes进行client credentials流程
+func WithOAuth2(cfg oauth2.Config, tok ...*oauth2.Token) Extension {
+	var src oauth2.TokenSource
+	if len(tok) > 0 && tok[0] != nil {
+		src = cfg.TokenSource(context.Background(), tok[0])
+	} else {
+		cc := &clientcredentials.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			TokenURL:     cfg.Endpoint.TokenURL,
+			Scopes:       cfg.Scopes,
+			AuthStyle:    cfg.Endpoint.AuthStyle,
+		}
+		src = cc.TokenSource(context.Background())
+	}
+	return WithOAuth2TokenSource(src)
+}
+
+// WithOAuth2TokenSource 使用src获取令牌，src会被oauth2.ReuseTokenSource包装，只在令牌过期时重新获取
+// 已经设置Authorization请求头的请求不会被修改，获取令牌失败时请求以该错误结束
+func WithOAuth2TokenSource(src oauth2.TokenSource) Extension {
+	src = oauth2.ReuseTokenSource(nil, src)
+	return func(s *Spider) {
+		s.Client.Use(func(c *goreq.Client, next goreq.Handler) goreq.Handler {
+			return func(req *goreq.Request) *goreq.Response {
+				if req.Err != nil || req.Header.Get("Authorization") != "" {
+					return next(req)
+				}
+				tok, err := src.Token()
+				if err != nil {
+					return &goreq.Response{
+						Req: req,
+						Err: err,
+					}
+				}
+				tok.SetAuthHeader(req.Request)
+				return next(req)
+			}
+		})
+	}
+}
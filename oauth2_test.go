@@ -0,0 +1,65 @@
+package gospider
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"golang.org/x/oauth2"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithOAuth2(t *testing.T) {
+	var issued int64
+	var grants []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			_ = r.ParseForm()
+			grants = append(grants, r.PostForm.Get("grant_type"))
+			n := atomic.AddInt64(&issued, 1)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprintf(w, `{"access_token":"tok%d","token_type":"Bearer","expires_in":3600}`, n)
+		default:
+			_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+		}
+	}))
+	defer ts.Close()
+
+	cfg := oauth2.Config{
+		ClientID:     "id",
+		ClientSecret: "secret",
+		Endpoint:     oauth2.Endpoint{TokenURL: ts.URL + "/token", AuthStyle: oauth2.AuthStyleInParams},
+	}
+
+	s := NewSpider(WithOAuth2(cfg))
+	s.Logging = false
+	for i := 0; i < 2; i++ {
+		resp, err := s.Client.Do(goreq.Get(ts.URL + "/api")).Resp()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "Bearer tok1", resp.Text)
+		}
+	}
+
+	expired := &oauth2.Token{AccessToken: "old", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Minute)}
+	s = NewSpider(WithOAuth2(cfg, expired))
+	s.Logging = false
+	resp, err := s.Client.Do(goreq.Get(ts.URL + "/api")).Resp()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Bearer tok2", resp.Text)
+	}
+	resp, err = s.Client.Do(goreq.Get(ts.URL+"/api").AddHeader("Authorization", "Basic x")).Resp()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Basic x", resp.Text)
+	}
+	assert.Equal(t, []string{"client_credentials", "refresh_token"}, grants)
+
+	cfg.Endpoint.TokenURL = "http://127.0.0.1:1/token"
+	s = NewSpider(WithOAuth2(cfg))
+	s.Logging = false
+	_, err = s.Client.Do(goreq.Get(ts.URL + "/api")).Resp()
+	assert.Error(t, err)
+}
@@ -0,0 +1,222 @@
+package gospider
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/tidwall/gjson"
+	"github.com/zhshch2002/goreq"
+)
+
+// PageMetaKey 翻页任务Meta中的页码，种子页为1，见FollowPagination
+const PageMetaKey = "_page"
+
+// pagination 翻页设置
+type pagination struct {
+	selector string // "下一页"链接的选择器，为空时只使用rel=next
+	limit    int    // 最多翻到的页码，0为不限制
+}
+
+// WithPagination 设置FollowPagination查找下一页的选择器(如"a.next"，优先于rel=next)和最多翻到的页码，limit为0时不限制
+func WithPagination(selector string, limit int) Extension {
+	return func(s *Spider) {
+		s.paging = &pagination{selector: selector, limit: limit}
+	}
+}
+
+// FollowPagination 查找下一页并以当前任务的处理方法加入任务，返回是否加入了任务
+// 下一页依次从WithPagination的选择器、HTML中的<link rel="next">/<a rel="next">和响应头Link: <...>; rel="next"中查找，
+// 相对地址按重定向后的URL解析；页码保存在Meta的PageMetaKey中，达到WithPagination的上限后不再翻页
+func (c *Context) FollowPagination() bool {
+	if c.task == nil || c.Resp == nil || c.Resp.Response == nil {
+		return false
+	}
+	p := c.s.paging
+	if p == nil {
+		p = &pagination{}
+	}
+	page := c.GetInt(PageMetaKey)
+	if page < 1 {
+		page = 1
+	}
+	if p.limit > 0 && page >= p.limit {
+		return false
+	}
+	next := c.nextPage(p.selector)
+	if next == nil {
+		return false
+	}
+	meta := c.childMeta(c.s.inheritMeta)
+	meta[PageMetaKey] = page + 1
+	c.addTask(goreq.Get(next.String()), meta, time.Time{}, c.task.Handlers...)
+	return true
+}
+
+// nextPage 下一页的地址，没有时为nil
+func (c *Context) nextPage(selector string) *url.URL {
+	base := c.FinalURL()
+	var href string
+	if c.Resp.IsHTML() {
+		if doc, err := c.HTML(); err == nil {
+			if selector != "" {
+				href = doc.Find(selector).First().AttrOr("href", "")
+			}
+			if href == "" {
+				doc.Find("link[rel][href], a[rel][href]").EachWithBreak(func(i int, sel *goquery.Selection) bool {
+					if hasRelNext(sel.AttrOr("rel", "")) {
+						href = sel.AttrOr("href", "")
+					}
+					return href == ""
+				})
+			}
+		}
+	}
+	if href == "" {
+		href = linkHeaderNext(c.Resp.Header.Values("Link"))
+	}
+	if href == "" {
+		return nil
+	}
+	u, err := base.Parse(strings.TrimSpace(href))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil
+	}
+	u.Fragment = ""
+	if *u == *base {
+		return nil
+	}
+	return u
+}
+
+// hasRelNext rel属性(空格分隔的多个值)中是否有next
+func hasRelNext(rel string) bool {
+	for _, r := range strings.Fields(rel) {
+		if strings.EqualFold(r, "next") {
+			return true
+		}
+	}
+	return false
+}
+
+// linkHeaderNext 从Link响应头(RFC 8288)中找到rel="next"的地址
+func linkHeaderNext(values []string) string {
+	for _, v := range values {
+		for _, link := range strings.Split(v, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+				if len(kv) == 2 && strings.EqualFold(kv[0], "rel") && hasRelNext(strings.Trim(kv[1], `"`)) {
+					return target[1 : len(target)-1]
+				}
+			}
+		}
+	}
+	return ""
+}
+
+const (
+	// APICursorMetaKey JSON接口翻页任务Meta中的游标，见APIPagination
+	APICursorMetaKey = "_api_cursor"
+	// APIOffsetMetaKey JSON接口翻页任务Meta中的偏移量，见APIPagination
+	APIOffsetMetaKey = "_api_offset"
+)
+
+// APIPagination JSON接口的翻页方式，设置CursorPath时按游标翻页，否则按偏移量翻页
+//
+//	p := &gospider.APIPagination{
+//		URL:        "https://api.example.com/items?cursor={cursor}",
+//		CursorPath: "meta.next_cursor",
+//	}
+//	s.SeedTask(goreq.Get("https://api.example.com/items"), p.Handler(parse))
+type APIPagination struct {
+	// URL 下一页的URL模板，可以是相对地址，{cursor}替换为游标(已转义)，{offset}替换为偏移量，{page}替换为页码
+	URL string
+	// CursorPath 响应中下一页游标的gjson路径，游标为空、为false或与本页相同时结束
+	CursorPath string
+	// ItemsPath 响应中本页条目数组的gjson路径，按偏移量翻页时用于计算下一页的偏移量，数组为空时结束
+	ItemsPath string
+	// TotalPath 响应中总条数的gjson路径，按偏移量翻页时偏移量达到总数后结束
+	TotalPath string
+	// PageSize 按偏移量翻页时每页的条数，没有设置ItemsPath时偏移量按此增加；本页条目少于PageSize时结束
+	PageSize int
+	// MaxPages 最多翻到的页码，0为不限制
+	MaxPages int
+}
+
+// Handler 返回先执行h、再调用FollowAPIPagination的处理方法，处理方法中Abort时不翻页
+func (p *APIPagination) Handler(h Handler) Handler {
+	return func(ctx *Context) {
+		if h != nil {
+			h(ctx)
+		}
+		if !ctx.IsAborted() {
+			ctx.FollowAPIPagination(p)
+		}
+	}
+}
+
+// FollowAPIPagination 按p从JSON响应中计算下一页并以当前任务的处理方法加入任务，返回是否加入了任务
+// 新任务复制当前请求的请求头(如认证信息)，游标、偏移量和页码保存在Meta中
+func (c *Context) FollowAPIPagination(p *APIPagination) bool {
+	if c.task == nil || c.Resp == nil || c.Resp.Response == nil || c.Req == nil || c.Req.Request == nil {
+		return false
+	}
+	page := c.GetInt(PageMetaKey)
+	if page < 1 {
+		page = 1
+	}
+	if p.MaxPages > 0 && page >= p.MaxPages {
+		return false
+	}
+	j, err := c.JSON()
+	if err != nil || !j.IsObject() && !j.IsArray() {
+		return false
+	}
+	meta := c.childMeta(c.s.inheritMeta)
+	cursor, offset := "", 0
+	if p.CursorPath != "" {
+		cur := j.Get(p.CursorPath)
+		cursor = cur.String()
+		if !cur.Exists() || cursor == "" || cur.Type == gjson.False || cursor == c.GetString(APICursorMetaKey) {
+			return false
+		}
+		meta[APICursorMetaKey] = cursor
+	} else {
+		n := p.PageSize
+		if p.ItemsPath != "" {
+			n = len(j.Get(p.ItemsPath).Array())
+		}
+		if n == 0 || (p.PageSize > 0 && n < p.PageSize) {
+			return false
+		}
+		offset = c.GetInt(APIOffsetMetaKey) + n
+		if p.TotalPath != "" {
+			if total := j.Get(p.TotalPath); total.Exists() && offset >= int(total.Int()) {
+				return false
+			}
+		}
+		meta[APIOffsetMetaKey] = offset
+	}
+	meta[PageMetaKey] = page + 1
+	next, err := c.FinalURL().Parse(strings.NewReplacer(
+		"{cursor}", url.QueryEscape(cursor),
+		"{offset}", strconv.Itoa(offset),
+		"{page}", strconv.Itoa(page+1),
+	).Replace(p.URL))
+	if err != nil {
+		return false
+	}
+	req := goreq.Get(next.String())
+	if req.Err == nil {
+		req.Header = c.Req.Header.Clone()
+	}
+	c.addTask(req, meta, time.Time{}, c.task.Handlers...)
+	return true
+}
@@ -0,0 +1,118 @@
+package gospider
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestLinkHeaderNext(t *testing.T) {
+	assert.Equal(t, "/p2", linkHeaderNext([]string{`</p0>; rel="prev", </p2>; rel="next"`}))
+	assert.Equal(t, "/p2", linkHeaderNext([]string{`</first>; rel=first`, `</p2>; rel="next last"`}))
+	assert.Equal(t, "", linkHeaderNext([]string{`</p0>; rel="prev"`}))
+}
+
+func TestContext_FollowPagination(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		switch r.URL.Path {
+		case "/rel":
+			w.Header().Set("Content-Type", "text/html")
+			if page < 5 {
+				fmt.Fprintf(w, `<html><head><link rel="next" href="?page=%d"></head></html>`, page+1)
+			}
+		case "/selector":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `<a rel="nofollow" href="/other">x</a><a class="next" href="/selector?page=%d">next</a>`, page+1)
+		case "/api":
+			w.Header().Set("Content-Type", "application/json")
+			if page < 3 {
+				w.Header().Set("Link", fmt.Sprintf(`</api?page=%d>; rel="next"`, page+1))
+			}
+			w.Write([]byte("[]"))
+		}
+	}))
+	defer ts.Close()
+
+	run := func(path string, e ...interface{}) (pages []int) {
+		s := NewSpider(append([]interface{}{WithSynchronousMode()}, e...)...)
+		s.Logging = false
+		s.SeedTask(goreq.Get(ts.URL+path), func(ctx *Context) {
+			page := ctx.GetInt(PageMetaKey)
+			if page == 0 {
+				page = 1
+			}
+			pages = append(pages, page)
+			ctx.FollowPagination()
+		})
+		s.Wait()
+		return
+	}
+
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, run("/rel"))
+	assert.Equal(t, []int{1, 2, 3}, run("/rel", WithPagination("", 3)))
+	assert.Equal(t, []int{1, 2, 3, 4}, run("/selector", WithPagination("a.next", 4)))
+	assert.Equal(t, []int{1, 2, 3}, run("/api"))
+}
+
+func TestAPIPagination(t *testing.T) {
+	items := make([]int, 25)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/cursor":
+			cur, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+			next := `"` + strconv.Itoa(cur+10) + `"`
+			if cur+10 >= len(items) {
+				next = "null"
+			}
+			fmt.Fprintf(w, `{"data":[],"next":%s}`, next)
+		case "/offset":
+			off, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			end := off + 10
+			if end > len(items) {
+				end = len(items)
+			}
+			b, _ := json.Marshal(items[off:end])
+			fmt.Fprintf(w, `{"items":%s,"total":%d}`, b, len(items))
+		}
+	}))
+	defer ts.Close()
+
+	run := func(path string, p *APIPagination) (got []string) {
+		s := NewSpider(WithSynchronousMode())
+		s.Logging = false
+		s.SeedTask(goreq.Get(ts.URL+path).AddHeader("Authorization", "Bearer t"), p.Handler(func(ctx *Context) {
+			got = append(got, ctx.Req.URL.RawQuery)
+		}))
+		s.Wait()
+		return
+	}
+
+	assert.Equal(t, []string{"", "cursor=10", "cursor=20"}, run("/cursor", &APIPagination{
+		URL:        "/cursor?cursor={cursor}",
+		CursorPath: "next",
+	}))
+	assert.Equal(t, []string{"", "offset=10&page=2", "offset=20&page=3"}, run("/offset", &APIPagination{
+		URL:       "/offset?offset={offset}&page={page}",
+		ItemsPath: "items",
+		TotalPath: "total",
+	}))
+	assert.Equal(t, []string{"", "offset=10&page=2"}, run("/offset", &APIPagination{
+		URL:      "/offset?offset={offset}&page={page}",
+		PageSize: 10,
+		MaxPages: 2,
+	}))
+}
@@ -0,0 +1,132 @@
+package gospider
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ledongthuc/pdf"
+)
+
+var (
+	// ErrNotPDF 数据不是PDF文件
+	ErrNotPDF = errors.New("not a pdf")
+)
+
+// PDFDoc 从PDF中提取的文本和元数据
+type PDFDoc struct {
+	NumPages int
+	Pages    []string // 每页的文本，无法提取的页面为空字符串
+	Text     string   // 全部页面的文本，页面之间以换页符(\f)分隔
+
+	Title        string
+	Author       string
+	Subject      string
+	Keywords     string
+	Creator      string
+	Producer     string
+	CreationDate time.Time
+	ModDate      time.Time
+	Info         map[string]string // 文档信息字典中全部的字符串项
+}
+
+// ParsePDF 解析PDF，提取每页的文本、页数和文档信息；加密的PDF只支持空密码
+// 单个页面提取文本失败时该页为空，不影响其他页面
+func ParsePDF(data []byte) (doc *PDFDoc, err error) {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return nil, ErrNotPDF
+	}
+	// pdf库在遇到损坏的文件时会panic
+	defer func() {
+		if e := recover(); e != nil {
+			doc, err = nil, fmt.Errorf("pdf: %v", e)
+		}
+	}()
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	doc = &PDFDoc{NumPages: r.NumPage(), Info: map[string]string{}}
+	fonts := map[string]*pdf.Font{}
+	for i := 1; i <= doc.NumPages; i++ {
+		p := r.Page(i)
+		if p.V.IsNull() {
+			doc.Pages = append(doc.Pages, "")
+			continue
+		}
+		for _, name := range p.Fonts() {
+			if _, ok := fonts[name]; !ok {
+				f := p.Font(name)
+				fonts[name] = &f
+			}
+		}
+		text, err := p.GetPlainText(fonts)
+		if err != nil {
+			text = ""
+		}
+		doc.Pages = append(doc.Pages, strings.TrimSpace(text))
+	}
+	doc.Text = strings.Join(doc.Pages, "\f")
+
+	info := r.Trailer().Key("Info")
+	for _, k := range info.Keys() {
+		if v := info.Key(k); v.Kind() == pdf.String {
+			doc.Info[k] = v.Text()
+		}
+	}
+	doc.Title = doc.Info["Title"]
+	doc.Author = doc.Info["Author"]
+	doc.Subject = doc.Info["Subject"]
+	doc.Keywords = doc.Info["Keywords"]
+	doc.Creator = doc.Info["Creator"]
+	doc.Producer = doc.Info["Producer"]
+	doc.CreationDate = parsePDFDate(doc.Info["CreationDate"])
+	doc.ModDate = parsePDFDate(doc.Info["ModDate"])
+	return doc, nil
+}
+
+// pdfDateRe PDF的日期格式 D:YYYYMMDDHHmmSSOHH'mm'，月以后的部分可以省略
+var pdfDateRe = regexp.MustCompile(`^(?:D:)?(\d{4})(\d{2})?(\d{2})?(\d{2})?(\d{2})?(\d{2})?(?:([Zz+-])(\d{2})?'?(\d{2})?'?)?`)
+
+// parsePDFDate 解析PDF的日期，无法解析时为零值
+func parsePDFDate(s string) time.Time {
+	m := pdfDateRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return time.Time{}
+	}
+	n := func(i, def int) int {
+		if m[i] == "" {
+			return def
+		}
+		v, _ := strconv.Atoi(m[i])
+		return v
+	}
+	loc := time.UTC
+	if m[7] == "+" || m[7] == "-" {
+		offset := n(8, 0)*3600 + n(9, 0)*60
+		if m[7] == "-" {
+			offset = -offset
+		}
+		loc = time.FixedZone("", offset)
+	}
+	return time.Date(n(1, 0), time.Month(n(2, 1)), n(3, 1), n(4, 0), n(5, 0), n(6, 0), 0, loc)
+}
+
+// OnPDF 解析PDF响应(Content-Type为application/pdf或响应体以%PDF-开头)并调用fn，解析失败时记录错误日志
+func (s *Spider) OnPDF(fn func(ctx *Context, doc *PDFDoc)) HookID {
+	return s.OnResp(func(ctx *Context) {
+		if mediaType(ctx.Resp.Header.Get("Content-Type")) != "application/pdf" && !bytes.HasPrefix(ctx.Resp.Body, []byte("%PDF-")) {
+			return
+		}
+		doc, err := ParsePDF(ctx.Resp.Body)
+		if err != nil {
+			s.writeLog(ctx, LogError, "pdf parse error", "error", err, "spider", s.Name, "context", ctx.String())
+			return
+		}
+		fn(ctx, doc)
+	})
+}
@@ -0,0 +1,85 @@
+package gospider
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testPDF 生成每页一行文字的PDF
+func testPDF(pages ...string) []byte {
+	var objs []string
+	objs = append(objs, "<< /Type /Catalog /Pages 2 0 R >>")
+	kids := ""
+	for i := range pages {
+		kids += fmt.Sprintf("%d 0 R ", 5+i*2)
+	}
+	objs = append(objs, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids, len(pages)))
+	objs = append(objs, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>")
+	objs = append(objs, "<< /Title (Annual Report) /Author (Gospider) /CreationDate (D:20210102030405+08'00') >>")
+	for i, text := range pages {
+		content := fmt.Sprintf("BT /F1 12 Tf 72 712 Td (%s) Tj ET", text)
+		objs = append(objs, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 6+i*2))
+		objs = append(objs, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString("%PDF-1.4\n")
+	var offsets []int
+	for i, o := range objs {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(buf, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(buf, "trailer\n<< /Size %d /Root 1 0 R /Info 4 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, xref)
+	return buf.Bytes()
+}
+
+func TestParsePDF(t *testing.T) {
+	doc, err := ParsePDF(testPDF("Hello PDF", "Second page"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, doc.NumPages)
+	assert.Equal(t, []string{"Hello PDF", "Second page"}, doc.Pages)
+	assert.Equal(t, "Hello PDF\fSecond page", doc.Text)
+	assert.Equal(t, "Annual Report", doc.Title)
+	assert.Equal(t, "Gospider", doc.Author)
+	assert.True(t, time.Date(2021, 1, 1, 19, 4, 5, 0, time.UTC).Equal(doc.CreationDate), doc.CreationDate.String())
+	assert.True(t, doc.ModDate.IsZero())
+
+	_, err = ParsePDF([]byte("<html></html>"))
+	assert.Equal(t, ErrNotPDF, err)
+	_, err = ParsePDF([]byte("%PDF-1.4\ngarbage"))
+	assert.Error(t, err)
+}
+
+func TestSpider_OnPDF(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/report.pdf" {
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write(testPDF("Hello PDF"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>hi</p>"))
+	}))
+	defer ts.Close()
+
+	s := NewSpider(WithSynchronousMode())
+	s.Logging = false
+	var texts []string
+	s.OnPDF(func(ctx *Context, doc *PDFDoc) {
+		texts = append(texts, doc.Text)
+	})
+	s.SeedTask(goreq.Get(ts.URL + "/report.pdf"))
+	s.SeedTask(goreq.Get(ts.URL + "/page"))
+	s.Wait()
+	assert.Equal(t, []string{"Hello PDF"}, texts)
+}
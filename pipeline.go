@@ -0,0 +1,211 @@
+package gospider
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ItemPipeline 有生命周期的Item处理管道，如保存到文件或数据库
+// Open在加入爬虫时调用一次；Process处理每个Item，返回的Item交给之后的OnItem，返回nil时丢弃(与OnItem相同)，
+// 返回错误时记录日志、放入死信队列(见WithDeadLetterQueue)，原Item继续传递；
+// Flush将缓冲的数据写出，Stop时和每次Wait返回前调用；Close在Stop后的Wait返回前或调用Spider.Close时调用一次，
+// 此后不再调用Process，管道在多次Wait之间保持打开(如ReplayErrors、ResumeFrom之后再次Wait)
+// Process可能被并发调用
+type ItemPipeline interface {
+	Open(s *Spider) error
+	Process(ctx *Context, item interface{}) (interface{}, error)
+	Flush() error
+	Close() error
+}
+
+// AddPipeline 打开p并注册为OnItem，Open出错时不注册，返回错误
+func (s *Spider) AddPipeline(p ItemPipeline) error {
+	if err := p.Open(s); err != nil {
+		return err
+	}
+	s.pipeLock.Lock()
+	s.pipelines = append(s.pipelines, p)
+	s.pipeLock.Unlock()
+	s.OnItem(func(ctx *Context, i interface{}) interface{} {
+		if !s.hasPipeline(p) {
+			// 已经关闭
+			return i
+		}
+		out, err := p.Process(ctx, i)
+		if err != nil {
+			s.writeLog(ctx, LogError, "pipeline error", "error", err, "spider", s.Name, "pipeline", fmt.Sprintf("%T", p))
+			s.pushDeadLetter(DeadLetterItem, ctx, i, err)
+			return i
+		}
+		return out
+	})
+	return nil
+}
+
+// WithPipeline 使用p处理Item(见AddPipeline)，Open出错时记录日志，不注册p
+func WithPipeline(p ItemPipeline) Extension {
+	return func(s *Spider) {
+		if err := s.AddPipeline(p); err != nil {
+			s.writeLog(nil, LogError, "pipeline open error", "error", err, "spider", s.Name, "pipeline", fmt.Sprintf("%T", p))
+		}
+	}
+}
+
+// Pipelines 注册的ItemPipeline
+func (s *Spider) Pipelines() []ItemPipeline {
+	s.pipeLock.Lock()
+	defer s.pipeLock.Unlock()
+	return append([]ItemPipeline(nil), s.pipelines...)
+}
+
+// hasPipeline p是否已注册且尚未关闭
+func (s *Spider) hasPipeline(p ItemPipeline) bool {
+	s.pipeLock.Lock()
+	defer s.pipeLock.Unlock()
+	for _, i := range s.pipelines {
+		if i == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Close 关闭所有ItemPipeline(见AddPipeline)和LifecycleExtension(如WithControlAPI、WithDebugServer的服务)，
+// 在不再调用Wait时调用；Stop之后的Wait会自动关闭，不需要再调用
+func (s *Spider) Close() error {
+	err := s.closePipelines()
+	if cerr := s.closeExtensions(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// flushPipelines 依次Flush所有管道，返回第一个错误
+func (s *Spider) flushPipelines() error {
+	var first error
+	for _, p := range s.Pipelines() {
+		if err := p.Flush(); err != nil {
+			s.writeLog(nil, LogError, "pipeline flush error", "error", err, "spider", s.Name, "pipeline", fmt.Sprintf("%T", p))
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// closePipelines 依次Close所有管道并移除，返回第一个错误
+func (s *Spider) closePipelines() error {
+	s.pipeLock.Lock()
+	ps := s.pipelines
+	s.pipelines = nil
+	s.pipeLock.Unlock()
+	var first error
+	for _, p := range ps {
+		if err := p.Close(); err != nil {
+			s.writeLog(nil, LogError, "pipeline close error", "error", err, "spider", s.Name, "pipeline", fmt.Sprintf("%T", p))
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// CsvPipeline 将CsvItem以csv格式写入io.Writer，其他Item原样传递
+// 写入有缓冲，Flush和Close时写出；Close不关闭io.Writer
+type CsvPipeline struct {
+	lock sync.Mutex
+	w    *csv.Writer
+}
+
+// NewCsvPipeline 写入w的CsvPipeline
+func NewCsvPipeline(w io.Writer) *CsvPipeline {
+	return &CsvPipeline{w: csv.NewWriter(w)}
+}
+
+// Open 无操作
+func (p *CsvPipeline) Open(s *Spider) error {
+	return nil
+}
+
+// Process 写入CsvItem
+func (p *CsvPipeline) Process(ctx *Context, i interface{}) (interface{}, error) {
+	data, ok := i.(CsvItem)
+	if !ok {
+		return i, nil
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return i, p.w.Write(data)
+}
+
+// Flush 写出缓冲的数据
+func (p *CsvPipeline) Flush() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.w.Flush()
+	return p.w.Error()
+}
+
+// Close 同Flush
+func (p *CsvPipeline) Close() error {
+	return p.Flush()
+}
+
+// JSONLinesPipeline 将Item编码为JSON写入io.Writer，每行一个
+// 写入有缓冲，Flush和Close时写出；Close不关闭io.Writer
+type JSONLinesPipeline struct {
+	lock sync.Mutex
+	buf  *bufio.Writer
+	enc  *json.Encoder
+}
+
+// NewJSONLinesPipeline 写入w的JSONLinesPipeline
+func NewJSONLinesPipeline(w io.Writer) *JSONLinesPipeline {
+	buf := bufio.NewWriter(w)
+	return &JSONLinesPipeline{buf: buf, enc: json.NewEncoder(buf)}
+}
+
+// Open 无操作
+func (p *JSONLinesPipeline) Open(s *Spider) error {
+	return nil
+}
+
+// Process 写入Item
+func (p *JSONLinesPipeline) Process(ctx *Context, i interface{}) (interface{}, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return i, p.enc.Encode(i)
+}
+
+// Flush 写出缓冲的数据
+func (p *JSONLinesPipeline) Flush() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.buf.Flush()
+}
+
+// Close 同Flush
+func (p *JSONLinesPipeline) Close() error {
+	return p.Flush()
+}
+
+// filePipeline Close时同时关闭写入的文件，用于配置中的输出
+type filePipeline struct {
+	ItemPipeline
+	f io.Closer
+}
+
+// Close 关闭管道和文件
+func (p *filePipeline) Close() error {
+	err := p.ItemPipeline.Close()
+	if cerr := p.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,153 @@
+package gospider
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// recordPipeline 记录生命周期方法的调用
+type recordPipeline struct {
+	lock    sync.Mutex
+	calls   []string
+	items   []interface{}
+	openErr error
+}
+
+func (p *recordPipeline) record(call string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.calls = append(p.calls, call)
+}
+
+func (p *recordPipeline) Open(s *Spider) error {
+	p.record("open")
+	return p.openErr
+}
+
+func (p *recordPipeline) Process(ctx *Context, i interface{}) (interface{}, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if i == "bad" {
+		return nil, errors.New("bad item")
+	}
+	p.items = append(p.items, i)
+	return i, nil
+}
+
+func (p *recordPipeline) Flush() error {
+	p.record("flush")
+	return nil
+}
+
+func (p *recordPipeline) Close() error {
+	p.record("close")
+	return nil
+}
+
+func TestWithPipeline(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	p := &recordPipeline{}
+	q := NewMemoryDeadLetterQueue()
+	s := NewSpider(WithSynchronousMode(), WithDeadLetterQueue(q), WithPipeline(p))
+	s.Logging = false
+	var after []interface{}
+	s.OnItem(func(ctx *Context, i interface{}) interface{} {
+		after = append(after, i)
+		return i
+	})
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		ctx.AddItem("a")
+		ctx.AddItem("bad")
+	})
+	s.Wait()
+	assert.Equal(t, []string{"open", "flush"}, p.calls)
+	assert.Equal(t, []interface{}{"a"}, p.items)
+	assert.Equal(t, []interface{}{"a", "bad"}, after)
+	assert.Equal(t, 1, q.Len())
+	assert.NoError(t, s.Close())
+	assert.Equal(t, []string{"open", "flush", "close"}, p.calls)
+	assert.Empty(t, s.Pipelines())
+
+	// Open出错时不注册
+	bad := &recordPipeline{openErr: errors.New("open failed")}
+	s = NewSpider(WithPipeline(bad))
+	s.Logging = false
+	assert.Empty(t, s.Pipelines())
+	assert.Error(t, s.AddPipeline(bad))
+}
+
+func TestWithPipeline_Stop(t *testing.T) {
+	p := &recordPipeline{}
+	s := NewSpider(WithPipeline(p))
+	s.Logging = false
+	s.Stop()
+	assert.Equal(t, []string{"open", "flush"}, p.calls)
+	s.Wait()
+	assert.Equal(t, []string{"open", "flush", "close"}, p.calls)
+}
+
+func TestWithPipeline_MultipleWait(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	buf := &bytes.Buffer{}
+	s := NewSpider(WithSynchronousMode(), WithCsvItemSaver(buf))
+	s.Logging = false
+	save := func(ctx *Context) {
+		ctx.AddItem(CsvItem{ctx.Req.URL.Path[1:]})
+	}
+	s.SeedTask(goreq.Get(ts.URL+"/a"), save)
+	s.Wait()
+	assert.Equal(t, "a\n", buf.String())
+	s.SeedTask(goreq.Get(ts.URL+"/b"), save)
+	s.Wait()
+	assert.Equal(t, "a\nb\n", buf.String())
+	assert.Len(t, s.Pipelines(), 1)
+
+	// 关闭之后的Item不再交给管道
+	assert.NoError(t, s.Close())
+	s.SeedTask(goreq.Get(ts.URL+"/c"), save)
+	s.Wait()
+	assert.Equal(t, "a\nb\n", buf.String())
+}
+
+func TestCsvPipeline(t *testing.T) {
+	buf := &bytes.Buffer{}
+	p := NewCsvPipeline(buf)
+	i, err := p.Process(nil, CsvItem{"a", "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, CsvItem{"a", "b"}, i)
+	i, err = p.Process(nil, "other")
+	assert.NoError(t, err)
+	assert.Equal(t, "other", i)
+	// 写出前数据在缓冲中
+	assert.Equal(t, 0, buf.Len())
+	assert.NoError(t, p.Close())
+	assert.Equal(t, "a,b\n", buf.String())
+}
+
+func TestJSONLinesPipeline(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	buf := &bytes.Buffer{}
+	s := NewSpider(WithSynchronousMode(), WithJSONLinesItemSaver(buf))
+	s.Logging = false
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		ctx.AddItem(map[string]int{"a": 1})
+	})
+	s.OnScraped(func(ctx *Context) {
+		// Wait返回前数据在缓冲中
+		assert.Equal(t, 0, buf.Len())
+	})
+	s.Wait()
+	assert.Equal(t, "{\"a\":1}\n", buf.String())
+}
@@ -0,0 +1,116 @@
+package gospider
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/zhshch2002/goreq"
+)
+
+// PreflightLimits HEAD预检的限制，零值字段不限制
+type PreflightLimits struct {
+	MaxSize int64    // Content-Length的上限，响应没有Content-Length时不限制
+	Allow   []string // 允许的MIME类型，支持"text/*"这样的通配，响应没有Content-Type时不限制
+}
+
+// preflight 等待HEAD预检的任务
+type preflight struct {
+	limits   PreflightLimits
+	patterns []*regexp.Regexp
+
+	lock    sync.Mutex
+	pending map[*Task]*Task // HEAD任务 -> 预检通过后执行的GET任务
+}
+
+// WithHeadPreflight 对URL匹配patterns(正则，如`\.(zip|iso|mp4)$`)的GET任务先发送HEAD请求，
+// Content-Length和Content-Type满足limits时才执行GET，避免意外下载很大的文件
+// 预检在其他OnTask之后进行(如去重、设置请求头)，GET任务不再经过OnTask；预检不通过时HEAD任务以"preflight"为原因Abort(见OnAbort)。
+// HEAD请求失败或服务器不支持HEAD(状态码>=400)时仍执行GET
+func WithHeadPreflight(limits PreflightLimits, patterns ...string) Extension {
+	p := &preflight{limits: PreflightLimits{MaxSize: limits.MaxSize}, pending: map[*Task]*Task{}}
+	for _, a := range limits.Allow {
+		p.limits.Allow = append(p.limits.Allow, strings.ToLower(strings.TrimSpace(a)))
+	}
+	for _, pattern := range patterns {
+		p.patterns = append(p.patterns, regexp.MustCompile(pattern))
+	}
+	return func(s *Spider) {
+		s.OnTaskWithPriority(1000, p.onTask)
+		onErr := func(ctx *Context, err error) {
+			if get := p.take(ctx.task); get != nil {
+				s.addTask(get)
+			}
+		}
+		s.OnReqError(onErr)
+		s.OnRespError(onErr)
+		s.OnAbort(func(ctx *Context, reason string) {
+			p.take(ctx.task)
+		})
+	}
+}
+
+func (p *preflight) match(t *Task) bool {
+	if t.Req.Request == nil || t.Req.Method != http.MethodGet {
+		return false
+	}
+	u := t.Req.URL.String()
+	for _, re := range p.patterns {
+		if re.MatchString(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// onTask 将匹配的GET任务替换为HEAD任务
+func (p *preflight) onTask(ctx *Context, t *Task) *Task {
+	if !p.match(t) {
+		return t
+	}
+	req := goreq.Head(t.Req.URL.String())
+	if req.Err != nil {
+		return t
+	}
+	req.Request = req.WithContext(t.Req.Context())
+	req.Header = t.Req.Header.Clone()
+	head := NewTask(req, t.Meta, p.handle)
+	head.NotBefore = t.NotBefore
+	head.Depth = t.Depth
+	p.lock.Lock()
+	p.pending[head] = t
+	p.lock.Unlock()
+	return head
+}
+
+// take 取出HEAD任务对应的GET任务
+func (p *preflight) take(head *Task) *Task {
+	if head == nil {
+		return nil
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	get := p.pending[head]
+	delete(p.pending, head)
+	return get
+}
+
+// handle 检查HEAD的响应，通过时加入GET任务
+func (p *preflight) handle(ctx *Context) {
+	get := p.take(ctx.task)
+	if get == nil {
+		return
+	}
+	if ctx.Resp.StatusCode < 400 {
+		if p.limits.MaxSize > 0 && ctx.Resp.ContentLength > p.limits.MaxSize {
+			ctx.AbortWithReason("preflight")
+			return
+		}
+		if ct := ctx.Resp.Header.Get("Content-Type"); ct != "" && len(p.limits.Allow) > 0 && !matchMediaType(p.limits.Allow, mediaType(ct)) {
+			ctx.AbortWithReason("preflight")
+			return
+		}
+	}
+	ctx.s.addTask(get)
+}
@@ -0,0 +1,74 @@
+package gospider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestWithHeadPreflight(t *testing.T) {
+	lock := sync.Mutex{}
+	var reqs []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		reqs = append(reqs, r.Method+" "+r.URL.Path+" "+r.Header.Get("X-Token"))
+		lock.Unlock()
+		switch r.URL.Path {
+		case "/big.zip":
+			w.Header().Set("Content-Type", "application/zip")
+			w.Header().Set("Content-Length", "1000")
+			if r.Method == http.MethodGet {
+				w.Write(make([]byte, 1000))
+			}
+		case "/small.zip":
+			w.Header().Set("Content-Type", "application/zip")
+			w.Write([]byte("PK"))
+		case "/video.zip":
+			w.Header().Set("Content-Type", "video/mp4")
+			w.Write([]byte("mp4"))
+		case "/nohead.zip":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Write([]byte("PK"))
+		}
+	}))
+	defer ts.Close()
+
+	s := NewSpider(WithHeadPreflight(PreflightLimits{MaxSize: 100, Allow: []string{"application/*"}}, `\.zip$`))
+	s.Logging = false
+	s.OnTask(func(ctx *Context, t *Task) *Task {
+		t.Req.Header.Set("X-Token", "t")
+		return t
+	})
+	aborted := map[string]string{}
+	var got []string
+	s.OnAbort(func(ctx *Context, reason string) {
+		lock.Lock()
+		defer lock.Unlock()
+		aborted[ctx.Req.URL.Path] = reason
+	})
+	h := func(ctx *Context) {
+		lock.Lock()
+		defer lock.Unlock()
+		got = append(got, ctx.Req.Method+" "+ctx.Req.URL.Path)
+	}
+	for _, p := range []string{"/page", "/big.zip", "/small.zip", "/video.zip", "/nohead.zip"} {
+		s.SeedTask(goreq.Get(ts.URL+p), h)
+	}
+	s.Wait()
+
+	assert.ElementsMatch(t, []string{"GET /page", "GET /small.zip", "GET /nohead.zip"}, got)
+	assert.Equal(t, map[string]string{"/big.zip": "preflight", "/video.zip": "preflight"}, aborted)
+	assert.ElementsMatch(t, []string{
+		"GET /page t",
+		"HEAD /big.zip t",
+		"HEAD /small.zip t", "GET /small.zip t",
+		"HEAD /video.zip t",
+		"HEAD /nohead.zip t", "GET /nohead.zip t",
+	}, reqs)
+}
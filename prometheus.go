@@ -0,0 +1,138 @@
+package gospider
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/zhshch2002/goreq"
+)
+
+// WithPrometheus 在addr上启动HTTP服务，通过/metrics暴露Prometheus指标，Spider.Close时关闭
+// 包括任务调度/完成数、各状态码的响应数、请求耗时、Item数、队列深度以及各host的请求数
+func WithPrometheus(addr string) Extension {
+	return func(s *Spider) {
+		s.useExtension(&prometheusServer{addr: addr})
+	}
+}
+
+// prometheusServer 暴露Prometheus指标的HTTP服务
+type prometheusServer struct {
+	addr string
+	srv  *http.Server
+}
+
+// Init 监听addr并开始服务
+func (p *prometheusServer) Init(s *Spider) error {
+	l, err := net.Listen("tcp", p.addr)
+	if err != nil {
+		return err
+	}
+	p.addr = l.Addr().String()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(newPrometheusRegistry(s), promhttp.HandlerOpts{}))
+	p.srv = &http.Server{Handler: mux}
+	go func() {
+		if err := p.srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			s.writeLog(nil, LogError, "prometheus server error", "error", err, "spider", s.Name, "addr", p.addr)
+		}
+	}()
+	return nil
+}
+
+// Close 关闭服务
+func (p *prometheusServer) Close() error {
+	return p.srv.Close()
+}
+
+func newPrometheusRegistry(s *Spider) *prometheus.Registry {
+	responses := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gospider",
+		Name:      "responses_total",
+		Help:      "Number of responses by status code.",
+	}, []string{"spider", "code"})
+	requestErrors := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gospider",
+		Name:      "request_errors_total",
+		Help:      "Number of requests failed without a response, by host.",
+	}, []string{"spider", "host"})
+	hostRequests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gospider",
+		Name:      "host_requests_total",
+		Help:      "Number of requests sent, by host.",
+	}, []string{"spider", "host"})
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "gospider",
+		Name:      "request_duration_seconds",
+		Help:      "Request duration in seconds, by host.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"spider", "host"})
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(&statusCollector{s: s}, responses, requestErrors, hostRequests, duration)
+
+	s.Client.Use(func(c *goreq.Client, h goreq.Handler) goreq.Handler {
+		return func(req *goreq.Request) *goreq.Response {
+			start := time.Now()
+			resp := h(req)
+			host := req.URL.Host
+			duration.WithLabelValues(s.Name, host).Observe(time.Since(start).Seconds())
+			hostRequests.WithLabelValues(s.Name, host).Inc()
+			if resp == nil || resp.Err != nil || resp.Response == nil {
+				requestErrors.WithLabelValues(s.Name, host).Inc()
+			} else {
+				responses.WithLabelValues(s.Name, strconv.Itoa(resp.StatusCode)).Inc()
+			}
+			return resp
+		}
+	})
+	return reg
+}
+
+var (
+	tasksScheduledDesc = prometheus.NewDesc("gospider_tasks_scheduled_total", "Number of tasks scheduled.", []string{"spider"}, nil)
+	tasksFinishedDesc  = prometheus.NewDesc("gospider_tasks_finished_total", "Number of tasks started executing.", []string{"spider"}, nil)
+	itemsDesc          = prometheus.NewDesc("gospider_items_emitted_total", "Number of items emitted.", []string{"spider"}, nil)
+	queueDepthDesc     = prometheus.NewDesc("gospider_queue_depth", "Number of tasks scheduled but not yet started, excluding abandoned tasks.", []string{"spider"}, nil)
+
+	handlerCallsDesc      = prometheus.NewDesc("gospider_handler_calls_total", "Number of handler executions, by handler.", []string{"spider", "handler"}, nil)
+	handlerPanicsDesc     = prometheus.NewDesc("gospider_handler_panics_total", "Number of handler executions that panicked, by handler.", []string{"spider", "handler"}, nil)
+	handlerSecondsDesc    = prometheus.NewDesc("gospider_handler_seconds_total", "Total handler execution time in seconds, by handler.", []string{"spider", "handler"}, nil)
+	handlerMaxSecondsDesc = prometheus.NewDesc("gospider_handler_max_seconds", "Longest single handler execution in seconds, by handler.", []string{"spider", "handler"}, nil)
+)
+
+// statusCollector 在采集时读取SpiderStatus，spider标签使用采集时的Spider.Name
+type statusCollector struct {
+	s *Spider
+}
+
+func (c *statusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tasksScheduledDesc
+	ch <- tasksFinishedDesc
+	ch <- itemsDesc
+	ch <- queueDepthDesc
+	ch <- handlerCallsDesc
+	ch <- handlerPanicsDesc
+	ch <- handlerSecondsDesc
+	ch <- handlerMaxSecondsDesc
+}
+
+func (c *statusCollector) Collect(ch chan<- prometheus.Metric) {
+	st := c.s.Status
+	total := float64(atomic.LoadInt64(&st.TotalTask))
+	finished := float64(atomic.LoadInt64(&st.FinishedTask))
+	ch <- prometheus.MustNewConstMetric(tasksScheduledDesc, prometheus.CounterValue, total, c.s.Name)
+	ch <- prometheus.MustNewConstMetric(tasksFinishedDesc, prometheus.CounterValue, finished, c.s.Name)
+	ch <- prometheus.MustNewConstMetric(itemsDesc, prometheus.CounterValue, float64(atomic.LoadInt64(&st.TotalItem)), c.s.Name)
+	ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(st.Snapshot().PendingTask), c.s.Name)
+	for name, h := range st.HandlerStats() {
+		ch <- prometheus.MustNewConstMetric(handlerCallsDesc, prometheus.CounterValue, float64(h.Calls), c.s.Name, name)
+		ch <- prometheus.MustNewConstMetric(handlerPanicsDesc, prometheus.CounterValue, float64(h.Panics), c.s.Name, name)
+		ch <- prometheus.MustNewConstMetric(handlerSecondsDesc, prometheus.CounterValue, h.Total.Seconds(), c.s.Name, name)
+		ch <- prometheus.MustNewConstMetric(handlerMaxSecondsDesc, prometheus.GaugeValue, h.Max.Seconds(), c.s.Name, name)
+	}
+}
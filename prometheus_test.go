@@ -0,0 +1,86 @@
+package gospider
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPrometheusRegistry(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/404" {
+			w.WriteHeader(404)
+		}
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+
+	s := NewSpider()
+	s.Logging = false
+	reg := newPrometheusRegistry(s)
+	s.RegisterHandler("item", func(ctx *Context) {
+		ctx.AddItem("a")
+	})
+	h, _ := s.GetHandler("item")
+	s.SeedTask(goreq.Get(ts.URL), h)
+	s.SeedTask(goreq.Get(ts.URL + "/404"))
+	s.Wait()
+
+	count, err := testutil.GatherAndCount(reg, "gospider_request_duration_seconds")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP gospider_handler_calls_total Number of handler executions, by handler.
+# TYPE gospider_handler_calls_total counter
+gospider_handler_calls_total{handler="item",spider="spider"} 1
+# HELP gospider_items_emitted_total Number of items emitted.
+# TYPE gospider_items_emitted_total counter
+gospider_items_emitted_total{spider="spider"} 1
+# HELP gospider_responses_total Number of responses by status code.
+# TYPE gospider_responses_total counter
+gospider_responses_total{code="200",spider="spider"} 1
+gospider_responses_total{code="404",spider="spider"} 1
+# HELP gospider_tasks_scheduled_total Number of tasks scheduled.
+# TYPE gospider_tasks_scheduled_total counter
+gospider_tasks_scheduled_total{spider="spider"} 2
+`), "gospider_handler_calls_total", "gospider_items_emitted_total", "gospider_responses_total", "gospider_tasks_scheduled_total"))
+}
+
+func TestPrometheusRegistry_QueueDepth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+
+	s := NewSpider()
+	s.Logging = false
+	reg := newPrometheusRegistry(s)
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		ctx.AddTaskAfter(time.Hour, goreq.Get(ts.URL))
+	})
+	for atomic.LoadInt64(&s.Status.TotalTask) < 2 || atomic.LoadInt64(&s.Status.FinishedTask) < 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP gospider_queue_depth Number of tasks scheduled but not yet started, excluding abandoned tasks.
+# TYPE gospider_queue_depth gauge
+gospider_queue_depth{spider="spider"} 1
+`), "gospider_queue_depth"))
+
+	// 放弃的任务不再计入队列深度
+	s.Stop()
+	s.Wait()
+	assert.Equal(t, int64(1), s.Status.AbandonedTask)
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP gospider_queue_depth Number of tasks scheduled but not yet started, excluding abandoned tasks.
+# TYPE gospider_queue_depth gauge
+gospider_queue_depth{spider="spider"} 0
+`), "gospider_queue_depth"))
+}
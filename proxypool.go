@@ -0,0 +1,452 @@
+package gospider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zhshch2002/goreq"
+)
+
+// RotationStrategy 代理池的轮换策略
+type RotationStrategy int
+
+const (
+	RoundRobin    RotationStrategy = iota // 依次使用每个代理
+	RandomProxy                           // 每个请求随机选择代理
+	StickyPerHost                         // 同一个host固定使用同一个代理
+)
+
+// ErrNoProxy 固定到代理组(见ProxyPool.Pin)的host没有可用的代理，或默认轮换中的代理全部被隔离，
+// 请求不会绕过代理直接发出(见ProxyPool.DirectFallback)
+var ErrNoProxy = errors.New("no proxy available")
+
+// ProxyMetaKey 任务Meta中指定代理的键，值为代理地址，优先于代理池的选择
+const ProxyMetaKey = "proxy"
+
+// proxyOverrideKey 请求context中由Meta指定的代理
+type proxyOverrideKey struct{}
+
+// ProxyPool 代理池，按轮换策略为请求选择HTTP/HTTPS代理
+// 请求超时、失败或返回封禁状态码时代理的失败计数增加，连续失败MaxFailures次后被隔离，不再参与轮换，
+// 被隔离的代理由StartHealthCheck定期重新检测，恢复后重新加入。
+// 可以用AddGroup和Pin将指定的host固定到一组代理，如受保护的目标使用住宅代理，其他host使用默认的数据中心代理
+type ProxyPool struct {
+	MaxFailures    int   // 连续失败多少次后隔离，默认3
+	BanCodes       []int // 视为被封禁的状态码，默认403和429
+	DirectFallback bool  // 默认轮换中的代理全部被隔离时直接发出请求，默认返回ErrNoProxy
+
+	strategy RotationStrategy
+
+	lock        sync.Mutex
+	proxies     []string       // 参与轮换的代理
+	failures    map[string]int // proxy -> 连续失败次数
+	quarantined map[string]bool
+	next        int
+	sticky      map[string]string // host -> proxy
+	rand        *rand.Rand
+
+	groups  map[string]*proxyGroup // 代理组，组内的代理不参与默认的轮换，见AddGroup
+	groupOf map[string]string      // proxy -> 所在的代理组
+	pins    []proxyPin             // 按顺序匹配的host规则，见Pin
+
+	onQuarantine []func(proxy string)
+	onRestore    []func(proxy string)
+}
+
+// NewProxyPool 创建代理池，proxies为代理地址，如http://127.0.0.1:8080
+func NewProxyPool(proxies []string, strategy RotationStrategy) *ProxyPool {
+	p := &ProxyPool{
+		MaxFailures: 3,
+		BanCodes:    []int{http.StatusForbidden, http.StatusTooManyRequests},
+		strategy:    strategy,
+		failures:    map[string]int{},
+		quarantined: map[string]bool{},
+		sticky:      map[string]string{},
+		rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, proxy := range proxies {
+		p.Add(proxy)
+	}
+	return p
+}
+
+// proxyGroup 一组代理，有自己的轮换位置
+type proxyGroup struct {
+	proxies []string
+	next    int
+}
+
+// proxyPin host规则固定使用的代理组
+type proxyPin struct {
+	glob  string
+	group string
+}
+
+// AddGroup 加入一组代理，组内的代理只用于Pin到该组的host，不参与默认的轮换；组已存在时追加代理
+// 组内的代理同样按轮换策略选择、计算失败和隔离，固定到单个代理时使用只有一个代理的组
+func (p *ProxyPool) AddGroup(name string, proxies ...string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.groups == nil {
+		p.groups = map[string]*proxyGroup{}
+		p.groupOf = map[string]string{}
+	}
+	g, ok := p.groups[name]
+	if !ok {
+		g = &proxyGroup{}
+		p.groups[name] = g
+	}
+	for _, proxy := range proxies {
+		if _, ok := p.groupOf[proxy]; ok || p.quarantined[proxy] {
+			continue
+		}
+		p.removeLocked(proxy)
+		p.groupOf[proxy] = name
+		g.proxies = append(g.proxies, proxy)
+	}
+}
+
+// Pin 将匹配glob的host(不含端口，语法同path.Match，如"*.example.com")固定到代理组，按Pin的顺序匹配第一个规则
+// 组中没有可用的代理时请求返回ErrNoProxy，而不是使用默认的代理或直接发出
+func (p *ProxyPool) Pin(glob, group string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.pins = append(p.pins, proxyPin{glob: strings.ToLower(glob), group: group})
+}
+
+// Group 代理组中参与轮换的代理
+func (p *ProxyPool) Group(name string) []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if g, ok := p.groups[name]; ok {
+		return append([]string(nil), g.proxies...)
+	}
+	return nil
+}
+
+// pinnedGroup host固定使用的代理组，没有匹配的规则时返回false
+func (p *ProxyPool) pinnedGroup(host string) (string, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	for _, pin := range p.pins {
+		if ok, _ := path.Match(pin.glob, host); ok {
+			return pin.group, true
+		}
+	}
+	return "", false
+}
+
+// Proxies 参与默认轮换的代理，不包括代理组中的代理
+func (p *ProxyPool) Proxies() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]string(nil), p.proxies...)
+}
+
+// Quarantined 被隔离的代理
+func (p *ProxyPool) Quarantined() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var res []string
+	for proxy := range p.quarantined {
+		res = append(res, proxy)
+	}
+	return res
+}
+
+// Add 在运行时加入新的代理，已存在的代理会被忽略
+func (p *ProxyPool) Add(proxy string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.quarantined[proxy] {
+		return
+	}
+	if _, ok := p.groupOf[proxy]; ok {
+		return
+	}
+	for _, v := range p.proxies {
+		if v == proxy {
+			return
+		}
+	}
+	p.proxies = append(p.proxies, proxy)
+}
+
+// Remove 移除代理，包括被隔离的代理和代理组中的代理
+func (p *ProxyPool) Remove(proxy string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.removeLocked(proxy)
+	delete(p.quarantined, proxy)
+	delete(p.failures, proxy)
+	delete(p.groupOf, proxy)
+}
+
+// removeLocked 将代理移出轮换，代理组中的代理仍记录在groupOf中，恢复时回到原来的组
+func (p *ProxyPool) removeLocked(proxy string) {
+	p.proxies = removeString(p.proxies, proxy)
+	if name, ok := p.groupOf[proxy]; ok {
+		g := p.groups[name]
+		g.proxies = removeString(g.proxies, proxy)
+	}
+	for host, v := range p.sticky {
+		if v == proxy {
+			delete(p.sticky, host)
+		}
+	}
+}
+
+// OnQuarantine 代理被隔离时调用，可以在其中用Add补充新的代理
+func (p *ProxyPool) OnQuarantine(fn func(proxy string)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.onQuarantine = append(p.onQuarantine, fn)
+}
+
+// OnRestore 被隔离的代理通过健康检查重新加入时调用
+func (p *ProxyPool) OnRestore(fn func(proxy string)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.onRestore = append(p.onRestore, fn)
+}
+
+// ReportSuccess 记录一次通过proxy的成功请求，清零失败计数
+func (p *ProxyPool) ReportSuccess(proxy string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.failures, proxy)
+}
+
+// ReportFailure 记录一次通过proxy的失败请求，达到MaxFailures时隔离该代理
+func (p *ProxyPool) ReportFailure(proxy string) {
+	p.lock.Lock()
+	if p.quarantined[proxy] {
+		p.lock.Unlock()
+		return
+	}
+	p.failures[proxy]++
+	max := p.MaxFailures
+	if max <= 0 {
+		max = 1
+	}
+	if p.failures[proxy] < max {
+		p.lock.Unlock()
+		return
+	}
+	found := false
+	for _, v := range p.rotation(proxy) {
+		found = found || v == proxy
+	}
+	if !found {
+		p.lock.Unlock()
+		return
+	}
+	p.removeLocked(proxy)
+	delete(p.failures, proxy)
+	p.quarantined[proxy] = true
+	fns := p.onQuarantine
+	p.lock.Unlock()
+	for _, fn := range fns {
+		fn(proxy)
+	}
+}
+
+// restore 将通过健康检查的代理重新加入轮换
+func (p *ProxyPool) restore(proxy string) {
+	p.lock.Lock()
+	if !p.quarantined[proxy] {
+		p.lock.Unlock()
+		return
+	}
+	delete(p.quarantined, proxy)
+	if name, ok := p.groupOf[proxy]; ok {
+		g := p.groups[name]
+		g.proxies = append(g.proxies, proxy)
+	} else {
+		p.proxies = append(p.proxies, proxy)
+	}
+	fns := p.onRestore
+	p.lock.Unlock()
+	for _, fn := range fns {
+		fn(proxy)
+	}
+}
+
+// rotation 代理所在的轮换列表，默认的轮换或所在代理组
+func (p *ProxyPool) rotation(proxy string) []string {
+	if name, ok := p.groupOf[proxy]; ok {
+		return p.groups[name].proxies
+	}
+	return p.proxies
+}
+
+func removeString(l []string, s string) []string {
+	for i, v := range l {
+		if v == s {
+			return append(l[:i:i], l[i+1:]...)
+		}
+	}
+	return l
+}
+
+// isBan 状态码是否表示被封禁
+func (p *ProxyPool) isBan(code int) bool {
+	for _, c := range p.BanCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// StartHealthCheck 每隔interval通过被隔离的代理请求checkURL，返回2xx/3xx的代理重新加入轮换
+// 返回的函数用于停止检测
+func (p *ProxyPool) StartHealthCheck(checkURL string, interval, timeout time.Duration) (stop func()) {
+	ch := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ch:
+				return
+			case <-ticker.C:
+			}
+			for _, proxy := range p.Quarantined() {
+				if checkProxy(proxy, checkURL, timeout) {
+					p.restore(proxy)
+				}
+			}
+		}
+	}()
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			close(ch)
+		})
+	}
+}
+
+// checkProxy 通过proxy请求checkURL，检测代理是否可用
+func checkProxy(proxy, checkURL string, timeout time.Duration) bool {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return false
+	}
+	cli := &http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyURL(u)},
+		Timeout:   timeout,
+	}
+	defer cli.CloseIdleConnections()
+	resp, err := cli.Get(checkURL)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode < 400
+}
+
+// Pick 为访问host的请求选择一个代理，host固定到代理组时从组中选择，没有可用的代理时返回空字符串
+func (p *ProxyPool) Pick(host string) string {
+	proxy, _ := p.pick(host)
+	return proxy
+}
+
+// pick 选择代理，required表示请求必须使用代理：host固定到了代理组，或默认轮换中的代理全部被隔离且没有设置DirectFallback
+func (p *ProxyPool) pick(host string) (proxy string, required bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	proxies, next := p.proxies, &p.next
+	if name, ok := p.pinnedGroup(host); ok {
+		required = true
+		g, ok := p.groups[name]
+		if !ok {
+			return "", true
+		}
+		proxies, next = g.proxies, &g.next
+	} else if len(proxies) == 0 && !p.DirectFallback {
+		for proxy := range p.quarantined {
+			if _, ok := p.groupOf[proxy]; !ok {
+				return "", true
+			}
+		}
+	}
+	if len(proxies) == 0 {
+		return "", required
+	}
+	switch p.strategy {
+	case RandomProxy:
+		return proxies[p.rand.Intn(len(proxies))], required
+	case StickyPerHost:
+		if proxy, ok := p.sticky[host]; ok {
+			return proxy, required
+		}
+		proxy := proxies[*next%len(proxies)]
+		*next++
+		p.sticky[host] = proxy
+		return proxy, required
+	default:
+		proxy := proxies[*next%len(proxies)]
+		*next++
+		return proxy, required
+	}
+}
+
+// WithProxyPool 代理池，按strategy在proxies中为每个请求选择代理
+// 任务Meta中ProxyMetaKey对应的代理优先于代理池的选择
+func WithProxyPool(proxies []string, strategy RotationStrategy) Extension {
+	return WithProxies(NewProxyPool(proxies, strategy))
+}
+
+// WithProxies 使用已创建的代理池，可以在外部配置健康检查、补充代理
+// 每个请求的结果会报告给代理池：请求失败或返回封禁状态码计为失败，否则计为成功，因Stop等取消的请求不计入
+func WithProxies(pool *ProxyPool) Extension {
+	return func(s *Spider) {
+		s.OnTask(func(ctx *Context, t *Task) *Task {
+			if proxy, ok := t.Meta[ProxyMetaKey].(string); ok && proxy != "" && t.Req.Request != nil {
+				t.Req.Request = t.Req.WithContext(context.WithValue(t.Req.Context(), proxyOverrideKey{}, proxy))
+			}
+			return t
+		})
+		s.Client.Use(func(c *goreq.Client, next goreq.Handler) goreq.Handler {
+			return func(req *goreq.Request) *goreq.Response {
+				if req.Err != nil {
+					return next(req)
+				}
+				if proxy, ok := req.Context().Value(proxyOverrideKey{}).(string); ok {
+					setProxy(req, proxy)
+					return next(req)
+				}
+				proxy, required := pool.pick(req.URL.Host)
+				if proxy == "" && required {
+					return &goreq.Response{Req: req, Err: fmt.Errorf("%w: %s", ErrNoProxy, req.URL.Host)}
+				}
+				if proxy == "" {
+					return next(req)
+				}
+				setProxy(req, proxy)
+				resp := next(req)
+				if resp != nil && errors.Is(resp.Err, context.Canceled) {
+					return resp
+				}
+				if resp == nil || resp.Err != nil || resp.Response == nil || pool.isBan(resp.StatusCode) {
+					pool.ReportFailure(proxy)
+				} else {
+					pool.ReportSuccess(proxy)
+				}
+				return resp
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package gospider
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestProxy(name string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, name)
+	}))
+}
+
+func TestProxyPool_Pick(t *testing.T) {
+	p := NewProxyPool([]string{"a", "b", "c"}, RoundRobin)
+	assert.Equal(t, []string{"a", "b", "c", "a"}, []string{p.Pick("x"), p.Pick("x"), p.Pick("y"), p.Pick("y")})
+
+	p = NewProxyPool([]string{"a", "b"}, StickyPerHost)
+	assert.Equal(t, "a", p.Pick("x"))
+	assert.Equal(t, "b", p.Pick("y"))
+	assert.Equal(t, "a", p.Pick("x"))
+	assert.Equal(t, "b", p.Pick("y"))
+
+	p = NewProxyPool([]string{"a", "b"}, RandomProxy)
+	for i := 0; i < 10; i++ {
+		assert.Contains(t, []string{"a", "b"}, p.Pick("x"))
+	}
+	assert.Equal(t, "", NewProxyPool(nil, RoundRobin).Pick("x"))
+}
+
+func TestProxyPool_Pin(t *testing.T) {
+	p := NewProxyPool([]string{"dc1", "dc2", "res1"}, RoundRobin)
+	p.AddGroup("residential", "res1", "res2")
+	p.AddGroup("single", "one")
+	p.Pin("*.shop.example", "residential")
+	p.Pin("shop.example", "residential")
+	p.Pin("api.example", "single")
+	p.Pin("empty.example", "missing")
+
+	assert.Equal(t, []string{"dc1", "dc2"}, p.Proxies())
+	assert.Equal(t, []string{"res1", "res2"}, p.Group("residential"))
+	assert.Equal(t, []string{"res1", "res2", "res1"}, []string{p.Pick("www.shop.example:443"), p.Pick("SHOP.example"), p.Pick("m.shop.example")})
+	assert.Equal(t, []string{"one", "one"}, []string{p.Pick("api.example"), p.Pick("api.example")})
+	assert.Equal(t, []string{"dc1", "dc2"}, []string{p.Pick("other.example"), p.Pick("api.example.org")})
+	assert.Equal(t, "", p.Pick("empty.example"))
+
+	// 组内的代理隔离后仍然只回到原来的组
+	p.MaxFailures = 1
+	p.ReportFailure("res1")
+	assert.Equal(t, []string{"res2"}, p.Group("residential"))
+	assert.Equal(t, "res2", p.Pick("shop.example"))
+	p.restore("res1")
+	assert.Equal(t, []string{"res2", "res1"}, p.Group("residential"))
+	assert.Equal(t, []string{"dc1", "dc2"}, p.Proxies())
+
+	p.ReportFailure("one")
+	_, pinned := p.pick("api.example")
+	assert.True(t, pinned)
+	assert.Equal(t, "", p.Pick("api.example"))
+}
+
+func TestWithProxies_pinned(t *testing.T) {
+	dc, res := newTestProxy("dc"), newTestProxy("res")
+	defer dc.Close()
+	defer res.Close()
+
+	pool := NewProxyPool([]string{dc.URL}, RoundRobin)
+	pool.AddGroup("residential", res.URL)
+	pool.AddGroup("down")
+	pool.Pin("*.protected.example", "residential")
+	pool.Pin("down.example", "down")
+	s := NewSpider(WithSynchronousMode(), WithProxies(pool))
+	s.Logging = false
+	got := map[string]string{}
+	s.OnResp(func(ctx *Context) {
+		got[ctx.Req.URL.Host] = ctx.Resp.Text
+	})
+	var errs []error
+	s.OnRespError(func(ctx *Context, err error) {
+		errs = append(errs, err)
+	})
+	s.SeedTask(goreq.Get("http://www.protected.example/"))
+	s.SeedTask(goreq.Get("http://plain.example/"))
+	s.SeedTask(goreq.Get("http://down.example/"))
+	s.Wait()
+	assert.Equal(t, map[string]string{"www.protected.example": "res", "plain.example": "dc"}, got)
+	if assert.Len(t, errs, 1) {
+		assert.True(t, errors.Is(errs[0], ErrNoProxy))
+	}
+}
+
+func TestWithProxies_exhausted(t *testing.T) {
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	direct := newTestProxy("direct")
+	defer direct.Close()
+
+	pool := NewProxyPool([]string{dead.URL}, RoundRobin)
+	pool.MaxFailures = 1
+	s := NewSpider(WithSynchronousMode(), WithProxies(pool))
+	s.Logging = false
+	var errs []error
+	s.OnReqError(func(ctx *Context, err error) {
+		errs = append(errs, err)
+	})
+	s.OnRespError(func(ctx *Context, err error) {
+		errs = append(errs, err)
+	})
+	s.SeedTask(goreq.Get(direct.URL))
+	s.SeedTask(goreq.Get(direct.URL))
+	s.Wait()
+	assert.Equal(t, []string{dead.URL}, pool.Quarantined())
+	if assert.Len(t, errs, 2) {
+		assert.False(t, errors.Is(errs[0], ErrNoProxy))
+		assert.True(t, errors.Is(errs[1], ErrNoProxy))
+	}
+
+	pool.DirectFallback = true
+	got := ""
+	s.SeedTask(goreq.Get(direct.URL), func(ctx *Context) {
+		got = ctx.Resp.Text
+	})
+	s.Wait()
+	assert.Equal(t, "direct", got)
+}
+
+func TestWithProxies_canceled(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	pool := NewProxyPool([]string{slow.URL}, RoundRobin)
+	pool.MaxFailures = 1
+	s := NewSpider(WithProxies(pool))
+	s.Logging = false
+	s.SeedTask(goreq.Get("http://x.example/"))
+	time.AfterFunc(100*time.Millisecond, s.Stop)
+	s.Wait()
+	assert.Equal(t, int64(1), s.Status.AbandonedTask)
+	assert.Empty(t, pool.Quarantined())
+	assert.Equal(t, []string{slow.URL}, pool.Proxies())
+}
+
+func TestWithProxyPool(t *testing.T) {
+	pa, pb, pc := newTestProxy("a"), newTestProxy("b"), newTestProxy("c")
+	defer pa.Close()
+	defer pb.Close()
+	defer pc.Close()
+
+	s := NewSpider(WithProxyPool([]string{pa.URL, pb.URL}, StickyPerHost))
+	s.Logging = false
+	lock := sync.Mutex{}
+	got := map[string]string{}
+	h := func(ctx *Context) {
+		lock.Lock()
+		defer lock.Unlock()
+		got[ctx.Req.URL.String()] = ctx.Resp.Text
+	}
+	s.SeedTask(goreq.Get("http://x.example/1"), func(ctx *Context) {
+		h(ctx)
+		ctx.AddTask(goreq.Get("http://x.example/2"), h)
+		ctx.Meta[ProxyMetaKey] = pc.URL
+		ctx.AddTask(goreq.Get("http://y.example/1"), h)
+	})
+	s.Wait()
+
+	assert.Equal(t, got["http://x.example/1"], got["http://x.example/2"])
+	assert.Contains(t, []string{"a", "b"}, got["http://x.example/1"])
+	assert.Equal(t, "c", got["http://y.example/1"])
+}
+
+func TestProxyPool_healthCheck(t *testing.T) {
+	var banned int32 = 1
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&banned) == 1 {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = fmt.Fprint(w, "bad")
+	}))
+	defer bad.Close()
+	good := newTestProxy("good")
+	defer good.Close()
+	fresh := newTestProxy("fresh")
+	defer fresh.Close()
+
+	pool := NewProxyPool([]string{bad.URL, good.URL}, RoundRobin)
+	pool.MaxFailures = 2
+	quarantined := make(chan string, 1)
+	pool.OnQuarantine(func(proxy string) {
+		pool.Add(fresh.URL)
+		quarantined <- proxy
+	})
+	restored := make(chan string, 1)
+	pool.OnRestore(func(proxy string) {
+		restored <- proxy
+	})
+
+	s := NewSpider(WithProxies(pool))
+	s.Logging = false
+	for i := 0; i < 4; i++ {
+		_ = s.Client.Do(goreq.Get("http://x.example/"))
+	}
+	assert.Equal(t, bad.URL, <-quarantined)
+	assert.Equal(t, []string{good.URL, fresh.URL}, pool.Proxies())
+	assert.Equal(t, []string{bad.URL}, pool.Quarantined())
+
+	stop := pool.StartHealthCheck("http://x.example/", 50*time.Millisecond, time.Second)
+	defer stop()
+	time.Sleep(120 * time.Millisecond)
+	assert.Len(t, pool.Quarantined(), 1)
+	atomic.StoreInt32(&banned, 0)
+	select {
+	case p := <-restored:
+		assert.Equal(t, bad.URL, p)
+	case <-time.After(time.Second):
+		t.Fatal("proxy not restored")
+	}
+	assert.Equal(t, []string{good.URL, fresh.URL, bad.URL}, pool.Proxies())
+	assert.Len(t, pool.Quarantined(), 0)
+}
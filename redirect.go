@@ -0,0 +1,120 @@
+package gospider
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/zhshch2002/goreq"
+)
+
+var (
+	// ErrRedirectForbidden 重定向到其他域名被RedirectPolicy禁止
+	ErrRedirectForbidden = errors.New("cross-domain redirect forbidden")
+)
+
+// RedirectPolicy 重定向策略，见WithRedirectPolicy
+type RedirectPolicy struct {
+	MaxRedirects int  // 最多跟随的重定向次数，0为默认的10次，小于0时不跟随重定向(处理方法收到3xx响应)
+	SameDomain   bool // 只跟随到原始请求的域名及其子域名的重定向，否则请求失败，错误为ErrRedirectForbidden
+	// NewTaskOn301 不跟随301永久重定向，而是将目标作为新任务加入(经过OnTask，可以去重)，新任务使用相同的处理方法，
+	// 原任务以"redirect"为原因Abort(见OnAbort)
+	NewTaskOn301 bool
+}
+
+func (p RedirectPolicy) check(orig *url.URL) func(req *http.Request, via []*http.Request) error {
+	max := p.MaxRedirects
+	if max == 0 {
+		max = 10
+	}
+	return func(req *http.Request, via []*http.Request) error {
+		if max < 0 {
+			return http.ErrUseLastResponse
+		}
+		if p.NewTaskOn301 && req.Response != nil && req.Response.StatusCode == http.StatusMovedPermanently {
+			return http.ErrUseLastResponse
+		}
+		if len(via) > max {
+			return fmt.Errorf("stopped after %d redirects", max)
+		}
+		if p.SameDomain && !sameDomain(orig.Hostname(), req.URL.Hostname()) {
+			return fmt.Errorf("%w: %s", ErrRedirectForbidden, req.URL)
+		}
+		return nil
+	}
+}
+
+// sameDomain host是domain或其子域名
+func sameDomain(domain, host string) bool {
+	domain, host = strings.ToLower(domain), strings.ToLower(host)
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// WithRedirectPolicy 设置爬虫的重定向策略，对goreq内置的客户端和Spider自定义的transport都有效，对FastHTTPFetcher无效
+func WithRedirectPolicy(p RedirectPolicy) Extension {
+	return func(s *Spider) {
+		s.Client.Use(func(c *goreq.Client, next goreq.Handler) goreq.Handler {
+			return func(req *goreq.Request) *goreq.Response {
+				if req.Request != nil {
+					setCheckRedirect(req, p.check(req.URL))
+				}
+				return next(req)
+			}
+		})
+		if !p.NewTaskOn301 {
+			return
+		}
+		s.OnRespWithPriority(-100, func(ctx *Context) {
+			if ctx.Resp.StatusCode != http.StatusMovedPermanently || ctx.task == nil {
+				return
+			}
+			loc, err := ctx.Resp.Location()
+			if err != nil {
+				return
+			}
+			// 重定向的目标与原任务的深度相同
+			ctx.addTaskAt(ctx.Depth(), goreq.Get(loc.String()), ctx.childMeta(ctx.s.inheritMeta), time.Time{}, ctx.task.Handlers...)
+			ctx.AbortWithReason("redirect")
+		})
+	}
+}
+
+// RedirectChain 请求经过的重定向，从原始URL到最终URL，没有重定向时只有原始URL；响应来自缓存、回放或不跟随重定向的Fetcher时也只有原始URL
+func (c *Context) RedirectChain() []*url.URL {
+	if c.Resp == nil || c.Resp.Response == nil || c.Resp.Request == nil {
+		if c.Req != nil && c.Req.Request != nil {
+			return []*url.URL{c.Req.URL}
+		}
+		return nil
+	}
+	var chain []*url.URL
+	for req := c.Resp.Request; req != nil; {
+		chain = append([]*url.URL{req.URL}, chain...)
+		if req.Response == nil {
+			break
+		}
+		req = req.Response.Request
+	}
+	return chain
+}
+
+// FinalURL 重定向之后最终的URL，没有响应时为请求的URL
+func (c *Context) FinalURL() *url.URL {
+	chain := c.RedirectChain()
+	if len(chain) == 0 {
+		return nil
+	}
+	return chain[len(chain)-1]
+}
+
+// OriginalURL 重定向之前原始请求的URL
+func (c *Context) OriginalURL() *url.URL {
+	chain := c.RedirectChain()
+	if len(chain) == 0 {
+		return nil
+	}
+	return chain[0]
+}
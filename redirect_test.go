@@ -0,0 +1,119 @@
+package gospider
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func redirectServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/a", http.RedirectHandler("/b", http.StatusFound))
+	mux.Handle("/b", http.RedirectHandler("/c", http.StatusFound))
+	mux.HandleFunc("/c", func(w http.ResponseWriter, r *http.Request) {})
+	mux.Handle("/moved", http.RedirectHandler("/c", http.StatusMovedPermanently))
+	mux.HandleFunc("/away", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://localhost:"+strings.Split(r.Host, ":")[1]+"/c", http.StatusFound)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestContext_RedirectChain(t *testing.T) {
+	ts := redirectServer()
+	defer ts.Close()
+
+	for _, custom := range []bool{false, true} {
+		s := NewSpider(WithSynchronousMode())
+		s.Logging = false
+		if custom {
+			s.httpTransport()
+		}
+		var chain []string
+		var orig, final string
+		s.SeedTask(goreq.Get(ts.URL+"/a"), func(ctx *Context) {
+			for _, u := range ctx.RedirectChain() {
+				chain = append(chain, u.Path)
+			}
+			orig, final = ctx.OriginalURL().Path, ctx.FinalURL().Path
+		})
+		s.Wait()
+		assert.Equal(t, []string{"/a", "/b", "/c"}, chain)
+		assert.Equal(t, "/a", orig)
+		assert.Equal(t, "/c", final)
+	}
+}
+
+func TestWithRedirectPolicy(t *testing.T) {
+	ts := redirectServer()
+	defer ts.Close()
+
+	run := func(p RedirectPolicy, custom bool, path string) (status int, err error) {
+		s := NewSpider(WithSynchronousMode(), WithRedirectPolicy(p))
+		s.Logging = false
+		if custom {
+			s.httpTransport()
+		}
+		s.OnRespError(func(ctx *Context, e error) {
+			err = e
+		})
+		s.SeedTask(goreq.Get(ts.URL+path), func(ctx *Context) {
+			status = ctx.Resp.StatusCode
+		})
+		s.Wait()
+		return
+	}
+
+	for _, custom := range []bool{false, true} {
+		status, err := run(RedirectPolicy{MaxRedirects: -1}, custom, "/a")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusFound, status)
+
+		_, err = run(RedirectPolicy{MaxRedirects: 1}, custom, "/a")
+		assert.Error(t, err)
+		status, err = run(RedirectPolicy{MaxRedirects: 2}, custom, "/a")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, status)
+
+		_, err = run(RedirectPolicy{SameDomain: true}, custom, "/away")
+		assert.True(t, errors.Is(err, ErrRedirectForbidden), "%v", err)
+		status, err = run(RedirectPolicy{}, custom, "/away")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, status)
+	}
+}
+
+func TestWithRedirectPolicy_NewTaskOn301(t *testing.T) {
+	ts := redirectServer()
+	defer ts.Close()
+
+	s := NewSpider(WithSynchronousMode(), WithRedirectPolicy(RedirectPolicy{NewTaskOn301: true}))
+	s.Logging = false
+	lock := sync.Mutex{}
+	var paths []string
+	var reason string
+	s.OnAbort(func(ctx *Context, r string) {
+		reason = r
+	})
+	moved := NewTask(goreq.Get(ts.URL+"/moved"), map[string]interface{}{"k": "v"}, func(ctx *Context) {
+		lock.Lock()
+		defer lock.Unlock()
+		// 重定向的目标与原任务的深度相同
+		paths = append(paths, fmt.Sprint(ctx.Req.URL.Path, " ", ctx.GetString("k"), " ", ctx.Depth()))
+	})
+	moved.Depth = 2
+	s.AddTask(moved)
+	s.SeedTask(goreq.Get(ts.URL+"/a"), func(ctx *Context) {
+		lock.Lock()
+		defer lock.Unlock()
+		paths = append(paths, ctx.FinalURL().Path)
+	})
+	s.Wait()
+	assert.ElementsMatch(t, []string{"/c v 2", "/c"}, paths)
+	assert.Equal(t, "redirect", reason)
+}
@@ -0,0 +1,48 @@
+package gospider
+
+import "net/url"
+
+// RefererPolicy 根据来源页面from和新请求的URL to决定新请求的Referer，返回空字符串时不设置
+type RefererPolicy func(from, to *url.URL) string
+
+var (
+	// RefererAlways 总是使用来源页面的URL
+	RefererAlways RefererPolicy = func(from, to *url.URL) string {
+		return refererOf(from)
+	}
+	// RefererSameOrigin 只有协议、host和端口都相同时才设置
+	RefererSameOrigin RefererPolicy = func(from, to *url.URL) string {
+		if from.Scheme != to.Scheme || from.Host != to.Host {
+			return ""
+		}
+		return refererOf(from)
+	}
+	// RefererNever 不设置
+	RefererNever RefererPolicy = func(from, to *url.URL) string {
+		return ""
+	}
+)
+
+// refererOf 作为Referer的URL，去掉用户信息和片段(RFC 7231 5.5.2)
+func refererOf(u *url.URL) string {
+	r := *u
+	r.User = nil
+	r.Fragment = ""
+	return r.String()
+}
+
+// WithRefererPolicy 为在处理响应时加入的任务(ctx.AddTask等)按policy设置Referer，请求已经带有Referer时不修改
+// SeedTask和Spider.AddTask加入的任务没有来源页面，不会设置
+func WithRefererPolicy(policy RefererPolicy) Extension {
+	return func(s *Spider) {
+		s.OnTask(func(ctx *Context, t *Task) *Task {
+			if ctx.Req == nil || ctx.Req.Request == nil || t.Req.Request == nil || t.Req.Header.Get("Referer") != "" {
+				return t
+			}
+			if r := policy(ctx.Req.URL, t.Req.URL); r != "" {
+				t.Req.Header.Set("Referer", r)
+			}
+			return t
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package gospider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+	"github.com/zhshch2002/goreq"
+)
+
+const (
+	RenderMetaKey       = "render"        // 任务Meta中为true时使用浏览器渲染
+	RenderWaitMetaKey   = "render_wait"   // 任务Meta中渲染时等待出现的选择器，覆盖渲染器的默认设置
+	RenderScriptMetaKey = "render_script" // 任务Meta中渲染服务执行的脚本，含义取决于渲染器，见SplashRenderer、BrowserlessRenderer
+)
+
+// RenderParams 任务的渲染参数，来自任务的Meta
+type RenderParams struct {
+	Wait   string // 等待出现的选择器
+	Script string // 渲染服务执行的脚本
+}
+
+// renderKey 请求context中的渲染参数
+type renderKey struct{}
+
+// GetRenderParams 请求需要渲染时返回渲染参数和true，供自定义的渲染器读取
+func GetRenderParams(req *goreq.Request) (RenderParams, bool) {
+	if req.Request == nil {
+		return RenderParams{}, false
+	}
+	p, ok := req.Context().Value(renderKey{}).(RenderParams)
+	return p, ok
+}
+
+// shouldRender 任务是否需要渲染：Task.Render、Meta中的RenderMetaKey或URL匹配WithRender的模式
+func (s *Spider) shouldRender(t *Task) bool {
+	if t.Render {
+		return true
+	}
+	if v, ok := t.Meta[RenderMetaKey].(bool); ok {
+		return v
+	}
+	u := t.Req.URL.String()
+	for _, p := range s.renderPatterns {
+		if p.MatchString(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithRender 需要渲染的任务使用renderer发送(如ChromeRenderer)，渲染后的DOM作为响应体进入OnResp、OnHTML等正常的处理流程
+// 任务的Render为true、Meta中RenderMetaKey为true或URL匹配patterns中的任一正则表达式时渲染，只渲染GET请求
+func WithRender(renderer Fetcher, patterns ...string) Extension {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		res = append(res, regexp.MustCompile(p))
+	}
+	return func(s *Spider) {
+		s.renderer = renderer
+		s.renderPatterns = append(s.renderPatterns, res...)
+	}
+}
+
+// ChromeRenderer 使用无头Chrome渲染页面的Fetcher，浏览器在第一次渲染时启动，同时打开的标签页数不超过Tabs
+type ChromeRenderer struct {
+	WaitSelector string        // 默认等待出现的选择器，为空时等待网络空闲
+	IdleTimeout  time.Duration // 等待网络空闲的最长时间，超过后直接读取DOM，默认10s
+	Timeout      time.Duration // 每个页面的超时，默认30s
+
+	opts []chromedp.ExecAllocatorOption
+	tabs chan struct{}
+
+	once       sync.Once
+	err        error
+	browserCtx context.Context
+	cancel     context.CancelFunc
+}
+
+// NewChromeRenderer 创建最多同时使用tabs个标签页的渲染器，opts追加在chromedp.DefaultExecAllocatorOptions之后，如chromedp.ExecPath
+func NewChromeRenderer(tabs int, opts ...chromedp.ExecAllocatorOption) *ChromeRenderer {
+	if tabs < 1 {
+		tabs = 1
+	}
+	return &ChromeRenderer{
+		IdleTimeout: 10 * time.Second,
+		Timeout:     30 * time.Second,
+		opts:        append(chromedp.DefaultExecAllocatorOptions[:], opts...),
+		tabs:        make(chan struct{}, tabs),
+	}
+}
+
+// start 启动浏览器
+func (r *ChromeRenderer) start() error {
+	r.once.Do(func() {
+		allocCtx, cancelAlloc := chromedp.NewExecAllocator(context.Background(), r.opts...)
+		browserCtx, cancelBrowser := chromedp.NewContext(allocCtx)
+		r.browserCtx = browserCtx
+		r.cancel = func() {
+			cancelBrowser()
+			cancelAlloc()
+		}
+		if r.err = chromedp.Run(browserCtx); r.err != nil {
+			r.cancel()
+		}
+	})
+	return r.err
+}
+
+// Close 关闭浏览器
+func (r *ChromeRenderer) Close() {
+	_ = r.start()
+	if r.err == nil {
+		r.cancel()
+	}
+}
+
+// Do 在新的标签页中打开请求的URL，等待选择器或网络空闲后返回渲染后的HTML
+// 成功时标签页保持打开并关联到请求上，处理方法中可以截图或执行JS，Spider在任务结束时调用ClosePage关闭；
+// 直接调用Do时需要自行调用ClosePage，否则标签页不会释放
+func (r *ChromeRenderer) Do(req *goreq.Request) *goreq.Response {
+	resp := &goreq.Response{
+		Req:  req,
+		Body: []byte{},
+	}
+	if resp.Err = r.start(); resp.Err != nil {
+		return resp
+	}
+	r.tabs <- struct{}{}
+	tabCtx, cancelTab := chromedp.NewContext(r.browserCtx)
+	once := sync.Once{}
+	closeTab := func() {
+		once.Do(func() {
+			cancelTab()
+			<-r.tabs
+		})
+	}
+	if resp.Err = r.load(tabCtx, req, resp); resp.Err != nil {
+		closeTab()
+		return resp
+	}
+	req.Request = req.WithContext(context.WithValue(req.Context(), pageKey{}, &renderedPage{
+		ctx:   tabCtx,
+		close: closeTab,
+	}))
+	resp.Response.Request = req.Request
+	return resp
+}
+
+// load 在标签页tabCtx中加载请求，将渲染后的HTML写入resp
+func (r *ChromeRenderer) load(tabCtx context.Context, req *goreq.Request, resp *goreq.Response) error {
+	// 第一次Run创建标签页，不能使用带超时的context，否则超时会关闭标签页
+	if err := chromedp.Run(tabCtx); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(tabCtx, r.Timeout)
+	defer cancel()
+
+	idle := make(chan struct{})
+	idleOnce := sync.Once{}
+	chromedp.ListenTarget(ctx, func(ev interface{}) {
+		if e, ok := ev.(*page.EventLifecycleEvent); ok && e.Name == "networkIdle" {
+			idleOnce.Do(func() { close(idle) })
+		}
+	})
+
+	headers := network.Headers{}
+	for k := range req.Header {
+		headers[k] = req.Header.Get(k)
+	}
+	if err := chromedp.Run(ctx, network.Enable(), network.SetExtraHTTPHeaders(headers)); err != nil {
+		return err
+	}
+	nr, err := chromedp.RunResponse(ctx, chromedp.Navigate(req.URL.String()))
+	if err != nil {
+		return err
+	}
+
+	params, _ := GetRenderParams(req)
+	wait := params.Wait
+	if wait == "" {
+		wait = r.WaitSelector
+	}
+	if wait != "" {
+		if err := chromedp.Run(ctx, chromedp.WaitReady(wait, chromedp.ByQuery)); err != nil {
+			return err
+		}
+	} else {
+		select {
+		case <-idle:
+		case <-time.After(r.IdleTimeout):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	var html string
+	if err := chromedp.Run(ctx, chromedp.OuterHTML("html", &html, chromedp.ByQuery)); err != nil {
+		return err
+	}
+	resp.Body = []byte(html)
+	resp.Response = renderedResponse(req, int(nr.Status), nr.Headers, resp.Body)
+	return nil
+}
+
+// pageKey 请求context中渲染后仍打开的标签页
+type pageKey struct{}
+
+// renderedPage 渲染后仍打开的标签页
+type renderedPage struct {
+	ctx   context.Context
+	close func()
+}
+
+// renderedPageOf 请求关联的标签页，没有时为nil
+func renderedPageOf(req *goreq.Request) *renderedPage {
+	if req == nil || req.Request == nil {
+		return nil
+	}
+	p, _ := req.Context().Value(pageKey{}).(*renderedPage)
+	return p
+}
+
+// ClosePage 关闭ChromeRenderer为请求保留的标签页，可以重复调用
+func ClosePage(req *goreq.Request) {
+	if p := renderedPageOf(req); p != nil {
+		p.close()
+	}
+}
+
+// renderedResponse 为渲染后的HTML构造http.Response，原响应的编码和长度相关的头不再适用
+func renderedResponse(req *goreq.Request, status int, headers map[string]interface{}, body []byte) *http.Response {
+	h := http.Header{}
+	for k, v := range headers {
+		h.Set(k, fmt.Sprint(v))
+	}
+	h.Del("Content-Encoding")
+	h.Del("Content-Length")
+	h.Del("Transfer-Encoding")
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req.Request,
+	}
+}
@@ -0,0 +1,101 @@
+package gospider
+
+import (
+	"github.com/PuerkitoBio/goquery"
+	"github.com/chromedp/chromedp"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"sync"
+	"testing"
+)
+
+func TestWithRender(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<html><body><p class="v">static</p></body></html>`))
+	}))
+	defer ts.Close()
+
+	lock := sync.Mutex{}
+	var rendered []string
+	renderer := FetcherFunc(func(req *goreq.Request) *goreq.Response {
+		params, _ := GetRenderParams(req)
+		lock.Lock()
+		rendered = append(rendered, req.URL.Path+" "+params.Wait)
+		lock.Unlock()
+		body := []byte(`<html><body><p class="v">rendered</p></body></html>`)
+		return &goreq.Response{
+			Req:      req,
+			Body:     body,
+			Response: renderedResponse(req, http.StatusOK, nil, body),
+		}
+	})
+	s := NewSpider(WithRender(renderer, `/spa/`))
+	s.Logging = false
+	s.OnTask(func(ctx *Context, t *Task) *Task {
+		if t.Req.URL.Path == "/flag" {
+			t.Render = true
+		}
+		return t
+	})
+	res := map[string]string{}
+	s.OnHTML(".v", func(ctx *Context, sel *goquery.Selection) {
+		lock.Lock()
+		res[ctx.Req.URL.Path] = sel.Text()
+		lock.Unlock()
+	})
+	s.SeedTask(goreq.Get(ts.URL + "/plain"))
+	s.SeedTask(goreq.Get(ts.URL + "/spa/page"))
+	s.SeedTask(goreq.Get(ts.URL + "/flag"))
+	seed := &Context{s: s, Meta: map[string]interface{}{RenderMetaKey: true, RenderWaitMetaKey: "#app"}}
+	seed.AddTask(goreq.Get(ts.URL + "/meta"))
+	s.SeedTask(goreq.Post(ts.URL + "/spa/post"))
+	s.Wait()
+
+	assert.Equal(t, map[string]string{
+		"/plain":    "static",
+		"/spa/page": "rendered",
+		"/flag":     "rendered",
+		"/meta":     "rendered",
+		"/spa/post": "static",
+	}, res)
+	assert.ElementsMatch(t, []string{"/spa/page ", "/flag ", "/meta #app"}, rendered)
+}
+
+// testChromePath 查找本机的Chrome，找不到时跳过测试
+func testChromePath(t *testing.T) string {
+	for _, name := range []string{"headless-shell", "chromium", "chromium-browser", "google-chrome"} {
+		if p, err := exec.LookPath(name); err == nil {
+			return p
+		}
+	}
+	t.Skip("chrome not found")
+	return ""
+}
+
+func TestChromeRenderer(t *testing.T) {
+	path := testChromePath(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<html><body><script>
+setTimeout(function(){var d=document.createElement("div");d.id="app";d.textContent="from js";document.body.appendChild(d)},100)
+</script></body></html>`))
+	}))
+	defer ts.Close()
+
+	r := NewChromeRenderer(2, chromedp.ExecPath(path), chromedp.NoSandbox)
+	defer r.Close()
+	r.WaitSelector = "#app"
+	s := NewSpider(WithRender(r, `.*`))
+	s.Logging = false
+	var text string
+	s.OnHTML("#app", func(ctx *Context, sel *goquery.Selection) {
+		text = sel.Text()
+	})
+	s.SeedTask(goreq.Get(ts.URL))
+	s.Wait()
+	assert.Equal(t, "from js", text)
+}
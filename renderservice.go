@@ -0,0 +1,152 @@
+package gospider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/zhshch2002/goreq"
+)
+
+// splashWaitScript 等待选择器出现后返回HTML的Splash脚本
+const splashWaitScript = `function main(splash, args)
+  splash:set_custom_headers(args.headers)
+  assert(splash:go(args.url))
+  while not splash:select(args.selector) do
+    splash:wait(0.1)
+  end
+  return splash:html()
+end`
+
+// SplashRenderer 通过Splash渲染页面的Fetcher，不需要在爬虫进程中运行浏览器
+// 默认使用render.html；任务指定等待的选择器时使用内置的Lua脚本轮询；
+// 指定脚本(RenderScriptMetaKey)时通过execute执行该Lua脚本，脚本的返回值作为响应体，可以通过args.url、args.headers读取请求
+type SplashRenderer struct {
+	Endpoint string        // Splash的地址，如http://localhost:8050
+	Wait     time.Duration // render.html加载后等待的时间，默认0.5s
+	Timeout  time.Duration // 渲染的超时，默认30s
+	Client   *http.Client  // 默认http.DefaultClient
+}
+
+// NewSplashRenderer 创建使用endpoint的Splash渲染器
+func NewSplashRenderer(endpoint string) *SplashRenderer {
+	return &SplashRenderer{
+		Endpoint: endpoint,
+		Wait:     500 * time.Millisecond,
+		Timeout:  30 * time.Second,
+		Client:   http.DefaultClient,
+	}
+}
+
+// Do 请求Splash渲染req的URL
+func (r *SplashRenderer) Do(req *goreq.Request) *goreq.Response {
+	params, _ := GetRenderParams(req)
+	args := map[string]interface{}{
+		"url":     req.URL.String(),
+		"timeout": r.Timeout.Seconds(),
+		"headers": renderHeaders(req),
+	}
+	path := "/render.html"
+	switch {
+	case params.Script != "":
+		path = "/execute"
+		args["lua_source"] = params.Script
+	case params.Wait != "":
+		path = "/execute"
+		args["lua_source"] = splashWaitScript
+		args["selector"] = params.Wait
+	default:
+		args["wait"] = r.Wait.Seconds()
+	}
+	return postRenderService(r.Client, req, strings.TrimSuffix(r.Endpoint, "/")+path, args)
+}
+
+// BrowserlessRenderer 通过browserless的/content接口渲染页面的Fetcher
+// 任务指定的脚本(RenderScriptMetaKey)会在页面加载后以script标签注入执行，之后再读取HTML
+type BrowserlessRenderer struct {
+	Endpoint string       // browserless的地址，如https://chrome.browserless.io
+	Token    string       // API token
+	Client   *http.Client // 默认http.DefaultClient
+}
+
+// NewBrowserlessRenderer 创建使用endpoint和token的browserless渲染器
+func NewBrowserlessRenderer(endpoint, token string) *BrowserlessRenderer {
+	return &BrowserlessRenderer{
+		Endpoint: endpoint,
+		Token:    token,
+		Client:   http.DefaultClient,
+	}
+}
+
+// Do 请求browserless渲染req的URL
+func (r *BrowserlessRenderer) Do(req *goreq.Request) *goreq.Response {
+	params, _ := GetRenderParams(req)
+	args := map[string]interface{}{
+		"url":                 req.URL.String(),
+		"setExtraHTTPHeaders": renderHeaders(req),
+		"gotoOptions":         map[string]interface{}{"waitUntil": "networkidle2"},
+	}
+	if params.Wait != "" {
+		args["waitFor"] = params.Wait
+	}
+	if params.Script != "" {
+		args["addScriptTag"] = []map[string]string{{"content": params.Script}}
+	}
+	u := strings.TrimSuffix(r.Endpoint, "/") + "/content"
+	if r.Token != "" {
+		u += "?token=" + url.QueryEscape(r.Token)
+	}
+	return postRenderService(r.Client, req, u, args)
+}
+
+// renderHeaders 转发给渲染服务的请求头
+func renderHeaders(req *goreq.Request) map[string]string {
+	h := map[string]string{}
+	for k := range req.Header {
+		h[k] = req.Header.Get(k)
+	}
+	return h
+}
+
+// postRenderService 以JSON向渲染服务提交参数，响应体作为渲染后的HTML
+func postRenderService(cli *http.Client, req *goreq.Request, endpoint string, args map[string]interface{}) *goreq.Response {
+	resp := &goreq.Response{
+		Req:  req,
+		Body: []byte{},
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		resp.Err = err
+		return resp
+	}
+	sreq, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		resp.Err = err
+		return resp
+	}
+	sreq = sreq.WithContext(req.Context())
+	sreq.Header.Set("Content-Type", "application/json")
+	sresp, err := cli.Do(sreq)
+	if err != nil {
+		resp.Err = err
+		return resp
+	}
+	defer sresp.Body.Close()
+	body, err := ioutil.ReadAll(sresp.Body)
+	if err != nil {
+		resp.Err = err
+		return resp
+	}
+	if sresp.StatusCode != http.StatusOK {
+		resp.Err = fmt.Errorf("render service %s: %s", sresp.Status, bytes.TrimSpace(body))
+		return resp
+	}
+	resp.Body = body
+	resp.Response = renderedResponse(req, http.StatusOK, nil, body)
+	return resp
+}
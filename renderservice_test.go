@@ -0,0 +1,90 @@
+package gospider
+
+import (
+	"encoding/json"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestSplashRenderer(t *testing.T) {
+	lock := sync.Mutex{}
+	calls := map[string]map[string]interface{}{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		args := map[string]interface{}{}
+		_ = json.NewDecoder(r.Body).Decode(&args)
+		lock.Lock()
+		calls[args["url"].(string)] = args
+		lock.Unlock()
+		if r.URL.Path == "/execute" && args["lua_source"] == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":400}`))
+			return
+		}
+		_, _ = w.Write([]byte(`<html><body><p>` + r.URL.Path + `</p></body></html>`))
+	}))
+	defer ts.Close()
+
+	s := NewSpider(WithRender(NewSplashRenderer(ts.URL), `.*`))
+	s.Logging = false
+	res := map[string]string{}
+	s.OnHTML("p", func(ctx *Context, sel *goquery.Selection) {
+		lock.Lock()
+		res[ctx.Req.URL.String()] = sel.Text()
+		lock.Unlock()
+	})
+	var errs int
+	s.OnRespError(func(ctx *Context, err error) {
+		lock.Lock()
+		errs++
+		lock.Unlock()
+	})
+	s.SeedTask(goreq.Get("http://example.test/a").AddHeader("X-Test", "1"))
+	wait := &Context{s: s, Meta: map[string]interface{}{RenderWaitMetaKey: "#app"}}
+	wait.AddTask(goreq.Get("http://example.test/b"))
+	script := &Context{s: s, Meta: map[string]interface{}{RenderScriptMetaKey: "function main(splash) end"}}
+	script.AddTask(goreq.Get("http://example.test/c"))
+	bad := &Context{s: s, Meta: map[string]interface{}{RenderScriptMetaKey: "bad"}}
+	bad.AddTask(goreq.Get("http://example.test/d"))
+	s.Wait()
+
+	assert.Equal(t, map[string]string{
+		"http://example.test/a": "/render.html",
+		"http://example.test/b": "/execute",
+		"http://example.test/c": "/execute",
+	}, res)
+	assert.Equal(t, 1, errs)
+	assert.Equal(t, 0.5, calls["http://example.test/a"]["wait"])
+	assert.Equal(t, "1", calls["http://example.test/a"]["headers"].(map[string]interface{})["X-Test"])
+	assert.Equal(t, "#app", calls["http://example.test/b"]["selector"])
+	assert.Equal(t, "function main(splash) end", calls["http://example.test/c"]["lua_source"])
+}
+
+func TestBrowserlessRenderer(t *testing.T) {
+	var args map[string]interface{}
+	var token string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.URL.Query().Get("token")
+		_ = json.NewDecoder(r.Body).Decode(&args)
+		_, _ = w.Write([]byte(`<html><body>rendered</body></html>`))
+	}))
+	defer ts.Close()
+
+	s := NewSpider(WithRender(NewBrowserlessRenderer(ts.URL, "tok"), `.*`))
+	s.Logging = false
+	var text string
+	ctx := &Context{s: s, Meta: map[string]interface{}{RenderWaitMetaKey: "#app", RenderScriptMetaKey: "window.x=1"}}
+	ctx.AddTask(goreq.Get("http://example.test/"), func(ctx *Context) {
+		text = ctx.Resp.Text
+	})
+	s.Wait()
+	assert.Equal(t, "<html><body>rendered</body></html>", text)
+	assert.Equal(t, "tok", token)
+	assert.Equal(t, "http://example.test/", args["url"])
+	assert.Equal(t, "#app", args["waitFor"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"content": "window.x=1"}}, args["addScriptTag"])
+}
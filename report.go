@@ -0,0 +1,189 @@
+package gospider
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+	"os"
+	"time"
+)
+
+// reportTopN 报告中列出的错误数
+const reportTopN = 10
+
+// Report 爬取结束后的总结报告，见Spider.Report、WithReport
+type Report struct {
+	Spider   string        `json:"spider"`
+	Start    time.Time     `json:"start"`    // 第一个任务加入的时间
+	End      time.Time     `json:"end"`      // 任务全部完成的时间，尚未完成时为生成报告的时间
+	Duration time.Duration `json:"duration"` // 爬取耗时(纳秒)
+	Stopped  bool          `json:"stopped"`  // 是否被Stop提前停止
+
+	TotalTask       int64 `json:"total_task"`
+	FinishedTask    int64 `json:"finished_task"`
+	AbandonedTask   int64 `json:"abandoned_task"`
+	TotalItem       int64 `json:"total_item"`
+	BytesDownloaded int64 `json:"bytes_downloaded"`
+	ReqErrors       int64 `json:"req_errors"`
+	RespErrors      int64 `json:"resp_errors"`
+	Retries         int64 `json:"retries"`
+
+	HostTasks    map[string]int64     `json:"host_tasks"`   // 各host的任务数
+	StatusCodes  map[int]int64        `json:"status_codes"` // 各状态码的响应数
+	SkippedTasks map[SkipReason]int64 `json:"skipped_tasks,omitempty"`
+	BlockedHosts map[string]int64     `json:"blocked_hosts,omitempty"`
+	TopErrors    []ErrorCount         `json:"top_errors"` // 次数最多的错误，见SpiderStatus.TopErrors
+	Slowest      []URLTiming          `json:"slowest"`    // 耗时最长的请求，见SpiderStatus.Slowest
+}
+
+// Report 生成爬取的总结报告，爬取过程中调用时为当前的状态
+func (s *Spider) Report() *Report {
+	ss := s.Status.Snapshot()
+	r := &Report{
+		Spider:          s.Name,
+		Stopped:         s.IsStopped(),
+		TotalTask:       ss.TotalTask,
+		FinishedTask:    ss.FinishedTask,
+		AbandonedTask:   ss.AbandonedTask,
+		TotalItem:       ss.TotalItem,
+		BytesDownloaded: ss.BytesDownloaded,
+		ReqErrors:       ss.ReqErrors,
+		RespErrors:      ss.RespErrors,
+		Retries:         ss.Retries,
+		HostTasks:       ss.HostTasks,
+		StatusCodes:     ss.StatusCodes,
+		SkippedTasks:    ss.SkippedTasks,
+		BlockedHosts:    ss.BlockedHosts,
+		TopErrors:       s.Status.TopErrors(reportTopN),
+		Slowest:         s.Status.Slowest(),
+	}
+	s.Status.lock.Lock()
+	r.Start, r.End = s.Status.startTime, s.Status.endTime
+	s.Status.lock.Unlock()
+	if r.End.IsZero() {
+		r.End = ss.Time
+	}
+	if !r.Start.IsZero() {
+		r.Duration = r.End.Sub(r.Start)
+	}
+	return r
+}
+
+// WriteJSON 以JSON格式写入w
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Spider}} crawl report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+td.n { text-align: right; }
+</style>
+</head>
+<body>
+<h1>{{.Spider}} crawl report</h1>
+<table>
+<tr><th>Start</th><td>{{.Start.Format "2006-01-02 15:04:05"}}</td></tr>
+<tr><th>End</th><td>{{.End.Format "2006-01-02 15:04:05"}}</td></tr>
+<tr><th>Duration</th><td>{{.Duration}}</td></tr>
+<tr><th>Stopped</th><td>{{.Stopped}}</td></tr>
+<tr><th>Tasks</th><td class="n">{{.FinishedTask}}/{{.TotalTask}}</td></tr>
+<tr><th>Abandoned</th><td class="n">{{.AbandonedTask}}</td></tr>
+<tr><th>Items</th><td class="n">{{.TotalItem}}</td></tr>
+<tr><th>Bytes</th><td class="n">{{.BytesDownloaded}}</td></tr>
+<tr><th>Request errors</th><td class="n">{{.ReqErrors}}</td></tr>
+<tr><th>Response errors</th><td class="n">{{.RespErrors}}</td></tr>
+<tr><th>Retries</th><td class="n">{{.Retries}}</td></tr>
+</table>
+<h2>Hosts</h2>
+<table>
+<tr><th>Host</th><th>Tasks</th></tr>
+{{range $k, $v := .HostTasks}}<tr><td>{{$k}}</td><td class="n">{{$v}}</td></tr>
+{{end}}</table>
+<h2>Status codes</h2>
+<table>
+<tr><th>Code</th><th>Responses</th></tr>
+{{range $k, $v := .StatusCodes}}<tr><td>{{$k}}</td><td class="n">{{$v}}</td></tr>
+{{end}}</table>
+{{if .SkippedTasks}}<h2>Skipped tasks</h2>
+<table>
+<tr><th>Reason</th><th>Tasks</th></tr>
+{{range $k, $v := .SkippedTasks}}<tr><td>{{$k}}</td><td class="n">{{$v}}</td></tr>
+{{end}}</table>
+{{end}}{{if .BlockedHosts}}<h2>Blocked hosts</h2>
+<table>
+<tr><th>Host</th><th>Blocked</th></tr>
+{{range $k, $v := .BlockedHosts}}<tr><td>{{$k}}</td><td class="n">{{$v}}</td></tr>
+{{end}}</table>
+{{end}}<h2>Top errors</h2>
+<table>
+<tr><th>Error</th><th>Count</th><th>Example</th></tr>
+{{range .TopErrors}}<tr><td>{{.Error}}</td><td class="n">{{.Count}}</td><td>{{.Example}}</td></tr>
+{{end}}</table>
+<h2>Slowest requests</h2>
+<table>
+<tr><th>URL</th><th>Duration</th></tr>
+{{range .Slowest}}<tr><td>{{.URL}}</td><td class="n">{{.Duration}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// WriteHTML 以HTML页面写入w
+func (r *Report) WriteHTML(w io.Writer) error {
+	return reportTemplate.Execute(w, r)
+}
+
+// WithReport 每次Wait返回前生成总结报告(见Spider.Report)，以JSON格式写入jsonPath、以HTML页面写入htmlPath，路径为空时不写入
+func WithReport(jsonPath, htmlPath string) Extension {
+	return func(s *Spider) {
+		s.useExtension(&reportWriter{jsonPath: jsonPath, htmlPath: htmlPath})
+	}
+}
+
+// reportWriter 在每次Wait返回前写入报告
+type reportWriter struct {
+	s        *Spider
+	jsonPath string
+	htmlPath string
+}
+
+// Init 记录爬虫
+func (w *reportWriter) Init(s *Spider) error {
+	w.s = s
+	return nil
+}
+
+// Flush 生成并写入报告
+func (w *reportWriter) Flush() error {
+	r := w.s.Report()
+	if w.jsonPath != "" {
+		if err := writeReportFile(w.jsonPath, r.WriteJSON); err != nil {
+			return err
+		}
+	}
+	if w.htmlPath != "" {
+		return writeReportFile(w.htmlPath, r.WriteHTML)
+	}
+	return nil
+}
+
+func writeReportFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
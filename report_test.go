@@ -0,0 +1,79 @@
+package gospider
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSpider_Report(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(50 * time.Millisecond)
+		case "/404":
+			w.WriteHeader(404)
+		}
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	dir, err := ioutil.TempDir("", "gospider-report")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	jsonPath, htmlPath := filepath.Join(dir, "report.json"), filepath.Join(dir, "report.html")
+
+	s := NewSpider(WithSynchronousMode(), WithReport(jsonPath, htmlPath))
+	s.Logging = false
+	for _, p := range []string{"/a", "/slow", "/404"} {
+		s.SeedTask(goreq.Get(ts.URL+p), func(ctx *Context) {
+			ctx.AddItem(ctx.Req.URL.Path)
+		})
+	}
+	s.SeedTask(goreq.Get(dead.URL+"/x"), func(ctx *Context) {})
+	s.SeedTask(goreq.Get(dead.URL+"/y"), func(ctx *Context) {})
+	s.Wait()
+
+	r := s.Report()
+	assert.Equal(t, int64(5), r.TotalTask)
+	assert.Equal(t, int64(3), r.TotalItem)
+	assert.Equal(t, int64(2), r.RespErrors)
+	assert.Equal(t, map[int]int64{200: 2, 404: 1}, r.StatusCodes)
+	u, _ := url.Parse(ts.URL)
+	assert.Equal(t, int64(3), r.HostTasks[u.Host])
+	if assert.Len(t, r.TopErrors, 1) {
+		assert.Equal(t, int64(2), r.TopErrors[0].Count)
+		assert.Equal(t, dead.URL+"/x", r.TopErrors[0].Example)
+	}
+	if assert.Len(t, r.Slowest, 3) {
+		assert.Equal(t, ts.URL+"/slow", r.Slowest[0].URL)
+	}
+	assert.True(t, r.Duration >= 50*time.Millisecond)
+	assert.False(t, r.Stopped)
+
+	data, err := ioutil.ReadFile(jsonPath)
+	if assert.NoError(t, err) {
+		saved := &Report{}
+		assert.NoError(t, json.Unmarshal(data, saved))
+		assert.Equal(t, r.TotalTask, saved.TotalTask)
+		assert.Equal(t, r.StatusCodes, saved.StatusCodes)
+		assert.Equal(t, r.Slowest, saved.Slowest)
+	}
+	page, err := ioutil.ReadFile(htmlPath)
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(page), "<td>"+u.Host+"</td>")
+		assert.Contains(t, string(page), ts.URL+"/slow")
+	}
+}
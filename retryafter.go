@@ -0,0 +1,126 @@
+package gospider
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zhshch2002/goreq"
+)
+
+// RetryAfterMetaKey 任务因Retry-After重试的次数在Meta中的键
+const RetryAfterMetaKey = "_retry_after"
+
+// retryAfter 遵循Retry-After的重试，以及按host暂停请求
+type retryAfter struct {
+	max      int
+	maxDelay time.Duration
+
+	lock  sync.Mutex
+	hosts map[string]time.Time // host -> 暂停到的时间
+}
+
+// parseRetryAfter 解析Retry-After头，支持秒数和HTTP日期两种格式
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if sec < 0 {
+			sec = 0
+		}
+		return time.Duration(sec) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// pauseHost 暂停host的请求直到until
+func (r *retryAfter) pauseHost(host string, until time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if until.After(r.hosts[host]) {
+		r.hosts[host] = until
+	}
+}
+
+// waitHost 等待host的暂停结束，ctx取消时返回其错误
+func (r *retryAfter) waitHost(ctx context.Context, host string) error {
+	r.lock.Lock()
+	until, ok := r.hosts[host]
+	if ok && !time.Now().Before(until) {
+		delete(r.hosts, host)
+		ok = false
+	}
+	r.lock.Unlock()
+	if !ok {
+		return nil
+	}
+	return sleepContext(ctx, time.Until(until))
+}
+
+// handle 处理要求稍后重试的响应，返回true表示任务已重新加入，不再继续处理
+func (r *retryAfter) handle(ctx *Context, t *Task) bool {
+	if ctx.Resp.StatusCode != http.StatusTooManyRequests && ctx.Resp.StatusCode != http.StatusServiceUnavailable {
+		return false
+	}
+	now := time.Now()
+	delay, ok := parseRetryAfter(ctx.Resp.Header.Get("Retry-After"), now)
+	if !ok {
+		return false
+	}
+	if r.maxDelay > 0 && delay > r.maxDelay {
+		delay = r.maxDelay
+	}
+	count := ctx.GetInt(RetryAfterMetaKey)
+	if count >= r.max {
+		return false
+	}
+
+	s := ctx.s
+	r.pauseHost(ctx.Req.URL.Host, now.Add(delay))
+	s.writeLog(ctx, LogWarn, "retry after", "spider", s.Name, "context", ctx.String(), "delay", delay)
+	s.handleOnRetryAfter(ctx, delay)
+
+	meta := make(map[string]interface{}, len(t.Meta)+1)
+	for k, v := range t.Meta {
+		meta[k] = v
+	}
+	meta[RetryAfterMetaKey] = count + 1
+	s.retryTask(t, t.Req, meta, now.Add(delay))
+	return true
+}
+
+// WithRetryAfter 遵循Retry-After重试
+// 响应为429或503且带有Retry-After时，不把它当作最终的响应，而是在指定的时间之后重新加入该任务(不再经过OnTask)，
+// 同时暂停对该host的请求直到这个时间，并调用OnRetryAfter。
+// 每个任务最多重试maxRetries次，超过后按普通响应处理；maxDelay大于0时限制等待的最长时间
+func WithRetryAfter(maxRetries int, maxDelay time.Duration) Extension {
+	return func(s *Spider) {
+		r := &retryAfter{
+			max:      maxRetries,
+			maxDelay: maxDelay,
+			hosts:    map[string]time.Time{},
+		}
+		s.retryAfter = r
+		s.Client.Use(func(c *goreq.Client, next goreq.Handler) goreq.Handler {
+			return func(req *goreq.Request) *goreq.Response {
+				if req.Err == nil {
+					if err := r.waitHost(requestContext(req), req.URL.Host); err != nil {
+						return &goreq.Response{Req: req, Err: err}
+					}
+				}
+				return next(req)
+			}
+		})
+	}
+}
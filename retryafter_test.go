@@ -0,0 +1,94 @@
+package gospider
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	d, ok := parseRetryAfter("120", now)
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, d)
+	d, ok = parseRetryAfter("Mon, 02 Jan 2006 15:04:35 GMT", now)
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, d)
+	d, ok = parseRetryAfter("Mon, 02 Jan 2006 15:00:00 GMT", now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), d)
+	_, ok = parseRetryAfter("soon", now)
+	assert.False(t, ok)
+}
+
+func TestWithRetryAfter(t *testing.T) {
+	var hits int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&hits, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = fmt.Fprint(w, "Hello")
+	}))
+	defer ts.Close()
+
+	s := NewSpider(WithRetryAfter(3, 200*time.Millisecond))
+	s.Logging = false
+	var retried, handled int64
+	s.OnRetryAfter(func(ctx *Context, delay time.Duration) {
+		atomic.AddInt64(&retried, 1)
+		assert.Equal(t, 200*time.Millisecond, delay)
+	})
+	start := time.Now()
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		atomic.AddInt64(&handled, 1)
+		assert.Equal(t, 200, ctx.Resp.StatusCode)
+		assert.Equal(t, 1, ctx.Meta[RetryAfterMetaKey])
+	})
+	s.Wait()
+
+	assert.True(t, time.Since(start) >= 200*time.Millisecond)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&retried))
+	assert.Equal(t, int64(1), atomic.LoadInt64(&handled))
+	assert.Equal(t, int64(1), s.Status.Retries)
+}
+
+func TestWithRetryAfter_maxRetries(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	s := NewSpider(WithRetryAfter(2, 0))
+	s.Logging = false
+	var handled int64
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		atomic.AddInt64(&handled, 1)
+		assert.Equal(t, 503, ctx.Resp.StatusCode)
+	})
+	s.Wait()
+
+	assert.Equal(t, int64(1), atomic.LoadInt64(&handled))
+	assert.Equal(t, int64(2), s.Status.Retries)
+
+	// 从JSON恢复的任务(如Checkpoint、WithTaskQueue)中重试次数为float64
+	s = NewSpider(WithRetryAfter(2, 0))
+	s.Logging = false
+	s.RegisterHandler("count", func(ctx *Context) {
+		atomic.AddInt64(&handled, 1)
+	})
+	sub := &TaskSubmission{}
+	assert.NoError(t, json.Unmarshal([]byte(fmt.Sprintf(`{"url":%q,"meta":{%q:1},"handlers":["count"]}`, ts.URL, RetryAfterMetaKey)), sub))
+	assert.NoError(t, s.submitTask(sub))
+	s.Wait()
+	assert.Equal(t, int64(2), atomic.LoadInt64(&handled))
+	assert.Equal(t, int64(1), s.Status.Retries)
+}
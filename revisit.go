@@ -0,0 +1,61 @@
+package gospider
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/zhshch2002/goreq"
+)
+
+// revisitValidators 记录的一个URL的验证器
+type revisitValidators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+func revisitKey(req *goreq.Request) string {
+	return "revisit " + req.URL.String()
+}
+
+// WithRevisit 重复爬取时的条件请求
+// 记录每个URL响应的ETag和Last-Modified，再次请求该URL时自动带上If-None-Match和If-Modified-Since。
+// 服务器返回304时跳过OnResp和任务的处理方法，只调用OnNotModified，使未修改的页面几乎没有开销。
+// store保存验证器，使用持久化的存储(如DiskCacheStore)可以在多次运行之间保留
+func WithRevisit(store CacheStore) Extension {
+	return func(s *Spider) {
+		s.revisit = store
+		s.Client.Use(func(c *goreq.Client, next goreq.Handler) goreq.Handler {
+			return func(req *goreq.Request) *goreq.Response {
+				if req.Err != nil || req.Method != http.MethodGet {
+					return next(req)
+				}
+				key := revisitKey(req)
+				if data, ok := store.Get(key); ok {
+					v := &revisitValidators{}
+					if json.Unmarshal(data, v) == nil {
+						if v.ETag != "" && req.Header.Get("If-None-Match") == "" {
+							req.Header.Set("If-None-Match", v.ETag)
+						}
+						if v.LastModified != "" && req.Header.Get("If-Modified-Since") == "" {
+							req.Header.Set("If-Modified-Since", v.LastModified)
+						}
+					}
+				}
+				resp := next(req)
+				if resp == nil || resp.Err != nil || resp.Response == nil || resp.StatusCode != http.StatusOK {
+					return resp
+				}
+				v := &revisitValidators{
+					ETag:         resp.Header.Get("ETag"),
+					LastModified: resp.Header.Get("Last-Modified"),
+				}
+				if v.ETag == "" && v.LastModified == "" {
+					store.Delete(key)
+				} else if data, err := json.Marshal(v); err == nil {
+					store.Set(key, data)
+				}
+				return resp
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package gospider
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWithRevisit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/etag":
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/lm":
+			w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+			if r.Header.Get("If-Modified-Since") == "Mon, 02 Jan 2006 15:04:05 GMT" {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		_, _ = fmt.Fprint(w, "Hello")
+	}))
+	defer ts.Close()
+
+	store := NewMemoryCacheStore()
+	run := func() (handled, onResp, notModified int64) {
+		s := NewSpider(WithRevisit(store))
+		s.Logging = false
+		s.OnResp(func(ctx *Context) {
+			atomic.AddInt64(&onResp, 1)
+		})
+		s.OnNotModified(func(ctx *Context) {
+			atomic.AddInt64(&notModified, 1)
+		})
+		for _, p := range []string{"/etag", "/lm", "/none"} {
+			s.SeedTask(goreq.Get(ts.URL+p), func(ctx *Context) {
+				atomic.AddInt64(&handled, 1)
+			})
+		}
+		s.Wait()
+		return
+	}
+
+	handled, onResp, notModified := run()
+	assert.Equal(t, int64(3), handled)
+	assert.Equal(t, int64(3), onResp)
+	assert.Equal(t, int64(0), notModified)
+
+	handled, onResp, notModified = run()
+	assert.Equal(t, int64(1), handled)
+	assert.Equal(t, int64(1), onResp)
+	assert.Equal(t, int64(2), notModified)
+}
@@ -0,0 +1,113 @@
+package gospider
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newHangingServer 直到请求被取消才返回的服务器
+func newHangingServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+}
+
+func TestSpider_StopCancelsRequests(t *testing.T) {
+	ts := newHangingServer()
+	defer ts.Close()
+
+	s := NewSpider()
+	s.Logging = false
+	var respErrors int32
+	s.OnRespError(func(ctx *Context, err error) {
+		atomic.AddInt32(&respErrors, 1)
+	})
+	for i := 0; i < 3; i++ {
+		s.SeedTask(goreq.Get(ts.URL + "/" + string(rune('a'+i))))
+	}
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	s.Stop()
+	s.Wait()
+	assert.True(t, time.Since(start) < 2*time.Second)
+	assert.Equal(t, int64(3), s.Status.AbandonedTask)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&respErrors))
+	assert.Error(t, s.Context().Err())
+}
+
+func TestWithContext(t *testing.T) {
+	ts := newHangingServer()
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := NewSpider(WithContext(ctx))
+	s.Logging = false
+	s.SeedTask(goreq.Get(ts.URL))
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, s.IsStopped())
+	cancel()
+	s.Wait()
+	assert.True(t, s.IsStopped())
+	assert.Equal(t, int64(1), s.Status.AbandonedTask)
+}
+
+func TestSpider_StopCancelsDelays(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	for name, ext := range map[string]Extension{
+		"WithRandomDelay":     WithRandomDelay(500*time.Millisecond, 500*time.Millisecond),
+		"WithHostRandomDelay": WithHostRandomDelay(500*time.Millisecond, 500*time.Millisecond),
+		"WithAutoThrottle":    WithAutoThrottle(AutoThrottleConfig{StartDelay: 500 * time.Millisecond}),
+	} {
+		s := NewSpider(ext)
+		s.Logging = false
+		for i := 0; i < 10; i++ {
+			s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {})
+		}
+		time.AfterFunc(100*time.Millisecond, s.Stop)
+		start := time.Now()
+		s.Wait()
+		assert.True(t, time.Since(start) < 400*time.Millisecond, name)
+		assert.True(t, s.Status.Snapshot().AbandonedTask > 0, name)
+	}
+}
+
+func TestSpider_GracefulStop(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	s := NewSpider()
+	s.Logging = false
+	var handled int32
+	for i := 0; i < 3; i++ {
+		s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+			atomic.AddInt32(&handled, 1)
+		})
+	}
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		ctx.AddTaskAfter(time.Hour, goreq.Get(ts.URL))
+	})
+	time.Sleep(50 * time.Millisecond)
+	s.GracefulStop()
+	assert.True(t, s.IsStopped())
+	assert.NoError(t, s.Context().Err())
+	s.Wait()
+	assert.Equal(t, int32(3), atomic.LoadInt32(&handled))
+	assert.Equal(t, int64(1), s.Status.AbandonedTask)
+	assert.NoError(t, s.Context().Err())
+
+	s.Stop()
+	assert.Error(t, s.Context().Err())
+}
@@ -0,0 +1,63 @@
+package gospider
+
+import (
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// scheduler 按cron表达式定时生成种子任务
+type scheduler struct {
+	lock sync.Mutex
+	stop chan struct{} // 运行时非nil，StopSchedule时关闭
+}
+
+// Schedule 按cron表达式定时调用seedFn生成种子任务，使周期性的爬取不需要外部调度器
+// cronExpr为标准的5字段格式(分 时 日 月 周)，也支持@hourly、@daily、@every 1h30m等写法，可以用TZ=或CRON_TZ=前缀指定时区。
+// seedFn在独立的goroutine中调用，应通过SeedTask等方法加入任务，可以配合Wait等待所有已加入的任务完成；爬虫停止(见Stop)后不再触发
+func (s *Spider) Schedule(cronExpr string, seedFn func(s *Spider)) error {
+	sched, err := cron.ParseStandard(cronExpr)
+	if err != nil {
+		return err
+	}
+	s.scheduler.lock.Lock()
+	if s.scheduler.stop == nil {
+		s.scheduler.stop = make(chan struct{})
+	}
+	stop := s.scheduler.stop
+	s.scheduler.lock.Unlock()
+
+	go func() {
+		for {
+			now := time.Now()
+			next := sched.Next(now)
+			if next.IsZero() {
+				return
+			}
+			timer := time.NewTimer(next.Sub(now))
+			select {
+			case <-stop:
+				timer.Stop()
+				return
+			case <-s.stopCh:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			s.writeLog(nil, LogInfo, "schedule triggered", "spider", s.Name, "cron", cronExpr)
+			seedFn(s)
+		}
+	}()
+	return nil
+}
+
+// StopSchedule 停止所有通过Schedule注册的定时任务，已经加入的任务仍会执行完
+func (s *Spider) StopSchedule() {
+	s.scheduler.lock.Lock()
+	defer s.scheduler.lock.Unlock()
+	if s.scheduler.stop != nil {
+		close(s.scheduler.stop)
+		s.scheduler.stop = nil
+	}
+}
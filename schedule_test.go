@@ -0,0 +1,65 @@
+package gospider
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSpider_Schedule(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "Hello")
+	}))
+	defer ts.Close()
+
+	s := NewSpider()
+	s.Logging = false
+	assert.Error(t, s.Schedule("not a cron", func(s *Spider) {}))
+
+	var handled int64
+	triggered := make(chan struct{}, 10)
+	assert.NoError(t, s.Schedule("@every 1s", func(s *Spider) {
+		s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+			atomic.AddInt64(&handled, 1)
+		})
+		triggered <- struct{}{}
+	}))
+	select {
+	case <-triggered:
+	case <-time.After(3 * time.Second):
+		t.Fatal("schedule not triggered")
+	}
+	s.StopSchedule()
+	s.Wait()
+	n := atomic.LoadInt64(&handled)
+	assert.True(t, n >= 1)
+
+	time.Sleep(1200 * time.Millisecond)
+	s.Wait()
+	assert.Equal(t, n, atomic.LoadInt64(&handled))
+}
+
+func TestSpider_Schedule_Stop(t *testing.T) {
+	s := NewSpider()
+	s.Logging = false
+	var triggered int64
+	assert.NoError(t, s.Schedule("@every 1s", func(s *Spider) {
+		atomic.AddInt64(&triggered, 1)
+	}))
+	s.GracefulStop()
+	s.scheduler.lock.Lock()
+	assert.Nil(t, s.scheduler.stop)
+	s.scheduler.lock.Unlock()
+
+	// 停止后注册的定时任务同样不会触发
+	assert.NoError(t, s.Schedule("@every 1s", func(s *Spider) {
+		atomic.AddInt64(&triggered, 1)
+	}))
+	time.Sleep(1200 * time.Millisecond)
+	assert.Equal(t, int64(0), atomic.LoadInt64(&triggered))
+}
@@ -0,0 +1,89 @@
+package gospider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// ErrNotRendered 任务的页面不是由ChromeRenderer渲染的，无法截图或执行JS
+var ErrNotRendered = errors.New("page is not rendered by ChromeRenderer")
+
+// pageTimeout 在渲染后的页面上执行操作的超时
+const pageTimeout = 30 * time.Second
+
+// Screenshot 截取渲染后页面的完整PNG图片，只能在ChromeRenderer渲染的任务的处理方法中调用
+func (c *Context) Screenshot() ([]byte, error) {
+	p := renderedPageOf(c.Req)
+	if p == nil {
+		return nil, ErrNotRendered
+	}
+	ctx, cancel := context.WithTimeout(p.ctx, pageTimeout)
+	defer cancel()
+	var buf []byte
+	err := chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		_, _, size, err := page.GetLayoutMetrics().Do(ctx)
+		if err != nil {
+			return err
+		}
+		w, h := int64(math.Ceil(size.Width)), int64(math.Ceil(size.Height))
+		err = emulation.SetDeviceMetricsOverride(w, h, 1, false).
+			WithScreenOrientation(&emulation.ScreenOrientation{Type: emulation.OrientationTypePortraitPrimary}).
+			Do(ctx)
+		if err != nil {
+			return err
+		}
+		buf, err = page.CaptureScreenshot().WithClip(&page.Viewport{
+			X:      size.X,
+			Y:      size.Y,
+			Width:  size.Width,
+			Height: size.Height,
+			Scale:  1,
+		}).Do(ctx)
+		return err
+	}))
+	return buf, err
+}
+
+// ScreenshotFile WithScreenshots为该任务保存的截图路径，没有截图时为空
+// 可以在OnItem中读取，将截图与Item一起保存
+func (c *Context) ScreenshotFile() string {
+	return c.screenshot
+}
+
+// WithScreenshots 为每个由ChromeRenderer渲染的任务截取完整页面，保存为dir中以URL的sha256命名的PNG文件
+// 截图在OnResp中进行，之后的处理方法和OnItem可以通过ctx.ScreenshotFile获取路径
+func WithScreenshots(dir string) Extension {
+	return func(s *Spider) {
+		s.OnResp(func(ctx *Context) {
+			if renderedPageOf(ctx.Req) == nil {
+				return
+			}
+			buf, err := ctx.Screenshot()
+			if err == nil {
+				err = os.MkdirAll(dir, 0755)
+			}
+			if err != nil {
+				s.writeLog(ctx, LogError, "screenshot error", "error", err, "spider", s.Name, "context", ctx.String())
+				return
+			}
+			sum := sha256.Sum256([]byte(ctx.Req.URL.String()))
+			file := filepath.Join(dir, hex.EncodeToString(sum[:])+".png")
+			if err := ioutil.WriteFile(file, buf, 0644); err != nil {
+				s.writeLog(ctx, LogError, "screenshot error", "error", err, "spider", s.Name, "context", ctx.String())
+				return
+			}
+			ctx.screenshot = file
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package gospider
+
+import (
+	"bytes"
+	"github.com/chromedp/chromedp"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestContext_Screenshot_NotRendered(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "gospider-screenshot")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	s := NewSpider(WithScreenshots(dir))
+	s.Logging = false
+	var shotErr error
+	var file string
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		_, shotErr = ctx.Screenshot()
+		file = ctx.ScreenshotFile()
+	})
+	s.Wait()
+	assert.Equal(t, ErrNotRendered, shotErr)
+	assert.Equal(t, "", file)
+}
+
+func TestWithScreenshots(t *testing.T) {
+	path := testChromePath(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<html><body style="height:2000px">hello</body></html>`))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "gospider-screenshot")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	r := NewChromeRenderer(1, chromedp.ExecPath(path), chromedp.NoSandbox)
+	defer r.Close()
+	s := NewSpider(WithRender(r, `.*`), WithScreenshots(dir))
+	s.Logging = false
+	var file string
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		file = ctx.ScreenshotFile()
+	})
+	s.Wait()
+	data, err := ioutil.ReadFile(file)
+	if assert.NoError(t, err) {
+		assert.True(t, bytes.HasPrefix(data, []byte("\x89PNG")))
+	}
+}
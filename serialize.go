@@ -0,0 +1,173 @@
+package gospider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+
+	"github.com/ugorji/go/codec"
+	"github.com/zhshch2002/goreq"
+)
+
+// SerializedRequest 可序列化的请求，用于持久化或跨进程传输
+type SerializedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// SerializeRequest 将goreq请求转换为可序列化的结构，包含方法、URL、请求头(含cookie)和请求体
+func SerializeRequest(r *goreq.Request) *SerializedRequest {
+	sr := &SerializedRequest{}
+	if r == nil || r.Request == nil {
+		return sr
+	}
+	sr.Method = r.Method
+	sr.URL = r.URL.String()
+	sr.Header = r.Header.Clone()
+	if r.GetBody != nil {
+		if br, err := r.GetBody(); err == nil {
+			if b, err := ioutil.ReadAll(br); err == nil {
+				sr.Body = b
+			}
+		}
+	}
+	return sr
+}
+
+// Request 还原为goreq请求
+func (sr *SerializedRequest) Request() *goreq.Request {
+	req := goreq.NewRequest(sr.Method, sr.URL)
+	if req.Err != nil {
+		return req
+	}
+	for k, v := range sr.Header {
+		for _, i := range v {
+			req.AddHeader(k, i)
+		}
+	}
+	if len(sr.Body) > 0 {
+		req.SetRawBody(sr.Body)
+	}
+	return req
+}
+
+// ErrUnregisteredHandler 任务的处理方法没有用RegisterHandler注册，无法序列化
+var ErrUnregisteredHandler = errors.New("handler is not registered")
+
+// SerializeTask 将任务转换为可序列化的TaskSubmission，处理方法按RegisterHandler注册的名字引用
+func (s *Spider) SerializeTask(t *Task) (*TaskSubmission, error) {
+	var names []string
+	for _, h := range t.Handlers {
+		name, ok := s.handlerName(h)
+		if !ok {
+			return nil, ErrUnregisteredHandler
+		}
+		names = append(names, name)
+	}
+	return &TaskSubmission{
+		SerializedRequest: *SerializeRequest(t.Req),
+		Meta:              t.Meta,
+		Handlers:          names,
+		NotBefore:         t.NotBefore,
+		Render:            t.Render,
+		Depth:             t.Depth,
+	}, nil
+}
+
+// DeserializeTask 将TaskSubmission还原为任务，按名字查找处理方法
+func (s *Spider) DeserializeTask(sub *TaskSubmission) (*Task, error) {
+	if sub.Method == "" {
+		sub.Method = http.MethodGet
+	}
+	var h []Handler
+	for _, name := range sub.Handlers {
+		fn, ok := s.GetHandler(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown handler %q", name)
+		}
+		h = append(h, fn)
+	}
+	req := sub.Request()
+	if req.Err != nil {
+		return nil, req.Err
+	}
+	if !req.URL.IsAbs() {
+		return nil, fmt.Errorf("url %q is not absolute", sub.URL)
+	}
+	meta := sub.Meta
+	if meta == nil {
+		meta = map[string]interface{}{}
+	}
+	t := NewTask(req, meta, h...)
+	t.NotBefore = sub.NotBefore
+	t.Render = sub.Render
+	t.Depth = sub.Depth
+	return t, nil
+}
+
+// Codec 任务的编码格式，见JSONCodec、MsgpackCodec
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// JSONCodec JSON编码
+	JSONCodec Codec = jsonCodec{}
+	// MsgpackCodec msgpack编码，比JSON紧凑，请求体等二进制内容不需要base64
+	MsgpackCodec Codec = msgpackCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// msgpackHandle 解码时map使用map[string]interface{}，字符串不解码为[]byte，与JSON解码的结果一致
+var msgpackHandle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{}
+	h.MapType = reflect.TypeOf(map[string]interface{}{})
+	h.RawToString = true
+	h.WriteExt = true
+	return h
+}()
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var data []byte
+	err := codec.NewEncoderBytes(&data, msgpackHandle).Encode(v)
+	return data, err
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return codec.NewDecoderBytes(data, msgpackHandle).Decode(v)
+}
+
+// MarshalTask 用c编码任务，包括请求、Meta和处理方法的名字，Meta中的值需要能被c编码
+func (s *Spider) MarshalTask(t *Task, c Codec) ([]byte, error) {
+	sub, err := s.SerializeTask(t)
+	if err != nil {
+		return nil, err
+	}
+	return c.Marshal(sub)
+}
+
+// UnmarshalTask 解码MarshalTask编码的任务，解码后Meta中的数字在JSON中为float64
+func (s *Spider) UnmarshalTask(data []byte, c Codec) (*Task, error) {
+	sub := &TaskSubmission{}
+	if err := c.Unmarshal(data, sub); err != nil {
+		return nil, err
+	}
+	return s.DeserializeTask(sub)
+}
@@ -0,0 +1,59 @@
+package gospider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSpider_MarshalTask(t *testing.T) {
+	s := NewSpider()
+	called := ""
+	s.RegisterHandler("parseProduct", func(ctx *Context) {
+		called = "parseProduct"
+	})
+	fn, _ := s.GetHandler("parseProduct")
+	notBefore := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for name, c := range map[string]Codec{"json": JSONCodec, "msgpack": MsgpackCodec} {
+		req := goreq.Post("http://example.com/p?id=1").SetRawBody([]byte("\x00body"))
+		req.Header.Set("X-Token", "t")
+		task := NewTask(req, map[string]interface{}{"depth": 2, "tag": "a", "ids": []interface{}{"x", "y"}}, fn)
+		task.NotBefore = notBefore
+		task.Render = true
+		task.Depth = 3
+
+		data, err := s.MarshalTask(task, c)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		got, err := s.UnmarshalTask(data, c)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		assert.Equal(t, http.MethodPost, got.Req.Method, name)
+		assert.Equal(t, "http://example.com/p?id=1", got.Req.URL.String(), name)
+		assert.Equal(t, "t", got.Req.Header.Get("X-Token"), name)
+		body, _ := ioutil.ReadAll(got.Req.Body)
+		assert.Equal(t, "\x00body", string(body), name)
+		assert.EqualValues(t, 2, got.Meta["depth"], name)
+		assert.Equal(t, "a", got.Meta["tag"], name)
+		assert.Equal(t, []interface{}{"x", "y"}, got.Meta["ids"], name)
+		assert.True(t, got.NotBefore.Equal(notBefore), name)
+		assert.True(t, got.Render, name)
+		assert.Equal(t, 3, got.Depth, name)
+		if assert.Len(t, got.Handlers, 1, name) {
+			called = ""
+			got.Handlers[0](nil)
+			assert.Equal(t, "parseProduct", called, name)
+		}
+	}
+
+	_, err := s.MarshalTask(NewTask(goreq.Get("http://example.com"), nil, func(ctx *Context) {}), JSONCodec)
+	assert.Equal(t, ErrUnregisteredHandler, err)
+	_, err = s.UnmarshalTask([]byte(`{"url":"http://example.com","handlers":["missing"]}`), JSONCodec)
+	assert.Error(t, err)
+}
@@ -0,0 +1,161 @@
+package gospider
+
+import (
+	"context"
+	"net/http"
+	"net/http/cookiejar"
+	"sync"
+
+	"github.com/zhshch2002/goreq"
+)
+
+// SessionMetaKey 任务Meta中指定会话的键，值为会话名，优先于按域名选择的会话
+const SessionMetaKey = "session"
+
+// sessionKey 请求context中的会话
+type sessionKey struct{}
+
+// Session 会话，拥有独立的Cookie、默认请求头和代理
+// 同一个站点使用多个账号并发爬取时，每个账号使用一个会话
+type Session struct {
+	Name   string
+	Jar    http.CookieJar
+	Header http.Header // 会话的默认请求头，不覆盖任务已经设置的请求头
+
+	s       *Spider
+	lock    sync.Mutex
+	proxy   string
+	fetcher Fetcher
+}
+
+// SeedTask 加入属于该会话的种子任务，子任务共享Meta，也属于该会话
+func (se *Session) SeedTask(req *goreq.Request, h ...Handler) {
+	ctx := &Context{
+		s:    se.s,
+		Meta: map[string]interface{}{SessionMetaKey: se.Name},
+	}
+	ctx.AddTask(req, h...)
+}
+
+// SetProxy 设置会话使用的代理，优先于代理池的选择，为空时不指定
+func (se *Session) SetProxy(proxy string) {
+	se.lock.Lock()
+	defer se.lock.Unlock()
+	se.proxy = proxy
+}
+
+// Proxy 会话使用的代理
+func (se *Session) Proxy() string {
+	se.lock.Lock()
+	defer se.lock.Unlock()
+	return se.proxy
+}
+
+// sessions Spider的会话
+type sessions struct {
+	lock sync.Mutex
+	m    map[string]*Session
+}
+
+// Session 获取名为name的会话，不存在时创建
+// 需要配合WithSessions使用，可以在加入任务前设置会话的请求头、代理或Cookie
+func (s *Spider) Session(name string) *Session {
+	s.sessions.lock.Lock()
+	defer s.sessions.lock.Unlock()
+	if s.sessions.m == nil {
+		s.sessions.m = map[string]*Session{}
+	}
+	se, ok := s.sessions.m[name]
+	if !ok {
+		j, _ := cookiejar.New(nil)
+		se = &Session{
+			s:      s,
+			Name:   name,
+			Jar:    j,
+			Header: http.Header{},
+		}
+		s.sessions.m[name] = se
+	}
+	return se
+}
+
+// Sessions 所有会话的名字
+func (s *Spider) Sessions() []string {
+	s.sessions.lock.Lock()
+	defer s.sessions.lock.Unlock()
+	var res []string
+	for name := range s.sessions.m {
+		res = append(res, name)
+	}
+	return res
+}
+
+// RemoveSession 移除会话，之后同名的会话会重新创建
+func (s *Spider) RemoveSession(name string) {
+	s.sessions.lock.Lock()
+	defer s.sessions.lock.Unlock()
+	delete(s.sessions.m, name)
+}
+
+// sessionFetcher 使用会话的Cookie发送请求的Fetcher
+func (s *Spider) sessionFetcher(se *Session) Fetcher {
+	se.lock.Lock()
+	defer se.lock.Unlock()
+	if se.fetcher == nil {
+		se.fetcher = NewHTTPFetcher(&http.Client{
+			Jar:           se.Jar,
+			Transport:     s.roundTripper(s.httpTransport()),
+			CheckRedirect: checkRedirect,
+		})
+	}
+	return se.fetcher
+}
+
+// requestSession 请求所属的会话
+func requestSession(req *goreq.Request) *Session {
+	if req.Request == nil {
+		return nil
+	}
+	se, _ := req.Context().Value(sessionKey{}).(*Session)
+	return se
+}
+
+// WithSessions 启用会话，任务Meta中SessionMetaKey指定的会话优先；byDomain为true时，其余任务按host使用各自的会话
+// 会话的请求使用Spider自定义的transport和会话自己的Cookie，不会与其他会话或goreq内置的Cookie混用
+func WithSessions(byDomain bool) Extension {
+	return func(s *Spider) {
+		s.httpTransport()
+		s.OnTask(func(ctx *Context, t *Task) *Task {
+			if t.Req.Request == nil {
+				return t
+			}
+			name, _ := t.Meta[SessionMetaKey].(string)
+			if name == "" && byDomain {
+				name = t.Req.URL.Hostname()
+			}
+			if name == "" {
+				return t
+			}
+			se := s.Session(name)
+			se.lock.Lock()
+			for k, vs := range se.Header {
+				if t.Req.Header.Get(k) == "" {
+					for _, v := range vs {
+						t.Req.Header.Add(k, v)
+					}
+				}
+			}
+			proxy := se.proxy
+			se.lock.Unlock()
+			c := context.WithValue(t.Req.Context(), sessionKey{}, se)
+			if proxy != "" {
+				c = context.WithValue(c, proxyOverrideKey{}, proxy)
+			}
+			t.Req.Request = t.Req.WithContext(c)
+			if proxy != "" {
+				setProxy(t.Req, proxy)
+			}
+			return t
+		})
+	}
+}
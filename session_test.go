@@ -0,0 +1,69 @@
+package gospider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestWithSessions(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "user", Value: r.URL.Query().Get("user"), Path: "/"})
+		case "/me":
+			c, err := r.Cookie("user")
+			if err != nil {
+				_, _ = w.Write([]byte("anonymous " + r.Header.Get("X-Account")))
+				return
+			}
+			_, _ = w.Write([]byte(c.Value + " " + r.Header.Get("X-Account")))
+		}
+	}))
+	defer ts.Close()
+
+	s := NewSpider(WithSessions(false))
+	s.Logging = false
+	lock := sync.Mutex{}
+	res := map[string]string{}
+	for _, name := range []string{"alice", "bob"} {
+		se := s.Session(name)
+		se.Header.Set("X-Account", name)
+		se.SeedTask(goreq.Get(ts.URL+"/login?user="+name), func(ctx *Context) {
+			ctx.AddTask(goreq.Get(ts.URL+"/me"), func(ctx *Context) {
+				lock.Lock()
+				res[ctx.Meta[SessionMetaKey].(string)] = ctx.Resp.Text
+				lock.Unlock()
+			})
+		})
+	}
+	s.SeedTask(goreq.Get(ts.URL+"/me"), func(ctx *Context) {
+		lock.Lock()
+		res[""] = ctx.Resp.Text
+		lock.Unlock()
+	})
+	s.Wait()
+
+	assert.Equal(t, map[string]string{
+		"alice": "alice alice",
+		"bob":   "bob bob",
+		"":      "anonymous ",
+	}, res)
+	assert.ElementsMatch(t, []string{"alice", "bob"}, s.Sessions())
+}
+
+func TestWithSessions_ByDomain(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	s := NewSpider(WithSessions(true))
+	s.Logging = false
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {})
+	s.Wait()
+	assert.Equal(t, []string{"127.0.0.1"}, s.Sessions())
+	s.RemoveSession("127.0.0.1")
+	assert.Empty(t, s.Sessions())
+}
@@ -0,0 +1,120 @@
+package gospider
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// SignalOptions WithSignalHandler的配置
+type SignalOptions struct {
+	Checkpoint string         // 不为空时停止后将尚未完成的任务保存到该文件(见Checkpoint)，重新启动时用ResumeFrom继续
+	Flush      []func() error // 停止后依次调用，如刷新保存Item的bufio.Writer、关闭文件或数据库连接
+	Summary    io.Writer      // 输出最终的状态摘要，默认为os.Stderr
+	Exit       func(code int) // 退出程序，默认为os.Exit
+}
+
+// signalHandler 记录收到的信号，Wait返回前完成清理并退出
+type signalHandler struct {
+	opts SignalOptions
+	sig  chan os.Signal
+	done chan struct{} // Wait完成时关闭
+
+	lock     sync.Mutex
+	received os.Signal // 第一次收到的信号
+	finished bool
+}
+
+// WithSignalHandler 捕获SIGINT和SIGTERM：第一次收到时停止爬虫(见Stop)，
+// Wait等待已收到的响应和Item处理完、关闭ItemPipeline(见AddPipeline)和扩展(见AddExtension)后依次保存检查点、调用Flush，输出状态摘要并退出程序，Wait不再返回；
+// 第二次收到时立即退出。退出码为128+信号值(SIGINT为130，SIGTERM为143)，关闭ItemPipeline或扩展、保存检查点或Flush出错时为1
+// 没有收到信号时Wait照常返回
+func WithSignalHandler(opts ...SignalOptions) Extension {
+	return func(s *Spider) {
+		h := &signalHandler{
+			sig:  make(chan os.Signal, 2),
+			done: make(chan struct{}),
+		}
+		if len(opts) > 0 {
+			h.opts = opts[0]
+		}
+		if h.opts.Summary == nil {
+			h.opts.Summary = os.Stderr
+		}
+		if h.opts.Exit == nil {
+			h.opts.Exit = os.Exit
+		}
+		s.signals = h
+		signal.Notify(h.sig, os.Interrupt, syscall.SIGTERM)
+		go h.loop(s)
+	}
+}
+
+// loop 等待信号
+func (h *signalHandler) loop(s *Spider) {
+	select {
+	case sig := <-h.sig:
+		h.lock.Lock()
+		h.received = sig
+		h.lock.Unlock()
+		s.writeLog(nil, LogInfo, "signal received, stopping", "spider", s.Name, "signal", sig.String())
+		s.Stop()
+	case <-h.done:
+		return
+	}
+	select {
+	case sig := <-h.sig:
+		s.writeLog(nil, LogWarn, "signal received again, exiting", "spider", s.Name, "signal", sig.String())
+		h.opts.Exit(exitCode(sig))
+	case <-h.done:
+	}
+}
+
+// finish 在Wait关闭ItemPipeline和扩展后调用，收到过信号时完成清理并退出，closeErr为关闭时的第一个错误
+func (h *signalHandler) finish(s *Spider, closeErr error) {
+	h.lock.Lock()
+	sig, finished := h.received, h.finished
+	h.finished = true
+	h.lock.Unlock()
+	if finished {
+		return
+	}
+	signal.Stop(h.sig)
+	close(h.done)
+	if sig == nil {
+		return
+	}
+	code := exitCode(sig)
+	if closeErr != nil {
+		code = 1
+	}
+	if h.opts.Checkpoint != "" && h.opts.Checkpoint != s.checkpoint {
+		if err := s.Checkpoint(h.opts.Checkpoint); err != nil {
+			s.writeLog(nil, LogError, "checkpoint error", "error", err, "spider", s.Name, "path", h.opts.Checkpoint)
+			code = 1
+		}
+	}
+	for _, fn := range h.opts.Flush {
+		if err := fn(); err != nil {
+			s.writeLog(nil, LogError, "flush error", "error", err, "spider", s.Name)
+			code = 1
+		}
+	}
+	ss := s.Status.Snapshot()
+	fmt.Fprintf(h.opts.Summary, "[%s] stopped by %v after %s: tasks %d/%d items %d errors %d abandoned %d\n",
+		s.Name, sig, ss.Elapsed.Truncate(time.Second), ss.FinishedTask, ss.TotalTask, ss.TotalItem,
+		ss.ReqErrors+ss.RespErrors, ss.AbandonedTask)
+	h.opts.Exit(code)
+}
+
+// exitCode 按惯例为128+信号值
+func exitCode(sig os.Signal) int {
+	if n, ok := sig.(syscall.Signal); ok {
+		return 128 + int(n)
+	}
+	return 1
+}
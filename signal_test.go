@@ -0,0 +1,77 @@
+package gospider
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWithSignalHandler(t *testing.T) {
+	ts := newHangingServer()
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "gospider-signal")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint.json")
+
+	flushed := 0
+	exit := -1
+	summary := &bytes.Buffer{}
+	s := NewSpider(WithSignalHandler(SignalOptions{
+		Checkpoint: path,
+		Flush: []func() error{func() error {
+			flushed++
+			return nil
+		}},
+		Summary: summary,
+		Exit: func(code int) {
+			exit = code
+		},
+	}))
+	s.Logging = false
+	s.SeedTask(goreq.Get(ts.URL + "/a"))
+	s.SeedTask(goreq.Get(ts.URL + "/b"))
+	time.Sleep(50 * time.Millisecond)
+	s.signals.sig <- syscall.SIGTERM
+	s.Wait()
+
+	assert.True(t, s.IsStopped())
+	assert.Equal(t, 143, exit)
+	assert.Equal(t, 1, flushed)
+	assert.Contains(t, summary.String(), "[spider] stopped by terminated")
+	assert.Contains(t, summary.String(), "abandoned 2")
+	data, err := ioutil.ReadFile(path)
+	if assert.NoError(t, err) {
+		cp := &checkpointFile{}
+		assert.NoError(t, json.Unmarshal(data, cp))
+		assert.Len(t, cp.Tasks, 2)
+	}
+}
+
+func TestWithSignalHandler_NoSignal(t *testing.T) {
+	exit := -1
+	flushed := 0
+	s := NewSpider(WithSynchronousMode(), WithSignalHandler(SignalOptions{
+		Flush: []func() error{func() error {
+			flushed++
+			return nil
+		}},
+		Exit: func(code int) {
+			exit = code
+		},
+	}))
+	s.Logging = false
+	s.Wait()
+	assert.Equal(t, -1, exit)
+	assert.Equal(t, 0, flushed)
+	assert.Equal(t, 130, exitCode(os.Interrupt))
+}
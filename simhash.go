@@ -0,0 +1,192 @@
+package gospider
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// NearDuplicateMetaKey 近似重复的页面的Meta中记录重复的页面URL的键，见WithNearDuplicateDetection
+const NearDuplicateMetaKey = "_near_duplicate"
+
+// SimHash 计算文本的64位SimHash，以相邻的词对(中文等没有空格的文字按字)为特征，内容相近的文本哈希的海明距离小
+func SimHash(text string) uint64 {
+	var words []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if isCJKWord(w) {
+			for _, r := range w {
+				words = append(words, string(r))
+			}
+		} else {
+			words = append(words, w)
+		}
+	}
+	if len(words) == 0 {
+		return 0
+	}
+	var v [64]int
+	add := func(feature string) {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		for i := 0; i < 64; i++ {
+			if sum&(1<<uint(i)) != 0 {
+				v[i]++
+			} else {
+				v[i]--
+			}
+		}
+	}
+	if len(words) == 1 {
+		add(words[0])
+	}
+	for i := 0; i+1 < len(words); i++ {
+		add(words[i] + " " + words[i+1])
+	}
+	var res uint64
+	for i := 0; i < 64; i++ {
+		if v[i] > 0 {
+			res |= 1 << uint(i)
+		}
+	}
+	return res
+}
+
+// isCJKWord 是否是中日韩文字组成的词
+func isCJKWord(w string) bool {
+	for _, r := range w {
+		if unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// HammingDistance 两个哈希不同的位数
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// SimHashIndex SimHash的索引，查找海明距离不超过阈值的哈希
+// 哈希被分为threshold+1段，距离不超过threshold的两个哈希至少有一段相同，只需比较有相同段的哈希
+type SimHashIndex struct {
+	threshold int
+	bands     [][2]uint // 每段的起始位和位数
+
+	lock   sync.RWMutex
+	tables []map[uint64][]simHashEntry
+}
+
+type simHashEntry struct {
+	hash uint64
+	key  string
+}
+
+// NewSimHashIndex 创建索引，threshold为认为近似重复的最大海明距离，常用3
+func NewSimHashIndex(threshold int) *SimHashIndex {
+	if threshold < 0 {
+		threshold = 0
+	}
+	if threshold > 63 {
+		threshold = 63
+	}
+	n := threshold + 1
+	idx := &SimHashIndex{threshold: threshold}
+	start := uint(0)
+	for i := 0; i < n; i++ {
+		width := uint(64 / n)
+		if i < 64%n {
+			width++
+		}
+		idx.bands = append(idx.bands, [2]uint{start, width})
+		idx.tables = append(idx.tables, map[uint64][]simHashEntry{})
+		start += width
+	}
+	return idx
+}
+
+func (idx *SimHashIndex) band(hash uint64, i int) uint64 {
+	b := idx.bands[i]
+	return (hash >> b[0]) & (1<<b[1] - 1)
+}
+
+// Find 查找与hash距离不超过阈值的已加入的哈希，返回其key
+func (idx *SimHashIndex) Find(hash uint64) (string, bool) {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+	for i, table := range idx.tables {
+		for _, e := range table[idx.band(hash, i)] {
+			if HammingDistance(e.hash, hash) <= idx.threshold {
+				return e.key, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Add 加入哈希
+func (idx *SimHashIndex) Add(hash uint64, key string) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	for i, table := range idx.tables {
+		b := idx.band(hash, i)
+		table[b] = append(table[b], simHashEntry{hash: hash, key: key})
+	}
+}
+
+// FindOrAdd 查找近似重复的哈希，没有时加入，并发调用时同一组近似的哈希只有一个会被加入
+func (idx *SimHashIndex) FindOrAdd(hash uint64, key string) (string, bool) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	for i, table := range idx.tables {
+		for _, e := range table[idx.band(hash, i)] {
+			if HammingDistance(e.hash, hash) <= idx.threshold {
+				return e.key, true
+			}
+		}
+	}
+	for i, table := range idx.tables {
+		b := idx.band(hash, i)
+		table[b] = append(table[b], simHashEntry{hash: hash, key: key})
+	}
+	return "", false
+}
+
+// WithNearDuplicateDetection 检测近似重复的页面，如软404、只有少量差异的模板页
+// 计算响应文本(HTML为body中的文字)的SimHash，与已爬取的页面的海明距离不超过threshold时为近似重复：
+// Meta中的NearDuplicateMetaKey记录重复的页面的URL并调用OnDuplicate，drop为true时以"duplicate"为原因Abort，跳过之后的处理
+// 只检测2xx的响应，没有文字的页面不检测
+func WithNearDuplicateDetection(threshold int, drop bool) Extension {
+	return func(s *Spider) {
+		idx := NewSimHashIndex(threshold)
+		s.OnRespWithPriority(-50, func(ctx *Context) {
+			if ctx.Resp.StatusCode < 200 || ctx.Resp.StatusCode >= 300 {
+				return
+			}
+			text := ctx.Resp.Text
+			if ctx.Resp.IsHTML() {
+				if doc, err := ctx.Resp.HTML(); err == nil {
+					doc.Find("script, style, noscript").Remove()
+					text = doc.Find("body").Text()
+				}
+			}
+			hash := SimHash(text)
+			if hash == 0 {
+				return
+			}
+			of, dup := idx.FindOrAdd(hash, ctx.Req.URL.String())
+			if !dup {
+				return
+			}
+			ctx.SetMeta(NearDuplicateMetaKey, of)
+			s.handleOnDuplicate(ctx, of)
+			if drop {
+				ctx.AbortWithReason("duplicate")
+			}
+		})
+	}
+}
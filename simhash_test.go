@@ -0,0 +1,78 @@
+package gospider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const simHashText = `The quick brown fox jumps over the lazy dog while the farmer watches from the old wooden
+fence and the sun sets slowly behind the hills of the quiet green valley far away from the noisy city`
+
+func TestSimHash(t *testing.T) {
+	a := SimHash(simHashText)
+	assert.Equal(t, a, SimHash(strings.ToUpper(simHashText)+"\n\n"))
+	assert.LessOrEqual(t, HammingDistance(a, SimHash(strings.Replace(simHashText, "lazy", "sleepy", 1))), 10)
+	assert.Greater(t, HammingDistance(a, SimHash("completely different words about programming languages and compilers with garbage collection")), 10)
+	assert.Equal(t, uint64(0), SimHash(" ,. "))
+	assert.NotEqual(t, SimHash("中文页面内容"), SimHash("完全不同的文字"))
+}
+
+func TestSimHashIndex(t *testing.T) {
+	idx := NewSimHashIndex(3)
+	assert.Len(t, idx.bands, 4)
+	idx.Add(0xff00ff00ff00ff00, "a")
+	key, ok := idx.Find(0xff00ff00ff00ff00 ^ 0x0101010000000000)
+	assert.True(t, ok)
+	assert.Equal(t, "a", key)
+	_, ok = idx.Find(0xff00ff00ff00ff00 ^ 0x0f00000000000000)
+	assert.False(t, ok)
+
+	key, ok = idx.FindOrAdd(0x1234, "b")
+	assert.False(t, ok)
+	key, ok = idx.FindOrAdd(0x1235, "c")
+	assert.True(t, ok)
+	assert.Equal(t, "b", key)
+}
+
+func TestWithNearDuplicateDetection(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/a":
+			w.Write([]byte("<html><body><p>" + simHashText + "</p></body></html>"))
+		case "/b":
+			w.Write([]byte("<html><body><script>var id = 2;</script><p>" + simHashText + "</p></body></html>"))
+		case "/c":
+			w.Write([]byte("<html><body><p>completely different words about programming languages and compilers</p></body></html>"))
+		}
+	}))
+	defer ts.Close()
+
+	run := func(drop bool) (handled []string, dups map[string]string) {
+		s := NewSpider(WithSynchronousMode(), WithNearDuplicateDetection(3, drop))
+		s.Logging = false
+		dups = map[string]string{}
+		s.OnDuplicate(func(ctx *Context, of string) {
+			dups[ctx.Req.URL.Path] = of
+		})
+		h := func(ctx *Context) {
+			handled = append(handled, ctx.Req.URL.Path+" "+ctx.GetString(NearDuplicateMetaKey))
+		}
+		for _, p := range []string{"/a", "/b", "/c"} {
+			s.SeedTask(goreq.Get(ts.URL+p), h)
+			s.Wait()
+		}
+		return
+	}
+
+	handled, dups := run(false)
+	assert.Equal(t, []string{"/a ", "/b " + ts.URL + "/a", "/c "}, handled)
+	assert.Equal(t, map[string]string{"/b": ts.URL + "/a"}, dups)
+	handled, dups = run(true)
+	assert.Equal(t, []string{"/a ", "/c "}, handled)
+	assert.Equal(t, map[string]string{"/b": ts.URL + "/a"}, dups)
+}
@@ -0,0 +1,167 @@
+package gospider
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SitemapMaxURLs 每个sitemap文件最多包含的URL数，超过时拆分为多个文件并由索引文件引用
+const SitemapMaxURLs = 50000
+
+// sitemapWriter 记录抓取成功的HTML页面，见WithSitemap
+type sitemapWriter struct {
+	path    string
+	baseURL string
+
+	lock sync.Mutex
+	urls map[string]time.Time // URL -> Last-Modified，没有时为零值
+}
+
+// WithSitemap 记录所有返回200的HTML页面(重定向后的最终URL)，在Wait结束时写入path作为sitemap.xml，用于检查抓取覆盖范围或为自己的网站生成sitemap
+// 超过SitemapMaxURLs个URL时拆分为path同目录下的sitemap-1.xml、sitemap-2.xml等，path写入引用它们的sitemap索引，
+// 索引中的地址为baseURL加文件名，baseURL为空时使用第一个URL的站点根目录
+func WithSitemap(path, baseURL string) Extension {
+	return func(s *Spider) {
+		sm := &sitemapWriter{path: path, baseURL: baseURL, urls: map[string]time.Time{}}
+		s.sitemap = sm
+		s.OnResp(func(ctx *Context) {
+			if ctx.Resp.StatusCode != http.StatusOK || !isHTMLResponse(ctx.Resp.Header) {
+				return
+			}
+			u := ctx.Req.URL
+			if f := ctx.FinalURL(); f != nil {
+				u = f
+			}
+			if u.Scheme != "http" && u.Scheme != "https" {
+				return
+			}
+			loc := *u
+			loc.Fragment = ""
+			lastmod, _ := http.ParseTime(ctx.Resp.Header.Get("Last-Modified"))
+			sm.add(loc.String(), lastmod)
+		})
+	}
+}
+
+func (sm *sitemapWriter) add(u string, lastmod time.Time) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	if t, ok := sm.urls[u]; !ok || lastmod.After(t) {
+		sm.urls[u] = lastmod
+	}
+}
+
+// snapshot 按字母顺序排列的URL和对应的Last-Modified
+func (sm *sitemapWriter) snapshot() ([]string, []time.Time) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	urls := make([]string, 0, len(sm.urls))
+	for u := range sm.urls {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	lastmod := make([]time.Time, len(urls))
+	for i, u := range urls {
+		lastmod[i] = sm.urls[u]
+	}
+	return urls, lastmod
+}
+
+// SitemapURLs WithSitemap记录的URL，按字母顺序排列
+func (s *Spider) SitemapURLs() []string {
+	if s.sitemap == nil {
+		return nil
+	}
+	urls, _ := s.sitemap.snapshot()
+	return urls
+}
+
+// WriteSitemap 立即写入WithSitemap记录的URL，用于Forever等不会调用Wait的场景
+func (s *Spider) WriteSitemap() error {
+	if s.sitemap == nil {
+		panic("gospider: WriteSitemap requires WithSitemap")
+	}
+	return s.sitemap.write(s.sitemap.snapshot())
+}
+
+func (sm *sitemapWriter) write(urls []string, lastmod []time.Time) error {
+	if dir := filepath.Dir(sm.path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	if len(urls) <= SitemapMaxURLs {
+		return writeFileAtomic(sm.path, sitemapURLSet(urls, lastmod))
+	}
+	base := sm.baseURL
+	if base == "" {
+		base = siteRoot(urls[0])
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	idx := &bytes.Buffer{}
+	idx.WriteString(xml.Header)
+	idx.WriteString(`<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` + "\n")
+	for i := 0; i*SitemapMaxURLs < len(urls); i++ {
+		end := (i + 1) * SitemapMaxURLs
+		if end > len(urls) {
+			end = len(urls)
+		}
+		name := fmt.Sprintf("sitemap-%d.xml", i+1)
+		if err := writeFileAtomic(filepath.Join(filepath.Dir(sm.path), name), sitemapURLSet(urls[i*SitemapMaxURLs:end], lastmod[i*SitemapMaxURLs:end])); err != nil {
+			return err
+		}
+		idx.WriteString("  <sitemap><loc>")
+		xml.EscapeText(idx, []byte(base+name))
+		idx.WriteString("</loc></sitemap>\n")
+	}
+	idx.WriteString("</sitemapindex>\n")
+	return writeFileAtomic(sm.path, idx.Bytes())
+}
+
+// sitemapURLSet 生成一个sitemap文件的内容
+func sitemapURLSet(urls []string, lastmod []time.Time) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` + "\n")
+	for i, u := range urls {
+		buf.WriteString("  <url><loc>")
+		xml.EscapeText(buf, []byte(u))
+		buf.WriteString("</loc>")
+		if !lastmod[i].IsZero() {
+			buf.WriteString("<lastmod>" + lastmod[i].UTC().Format(time.RFC3339) + "</lastmod>")
+		}
+		buf.WriteString("</url>\n")
+	}
+	buf.WriteString("</urlset>\n")
+	return buf.Bytes()
+}
+
+// siteRoot URL的站点根目录，如https://example.com/
+func siteRoot(u string) string {
+	p, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	return p.Scheme + "://" + p.Host + "/"
+}
+
+// writeFileAtomic 先写入临时文件再重命名，避免留下不完整的文件
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,88 @@
+package gospider
+
+import (
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithSitemap(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<a href="/a?x=1&y=2">a</a><a href="/old">old</a><a href="/missing">m</a><a href="/logo.png">l</a>`))
+		case "/a":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+			w.Write([]byte(`<p>a</p>`))
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/new":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<p>new</p>`))
+		case "/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "gospider-sitemap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sitemap.xml")
+
+	s := NewSpider(WithSynchronousMode(), WithSitemap(path, ""))
+	s.Logging = false
+	s.OnHTML("a[href]", func(ctx *Context, sel *goquery.Selection) {
+		ctx.AddTask(goreq.Get(ts.URL + sel.AttrOr("href", "")))
+	})
+	s.SeedTask(goreq.Get(ts.URL + "/"))
+	s.Wait()
+
+	assert.Equal(t, []string{ts.URL + "/", ts.URL + "/a?x=1&y=2", ts.URL + "/new"}, s.SitemapURLs())
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>`+ts.URL+`/</loc></url>
+  <url><loc>`+ts.URL+`/a?x=1&amp;y=2</loc><lastmod>2015-10-21T07:28:00Z</lastmod></url>
+  <url><loc>`+ts.URL+`/new</loc></url>
+</urlset>
+`, string(data))
+}
+
+func TestSitemapIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gospider-sitemap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sm := &sitemapWriter{path: filepath.Join(dir, "sitemap.xml"), urls: map[string]time.Time{}}
+	for i := 0; i < SitemapMaxURLs+1; i++ {
+		sm.add(fmt.Sprintf("https://example.com/p/%06d", i), time.Time{})
+	}
+	assert.NoError(t, sm.write(sm.snapshot()))
+
+	data, err := ioutil.ReadFile(sm.path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "<sitemapindex")
+	assert.Contains(t, string(data), "<loc>https://example.com/sitemap-1.xml</loc>")
+	assert.Contains(t, string(data), "<loc>https://example.com/sitemap-2.xml</loc>")
+	first, err := ioutil.ReadFile(filepath.Join(dir, "sitemap-1.xml"))
+	assert.NoError(t, err)
+	assert.Equal(t, SitemapMaxURLs, strings.Count(string(first), "<url>"))
+	second, err := ioutil.ReadFile(filepath.Join(dir, "sitemap-2.xml"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(second), "<url>"))
+	assert.Contains(t, string(second), "https://example.com/p/050000")
+}
@@ -0,0 +1,39 @@
+package gospider
+
+// SkipReason 任务被OnTask丢弃的原因，见OnSkip
+type SkipReason string
+
+const (
+	SkipDuplicate SkipReason = "duplicate" // 请求已经加入过，见WithDeduplicate
+	SkipRobots    SkipReason = "robots"    // robots.txt不允许，见WithRobotsTxt
+	SkipDepth     SkipReason = "depth"     // 超过爬取深度，见WithDepthLimit
+	SkipDomain    SkipReason = "domain"    // 不在允许的域名中，见WithAllowedDomains
+	SkipLimit     SkipReason = "limit"     // 超过请求数限制，见WithMaxReqLimit
+	SkipFiltered  SkipReason = "filtered"  // OnTask返回nil且没有给出原因
+)
+
+// Skip 在OnTask中丢弃任务并给出原因，返回nil，如 return t.Skip(gospider.SkipLimit)
+// 直接返回nil丢弃的任务原因为SkipFiltered
+func (t *Task) Skip(reason SkipReason) *Task {
+	t.skip = reason
+	return nil
+}
+
+// handOff 任务转交给了其他地方执行，OnTask返回nil但不算丢弃
+func (t *Task) handOff() *Task {
+	t.handedOff = true
+	return nil
+}
+
+// skipTask 记录被OnTask丢弃的任务并调用OnSkip
+func (s *Spider) skipTask(ctx *Context, t *Task) {
+	if t.handedOff {
+		return
+	}
+	reason := t.skip
+	if reason == "" {
+		reason = SkipFiltered
+	}
+	s.Status.AddSkippedTask(reason)
+	s.handleOnSkip(ctx, t, reason)
+}
@@ -0,0 +1,71 @@
+package gospider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSpider_OnSkip(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	s := NewSpider(WithSynchronousMode(), WithDeduplicate(), WithAllowedDomains("127.0.0.1"), WithDepthLimit(1))
+	s.Logging = false
+	s.OnTask(func(ctx *Context, t *Task) *Task {
+		if strings.HasSuffix(t.Req.URL.Path, "/private") {
+			return nil
+		}
+		return t
+	})
+	lock := sync.Mutex{}
+	skipped := map[string]SkipReason{}
+	s.OnSkip(func(ctx *Context, t *Task, reason SkipReason) {
+		lock.Lock()
+		defer lock.Unlock()
+		skipped[t.Req.URL.Path] = reason
+	})
+	s.SeedTask(goreq.Get(ts.URL+"/"), func(ctx *Context) {
+		ctx.AddTask(goreq.Get(ts.URL + "/a"))
+	})
+	s.SeedTask(goreq.Get(ts.URL + "/"))
+	s.SeedTask(goreq.Get(strings.Replace(ts.URL, "127.0.0.1", "localhost", 1) + "/other"))
+	s.SeedTask(goreq.Get(ts.URL + "/private"))
+	s.Wait()
+
+	assert.Equal(t, map[string]SkipReason{
+		"/":        SkipDuplicate,
+		"/a":       SkipDepth,
+		"/other":   SkipDomain,
+		"/private": SkipFiltered,
+	}, skipped)
+	assert.Equal(t, map[SkipReason]int64{
+		SkipDuplicate: 1,
+		SkipDepth:     1,
+		SkipDomain:    1,
+		SkipFiltered:  1,
+	}, s.Status.SkippedTasks())
+	assert.Equal(t, s.Status.SkippedTasks(), s.Status.Snapshot().SkippedTasks)
+}
+
+func TestTask_Skip(t *testing.T) {
+	s := NewSpider(WithSynchronousMode())
+	s.Logging = false
+	s.OnTask(func(ctx *Context, t *Task) *Task {
+		return t.Skip("blocked path")
+	})
+	var reasons []SkipReason
+	s.OnSkip(func(ctx *Context, t *Task, reason SkipReason) {
+		reasons = append(reasons, reason)
+	})
+	s.SeedTask(goreq.Get("http://127.0.0.1/"))
+	s.Wait()
+	assert.Equal(t, []SkipReason{"blocked path"}, reasons)
+	assert.Equal(t, int64(0), s.Status.TotalTask)
+}
@@ -0,0 +1,42 @@
+package gospider
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// taskTimings 任务各阶段的耗时，见WithSlowTaskWarning
+type taskTimings struct {
+	start    time.Time
+	fetch    time.Duration
+	handlers []handlerTiming
+}
+
+type handlerTiming struct {
+	name string
+	d    time.Duration
+}
+
+// WithSlowTaskWarning 任务的请求和处理方法总耗时超过threshold时输出警告日志，
+// 包括URL、总耗时、请求耗时和各处理方法(名字见HandlerName)的耗时，便于及早发现异常的页面
+func WithSlowTaskWarning(threshold time.Duration) Extension {
+	return func(s *Spider) {
+		s.slowTask = threshold
+	}
+}
+
+// checkSlowTask 任务结束时检查耗时
+func (s *Spider) checkSlowTask(ctx *Context) {
+	tm := ctx.timings
+	elapsed := time.Since(tm.start)
+	if elapsed < s.slowTask {
+		return
+	}
+	handlers := make([]string, 0, len(tm.handlers))
+	for _, h := range tm.handlers {
+		handlers = append(handlers, fmt.Sprintf("%s=%s", h.name, h.d))
+	}
+	s.writeLog(ctx, LogWarn, "slow task", "spider", s.Name, "url", ctx.Req.URL.String(),
+		"elapsed", elapsed, "fetch", tm.fetch, "handlers", strings.Join(handlers, ", "))
+}
@@ -0,0 +1,50 @@
+package gospider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithSlowTaskWarning(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(30 * time.Millisecond)
+		}
+	}))
+	defer ts.Close()
+
+	l := &testLogger{}
+	s := NewSpider(WithSynchronousMode(), WithSlowTaskWarning(50*time.Millisecond))
+	s.SetLogger(l)
+	parse := func(ctx *Context) {
+		time.Sleep(30 * time.Millisecond)
+	}
+	s.RegisterHandler("parse", parse)
+	s.SeedTask(goreq.Get(ts.URL+"/slow"), parse)
+	s.SeedTask(goreq.Get(ts.URL+"/fast"), parse)
+	s.SeedTask(goreq.Get(ts.URL+"/slow"), func(ctx *Context) {})
+	s.Wait()
+
+	var slow []testLogRecord
+	for _, r := range l.records {
+		if r.Msg == "slow task" {
+			slow = append(slow, r)
+		}
+	}
+	if !assert.Len(t, slow, 1) {
+		return
+	}
+	assert.Equal(t, "warn", slow[0].Level)
+	kv := map[interface{}]interface{}{}
+	for i := 0; i+1 < len(slow[0].Keyvals); i += 2 {
+		kv[slow[0].Keyvals[i]] = slow[0].Keyvals[i+1]
+	}
+	assert.Equal(t, ts.URL+"/slow", kv["url"])
+	assert.True(t, kv["elapsed"].(time.Duration) >= 60*time.Millisecond)
+	assert.True(t, kv["fetch"].(time.Duration) >= 30*time.Millisecond)
+	assert.Regexp(t, `^parse=\d`, kv["handlers"])
+}
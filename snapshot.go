@@ -0,0 +1,139 @@
+package gospider
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// snapshotIndexFile 快照索引文件名，JSON Lines格式
+const snapshotIndexFile = "index.jsonl"
+
+// SnapshotEntry 快照索引中的一条记录
+type SnapshotEntry struct {
+	URL         string    `json:"url"`
+	File        string    `json:"file"` // 相对于存储目录的文件路径
+	ContentType string    `json:"content_type,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// SnapshotStore 以内容寻址方式保存响应原始内容的磁盘存储
+// 内容按sha256命名保存在Dir/<前两位>/<sha256>，相同内容只保存一份，Dir/index.jsonl记录URL→文件→时间
+type SnapshotStore struct {
+	Dir  string
+	lock sync.Mutex
+}
+
+// NewSnapshotStore 创建快照存储，目录不存在时会在写入时创建
+func NewSnapshotStore(dir string) *SnapshotStore {
+	return &SnapshotStore{Dir: dir}
+}
+
+// Save 保存一个URL的内容并写入索引
+func (st *SnapshotStore) Save(url, contentType string, body []byte, t time.Time) (*SnapshotEntry, error) {
+	sum := sha256.Sum256(body)
+	name := hex.EncodeToString(sum[:])
+	e := &SnapshotEntry{
+		URL:         url,
+		File:        filepath.Join(name[:2], name),
+		ContentType: contentType,
+		Time:        t,
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	p := filepath.Join(st.Dir, e.File)
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(p, body, 0644); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(filepath.Join(st.Dir, snapshotIndexFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Index 读取索引中的所有记录，按写入顺序返回
+func (st *SnapshotStore) Index() ([]*SnapshotEntry, error) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	f, err := os.Open(filepath.Join(st.Dir, snapshotIndexFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var res []*SnapshotEntry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		e := &SnapshotEntry{}
+		if err := json.Unmarshal(sc.Bytes(), e); err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	return res, sc.Err()
+}
+
+// Read 读取一条记录对应的内容
+func (st *SnapshotStore) Read(e *SnapshotEntry) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(st.Dir, e.File))
+}
+
+// WithSnapshotStore 将响应的原始内容保存到st，便于之后不重新爬取而重新解析
+// 指定selectors时只保存包含任一选择器匹配元素的HTML响应
+func WithSnapshotStore(st *SnapshotStore, selectors ...string) Extension {
+	return func(s *Spider) {
+		s.OnResp(func(ctx *Context) {
+			if len(selectors) > 0 && !snapshotMatch(ctx, selectors) {
+				return
+			}
+			body := ctx.Resp.NotDecodedBody
+			if body == nil {
+				body = ctx.Resp.Body
+			}
+			if _, err := st.Save(ctx.Req.URL.String(), ctx.Resp.Header.Get("Content-Type"), body, time.Now()); err != nil {
+				s.writeLog(ctx, LogError, "WithSnapshotStore Error", "error", err, "spider", s.Name, "context", ctx.String())
+			}
+		})
+	}
+}
+
+func snapshotMatch(ctx *Context, selectors []string) bool {
+	if !ctx.Resp.IsHTML() {
+		return false
+	}
+	h, err := ctx.HTML()
+	if err != nil {
+		return false
+	}
+	for _, sel := range selectors {
+		if h.Find(sel).Length() > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package gospider
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestWithSnapshotStore(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		switch r.URL.Path {
+		case "/list":
+			_, _ = fmt.Fprint(w, `<html><body><ul class="list"><li>a</li></ul></body></html>`)
+		default:
+			_, _ = fmt.Fprint(w, `<html><body><p>hello</p></body></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "gospider-snapshot")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	st := NewSnapshotStore(dir)
+	s := NewSpider(WithSnapshotStore(st))
+	s.Logging = false
+	s.SeedTask(goreq.Get(ts.URL + "/a"))
+	s.SeedTask(goreq.Get(ts.URL + "/b"))
+	s.SeedTask(goreq.Get(ts.URL + "/list"))
+	s.Wait()
+
+	entries, err := st.Index()
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 3) {
+		files := map[string]string{}
+		for _, e := range entries {
+			files[e.URL] = e.File
+			assert.Equal(t, "text/html; charset=utf-8", e.ContentType)
+			assert.False(t, e.Time.IsZero())
+		}
+		assert.Equal(t, files[ts.URL+"/a"], files[ts.URL+"/b"])
+		assert.NotEqual(t, files[ts.URL+"/a"], files[ts.URL+"/list"])
+		body, err := st.Read(entries[0])
+		assert.NoError(t, err)
+		assert.Contains(t, string(body), "<html>")
+	}
+
+	dir2, err := ioutil.TempDir("", "gospider-snapshot")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir2)
+
+	st2 := NewSnapshotStore(dir2)
+	s = NewSpider(WithSnapshotStore(st2, "ul.list"))
+	s.Logging = false
+	s.SeedTask(goreq.Get(ts.URL + "/a"))
+	s.SeedTask(goreq.Get(ts.URL + "/list"))
+	s.Wait()
+
+	entries, err = st2.Index()
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, ts.URL+"/list", entries[0].URL)
+	}
+}
@@ -1,13 +1,22 @@
 package gospider
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/tidwall/gjson"
 	"github.com/zhshch2002/goreq"
+	"golang.org/x/net/html"
 )
 
 var (
@@ -23,9 +32,16 @@ type Extension func(s *Spider)
 
 // Task 类
 type Task struct {
-	Req      *goreq.Request
-	Handlers []Handler
-	Meta     map[string]interface{}
+	Req       *goreq.Request
+	Handlers  []Handler
+	Meta      map[string]interface{}
+	NotBefore time.Time // 不为零值时，任务在此时间之前不会执行
+	Render    bool      // 使用WithRender设置的渲染器获取页面
+	Depth     int       // 爬取深度，种子任务为0，ctx.AddTask加入的任务为当前任务的深度加一，见WithDepthLimit
+
+	skip      SkipReason // 被OnTask丢弃的原因，见Skip
+	handedOff bool       // 转交给任务队列或主节点，OnTask返回nil但不算丢弃
+	noDedup   bool       // 不经过WithDeduplicate去重，如Monitor重复访问同一个URL
 }
 
 // Item 类型
@@ -53,13 +69,94 @@ type Spider struct {
 	Client *goreq.Client // http客户端
 	Status *SpiderStatus // 爬虫状态类型
 	wg     sync.WaitGroup
+	logger Logger
+
+	logLevel       LogLevel
+	logSampling    uint64
+	logSampleCount uint64
+
+	hookSeq     uint64   // 最后分配的HookID，见RemoveHook
+	onTaskHooks hookList // handler方法集合(func(ctx *Context, t *Task) *Task)
+	onRespHooks hookList // func(ctx *Context) 集合，  没有返回值
+	onItemHooks hookList // 因为不知道Item的数据类型， 所以接收任意类型的数据(func(ctx *Context, i interface{}) interface{})， 并返回
+
+	onRecoverHandlers     []func(ctx *Context, err error)           // 错误(panic)捕捉模式下的处理方法
+	onReqErrorHandlers    []func(ctx *Context, err error)           // 请求错误后的处理方法
+	onRespErrorHandlers   []func(ctx *Context, err error)           // 响应错误后的处理方法
+	onLogHandlers         []func(ctx *Context, e *LogEvent)         // 框架输出任务相关日志前的处理方法
+	onNotModifiedHandlers []Handler                                 // 重访的页面未修改(304)时的处理方法
+	onRetryAfterHandlers  []func(ctx *Context, delay time.Duration) // 响应要求稍后重试(Retry-After)时的处理方法
+	onCaptchaHandlers     []func(ctx *Context, c *Captcha)          // 检测到验证码页面时的处理方法
+	onBlockedHandlers     []func(ctx *Context, vendor BlockVendor)  // 被反爬服务拦截时的处理方法
+	onScrapedHandlers     []Handler                                 // 任务的处理方法全部执行完(没有Abort)后的处理方法
+	onAbortHandlers       []func(ctx *Context, reason string)       // 任务被Abort后的处理方法
+	onDuplicateHandlers   []func(ctx *Context, of string)           // 页面与已爬取的页面近似重复时的处理方法
+	onHTMLTokenHandlers   []func(ctx *Context, tok html.Token)      // 流式解析HTML时每个标签和文本的处理方法
+	onSkipHandlers        []func(*Context, *Task, SkipReason)       // 任务被OnTask丢弃时的处理方法
+	onItemShedHandlers    []func(ctx *Context, i interface{})       // Item队列已满被丢弃时的处理方法
+	onRequestHandlers     []func(ctx *Context, req *goreq.Request)  // 发送请求前的处理方法
+
+	deadLetters DeadLetterQueue // 死信队列，见WithDeadLetterQueue
+	tracing     *tracing        // 链路追踪，见WithTracing
+	revisit     CacheStore      // 重访时条件请求的验证器存储，见WithRevisit
+	retryAfter  *retryAfter     // 遵循Retry-After重试，见WithRetryAfter
+	captcha     *captchaSolving // 解决验证码并重试，见WithCaptchaSolver
+	block       *blockDetection // 反爬拦截检测，见WithBlockDetection
+	scheduler   scheduler       // 定时生成种子任务，见Schedule
+	sessions    sessions        // 会话，见WithSessions
+	dedup       *dedupSet       // 已加入过的请求，见WithDeduplicate
+	taskQueue   *queueRunner    // 持久化的任务队列，见WithTaskQueue
+	syncTasks   *syncQueue      // 同步模式下等待执行的任务，见WithSynchronousMode
+	inheritMeta []string        // 新任务继承的Meta键，nil时继承全部，见WithMetaInheritance
+	limit       *taskLimiter    // 调度时的并发限制，见WithConcurrencyLimit
+	paging      *pagination     // 翻页设置，见WithPagination
+	linkCheck   *linkChecker    // 死链检查，见WithLinkChecker
+	ctFilter    *mimeFilter     // 响应类型过滤，见WithContentTypeFilter
+	sitemap     *sitemapWriter  // 记录抓取成功的页面，见WithSitemap
+	errStatus   func(int) bool  // 作为响应错误的状态码，见WithHTTPStatusErrors
+	backoff     *hostBackoff    // 按host的退避，见WithHostBackoff
+	fingerprint FingerprintFunc // 去重使用的请求指纹，为nil时使用GetRequestHash，见WithRequestFingerprint
+	memGuard    *memoryGuard    // 内存保护，见WithMemoryGuard
+	items       *itemQueue      // 有界的Item队列，见WithItemQueue
+	slowTask    time.Duration   // 超过时输出警告的任务耗时，见WithSlowTaskWarning
+	dump        *debugDump      // 保存请求和响应报文，见WithDebugDump
+
+	fetcher          Fetcher         // 发送请求，为nil时使用goreq内置的客户端，见SetFetcher
+	hostFetch        sync.Map        // 指定host使用的Fetcher string -> Fetcher，见SetHostFetcher
+	transport        *http.Transport // 自定义的transport，见httpTransport
+	transportFetcher *HTTPFetcher    // useTransport设置的Fetcher
+	inflate          *inflateLimit   // 解压的限制，见WithDecompressionLimit
+
+	renderer       Fetcher          // 渲染页面的Fetcher，见WithRender
+	renderPatterns []*regexp.Regexp // 需要渲染的URL
+	streamPatterns []*regexp.Regexp // 需要流式解析HTML的URL，见WithHTMLStreaming
+
+	handlerLock sync.RWMutex
+	handlers    map[string]Handler      // 具名的处理方法，见RegisterHandler
+	itemTypes   map[string]reflect.Type // 具名的Item类型，见RegisterItemType
+
+	pauseLock sync.Mutex
+	pauseCh   chan struct{} // 暂停时非nil，恢复时关闭
+	holdCh    chan struct{} // 内部暂停(如WithMemoryGuard)时非nil，与Pause独立
+
+	stopOnce sync.Once
+	stopCh   chan struct{} // Stop时关闭
+
+	rootCtx    context.Context // 所有请求所属的context，Stop时取消，见Context
+	rootCancel context.CancelFunc
+
+	pipeLock  sync.Mutex
+	pipelines []ItemPipeline // 见AddPipeline，Wait返回前关闭
+
+	extLock   sync.Mutex
+	exts      []LifecycleExtension // 见AddExtension，Wait返回前关闭
+	extCtx    context.Context      // Wait开始时创建，传给ExtensionStarter
+	extCancel context.CancelFunc
 
-	onTaskHandlers      []func(ctx *Context, t *Task) *Task             // handler方法集合(func(ctx *Context, t *Task) *Task)
-	onRespHandlers      []Handler                                       // func(ctx *Context) 集合，  没有返回值
-	onItemHandlers      []func(ctx *Context, i interface{}) interface{} // 因为不知道Item的数据类型， 所以接收任意类型的数据， 并返回
-	onRecoverHandlers   []func(ctx *Context, err error)                 // 错误(panic)捕捉模式下的处理方法
-	onReqErrorHandlers  []func(ctx *Context, err error)                 // 请求错误后的处理方法
-	onRespErrorHandlers []func(ctx *Context, err error)                 // 响应错误后的处理方法
+	pendingLock sync.Mutex
+	pending     map[*pendingTask]struct{} // 尚未完成的任务，包括停止后放弃的任务，见Checkpoint
+	checkpoint  string                    // 停止后保存检查点的路径，见WithCheckpoint
+	signals     *signalHandler            // 见WithSignalHandler
 }
 
 // NewSpider 创建Spider的工厂类
@@ -69,8 +166,12 @@ func NewSpider(e ...interface{}) *Spider {
 		Logging: true,
 		Client:  goreq.NewClient(),
 		Status:  NewSpiderStatus(),
+		logger:  NewZerologLogger(log),
+		stopCh:  make(chan struct{}),
 	}
+	s.rootCtx, s.rootCancel = context.WithCancel(context.Background())
 	s.SetWaitGroup()
+	s.Client.Use(s.fetcherMiddleware)
 	s.Use(e...)
 	return s
 }
@@ -93,6 +194,9 @@ func (s *Spider) Use(exts ...interface{}) {
 		case Extension:
 			fn.(Extension)(s)
 			break
+		case LifecycleExtension:
+			s.useExtension(fn.(LifecycleExtension))
+			break
 		case goreq.Middleware, func(*goreq.Client, goreq.Handler) goreq.Handler:
 			s.Client.Use(fn.(goreq.Middleware))
 			break
@@ -102,17 +206,238 @@ func (s *Spider) Use(exts ...interface{}) {
 	}
 }
 
+// RegisterHandler 注册具名的处理方法，供控制接口等以名字引用
+func (s *Spider) RegisterHandler(name string, fn Handler) {
+	s.handlerLock.Lock()
+	defer s.handlerLock.Unlock()
+	if s.handlers == nil {
+		s.handlers = map[string]Handler{}
+	}
+	s.handlers[name] = fn
+}
+
+// GetHandler 获取具名的处理方法
+func (s *Spider) GetHandler(name string) (Handler, bool) {
+	s.handlerLock.RLock()
+	defer s.handlerLock.RUnlock()
+	fn, ok := s.handlers[name]
+	return fn, ok
+}
+
+// HandlerName 处理方法的名字，用于Status.HandlerStats：RegisterHandler注册的名字，
+// 没有注册时为函数名和定义的位置，如"main.main.func1 (main.go:42)"
+func (s *Spider) HandlerName(fn Handler) string {
+	if name, ok := s.handlerName(fn); ok {
+		return name
+	}
+	p := reflect.ValueOf(fn).Pointer()
+	f := runtime.FuncForPC(p)
+	if f == nil {
+		return fmt.Sprintf("%#x", p)
+	}
+	file, line := f.FileLine(p)
+	return fmt.Sprintf("%s (%s:%d)", f.Name(), filepath.Base(file), line)
+}
+
+// handlerName 查找已注册的处理方法的名字，按函数地址比较，同一个函数字面量创建的闭包无法区分
+func (s *Spider) handlerName(fn Handler) (string, bool) {
+	p := reflect.ValueOf(fn).Pointer()
+	s.handlerLock.RLock()
+	defer s.handlerLock.RUnlock()
+	for name, h := range s.handlers {
+		if reflect.ValueOf(h).Pointer() == p {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// Pause 暂停执行任务，暂停期间新加入和尚未开始的任务会等待Resume
+func (s *Spider) Pause() {
+	s.pauseLock.Lock()
+	defer s.pauseLock.Unlock()
+	if s.pauseCh == nil {
+		s.pauseCh = make(chan struct{})
+	}
+}
+
+// Resume 恢复执行任务
+func (s *Spider) Resume() {
+	s.pauseLock.Lock()
+	defer s.pauseLock.Unlock()
+	if s.pauseCh != nil {
+		close(s.pauseCh)
+		s.pauseCh = nil
+	}
+}
+
+// IsPaused 是否处于暂停状态
+func (s *Spider) IsPaused() bool {
+	s.pauseLock.Lock()
+	defer s.pauseLock.Unlock()
+	return s.pauseCh != nil
+}
+
+// waitResume 等待Pause和内部暂停都结束，爬虫停止时直接返回
+func (s *Spider) waitResume() {
+	for {
+		s.pauseLock.Lock()
+		ch := s.pauseCh
+		if ch == nil {
+			ch = s.holdCh
+		}
+		s.pauseLock.Unlock()
+		if ch == nil {
+			return
+		}
+		select {
+		case <-ch:
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// hold 内部暂停或恢复执行任务，不影响IsPaused
+func (s *Spider) hold(on bool) {
+	s.pauseLock.Lock()
+	defer s.pauseLock.Unlock()
+	if on && s.holdCh == nil {
+		s.holdCh = make(chan struct{})
+	} else if !on && s.holdCh != nil {
+		close(s.holdCh)
+		s.holdCh = nil
+	}
+}
+
+// Stop 中止爬虫，在GracefulStop的基础上取消根context(见Context)，正在进行的请求立即结束，这些任务同样被放弃，
+// 已经收到响应的任务和Item会继续处理完；GracefulStop之后仍然可以调用Stop中止正在进行的请求
+func (s *Spider) Stop() {
+	s.stop(true)
+}
+
+// GracefulStop 停止调度(包括Schedule注册的定时任务)，之后加入的任务和尚未开始执行的任务(如延时或暂停中的任务)会被放弃，正在进行的请求和处理会完成
+// 放弃的任务数记录在Status.AbandonedTask中，Wait返回时会输出；注册的ItemPipeline会被Flush，Wait返回前关闭ItemPipeline和LifecycleExtension
+func (s *Spider) GracefulStop() {
+	s.stop(false)
+}
+
+// stop 关闭stopCh停止调度，abort为true时同时取消根context
+func (s *Spider) stop(abort bool) {
+	first := false
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+		first = true
+	})
+	if abort {
+		s.rootCancel()
+	}
+	if first {
+		s.StopSchedule()
+		s.cancelExtensions()
+		s.writeLog(nil, LogInfo, "spider stopping", "spider", s.Name, "abort", abort)
+		s.flushPipelines()
+	}
+	s.Resume()
+}
+
+// Context 爬虫的根context，每个请求的context都派生自它，Stop时取消
+func (s *Spider) Context() context.Context {
+	return s.rootCtx
+}
+
+// WithContext 使用ctx作为根context的父context，ctx取消(如收到退出信号)时停止爬虫(见Stop)
+func WithContext(ctx context.Context) Extension {
+	return func(s *Spider) {
+		s.rootCancel()
+		s.rootCtx, s.rootCancel = context.WithCancel(ctx)
+		go func(done <-chan struct{}) {
+			<-done
+			s.Stop()
+		}(s.rootCtx.Done())
+	}
+}
+
+// fetch 发送请求，请求的context在根context取消时取消
+// 请求结束后不取消派生的context，重试的任务会复用同一个请求
+func (s *Spider) fetch(req *goreq.Request) *goreq.Response {
+	if req.Request == nil {
+		return s.Client.Do(req)
+	}
+	c, cancel := context.WithCancel(req.Context())
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-s.rootCtx.Done():
+			cancel()
+		case <-done:
+		}
+	}()
+	req.Request = req.WithContext(c)
+	return s.Client.Do(req)
+}
+
+// IsStopped 是否已经调用Stop或GracefulStop
+func (s *Spider) IsStopped() bool {
+	select {
+	case <-s.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
 func (s *Spider) Forever() {
 	select {}
 }
 
 // Wait 内置WaitGroup，调用wait方法
 func (s *Spider) Wait() {
-	s.wg.Wait()
+	s.startExtensions()
+	if s.taskQueue != nil {
+		s.taskQueue.start(s)
+	}
+	if s.syncTasks != nil {
+		s.syncTasks.run(s)
+	} else {
+		s.wg.Wait()
+	}
+	s.Status.stop()
+	if s.sitemap != nil {
+		if err := s.WriteSitemap(); err != nil {
+			s.writeLog(nil, LogError, "sitemap write error", "error", err, "spider", s.Name, "path", s.sitemap.path)
+		}
+	}
+	if s.IsStopped() {
+		s.writeLog(nil, LogInfo, "spider stopped", "spider", s.Name, "abandoned", atomic.LoadInt64(&s.Status.AbandonedTask))
+		if s.checkpoint != "" {
+			if err := s.Checkpoint(s.checkpoint); err != nil {
+				s.writeLog(nil, LogError, "checkpoint error", "error", err, "spider", s.Name, "path", s.checkpoint)
+			}
+		}
+	}
+	var err error
+	if s.IsStopped() {
+		err = s.closePipelines()
+	} else {
+		err = s.flushPipelines()
+	}
+	if ferr := s.flushExtensions(); err == nil {
+		err = ferr
+	}
+	if s.IsStopped() {
+		if cerr := s.closeExtensions(); err == nil {
+			err = cerr
+		}
+	}
+	if s.signals != nil {
+		s.signals.finish(s, err)
+	}
 }
 
-// 处理任务
-func (s *Spider) handleTask(t *Task) {
+// 处理任务，请求因Stop被取消时返回true，任务被放弃
+func (s *Spider) handleTask(t *Task) (abandoned bool) {
 	s.Status.FinishTask()
 	ctx := &Context{
 		s:     s,
@@ -120,50 +445,158 @@ func (s *Spider) handleTask(t *Task) {
 		Resp:  nil,
 		Meta:  t.Meta,
 		abort: false,
+		task:  t,
+	}
+	if s.slowTask > 0 {
+		ctx.timings = &taskTimings{start: time.Now()}
+		defer s.checkSlowTask(ctx)
 	}
+	// 在recover之后执行，处理方法中先Abort再panic时也会调用OnAbort
+	defer func() {
+		if ctx.IsAborted() {
+			s.handleOnAbort(ctx, ctx.abortReason)
+		}
+	}()
 	// 相当于 final， 错误捕捉 panic级别
 	defer func() {
 		// recover catch panic？,能让程序不退出继续执行
 		if err := recover(); err != nil {
-			if s.Logging {
-				log.Error().Err(fmt.Errorf("%v", err)).Str("spider", s.Name).Str("context", fmt.Sprint(ctx)).Str("stack", SprintStack()).Msg("handler recover from panic")
+			s.writeLog(ctx, LogError, "handler recover from panic", "error", fmt.Errorf("%v", err), "spider", s.Name, "context", fmt.Sprint(ctx), "stack", SprintStack())
+			e, ok := err.(error)
+			if !ok {
+				e = fmt.Errorf("%v", err)
 			}
-			if e, ok := err.(error); ok {
-				s.handleOnError(ctx, e)
-			} else {
-				s.handleOnError(ctx, fmt.Errorf("%v", err))
+			url := ""
+			if t.Req.URL != nil {
+				url = t.Req.URL.String()
 			}
+			s.Status.AddError(e, url)
+			s.handleOnError(ctx, e)
 		}
 	}()
+	defer s.tracing.startTask(ctx)()
 	if t.Req.Err != nil {
-		if s.Logging {
-			log.Error().Err(fmt.Errorf("%v", ctx.Req.Err)).Str("spider", s.Name).Str("context", fmt.Sprint(ctx)).Str("stack", SprintStack()).Msg("req error")
-		}
-		s.handleOnReqError(ctx, t.Req.Err)
+		s.writeLog(ctx, LogError, "req error", "error", ctx.Req.Err, "spider", s.Name, "context", fmt.Sprint(ctx), "stack", SprintStack())
+		s.Status.AddReqError()
+		s.Status.AddError(t.Req.Err, "")
+		s.handleOnReqError(ctx, classifyError(t.Req.Err))
+		return
+	}
+	if s.renderer != nil && t.Req.Method == http.MethodGet && s.shouldRender(t) {
+		params := RenderParams{}
+		params.Wait, _ = t.Meta[RenderWaitMetaKey].(string)
+		params.Script, _ = t.Meta[RenderScriptMetaKey].(string)
+		t.Req.Request = t.Req.WithContext(context.WithValue(t.Req.Context(), renderKey{}, params))
+	}
+	s.handleOnRequest(ctx, t.Req)
+	if ctx.IsAborted() {
 		return
 	}
-	ctx.Resp = s.Client.Do(t.Req)
+	endStream := s.streamTask(ctx, t)
+	endFetch, fetchStart := s.tracing.start(ctx, "fetch"), time.Now()
+	ctx.Resp = s.fetch(t.Req)
+	defer ClosePage(t.Req)
+	if s.dump != nil {
+		defer s.dump.write(s, ctx)
+	}
+	endFetch(ctx.Resp.Err)
+	fetchTime := time.Since(fetchStart)
+	if ctx.timings != nil {
+		ctx.timings.fetch = fetchTime
+	}
+	if ctx.Resp.Err != nil && s.IsStopped() && errors.Is(ctx.Resp.Err, context.Canceled) {
+		// 请求因Stop被取消，任务被放弃而不是失败
+		s.writeLog(ctx, LogInfo, "request canceled", "spider", s.Name, "context", fmt.Sprint(ctx))
+		s.Status.AddAbandonedTask()
+		return true
+	}
 	if ctx.Resp.Err != nil {
-		if s.Logging {
-			log.Error().Err(fmt.Errorf("%v", ctx.Resp.Err)).Str("spider", s.Name).Str("context", fmt.Sprint(ctx)).Str("stack", SprintStack()).Msg("resp error")
+		s.writeLog(ctx, LogError, "resp error", "error", ctx.Resp.Err, "spider", s.Name, "context", fmt.Sprint(ctx), "stack", SprintStack())
+		s.Status.AddRespError()
+		s.Status.AddError(ctx.Resp.Err, t.Req.URL.String())
+		s.handleOnRespError(ctx, classifyError(ctx.Resp.Err))
+		return
+	}
+	s.Status.AddFetchTime(t.Req.URL.String(), fetchTime)
+	s.Status.AddStatusCode(ctx.Resp.StatusCode)
+	if ctx.Resp.NotDecodedBody != nil {
+		s.Status.AddBytes(int64(len(ctx.Resp.NotDecodedBody)))
+	} else {
+		s.Status.AddBytes(int64(len(ctx.Resp.Body)))
+	}
+	if s.logEnabled(LogDebug) && s.logSampled() {
+		s.writeLog(ctx, LogDebug, "Finish", "spider", s.Name, "context", fmt.Sprint(ctx))
+	}
+	if s.revisit != nil && ctx.Resp.StatusCode == http.StatusNotModified {
+		s.handleOnNotModified(ctx)
+		return
+	}
+	if s.retryAfter != nil && s.retryAfter.handle(ctx, t) {
+		return
+	}
+	if len(s.onBlockedHandlers) > 0 || s.block != nil {
+		if vendor := DetectBlock(ctx.Resp); vendor != "" {
+			s.Status.AddBlockedHost(ctx.Req.URL.Host)
+			s.writeLog(ctx, LogWarn, "blocked", "spider", s.Name, "context", ctx.String(), "vendor", string(vendor))
+			s.handleOnBlocked(ctx, vendor)
+			if ctx.IsAborted() {
+				return
+			}
+			if s.block != nil && s.block.handle(ctx, t) {
+				return
+			}
 		}
-		s.handleOnRespError(ctx, ctx.Resp.Err)
+	}
+	if len(s.onCaptchaHandlers) > 0 || s.captcha != nil {
+		if c := DetectCaptcha(ctx.Resp); c != nil {
+			s.writeLog(ctx, LogWarn, "captcha detected", "spider", s.Name, "context", ctx.String(), "kind", string(c.Kind))
+			s.handleOnCaptcha(ctx, c)
+			if ctx.IsAborted() {
+				return
+			}
+			if s.captcha != nil && s.captcha.handle(ctx, t, c) {
+				return
+			}
+		}
+	}
+	if s.errStatus != nil && s.errStatus(ctx.Resp.StatusCode) {
+		err := &ErrHTTPStatus{Code: ctx.Resp.StatusCode, Status: ctx.Resp.Status, URL: ctx.Req.URL.String()}
+		s.writeLog(ctx, LogError, "resp error", "error", err, "spider", s.Name, "context", fmt.Sprint(ctx))
+		s.Status.AddRespError()
+		s.Status.AddError(err, err.URL)
+		s.handleOnRespError(ctx, err)
 		return
 	}
-	if s.Logging {
-		log.Debug().Str("Spider", s.Name).Str("context", fmt.Sprint(ctx)).Msg("Finish")
-
+	if endStream != nil {
+		endStream()
+		if ctx.IsAborted() {
+			return
+		}
 	}
 	s.handleOnResp(ctx)
 	if ctx.IsAborted() {
 		return
 	}
-	for _, fn := range t.Handlers {
-		fn(ctx) // 执行传入的处理方法
+	for i, fn := range t.Handlers {
+		name := s.HandlerName(fn)
+		s.tracing.do(ctx, "handler", i, func() {
+			start, done := time.Now(), false
+			defer func() {
+				d := time.Since(start)
+				s.Status.AddHandlerCall(name, d, !done)
+				if ctx.timings != nil {
+					ctx.timings.handlers = append(ctx.timings.handlers, handlerTiming{name, d})
+				}
+			}()
+			fn(ctx) // 执行传入的处理方法
+			done = true
+		})
 		if ctx.IsAborted() {
 			return
 		}
 	}
+	s.handleOnScraped(ctx)
+	return
 }
 
 // SeedTask  种子任务
@@ -179,16 +612,107 @@ func (s *Spider) SeedTask(req *goreq.Request, h ...Handler) {
 	ctx.AddTask(req, h...)
 }
 
+// AddTask 加入一个构造好的任务(如NewGraphQLTask)，与SeedTask一样经过OnTask，任务的Meta作为其Context的Meta
+func (s *Spider) AddTask(t *Task) {
+	if t.Meta == nil {
+		t.Meta = map[string]interface{}{}
+	}
+	ctx := &Context{
+		s:    s,
+		Meta: t.Meta,
+	}
+	if t = s.handleOnTask(ctx, t); t == nil {
+		return
+	}
+	s.addTask(t)
+}
+
+// retryTask 用req重新加入任务t，保留处理方法和深度，不经过OnTask
+// req发送时计为一次重试(见SpiderStatus.Retries)，与t.Req不同时(如提交验证码的请求)同样计数
+func (s *Spider) retryTask(t *Task, req *goreq.Request, meta map[string]interface{}, notBefore time.Time) {
+	markSent(req)
+	nt := NewTask(req, meta, t.Handlers...)
+	nt.NotBefore = notBefore
+	nt.Depth = t.Depth
+	s.addTask(nt)
+}
+
 func (s *Spider) addTask(t *Task) {
+	if s.IsStopped() {
+		s.Status.AddAbandonedTask()
+		s.trackTask(&pendingTask{t: t, abandoned: true})
+		return
+	}
+	if s.memGuard != nil && s.memGuard.spill(t) {
+		return
+	}
+	s.Status.AddTask()
+	if t.Req.Request != nil {
+		s.Status.AddHostTask(t.Req.URL.Host)
+	}
+	p := s.trackTask(&pendingTask{t: t, counted: true})
+	if s.syncTasks != nil {
+		s.syncTasks.push(p)
+		return
+	}
 	s.wg.Add(1)
 	go func() {
 		defer s.wg.Done()
-		s.handleTask(t)
+		s.runTask(p)
 	}()
-	s.Status.AddTask()
+}
+
+// runTask 等待任务的开始时间和暂停结束后执行任务，爬虫已停止时放弃任务，返回任务是否被放弃
+func (s *Spider) runTask(p *pendingTask) (abandoned bool) {
+	t := p.t
+	if d := time.Until(t.NotBefore); d > 0 {
+		timer := time.NewTimer(d)
+		select {
+		case <-timer.C:
+		case <-s.stopCh:
+			timer.Stop()
+		}
+	}
+	s.waitResume()
+	if s.IsStopped() {
+		s.Status.abandonPending()
+		s.abandonTask(p)
+		return true
+	}
+	host := ""
+	if t.Req.Request != nil {
+		host = t.Req.URL.Host
+	}
+	release, ok := s.limit.acquire(host, s.stopCh)
+	if !ok {
+		s.Status.abandonPending()
+		s.abandonTask(p)
+		return true
+	}
+	defer release()
+	s.startTask(p)
+	if s.handleTask(t) {
+		s.abandonTask(p)
+		return true
+	}
+	s.untrackTask(p)
+	return false
 }
 
 func (s *Spider) addItem(i *Item) {
+	if s.syncTasks != nil {
+		s.Status.AddItem()
+		s.handleOnItem(i)
+		return
+	}
+	if s.items != nil {
+		if !s.items.push(s, i) {
+			s.handleOnItemShed(i)
+			return
+		}
+		s.Status.AddItem()
+		return
+	}
 	s.wg.Add(1)
 	go func() {
 		defer s.wg.Done()
@@ -198,34 +722,37 @@ func (s *Spider) addItem(i *Item) {
 }
 
 // OnTask 任务
-// 将要在任务中的执行的方法添加到onTaskHandlers中， 仅接收func(ctx *Context, t *Task) * Task的类型
+// 将要在任务中的执行的方法添加到onTaskHooks中， 仅接收func(ctx *Context, t *Task) * Task的类型
+// 返回的HookID可以用于RemoveHook，需要控制顺序时使用OnTaskWithPriority
 /*************************************************************************************/
-func (s *Spider) OnTask(fn func(ctx *Context, t *Task) *Task) {
-	s.onTaskHandlers = append(s.onTaskHandlers, fn)
+func (s *Spider) OnTask(fn func(ctx *Context, t *Task) *Task) HookID {
+	return s.OnTaskWithPriority(0, fn)
 }
 
-// 执行onTaskHandlers中的方法
+// 执行onTaskHooks中的方法
 func (s *Spider) handleOnTask(ctx *Context, t *Task) *Task {
-	for _, fn := range s.onTaskHandlers {
-		t = fn(ctx, t)
-		if t == nil {
-			return t
+	for _, h := range s.onTaskHooks.list() {
+		next := h.fn.(func(ctx *Context, t *Task) *Task)(ctx, t)
+		if next == nil {
+			s.skipTask(ctx, t)
+			return nil
 		}
+		t = next
 	}
 	return t
 }
 
 // OnResp 响应处理方法
 /*************************************************************************************/
-func (s *Spider) OnResp(fn Handler) {
-	s.onRespHandlers = append(s.onRespHandlers, fn)
+func (s *Spider) OnResp(fn Handler) HookID {
+	return s.OnRespWithPriority(0, fn)
 }
 
 // OnHTML html文件处理
-func (s *Spider) OnHTML(selector string, fn func(ctx *Context, sel *goquery.Selection)) {
-	s.OnResp(func(ctx *Context) {
+func (s *Spider) OnHTML(selector string, fn func(ctx *Context, sel *goquery.Selection)) HookID {
+	return s.OnResp(func(ctx *Context) {
 		if ctx.Resp.IsHTML() {
-			if h, err := ctx.Resp.HTML(); err == nil {
+			if h, err := ctx.HTML(); err == nil {
 				h.Find(selector).Each(func(i int, selection *goquery.Selection) {
 					fn(ctx, selection)
 				})
@@ -235,10 +762,10 @@ func (s *Spider) OnHTML(selector string, fn func(ctx *Context, sel *goquery.Sele
 }
 
 // OnJSON json文件处理
-func (s *Spider) OnJSON(q string, fn func(ctx *Context, j gjson.Result)) {
-	s.onRespHandlers = append(s.onRespHandlers, func(ctx *Context) {
+func (s *Spider) OnJSON(q string, fn func(ctx *Context, j gjson.Result)) HookID {
+	return s.OnResp(func(ctx *Context) {
 		if ctx.Resp.IsJSON() {
-			if j, err := ctx.Resp.JSON(); err == nil {
+			if j, err := ctx.JSON(); err == nil {
 				if res := j.Get(q); res.Exists() {
 					fn(ctx, res)
 				}
@@ -247,34 +774,39 @@ func (s *Spider) OnJSON(q string, fn func(ctx *Context, j gjson.Result)) {
 	})
 }
 func (s *Spider) handleOnResp(ctx *Context) {
-	for _, fn := range s.onRespHandlers {
+	for i, h := range s.onRespHooks.list() {
 		if ctx.IsAborted() {
 			return
 		}
-		fn(ctx)
+		fn := h.fn.(Handler)
+		s.tracing.do(ctx, "OnResp", i, func() {
+			fn(ctx)
+		})
 	}
 }
 
 // OnItem 处理
 /*************************************************************************************/
-func (s *Spider) OnItem(fn func(ctx *Context, i interface{}) interface{}) {
-	s.onItemHandlers = append(s.onItemHandlers, fn)
+func (s *Spider) OnItem(fn func(ctx *Context, i interface{}) interface{}) HookID {
+	return s.OnItemWithPriority(0, fn)
 }
 func (s *Spider) handleOnItem(i *Item) {
 	defer func() {
 		if err := recover(); err != nil {
-			if s.Logging {
-				log.Error().Err(fmt.Errorf("%v", err)).Str("spider", s.Name).Str("context", fmt.Sprint(i.Ctx)).Str("stack", SprintStack()).Msg("OnItem recover from panic")
-			}
-			if e, ok := err.(error); ok {
-				s.handleOnError(i.Ctx, e)
-			} else {
-				s.handleOnError(i.Ctx, fmt.Errorf("%v", err))
+			s.writeLog(i.Ctx, LogError, "OnItem recover from panic", "error", fmt.Errorf("%v", err), "spider", s.Name, "context", fmt.Sprint(i.Ctx), "stack", SprintStack())
+			e, ok := err.(error)
+			if !ok {
+				e = fmt.Errorf("%v", err)
 			}
+			s.pushDeadLetter(DeadLetterItem, i.Ctx, i.Data, e)
+			s.handleOnError(i.Ctx, e)
 		}
 	}()
-	for _, fn := range s.onItemHandlers {
-		i.Data = fn(i.Ctx, i.Data)
+	for idx, h := range s.onItemHooks.list() {
+		fn := h.fn.(func(ctx *Context, i interface{}) interface{})
+		s.tracing.do(i.Ctx, "OnItem", idx, func() {
+			i.Data = fn(i.Ctx, i.Data)
+		})
 		if i.Data == nil {
 			return
 		}
@@ -306,3 +838,140 @@ func (s *Spider) handleOnReqError(ctx *Context, err error) {
 		fn(ctx, err)
 	}
 }
+
+// OnLog 框架输出任务相关的日志前调用，可以向日志追加自定义字段(如租户、任务批次、URL分类)
+// 只对属于某个任务的日志调用，日志被级别或采样过滤时不会调用
+func (s *Spider) OnLog(fn func(ctx *Context, e *LogEvent)) {
+	s.onLogHandlers = append(s.onLogHandlers, fn)
+}
+func (s *Spider) handleOnLog(ctx *Context, e *LogEvent) {
+	for _, fn := range s.onLogHandlers {
+		fn(ctx, e)
+	}
+}
+
+// OnNotModified 使用WithRevisit时，重访的页面未修改(服务器返回304)时调用，此时不会执行OnResp和任务的处理方法
+func (s *Spider) OnNotModified(fn Handler) {
+	s.onNotModifiedHandlers = append(s.onNotModifiedHandlers, fn)
+}
+func (s *Spider) handleOnNotModified(ctx *Context) {
+	for _, fn := range s.onNotModifiedHandlers {
+		if ctx.IsAborted() {
+			return
+		}
+		fn(ctx)
+	}
+}
+
+// OnRetryAfter 使用WithRetryAfter时，响应为429或503且带有Retry-After，任务将在delay之后重试时调用
+// 此时不会执行OnResp和任务的处理方法
+func (s *Spider) OnRetryAfter(fn func(ctx *Context, delay time.Duration)) {
+	s.onRetryAfterHandlers = append(s.onRetryAfterHandlers, fn)
+}
+func (s *Spider) handleOnRetryAfter(ctx *Context, delay time.Duration) {
+	for _, fn := range s.onRetryAfterHandlers {
+		fn(ctx, delay)
+	}
+}
+
+// OnCaptcha 响应被识别为验证码页面时调用(见DetectCaptcha)，在WithCaptchaSolver解决之前
+// 注册后才会检测验证码；在其中Abort可以跳过解决和后续的处理
+func (s *Spider) OnCaptcha(fn func(ctx *Context, c *Captcha)) {
+	s.onCaptchaHandlers = append(s.onCaptchaHandlers, fn)
+}
+func (s *Spider) handleOnCaptcha(ctx *Context, c *Captcha) {
+	for _, fn := range s.onCaptchaHandlers {
+		fn(ctx, c)
+	}
+}
+
+// OnBlocked 响应被识别为反爬服务的挑战页面时调用(见DetectBlock)，vendor为服务商
+// 注册后才会检测；在其中Abort可以跳过后续的处理
+func (s *Spider) OnBlocked(fn func(ctx *Context, vendor BlockVendor)) {
+	s.onBlockedHandlers = append(s.onBlockedHandlers, fn)
+}
+func (s *Spider) handleOnBlocked(ctx *Context, vendor BlockVendor) {
+	for _, fn := range s.onBlockedHandlers {
+		fn(ctx, vendor)
+	}
+}
+
+// OnRequest 发送请求前调用(在OnTask之后，经过goreq中间件之前)，可以在这里最后修改请求头或记录请求
+// 每次执行任务(包括重试)都会调用；在其中Abort时不发送请求，任务结束
+func (s *Spider) OnRequest(fn func(ctx *Context, req *goreq.Request)) {
+	s.onRequestHandlers = append(s.onRequestHandlers, fn)
+}
+func (s *Spider) handleOnRequest(ctx *Context, req *goreq.Request) {
+	for i, fn := range s.onRequestHandlers {
+		if ctx.IsAborted() {
+			return
+		}
+		s.tracing.do(ctx, "OnRequest", i, func() {
+			fn(ctx, req)
+		})
+	}
+}
+
+// OnScraped 任务的处理方法全部执行完且没有Abort后执行，用于标记完成、统计等不需要加入每个任务的处理方法中的逻辑
+func (s *Spider) OnScraped(fn Handler) {
+	s.onScrapedHandlers = append(s.onScrapedHandlers, fn)
+}
+func (s *Spider) handleOnScraped(ctx *Context) {
+	for i, fn := range s.onScrapedHandlers {
+		if ctx.IsAborted() {
+			return
+		}
+		s.tracing.do(ctx, "OnScraped", i, func() {
+			fn(ctx)
+		})
+	}
+}
+
+// OnAbort 任务的处理被Abort中断后执行，reason为AbortWithReason给出的原因，使用Abort时为空
+func (s *Spider) OnAbort(fn func(ctx *Context, reason string)) {
+	s.onAbortHandlers = append(s.onAbortHandlers, fn)
+}
+func (s *Spider) handleOnAbort(ctx *Context, reason string) {
+	if s.logEnabled(LogDebug) {
+		s.writeLog(ctx, LogDebug, "aborted", "spider", s.Name, "context", ctx.String(), "reason", reason)
+	}
+	for _, fn := range s.onAbortHandlers {
+		fn(ctx, reason)
+	}
+}
+
+// OnDuplicate 页面与已爬取的页面近似重复时调用(见WithNearDuplicateDetection)，of为重复的页面的URL
+// 在其中Abort可以跳过后续的处理
+func (s *Spider) OnDuplicate(fn func(ctx *Context, of string)) {
+	s.onDuplicateHandlers = append(s.onDuplicateHandlers, fn)
+}
+func (s *Spider) handleOnDuplicate(ctx *Context, of string) {
+	for _, fn := range s.onDuplicateHandlers {
+		fn(ctx, of)
+	}
+}
+
+// OnItemShed Item队列已满，Item被丢弃时调用，见WithItemQueue
+func (s *Spider) OnItemShed(fn func(ctx *Context, i interface{})) {
+	s.onItemShedHandlers = append(s.onItemShedHandlers, fn)
+}
+func (s *Spider) handleOnItemShed(i *Item) {
+	s.writeLog(i.Ctx, LogWarn, "item queue full, item dropped", "spider", s.Name)
+	for _, fn := range s.onItemShedHandlers {
+		fn(i.Ctx, i.Data)
+	}
+}
+
+// OnSkip 任务被OnTask丢弃(去重、robots、深度、域名、数量限制等)时调用，reason为丢弃的原因，见Task.Skip
+// ctx为加入任务的Context，SeedTask等没有来源任务时ctx.Req为nil
+func (s *Spider) OnSkip(fn func(ctx *Context, t *Task, reason SkipReason)) {
+	s.onSkipHandlers = append(s.onSkipHandlers, fn)
+}
+func (s *Spider) handleOnSkip(ctx *Context, t *Task, reason SkipReason) {
+	if s.logEnabled(LogDebug) {
+		s.writeLog(ctx, LogDebug, "task skipped", "spider", s.Name, "url", t.Req.URL.String(), "reason", reason)
+	}
+	for _, fn := range s.onSkipHandlers {
+		fn(ctx, t, reason)
+	}
+}
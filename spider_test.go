@@ -7,7 +7,9 @@ import (
 	"github.com/zhshch2002/goreq"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewSpider(t *testing.T) {
@@ -78,6 +80,37 @@ func TestContext_Abort(t *testing.T) {
 	s.Wait()
 }
 
+func TestContext_AddTaskAfter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+
+	s := NewSpider()
+	s.Logging = false
+	lock := sync.Mutex{}
+	var order []string
+	var start, delayed time.Time
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		start = time.Now()
+		ctx.AddTaskAfter(300*time.Millisecond, goreq.Get(ts.URL+"/delayed"), func(ctx *Context) {
+			lock.Lock()
+			defer lock.Unlock()
+			delayed = time.Now()
+			order = append(order, "delayed")
+		})
+		ctx.AddTask(goreq.Get(ts.URL+"/now"), func(ctx *Context) {
+			lock.Lock()
+			defer lock.Unlock()
+			order = append(order, "now")
+		})
+	})
+	s.Wait()
+
+	assert.Equal(t, []string{"now", "delayed"}, order)
+	assert.True(t, delayed.Sub(start) >= 300*time.Millisecond)
+}
+
 func TestSpiderManyTask(t *testing.T) {
 	s := NewSpider()
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -119,3 +152,106 @@ func BenchmarkGoreq(b *testing.B) {
 		goreq.Get(ts.URL).Do()
 	}
 }
+
+func TestSpider_OnScraped(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	s := NewSpider(WithSynchronousMode())
+	s.Logging = false
+	var events []string
+	s.OnScraped(func(ctx *Context) {
+		events = append(events, "scraped "+ctx.Req.URL.Path)
+	})
+	s.SeedTask(goreq.Get(ts.URL+"/ok"), func(ctx *Context) {
+		events = append(events, "first")
+	}, func(ctx *Context) {
+		events = append(events, "second")
+	})
+	s.SeedTask(goreq.Get(ts.URL+"/abort"), func(ctx *Context) {
+		ctx.Abort()
+	})
+	s.SeedTask(goreq.Get(ts.URL+"/panic"), func(ctx *Context) {
+		panic("boom")
+	})
+	s.SeedTask(goreq.Get("http://127.0.0.1:0/error"), func(ctx *Context) {
+		events = append(events, "error handler")
+	})
+	s.Wait()
+
+	assert.Equal(t, []string{"first", "second", "scraped /ok"}, events)
+}
+
+func TestSpider_OnAbort(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	s := NewSpider(WithSynchronousMode())
+	s.Logging = false
+	var events []string
+	s.OnAbort(func(ctx *Context, reason string) {
+		events = append(events, fmt.Sprintf("abort %s %q", ctx.Req.URL.Path, reason))
+	})
+	s.OnResp(func(ctx *Context) {
+		if ctx.Req.URL.Path == "/wall" {
+			ctx.AbortWithReason("login wall")
+		}
+	})
+	s.SeedTask(goreq.Get(ts.URL+"/wall"), func(ctx *Context) {
+		events = append(events, "handler /wall")
+	})
+	s.SeedTask(goreq.Get(ts.URL+"/plain"), func(ctx *Context) {
+		ctx.Abort()
+		assert.Equal(t, "", ctx.AbortReason())
+	}, func(ctx *Context) {
+		events = append(events, "handler /plain")
+	})
+	s.SeedTask(goreq.Get(ts.URL+"/panic"), func(ctx *Context) {
+		ctx.AbortWithReason("bad page")
+		panic("boom")
+	})
+	s.SeedTask(goreq.Get(ts.URL + "/ok"))
+	s.Wait()
+
+	assert.Equal(t, []string{
+		`abort /wall "login wall"`,
+		`abort /plain ""`,
+		`abort /panic "bad page"`,
+	}, events)
+}
+
+func TestSpider_OnRequest(t *testing.T) {
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path+" "+r.Header.Get("X-Token"))
+	}))
+	defer ts.Close()
+
+	s := NewSpider(WithSynchronousMode())
+	s.Logging = false
+	var events []string
+	s.OnTask(func(ctx *Context, t *Task) *Task {
+		t.Req.Header.Set("X-Token", "task")
+		return t
+	})
+	s.OnRequest(func(ctx *Context, req *goreq.Request) {
+		events = append(events, "request "+req.URL.Path)
+		req.Header.Set("X-Token", req.Header.Get("X-Token")+"+request")
+		if req.URL.Path == "/skip" {
+			ctx.AbortWithReason("skipped")
+		}
+	})
+	s.OnAbort(func(ctx *Context, reason string) {
+		events = append(events, "abort "+reason)
+	})
+	s.SeedTask(goreq.Get(ts.URL+"/a"), func(ctx *Context) {
+		events = append(events, "handler /a")
+	})
+	s.SeedTask(goreq.Get(ts.URL+"/skip"), func(ctx *Context) {
+		events = append(events, "handler /skip")
+	})
+	s.Wait()
+
+	assert.Equal(t, []string{"request /a", "handler /a", "request /skip", "abort skipped"}, events)
+	assert.Equal(t, []string{"/a task+request"}, paths)
+}
@@ -0,0 +1,114 @@
+package gospider
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zhshch2002/goreq"
+)
+
+// statsd 通过UDP发送StatsD格式的指标，发送失败或连接已关闭时直接丢弃
+type statsd struct {
+	addr   string
+	prefix string
+
+	lock sync.Mutex
+	conn net.Conn
+}
+
+// Init 连接addr并注册发送指标的回调
+func (c *statsd) Init(s *Spider) error {
+	conn, err := net.Dial("udp", c.addr)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.hook(s)
+	return nil
+}
+
+// Close 关闭连接，之后的指标被丢弃
+func (c *statsd) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+func (c *statsd) send(name, value, kind string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.conn == nil {
+		return
+	}
+	_, _ = fmt.Fprintf(c.conn, "%s%s:%s|%s", c.prefix, name, value, kind)
+}
+
+func (c *statsd) count(name string, n int64) {
+	c.send(name, strconv.FormatInt(n, 10), "c")
+}
+
+func (c *statsd) timing(name string, d time.Duration) {
+	c.send(name, strconv.FormatInt(d.Milliseconds(), 10), "ms")
+}
+
+// WithStatsd 以StatsD格式通过UDP发送指标到addr，指标名以prefix开头，Spider.Close时关闭连接
+//
+//	task                    新任务数(经过在此之前注册的OnTask)
+//	item                    Item数(经过在此之前注册的OnItem)
+//	request                 请求数
+//	request.duration        请求耗时(ms)
+//	response.<code>         各状态码的响应数
+//	error.request           请求失败数(没有得到响应)
+//	error.req/error.resp    OnReqError/OnRespError的次数
+//	error.panic             处理方法panic的次数
+func WithStatsd(addr, prefix string) Extension {
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	return func(s *Spider) {
+		s.useExtension(&statsd{addr: addr, prefix: prefix})
+	}
+}
+
+func (c *statsd) hook(s *Spider) {
+	s.Client.Use(func(x *goreq.Client, h goreq.Handler) goreq.Handler {
+		return func(req *goreq.Request) *goreq.Response {
+			start := time.Now()
+			resp := h(req)
+			c.count("request", 1)
+			c.timing("request.duration", time.Since(start))
+			if resp == nil || resp.Err != nil || resp.Response == nil {
+				c.count("error.request", 1)
+			} else {
+				c.count("response."+strconv.Itoa(resp.StatusCode), 1)
+			}
+			return resp
+		}
+	})
+	s.OnTask(func(ctx *Context, t *Task) *Task {
+		c.count("task", 1)
+		return t
+	})
+	s.OnItem(func(ctx *Context, i interface{}) interface{} {
+		c.count("item", 1)
+		return i
+	})
+	s.OnReqError(func(ctx *Context, err error) {
+		c.count("error.req", 1)
+	})
+	s.OnRespError(func(ctx *Context, err error) {
+		c.count("error.resp", 1)
+	})
+	s.OnRecover(func(ctx *Context, err error) {
+		c.count("error.panic", 1)
+	})
+}
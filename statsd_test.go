@@ -0,0 +1,66 @@
+package gospider
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithStatsd(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer pc.Close()
+
+	s := NewSpider(WithStatsd(pc.LocalAddr().String(), "crawl"))
+	s.Logging = false
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		ctx.AddItem("item")
+	})
+	s.Wait()
+
+	want := map[string]bool{
+		"crawl.task:1|c":         false,
+		"crawl.item:1|c":         false,
+		"crawl.request:1|c":      false,
+		"crawl.response.200:1|c": false,
+	}
+	duration := false
+	buf := make([]byte, 1024)
+	_ = pc.SetReadDeadline(time.Now().Add(time.Second))
+	for i := 0; i < 5; i++ {
+		n, _, err := pc.ReadFrom(buf)
+		if !assert.NoError(t, err) {
+			break
+		}
+		m := string(buf[:n])
+		if _, ok := want[m]; ok {
+			want[m] = true
+		}
+		if strings.HasPrefix(m, "crawl.request.duration:") && strings.HasSuffix(m, "|ms") {
+			duration = true
+		}
+	}
+	for m, got := range want {
+		assert.True(t, got, m)
+	}
+	assert.True(t, duration)
+	assert.NoError(t, s.Close())
+	assert.Empty(t, s.Extensions())
+
+	// 关闭后的指标被丢弃
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {})
+	s.Wait()
+	_ = pc.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, _, err = pc.ReadFrom(buf)
+	assert.Error(t, err)
+}
@@ -1,55 +1,519 @@
 package gospider
 
 import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
 // SpiderStatus 爬虫状态
+// 字段由原子操作更新，爬虫运行中读取请使用Snapshot
 type SpiderStatus struct { //  TODO
 	TotalTask    int64 // task总数
 	FinishedTask int64 // 已完成的任务数
 	TotalItem    int64 // Item的总数
 	ExecSpeed    int64 // 执行数据
 	itemSpeed    int64
+
+	BytesDownloaded int64 // 下载的响应体字节数
+	ReqErrors       int64 // 请求错误数
+	RespErrors      int64 // 响应错误数
+	Retries         int64 // 重试次数，同一个请求每次再次发送计一次(如goreq.WithRetry重试、WithRetryAfter重新加入的任务)
+	AbandonedTask   int64 // 爬虫停止后放弃的任务数
+
+	statusCodes sync.Map // 各状态码的响应数 int -> *int64
+	hostTasks   sync.Map // 各host的任务数 string -> *int64
+	blocked     sync.Map // 各host被反爬拦截的次数 string -> *int64
+	skipped     sync.Map // 各原因被OnTask丢弃的任务数 SkipReason -> *int64
+	handlers    sync.Map // 各处理方法的执行统计 string -> *handlerCounter
+	errors      sync.Map // 各错误的次数 string -> *errorCounter
+	errorKinds  int64    // errors中不同错误的数量
+	pending     int64    // 已加入但尚未开始执行也未被放弃的任务数
+
+	slowLock sync.Mutex
+	slowest  []URLTiming // 请求耗时最长的URL，按耗时从长到短
+
+	running   int32
+	lock      sync.Mutex
+	stopCh    chan struct{} // 速度统计运行时非nil
+	startTime time.Time
+	endTime   time.Time
+	execRate  float64 // 最近一个统计周期的任务速度(个/秒)
+	itemRate  float64 // 最近一个统计周期的Item速度(个/秒)
+	rateValid bool
 }
 
+// statusInterval 速度统计的周期
+const statusInterval = 5 * time.Second
+
 // NewSpiderStatus 爬虫状态初始化函数
 func NewSpiderStatus() *SpiderStatus {
-	s := &SpiderStatus{}
-	lastFinish := int64(0)
-	lastItem := int64(0)
-	go func() {
-		for true {
-			s.ExecSpeed = (s.FinishedTask - lastFinish) / 5
-			s.itemSpeed = (s.TotalItem - lastItem) / 5
-			lastFinish = s.FinishedTask
-			lastItem = s.TotalItem
-			time.Sleep(5 * time.Second)
+	return &SpiderStatus{}
+}
+
+// start 开始速度统计，在加入任务时自动调用
+func (s *SpiderStatus) start() {
+	if atomic.LoadInt32(&s.running) == 1 {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stopCh != nil {
+		return
+	}
+	if s.startTime.IsZero() {
+		s.startTime = time.Now()
+	}
+	s.endTime = time.Time{}
+	s.stopCh = make(chan struct{})
+	atomic.StoreInt32(&s.running, 1)
+	go s.loop(s.stopCh)
+}
+
+// stop 停止速度统计，在爬虫的任务全部完成时调用
+func (s *SpiderStatus) stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stopCh != nil {
+		close(s.stopCh)
+		s.stopCh = nil
+		s.endTime = time.Now()
+		atomic.StoreInt32(&s.running, 0)
+	}
+}
+
+func (s *SpiderStatus) loop(stop chan struct{}) {
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+	lastFinish := atomic.LoadInt64(&s.FinishedTask)
+	lastItem := atomic.LoadInt64(&s.TotalItem)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
 		}
-	}()
-	return s
+		finish := atomic.LoadInt64(&s.FinishedTask)
+		item := atomic.LoadInt64(&s.TotalItem)
+		sec := statusInterval.Seconds()
+		s.lock.Lock()
+		s.execRate = float64(finish-lastFinish) / sec
+		s.itemRate = float64(item-lastItem) / sec
+		s.rateValid = true
+		s.lock.Unlock()
+		atomic.StoreInt64(&s.ExecSpeed, int64(s.execRate))
+		atomic.StoreInt64(&s.itemSpeed, int64(s.itemRate))
+		lastFinish = finish
+		lastItem = item
+	}
+}
+
+// StatusSnapshot 某一时刻爬虫状态的副本，可以安全地读取
+type StatusSnapshot struct {
+	Time    time.Time     // 快照的时间
+	Elapsed time.Duration // 从第一个任务加入开始经过的时间
+
+	TotalTask    int64
+	FinishedTask int64
+	PendingTask  int64 // 已加入但尚未开始执行(也未被放弃)的任务数
+	TotalItem    int64
+
+	BytesDownloaded int64
+	ReqErrors       int64
+	RespErrors      int64
+	Retries         int64
+	AbandonedTask   int64
+	StatusCodes     map[int]int64
+	HostTasks       map[string]int64
+	BlockedHosts    map[string]int64
+	SkippedTasks    map[SkipReason]int64
+	Handlers        map[string]HandlerStats // 各处理方法的执行统计，见SpiderStatus.HandlerStats
+
+	ExecRate float64       // 任务速度(个/秒)
+	ItemRate float64       // Item速度(个/秒)
+	Progress float64       // 进度，已完成的任务数占已加入的任务数的比例，0~1
+	ETA      time.Duration // 按当前任务速度完成已加入的任务预计还需的时间，速度为0时为0
+}
+
+// Snapshot 返回当前状态的副本
+// 速度为最近一个统计周期内的速度，尚未完成一个周期时为开始以来的平均速度
+func (s *SpiderStatus) Snapshot() StatusSnapshot {
+	now := time.Now()
+	ss := StatusSnapshot{
+		Time:            now,
+		TotalTask:       atomic.LoadInt64(&s.TotalTask),
+		FinishedTask:    atomic.LoadInt64(&s.FinishedTask),
+		TotalItem:       atomic.LoadInt64(&s.TotalItem),
+		BytesDownloaded: atomic.LoadInt64(&s.BytesDownloaded),
+		ReqErrors:       atomic.LoadInt64(&s.ReqErrors),
+		RespErrors:      atomic.LoadInt64(&s.RespErrors),
+		Retries:         atomic.LoadInt64(&s.Retries),
+		AbandonedTask:   atomic.LoadInt64(&s.AbandonedTask),
+		StatusCodes:     s.StatusCodes(),
+		HostTasks:       s.HostTasks(),
+		BlockedHosts:    s.BlockedHosts(),
+		SkippedTasks:    s.SkippedTasks(),
+		Handlers:        s.HandlerStats(),
+	}
+	ss.PendingTask = atomic.LoadInt64(&s.pending)
+	if ss.PendingTask < 0 {
+		ss.PendingTask = 0
+	}
+
+	s.lock.Lock()
+	if !s.startTime.IsZero() {
+		ss.Elapsed = now.Sub(s.startTime)
+	}
+	if s.rateValid {
+		ss.ExecRate = s.execRate
+		ss.ItemRate = s.itemRate
+	} else if sec := ss.Elapsed.Seconds(); sec > 0 {
+		ss.ExecRate = float64(ss.FinishedTask) / sec
+		ss.ItemRate = float64(ss.TotalItem) / sec
+	}
+	s.lock.Unlock()
+
+	ss.Progress = progress(ss.FinishedTask, ss.TotalTask)
+	if ss.ExecRate > 0 {
+		ss.ETA = time.Duration(float64(ss.PendingTask) / ss.ExecRate * float64(time.Second))
+	}
+	return ss
+}
+
+// ETA 按当前任务速度完成已加入的任务预计还需的时间，无法估计时为0
+// 爬取过程中任务会不断加入，ETA只反映已知的任务
+func (s *SpiderStatus) ETA() time.Duration {
+	return s.Snapshot().ETA
+}
+
+// Progress 已完成的任务数占已加入的任务数的比例，0~1
+func (s *SpiderStatus) Progress() float64 {
+	return progress(atomic.LoadInt64(&s.FinishedTask), atomic.LoadInt64(&s.TotalTask))
+}
+
+func progress(finished, total int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(finished) / float64(total)
 }
 
 // AddTask 增加task， 并记录在内存中
 func (s *SpiderStatus) AddTask() {
+	s.start()
 	atomic.AddInt64(&s.TotalTask, 1)
+	atomic.AddInt64(&s.pending, 1)
 }
 
 // AddItem 新增 Item
 func (s *SpiderStatus) AddItem() {
-	atomic.AddInt64(&s.TotalTask, 1)
+	atomic.AddInt64(&s.TotalItem, 1)
 }
 
-// FinishTask 新增完成任务
+// FinishTask 新增完成任务，任务开始执行时调用
 func (s *SpiderStatus) FinishTask() {
 	atomic.AddInt64(&s.FinishedTask, 1)
+	atomic.AddInt64(&s.pending, -1)
 }
 
 // PrintSignalLine 打印爬虫
 func (s *SpiderStatus) PrintSignalLine(name string) {
-	log.Info().
-		Str("spider", name).
-		Int64("items/sec", s.TotalItem).
-		Int64("task finished/sec", s.itemSpeed).Send()
+	printStatusLine(NewZerologLogger(log), name, s.Snapshot())
+}
+
+func printStatusLine(l Logger, name string, ss StatusSnapshot) {
+	l.Info("",
+		"spider", name,
+		"items/sec", ss.ItemRate,
+		"task finished/sec", ss.ExecRate,
+		"progress", fmt.Sprintf("%.1f%%", ss.Progress*100),
+		"eta", ss.ETA,
+	)
+}
+
+// AddBytes 增加下载的字节数
+func (s *SpiderStatus) AddBytes(n int64) {
+	atomic.AddInt64(&s.BytesDownloaded, n)
+}
+
+// AddReqError 新增请求错误
+func (s *SpiderStatus) AddReqError() {
+	atomic.AddInt64(&s.ReqErrors, 1)
+}
+
+// AddRespError 新增响应错误
+func (s *SpiderStatus) AddRespError() {
+	atomic.AddInt64(&s.RespErrors, 1)
+}
+
+// AddRetry 新增重试，同一个请求再次发送时调用
+func (s *SpiderStatus) AddRetry() {
+	atomic.AddInt64(&s.Retries, 1)
+}
+
+// AddAbandonedTask 新增放弃的任务
+func (s *SpiderStatus) AddAbandonedTask() {
+	atomic.AddInt64(&s.AbandonedTask, 1)
+}
+
+// abandonPending 已加入的任务在开始执行前被放弃
+func (s *SpiderStatus) abandonPending() {
+	s.AddAbandonedTask()
+	atomic.AddInt64(&s.pending, -1)
+}
+
+// AddStatusCode 新增一个状态码为code的响应
+func (s *SpiderStatus) AddStatusCode(code int) {
+	addMapCounter(&s.statusCodes, code)
+}
+
+// AddHostTask 新增一个host的任务
+func (s *SpiderStatus) AddHostTask(host string) {
+	addMapCounter(&s.hostTasks, host)
+}
+
+// AddBlockedHost 新增一次host被反爬拦截，见OnBlocked
+func (s *SpiderStatus) AddBlockedHost(host string) {
+	addMapCounter(&s.blocked, host)
+}
+
+// AddSkippedTask 新增一个因reason被丢弃的任务，见OnSkip
+func (s *SpiderStatus) AddSkippedTask(reason SkipReason) {
+	addMapCounter(&s.skipped, reason)
+}
+
+// StatusCodes 各状态码的响应数
+func (s *SpiderStatus) StatusCodes() map[int]int64 {
+	res := map[int]int64{}
+	s.statusCodes.Range(func(k, v interface{}) bool {
+		res[k.(int)] = atomic.LoadInt64(v.(*int64))
+		return true
+	})
+	return res
+}
+
+// HostTasks 各host的任务数
+func (s *SpiderStatus) HostTasks() map[string]int64 {
+	res := map[string]int64{}
+	s.hostTasks.Range(func(k, v interface{}) bool {
+		res[k.(string)] = atomic.LoadInt64(v.(*int64))
+		return true
+	})
+	return res
+}
+
+// BlockedHosts 各host被反爬拦截的次数
+func (s *SpiderStatus) BlockedHosts() map[string]int64 {
+	res := map[string]int64{}
+	s.blocked.Range(func(k, v interface{}) bool {
+		res[k.(string)] = atomic.LoadInt64(v.(*int64))
+		return true
+	})
+	return res
+}
+
+// SkippedTasks 各原因被OnTask丢弃的任务数
+func (s *SpiderStatus) SkippedTasks() map[SkipReason]int64 {
+	res := map[SkipReason]int64{}
+	s.skipped.Range(func(k, v interface{}) bool {
+		res[k.(SkipReason)] = atomic.LoadInt64(v.(*int64))
+		return true
+	})
+	return res
+}
+
+// maxErrorKinds 最多分别统计的错误种类，超过后新的错误计入otherErrors
+const maxErrorKinds = 1000
+
+// otherErrors 超过maxErrorKinds后的错误
+const otherErrors = "(other)"
+
+// slowestSize 记录的耗时最长的URL数
+const slowestSize = 10
+
+// ErrorCount 一种错误的次数，见SpiderStatus.TopErrors
+type ErrorCount struct {
+	Error   string `json:"error"`   // 错误信息，其中的URL替换为<url>
+	Count   int64  `json:"count"`   // 次数
+	Example string `json:"example"` // 第一次出现时请求的URL
+}
+
+type errorCounter struct {
+	count   int64
+	example string
+}
+
+// AddError 记录请求url的一次错误，错误信息相同(URL不同)的错误合并计数
+func (s *SpiderStatus) AddError(err error, url string) {
+	key := err.Error()
+	if url != "" {
+		key = strings.Replace(key, strconv.Quote(url), "<url>", -1)
+		key = strings.Replace(key, url, "<url>", -1)
+	}
+	v, ok := s.errors.Load(key)
+	if !ok {
+		if atomic.LoadInt64(&s.errorKinds) >= maxErrorKinds {
+			key = otherErrors
+		}
+		var loaded bool
+		v, loaded = s.errors.LoadOrStore(key, &errorCounter{example: url})
+		if !loaded {
+			atomic.AddInt64(&s.errorKinds, 1)
+		}
+	}
+	atomic.AddInt64(&v.(*errorCounter).count, 1)
+}
+
+// TopErrors 次数最多的n种错误，按次数从多到少
+func (s *SpiderStatus) TopErrors(n int) []ErrorCount {
+	res := []ErrorCount{}
+	s.errors.Range(func(k, v interface{}) bool {
+		c := v.(*errorCounter)
+		res = append(res, ErrorCount{Error: k.(string), Count: atomic.LoadInt64(&c.count), Example: c.example})
+		return true
+	})
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		return res[i].Error < res[j].Error
+	})
+	if len(res) > n {
+		res = res[:n]
+	}
+	return res
+}
+
+// URLTiming 一次请求的耗时，见SpiderStatus.Slowest
+type URLTiming struct {
+	URL      string        `json:"url"`
+	Duration time.Duration `json:"duration"`
+}
+
+// AddFetchTime 记录请求url的耗时
+func (s *SpiderStatus) AddFetchTime(url string, d time.Duration) {
+	s.slowLock.Lock()
+	defer s.slowLock.Unlock()
+	if len(s.slowest) == slowestSize && d <= s.slowest[slowestSize-1].Duration {
+		return
+	}
+	i := sort.Search(len(s.slowest), func(i int) bool { return s.slowest[i].Duration < d })
+	s.slowest = append(s.slowest, URLTiming{})
+	copy(s.slowest[i+1:], s.slowest[i:])
+	s.slowest[i] = URLTiming{URL: url, Duration: d}
+	if len(s.slowest) > slowestSize {
+		s.slowest = s.slowest[:slowestSize]
+	}
+}
+
+// Slowest 耗时最长的请求(最多10个)，按耗时从长到短
+func (s *SpiderStatus) Slowest() []URLTiming {
+	s.slowLock.Lock()
+	defer s.slowLock.Unlock()
+	return append([]URLTiming{}, s.slowest...)
+}
+
+// HandlerStats 处理方法的执行统计
+type HandlerStats struct {
+	Calls  int64         // 执行次数
+	Panics int64         // panic的次数
+	Total  time.Duration // 总耗时
+	Max    time.Duration // 单次最长耗时
+}
+
+// Mean 平均耗时
+func (h HandlerStats) Mean() time.Duration {
+	if h.Calls == 0 {
+		return 0
+	}
+	return h.Total / time.Duration(h.Calls)
+}
+
+type handlerCounter struct {
+	calls, panics, total, max int64
+}
+
+// AddHandlerCall 记录一次处理方法的执行，name为处理方法的名字，见Spider.HandlerName
+func (s *SpiderStatus) AddHandlerCall(name string, d time.Duration, panicked bool) {
+	v, ok := s.handlers.Load(name)
+	if !ok {
+		v, _ = s.handlers.LoadOrStore(name, &handlerCounter{})
+	}
+	c := v.(*handlerCounter)
+	atomic.AddInt64(&c.calls, 1)
+	if panicked {
+		atomic.AddInt64(&c.panics, 1)
+	}
+	atomic.AddInt64(&c.total, int64(d))
+	for {
+		max := atomic.LoadInt64(&c.max)
+		if int64(d) <= max || atomic.CompareAndSwapInt64(&c.max, max, int64(d)) {
+			break
+		}
+	}
+}
+
+// HandlerStats 各处理方法的执行统计，按名字区分
+func (s *SpiderStatus) HandlerStats() map[string]HandlerStats {
+	res := map[string]HandlerStats{}
+	s.handlers.Range(func(k, v interface{}) bool {
+		c := v.(*handlerCounter)
+		res[k.(string)] = HandlerStats{
+			Calls:  atomic.LoadInt64(&c.calls),
+			Panics: atomic.LoadInt64(&c.panics),
+			Total:  time.Duration(atomic.LoadInt64(&c.total)),
+			Max:    time.Duration(atomic.LoadInt64(&c.max)),
+		}
+		return true
+	})
+	return res
+}
+
+// restore 从检查点恢复计数，见Spider.ResumeFrom
+func (s *SpiderStatus) restore(ss StatusSnapshot) {
+	atomic.StoreInt64(&s.TotalTask, ss.TotalTask)
+	atomic.StoreInt64(&s.FinishedTask, ss.FinishedTask)
+	atomic.StoreInt64(&s.TotalItem, ss.TotalItem)
+	atomic.StoreInt64(&s.BytesDownloaded, ss.BytesDownloaded)
+	atomic.StoreInt64(&s.ReqErrors, ss.ReqErrors)
+	atomic.StoreInt64(&s.RespErrors, ss.RespErrors)
+	atomic.StoreInt64(&s.Retries, ss.Retries)
+	atomic.StoreInt64(&s.AbandonedTask, ss.AbandonedTask)
+	for k, v := range ss.StatusCodes {
+		storeMapCounter(&s.statusCodes, k, v)
+	}
+	for k, v := range ss.HostTasks {
+		storeMapCounter(&s.hostTasks, k, v)
+	}
+	for k, v := range ss.BlockedHosts {
+		storeMapCounter(&s.blocked, k, v)
+	}
+	for k, v := range ss.SkippedTasks {
+		storeMapCounter(&s.skipped, k, v)
+	}
+	for k, v := range ss.Handlers {
+		s.handlers.Store(k, &handlerCounter{
+			calls:  v.Calls,
+			panics: v.Panics,
+			total:  int64(v.Total),
+			max:    int64(v.Max),
+		})
+	}
+}
+
+func storeMapCounter(m *sync.Map, k interface{}, n int64) {
+	v := n
+	m.Store(k, &v)
+}
+
+func addMapCounter(m *sync.Map, k interface{}) {
+	v, ok := m.Load(k)
+	if !ok {
+		v, _ = m.LoadOrStore(k, new(int64))
+	}
+	atomic.AddInt64(v.(*int64), 1)
 }
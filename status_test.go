@@ -0,0 +1,223 @@
+package gospider
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSpiderStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/404" {
+			w.WriteHeader(404)
+		}
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+
+	s := NewSpider()
+	s.Logging = false
+	s.SeedTask(goreq.Get(ts.URL))
+	s.SeedTask(goreq.Get(ts.URL + "/404"))
+	s.SeedTask(goreq.Get("http://127.0.0.1:1/"))
+	r := goreq.Get(ts.URL)
+	r.Err = errors.New("test error")
+	s.SeedTask(r)
+	s.Wait()
+
+	assert.Equal(t, int64(10), s.Status.BytesDownloaded)
+	assert.Equal(t, int64(1), s.Status.ReqErrors)
+	assert.Equal(t, int64(1), s.Status.RespErrors)
+	assert.Equal(t, map[int]int64{200: 1, 404: 1}, s.Status.StatusCodes())
+	assert.Equal(t, map[string]int64{u.Host: 3, "127.0.0.1:1": 1}, s.Status.HostTasks())
+}
+
+func TestSpiderStatus_Snapshot(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+
+	s := NewSpider()
+	s.Logging = false
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				_ = s.Status.Snapshot()
+			}
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+			ctx.AddItem("item")
+		})
+	}
+	s.Wait()
+	close(done)
+
+	ss := s.Status.Snapshot()
+	assert.Equal(t, int64(10), ss.TotalTask)
+	assert.Equal(t, int64(10), ss.FinishedTask)
+	assert.Equal(t, int64(0), ss.PendingTask)
+	assert.Equal(t, int64(10), ss.TotalItem)
+	assert.True(t, ss.ExecRate > 0)
+	assert.Equal(t, time.Duration(0), ss.ETA)
+	assert.Equal(t, int32(0), s.Status.running)
+	ss.StatusCodes[200] = 0
+	assert.Equal(t, int64(10), s.Status.StatusCodes()[200])
+}
+
+func TestSpiderStatus_ETA(t *testing.T) {
+	s := NewSpiderStatus()
+	assert.Equal(t, float64(0), s.Progress())
+	assert.Equal(t, time.Duration(0), s.ETA())
+	for i := 0; i < 4; i++ {
+		s.AddTask()
+	}
+	s.FinishTask()
+	s.lock.Lock()
+	s.execRate = 2
+	s.rateValid = true
+	s.lock.Unlock()
+	defer s.stop()
+
+	assert.Equal(t, 0.25, s.Progress())
+	assert.Equal(t, 1500*time.Millisecond, s.ETA())
+	ss := s.Snapshot()
+	assert.Equal(t, 0.25, ss.Progress)
+	assert.Equal(t, 1500*time.Millisecond, ss.ETA)
+}
+
+func TestSpiderStatus_PendingTask(t *testing.T) {
+	s := NewSpiderStatus()
+	defer s.stop()
+	for i := 0; i < 4; i++ {
+		s.AddTask()
+	}
+	s.FinishTask()
+	assert.Equal(t, int64(3), s.Snapshot().PendingTask)
+
+	// 停止后加入的任务直接放弃，不计入TotalTask
+	s.AddAbandonedTask()
+	s.AddAbandonedTask()
+	assert.Equal(t, int64(3), s.Snapshot().PendingTask)
+	// 执行中的请求被取消
+	s.FinishTask()
+	s.AddAbandonedTask()
+	assert.Equal(t, int64(2), s.Snapshot().PendingTask)
+	// 等待执行的任务被放弃
+	s.abandonPending()
+	ss := s.Snapshot()
+	assert.Equal(t, int64(1), ss.PendingTask)
+	assert.Equal(t, int64(4), ss.AbandonedTask)
+}
+
+func TestSpiderStatus_HandlerStats(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	s := NewSpider(WithSynchronousMode())
+	s.Logging = false
+	slow := func(ctx *Context) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	bad := func(ctx *Context) {
+		panic("bad handler")
+	}
+	s.RegisterHandler("slow", slow)
+	s.SeedTask(goreq.Get(ts.URL+"/a"), slow)
+	s.SeedTask(goreq.Get(ts.URL+"/b"), slow, bad)
+	s.Wait()
+
+	hs := s.Status.Snapshot().Handlers
+	assert.Len(t, hs, 2)
+	assert.Equal(t, int64(2), hs["slow"].Calls)
+	assert.Equal(t, int64(0), hs["slow"].Panics)
+	assert.True(t, hs["slow"].Max >= 20*time.Millisecond)
+	assert.True(t, hs["slow"].Mean() >= 20*time.Millisecond)
+	name := s.HandlerName(bad)
+	assert.Contains(t, name, "TestSpiderStatus_HandlerStats.func")
+	assert.Contains(t, name, "status_test.go:")
+	assert.Equal(t, int64(1), hs[name].Calls)
+	assert.Equal(t, int64(1), hs[name].Panics)
+
+	// 从检查点恢复
+	st := NewSpiderStatus()
+	st.restore(s.Status.Snapshot())
+	assert.Equal(t, hs, st.HandlerStats())
+}
+
+func TestSpiderStatus_TopErrors(t *testing.T) {
+	s := NewSpiderStatus()
+	for _, u := range []string{"http://a.com/1", "http://a.com/2", "http://a.com/3"} {
+		s.AddError(&url.Error{Op: "Get", URL: u, Err: errors.New("connection refused")}, u)
+	}
+	s.AddError(errors.New("boom"), "http://a.com/4")
+	top := s.TopErrors(10)
+	if assert.Len(t, top, 2) {
+		assert.Equal(t, ErrorCount{Error: `Get <url>: connection refused`, Count: 3, Example: "http://a.com/1"}, top[0])
+		assert.Equal(t, ErrorCount{Error: "boom", Count: 1, Example: "http://a.com/4"}, top[1])
+	}
+	assert.Len(t, s.TopErrors(1), 1)
+}
+
+func TestSpiderStatus_Slowest(t *testing.T) {
+	s := NewSpiderStatus()
+	for i := 1; i <= 15; i++ {
+		s.AddFetchTime(fmt.Sprintf("http://a.com/%d", i), time.Duration(i%8)*time.Second+time.Duration(i))
+	}
+	slowest := s.Slowest()
+	if assert.Len(t, slowest, 10) {
+		assert.Equal(t, "http://a.com/15", slowest[0].URL)
+		assert.Equal(t, "http://a.com/7", slowest[1].URL)
+		for i := 1; i < len(slowest); i++ {
+			assert.True(t, slowest[i-1].Duration > slowest[i].Duration)
+		}
+	}
+}
+
+func TestSpiderStatus_Retries(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(500)
+		}
+		_, _ = fmt.Fprint(w, "Hello")
+	}))
+	defer ts.Close()
+
+	// goreq.WithRetry在中间件中重试，最多发送3次
+	s := NewSpider(WithSynchronousMode(), goreq.WithRetry(3, func(resp *goreq.Response) bool {
+		return resp.StatusCode != 500
+	}))
+	s.Logging = false
+	s.SeedTask(goreq.Get(ts.URL + "/fail"))
+	s.SeedTask(goreq.Get(ts.URL))
+	s.Wait()
+	assert.Equal(t, int64(2), s.Status.Retries)
+
+	// 处理方法中用同一个请求重新加入任务
+	s = NewSpider(WithSynchronousMode())
+	s.Logging = false
+	var h Handler
+	h = func(ctx *Context) {
+		if ctx.GetInt("n") < 2 {
+			ctx.SetMeta("n", ctx.GetInt("n")+1)
+			ctx.AddTask(ctx.Req, h)
+		}
+	}
+	s.SeedTask(goreq.Get(ts.URL), h)
+	s.Wait()
+	assert.Equal(t, int64(3), s.Status.FinishedTask)
+	assert.Equal(t, int64(2), s.Status.Retries)
+}
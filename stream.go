@@ -0,0 +1,119 @@
+package gospider
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"regexp"
+
+	"github.com/zhshch2002/goreq"
+	"golang.org/x/net/html"
+)
+
+// StreamMetaKey 任务Meta中指定是否流式解析HTML的键，值为bool，优先于WithHTMLStreaming的URL匹配
+const StreamMetaKey = "_stream"
+
+// streamKey 请求context中流式读取响应体的方法，见HTTPFetcher
+type streamKey struct{}
+
+// streamSink 读取响应体，返回false时表示不处理，由Fetcher照常读取
+type streamSink func(resp *http.Response) (bool, error)
+
+// WithHTMLStreaming 对URL匹配patterns(正则)的任务流式解析HTML，不构建完整的DOM，也不在内存中保存响应体，
+// 用于过大的页面(如几十MB的列表页、索引页)。读取响应的同时将标签和文本交给OnHTMLToken注册的处理方法，
+// 之后照常执行OnResp和任务的处理方法，此时Resp.Body为空。在OnHTMLToken中Abort会停止读取并跳过之后的处理
+// 流式读取需要Spider自定义的transport(见WithTLSFingerprint等)或HTTPFetcher；响应来自缓存等中间件时从完整的响应体解析
+func WithHTMLStreaming(patterns ...string) Extension {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		res = append(res, regexp.MustCompile(p))
+	}
+	return func(s *Spider) {
+		s.streamPatterns = append(s.streamPatterns, res...)
+		s.httpTransport()
+	}
+}
+
+// OnHTMLToken 流式解析HTML时(见WithHTMLStreaming)对读取到的每个开始标签、结束标签、自闭合标签和文本调用，
+// 此时ctx.Resp只有状态码和响应头
+func (s *Spider) OnHTMLToken(fn func(ctx *Context, tok html.Token)) {
+	s.onHTMLTokenHandlers = append(s.onHTMLTokenHandlers, fn)
+}
+func (s *Spider) handleOnHTMLToken(ctx *Context, tok html.Token) {
+	for _, fn := range s.onHTMLTokenHandlers {
+		if ctx.IsAborted() {
+			return
+		}
+		fn(ctx, tok)
+	}
+}
+
+func (s *Spider) shouldStream(t *Task) bool {
+	if len(s.onHTMLTokenHandlers) == 0 || t.Req.Request == nil {
+		return false
+	}
+	if v, ok := t.Meta[StreamMetaKey].(bool); ok {
+		return v
+	}
+	u := t.Req.URL.String()
+	for _, p := range s.streamPatterns {
+		if p.MatchString(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// streamTask 为需要流式解析的任务设置读取响应体的方法，返回在收到响应后调用的方法：
+// Fetcher没有流式读取(如响应来自缓存)时从完整的响应体解析；不需要流式解析时返回nil
+func (s *Spider) streamTask(ctx *Context, t *Task) func() {
+	if !s.shouldStream(t) {
+		return nil
+	}
+	streamed := false
+	sink := streamSink(func(resp *http.Response) (bool, error) {
+		if !isHTMLResponse(resp.Header) {
+			return false, nil
+		}
+		streamed = true
+		ctx.Resp = &goreq.Response{Req: t.Req, Response: resp, Body: []byte{}}
+		return true, s.tokenize(ctx, resp.Body)
+	})
+	t.Req.Request = t.Req.WithContext(context.WithValue(t.Req.Context(), streamKey{}, sink))
+	return func() {
+		if !streamed && isHTMLResponse(ctx.Resp.Header) && len(ctx.Resp.Body) > 0 {
+			s.tokenize(ctx, bytes.NewReader(ctx.Resp.Body))
+		}
+	}
+}
+
+// tokenize 解析r并调用OnHTMLToken，Abort后停止
+func (s *Spider) tokenize(ctx *Context, r io.Reader) error {
+	z := html.NewTokenizer(r)
+	for !ctx.IsAborted() {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return nil
+			}
+			return z.Err()
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken, html.TextToken:
+			s.handleOnHTMLToken(ctx, z.Token())
+		}
+	}
+	return nil
+}
+
+// streamRequest 请求设置的流式读取方法
+func streamRequest(req *goreq.Request) streamSink {
+	if req.Request == nil {
+		return nil
+	}
+	sink, _ := req.Context().Value(streamKey{}).(streamSink)
+	return sink
+}
+
+func isHTMLResponse(h http.Header) bool {
+	return h != nil && mediaType(h.Get("Content-Type")) == "text/html"
+}
@@ -0,0 +1,75 @@
+package gospider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"golang.org/x/net/html"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithHTMLStreaming(t *testing.T) {
+	seen := make(chan struct{})
+	streamed := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/small" {
+			w.Write([]byte(`<a href="/x">x</a>`))
+			return
+		}
+		w.Write([]byte(`<html><body><a href="/1">one</a>`))
+		w.(http.Flusher).Flush()
+		if r.URL.Path == "/huge" {
+			// 处理方法在收到剩余内容之前就拿到了第一个链接
+			select {
+			case <-seen:
+				streamed = true
+			case <-time.After(2 * time.Second):
+			}
+		}
+		w.Write([]byte(`<a href="/2">two</a><br/>` + strings.Repeat("<p>filler</p>", 1000) + `<a href="/3">three</a></body></html>`))
+	}))
+	defer ts.Close()
+
+	s := NewSpider(WithSynchronousMode(), WithHTMLStreaming(`/huge$`, `/abort$`))
+	s.Logging = false
+	links := map[string][]string{}
+	s.OnHTMLToken(func(ctx *Context, tok html.Token) {
+		if tok.Type != html.StartTagToken || tok.Data != "a" {
+			return
+		}
+		path := ctx.Req.URL.Path
+		assert.Equal(t, http.StatusOK, ctx.Resp.StatusCode)
+		for _, a := range tok.Attr {
+			if a.Key == "href" {
+				links[path] = append(links[path], a.Val)
+			}
+		}
+		if path == "/huge" && len(links[path]) == 1 {
+			close(seen)
+		}
+		if path == "/abort" && len(links[path]) == 2 {
+			ctx.Abort()
+		}
+	})
+	bodies := map[string]int{}
+	h := func(ctx *Context) {
+		bodies[ctx.Req.URL.RequestURI()] = len(ctx.Resp.Body)
+	}
+	s.SeedTask(goreq.Get(ts.URL+"/huge"), h)
+	s.SeedTask(goreq.Get(ts.URL+"/abort"), h)
+	s.SeedTask(goreq.Get(ts.URL+"/small"), h)
+	s.AddTask(NewTask(goreq.Get(ts.URL+"/small?stream"), map[string]interface{}{StreamMetaKey: true}, h))
+	s.Wait()
+
+	assert.True(t, streamed)
+	assert.Equal(t, map[string][]string{
+		"/huge":  {"/1", "/2", "/3"},
+		"/abort": {"/1", "/2"},
+		"/small": {"/x"},
+	}, links)
+	assert.Equal(t, map[string]int{"/huge": 0, "/small": 18, "/small?stream": 0}, bodies)
+}
@@ -0,0 +1,52 @@
+package gospider
+
+import "sync"
+
+// syncQueue 同步模式下按加入顺序等待执行的任务
+type syncQueue struct {
+	lock  sync.Mutex
+	tasks []*pendingTask
+}
+
+func (q *syncQueue) push(p *pendingTask) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.tasks = append(q.tasks, p)
+}
+
+func (q *syncQueue) pop() *pendingTask {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if len(q.tasks) == 0 {
+		return nil
+	}
+	p := q.tasks[0]
+	q.tasks[0] = nil
+	q.tasks = q.tasks[1:]
+	return p
+}
+
+// run 在调用的goroutine上依次执行任务，直到队列为空且其他goroutine(如WithTaskQueue)都已结束
+func (q *syncQueue) run(s *Spider) {
+	for {
+		for p := q.pop(); p != nil; p = q.pop() {
+			s.runTask(p)
+		}
+		s.wg.Wait()
+		q.lock.Lock()
+		empty := len(q.tasks) == 0
+		q.lock.Unlock()
+		if empty {
+			return
+		}
+	}
+}
+
+// WithSynchronousMode 同步模式：任务不再各自启动goroutine，而是在调用Wait的goroutine上按加入的顺序(FIFO)逐个执行，
+// OnItem在AddItem时直接执行。执行顺序确定，便于调试和编写golden file测试，panic的调用栈也更易读
+// SeedTask只加入任务，任务在Wait中执行；带NotBefore的任务会阻塞后续任务直到其开始时间
+func WithSynchronousMode() Extension {
+	return func(s *Spider) {
+		s.syncTasks = &syncQueue{}
+	}
+}
@@ -0,0 +1,73 @@
+package gospider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithSynchronousMode(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	s := NewSpider(WithSynchronousMode())
+	s.Logging = false
+	// 不加锁记录执行顺序，任务或Item在其他goroutine上执行时-race会报告
+	var events []string
+	s.OnItem(func(ctx *Context, i interface{}) interface{} {
+		events = append(events, "item "+i.(string))
+		return i
+	})
+	var page Handler
+	page = func(ctx *Context) {
+		p := ctx.Req.URL.Path
+		events = append(events, "task "+p)
+		if len(p) < 3 {
+			ctx.AddTask(goreq.Get(ts.URL+p+"a"), page)
+			ctx.AddItem(p)
+			ctx.AddTask(goreq.Get(ts.URL+p+"b"), page)
+		}
+	}
+	s.SeedTask(goreq.Get(ts.URL+"/"), page)
+	s.SeedTask(goreq.Get(ts.URL+"/x"), page)
+	assert.Empty(t, events)
+	s.Wait()
+
+	assert.Equal(t, []string{
+		"task /", "item /",
+		"task /x", "item /x",
+		"task /a", "item /a",
+		"task /b", "item /b",
+		"task /xa", "task /xb",
+		"task /aa", "task /ab",
+		"task /ba", "task /bb",
+	}, events)
+	assert.Equal(t, int64(10), s.Status.TotalTask)
+	assert.Equal(t, int64(10), s.Status.FinishedTask)
+	assert.Equal(t, int64(4), s.Status.TotalItem)
+}
+
+func TestWithSynchronousMode_Stop(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	s := NewSpider(WithSynchronousMode())
+	s.Logging = false
+	var paths []string
+	for _, p := range []string{"/1", "/2", "/3"} {
+		s.SeedTask(goreq.Get(ts.URL+p), func(ctx *Context) {
+			paths = append(paths, ctx.Req.URL.Path)
+			ctx.s.Stop()
+		})
+	}
+	delayed := NewTask(goreq.Get(ts.URL+"/later"), nil)
+	delayed.NotBefore = time.Now().Add(time.Hour)
+	s.AddTask(delayed)
+	s.Wait()
+
+	assert.Equal(t, []string{"/1"}, paths)
+	assert.Equal(t, int64(3), s.Status.AbandonedTask)
+}
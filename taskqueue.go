@@ -0,0 +1,444 @@
+package gospider
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrLeaseNotFound 租约不存在或已经过期
+var ErrLeaseNotFound = errors.New("task lease not found")
+
+// QueuedTask 从任务队列中租用的任务
+type QueuedTask struct {
+	ID       string
+	Task     *TaskSubmission
+	Deadline time.Time // 租约到期的时间，到期前没有Ack或Extend时任务重新入队
+}
+
+// TaskQueue 任务队列的存储后端，见WithTaskQueue
+// 任务出队时被租用，执行完成后Ack；租约到期的任务自动重新入队，保证每个任务至少被处理一次
+type TaskQueue interface {
+	// Push 加入一个任务
+	Push(sub *TaskSubmission) error
+	// Lease 租用一个任务ttl时间，没有可租用的任务时返回nil
+	Lease(ttl time.Duration) (*QueuedTask, error)
+	// Extend 续约，租约已过期时返回ErrLeaseNotFound
+	Extend(id string, ttl time.Duration) error
+	// Ack 确认任务已完成，从队列中删除
+	Ack(id string) error
+	// Len 等待租用的任务数和租用中的任务数
+	Len() (pending, leased int, err error)
+}
+
+// MemoryTaskQueue 内存中的任务队列
+type MemoryTaskQueue struct {
+	lock    sync.Mutex
+	nextID  int64
+	pending []string
+	tasks   map[string]*TaskSubmission
+	leases  map[string]time.Time
+}
+
+// NewMemoryTaskQueue 创建内存任务队列
+func NewMemoryTaskQueue() *MemoryTaskQueue {
+	return &MemoryTaskQueue{
+		tasks:  map[string]*TaskSubmission{},
+		leases: map[string]time.Time{},
+	}
+}
+
+// Push 加入一个任务
+func (q *MemoryTaskQueue) Push(sub *TaskSubmission) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.push(sub)
+	return nil
+}
+
+func (q *MemoryTaskQueue) push(sub *TaskSubmission) string {
+	q.nextID++
+	id := strconv.FormatInt(q.nextID, 10)
+	q.tasks[id] = sub
+	q.pending = append(q.pending, id)
+	return id
+}
+
+// expire 到期的租约重新放回队首，调用时需持有锁
+func (q *MemoryTaskQueue) expire(now time.Time) {
+	for id, d := range q.leases {
+		if now.After(d) {
+			delete(q.leases, id)
+			q.pending = append([]string{id}, q.pending...)
+		}
+	}
+}
+
+// Lease 租用一个任务ttl时间
+func (q *MemoryTaskQueue) Lease(ttl time.Duration) (*QueuedTask, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.lease(ttl), nil
+}
+
+func (q *MemoryTaskQueue) lease(ttl time.Duration) *QueuedTask {
+	now := time.Now()
+	q.expire(now)
+	if len(q.pending) == 0 {
+		return nil
+	}
+	id := q.pending[0]
+	q.pending = q.pending[1:]
+	q.leases[id] = now.Add(ttl)
+	return &QueuedTask{ID: id, Task: q.tasks[id], Deadline: q.leases[id]}
+}
+
+// Extend 续约
+func (q *MemoryTaskQueue) Extend(id string, ttl time.Duration) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	_, err := q.extend(id, ttl)
+	return err
+}
+
+func (q *MemoryTaskQueue) extend(id string, ttl time.Duration) (time.Time, error) {
+	now := time.Now()
+	q.expire(now)
+	if _, ok := q.leases[id]; !ok {
+		return time.Time{}, ErrLeaseNotFound
+	}
+	q.leases[id] = now.Add(ttl)
+	return q.leases[id], nil
+}
+
+// Ack 确认任务已完成
+func (q *MemoryTaskQueue) Ack(id string) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.ack(id)
+}
+
+func (q *MemoryTaskQueue) ack(id string) error {
+	if _, ok := q.leases[id]; !ok {
+		return ErrLeaseNotFound
+	}
+	delete(q.leases, id)
+	delete(q.tasks, id)
+	return nil
+}
+
+// Len 等待租用的任务数和租用中的任务数
+func (q *MemoryTaskQueue) Len() (int, int, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.expire(time.Now())
+	return len(q.pending), len(q.leases), nil
+}
+
+// taskQueueRecord FileTaskQueue日志中的一条记录
+type taskQueueRecord struct {
+	Op       string          `json:"op"` // push、lease、ack
+	ID       string          `json:"id"`
+	Task     *TaskSubmission `json:"task,omitempty"`
+	Deadline time.Time       `json:"deadline,omitempty"`
+}
+
+// FileTaskQueue 持久化到文件的任务队列，每次操作以JSON Lines追加到日志中
+// 进程崩溃后用OpenFileTaskQueue重新打开，未确认的任务会恢复，租用中的任务在租约到期后重新入队
+type FileTaskQueue struct {
+	mem  *MemoryTaskQueue
+	path string
+	f    *os.File
+}
+
+// OpenFileTaskQueue 打开path的任务队列，文件不存在时创建；打开时回放并压缩日志
+func OpenFileTaskQueue(path string) (*FileTaskQueue, error) {
+	q := &FileTaskQueue{mem: NewMemoryTaskQueue(), path: path}
+	if err := q.replay(); err != nil {
+		return nil, err
+	}
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// replay 按日志恢复队列状态，忽略崩溃时写了一半的记录
+func (q *FileTaskQueue) replay() error {
+	f, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	m := q.mem
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 64*1024*1024)
+	for sc.Scan() {
+		r := &taskQueueRecord{}
+		if err := json.Unmarshal(sc.Bytes(), r); err != nil {
+			continue
+		}
+		if n, err := strconv.ParseInt(r.ID, 10, 64); err == nil && n > m.nextID {
+			m.nextID = n
+		}
+		switch r.Op {
+		case "push":
+			m.tasks[r.ID] = r.Task
+			m.pending = append(m.pending, r.ID)
+		case "lease":
+			if _, ok := m.tasks[r.ID]; ok {
+				m.leases[r.ID] = r.Deadline
+			}
+		case "ack":
+			delete(m.leases, r.ID)
+			delete(m.tasks, r.ID)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	pending := m.pending[:0]
+	for _, id := range m.pending {
+		if _, leased := m.leases[id]; !leased && m.tasks[id] != nil {
+			pending = append(pending, id)
+		}
+	}
+	m.pending = pending
+	return nil
+}
+
+// compact 只保留未确认的任务和租约，重写日志
+func (q *FileTaskQueue) compact() error {
+	m := q.mem
+	tmp := q.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for id, t := range m.tasks {
+		if _, leased := m.leases[id]; leased {
+			_ = enc.Encode(&taskQueueRecord{Op: "push", ID: id, Task: t})
+			_ = enc.Encode(&taskQueueRecord{Op: "lease", ID: id, Deadline: m.leases[id]})
+		}
+	}
+	for _, id := range m.pending {
+		_ = enc.Encode(&taskQueueRecord{Op: "push", ID: id, Task: m.tasks[id]})
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, q.path); err != nil {
+		return err
+	}
+	q.f, err = os.OpenFile(q.path, os.O_APPEND|os.O_WRONLY, 0644)
+	return err
+}
+
+// write 追加一条记录并同步到磁盘，调用时需持有锁
+func (q *FileTaskQueue) write(r *taskQueueRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := q.f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return q.f.Sync()
+}
+
+// Push 加入一个任务
+func (q *FileTaskQueue) Push(sub *TaskSubmission) error {
+	q.mem.lock.Lock()
+	defer q.mem.lock.Unlock()
+	id := q.mem.push(sub)
+	return q.write(&taskQueueRecord{Op: "push", ID: id, Task: sub})
+}
+
+// Lease 租用一个任务ttl时间
+func (q *FileTaskQueue) Lease(ttl time.Duration) (*QueuedTask, error) {
+	q.mem.lock.Lock()
+	defer q.mem.lock.Unlock()
+	t := q.mem.lease(ttl)
+	if t == nil {
+		return nil, nil
+	}
+	return t, q.write(&taskQueueRecord{Op: "lease", ID: t.ID, Deadline: t.Deadline})
+}
+
+// Extend 续约
+func (q *FileTaskQueue) Extend(id string, ttl time.Duration) error {
+	q.mem.lock.Lock()
+	defer q.mem.lock.Unlock()
+	d, err := q.mem.extend(id, ttl)
+	if err != nil {
+		return err
+	}
+	return q.write(&taskQueueRecord{Op: "lease", ID: id, Deadline: d})
+}
+
+// Ack 确认任务已完成
+func (q *FileTaskQueue) Ack(id string) error {
+	q.mem.lock.Lock()
+	defer q.mem.lock.Unlock()
+	if err := q.mem.ack(id); err != nil {
+		return err
+	}
+	return q.write(&taskQueueRecord{Op: "ack", ID: id})
+}
+
+// Len 等待租用的任务数和租用中的任务数
+func (q *FileTaskQueue) Len() (int, int, error) {
+	return q.mem.Len()
+}
+
+// Close 关闭日志文件
+func (q *FileTaskQueue) Close() error {
+	q.mem.lock.Lock()
+	defer q.mem.lock.Unlock()
+	return q.f.Close()
+}
+
+// queueRunner 从任务队列中租用并执行任务，见WithTaskQueue
+type queueRunner struct {
+	q     TaskQueue
+	ttl   time.Duration
+	slots chan struct{}
+
+	lock    sync.Mutex
+	running bool // 租用任务的循环是否在运行
+}
+
+// WithTaskQueue 使用持久化的任务队列q调度任务
+// 经过OnTask的任务写入q(需要放在WithDeduplicate等过滤任务的扩展之后)，再由最多concurrency个执行者租用执行，
+// 执行中每隔leaseTTL/3续约，完成后确认；进程崩溃时租用中的任务在租约到期后重新入队，重启后用同一个q即可继续。
+// 任务的处理方法需要用RegisterHandler注册，未注册的任务仍直接执行；Wait在q中没有等待和租用中的任务时返回
+func WithTaskQueue(q TaskQueue, concurrency int, leaseTTL time.Duration) Extension {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return func(s *Spider) {
+		r := &queueRunner{
+			q:     q,
+			ttl:   leaseTTL,
+			slots: make(chan struct{}, concurrency),
+		}
+		s.taskQueue = r
+		s.OnTask(func(ctx *Context, t *Task) *Task {
+			sub, err := s.SerializeTask(t)
+			if err != nil {
+				s.writeLog(ctx, LogWarn, "task kept out of queue", "error", err, "spider", s.Name, "context", ctx.String())
+				return t
+			}
+			if err := q.Push(sub); err != nil {
+				s.writeLog(ctx, LogError, "task queue push error", "error", err, "spider", s.Name, "context", ctx.String())
+				return t
+			}
+			r.start(s)
+			return t.handOff()
+		})
+	}
+}
+
+// start 启动租用任务的循环，在加入任务或Wait时调用，此时处理方法已经注册；循环已在运行时不重复启动
+func (r *queueRunner) start(s *Spider) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.running {
+		return
+	}
+	r.running = true
+	s.wg.Add(1)
+	go r.loop(s)
+}
+
+// idle 队列中没有任务时结束循环；结束前再检查一次，之间加入的任务(其start看到循环仍在运行)由循环继续处理
+func (r *queueRunner) idle() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if pending, leased, err := r.q.Len(); err == nil && pending == 0 && leased == 0 {
+		r.running = false
+		return true
+	}
+	return false
+}
+
+func (r *queueRunner) loop(s *Spider) {
+	defer s.wg.Done()
+	for {
+		if s.IsStopped() {
+			r.lock.Lock()
+			r.running = false
+			r.lock.Unlock()
+			return
+		}
+		s.waitResume()
+		r.slots <- struct{}{}
+		qt, err := r.q.Lease(r.ttl)
+		if err != nil || qt == nil {
+			<-r.slots
+			if err != nil {
+				s.writeLog(nil, LogError, "task queue lease error", "error", err, "spider", s.Name)
+			} else if r.idle() {
+				return
+			}
+			select {
+			case <-time.After(100 * time.Millisecond):
+			case <-s.stopCh:
+			}
+			continue
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() { <-r.slots }()
+			r.run(s, qt)
+		}()
+	}
+}
+
+// run 执行租用的任务，执行中定期续约
+func (r *queueRunner) run(s *Spider, qt *QueuedTask) {
+	t, err := s.DeserializeTask(qt.Task)
+	if err != nil {
+		s.writeLog(nil, LogError, "task queue task error", "error", err, "spider", s.Name, "url", qt.Task.URL)
+		_ = r.q.Ack(qt.ID)
+		return
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(r.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := r.q.Extend(qt.ID, r.ttl); err != nil {
+					s.writeLog(nil, LogWarn, "task queue extend error", "error", err, "spider", s.Name, "url", qt.Task.URL)
+				}
+			}
+		}
+	}()
+	s.Status.AddTask()
+	s.Status.AddHostTask(t.Req.URL.Host)
+	if s.runTask(&pendingTask{t: t, counted: true}) {
+		// 请求因Stop被取消，不确认，任务留在队列中
+		return
+	}
+	if err := r.q.Ack(qt.ID); err != nil {
+		s.writeLog(nil, LogWarn, "task queue ack error", "error", err, "spider", s.Name, "url", qt.Task.URL)
+	}
+}
@@ -0,0 +1,157 @@
+package gospider
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileTaskQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gospider-taskqueue")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queue.jsonl")
+
+	q, err := OpenFileTaskQueue(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, q.Push(&TaskSubmission{SerializedRequest: SerializedRequest{URL: fmt.Sprintf("http://example.com/%d", i)}}))
+	}
+	a, err := q.Lease(time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com/0", a.Task.URL)
+	b, err := q.Lease(50 * time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com/1", b.Task.URL)
+	assert.NoError(t, q.Ack(a.ID))
+	assert.Equal(t, ErrLeaseNotFound, q.Ack(a.ID))
+	// 模拟崩溃：不确认b，直接重新打开
+	assert.NoError(t, q.Close())
+
+	q, err = OpenFileTaskQueue(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer q.Close()
+	pending, leased, err := q.Len()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pending)
+	assert.Equal(t, 1, leased)
+	c, err := q.Lease(time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com/2", c.Task.URL)
+	none, err := q.Lease(time.Hour)
+	assert.NoError(t, err)
+	assert.Nil(t, none)
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, ErrLeaseNotFound, q.Extend(b.ID, time.Hour))
+	d, err := q.Lease(time.Hour)
+	assert.NoError(t, err)
+	if assert.NotNil(t, d) {
+		assert.Equal(t, "http://example.com/1", d.Task.URL)
+		assert.NoError(t, q.Extend(d.ID, time.Hour))
+	}
+	d2, err := q.Lease(time.Hour)
+	assert.NoError(t, err)
+	assert.Nil(t, d2)
+}
+
+func TestWithTaskQueue(t *testing.T) {
+	lock := sync.Mutex{}
+	hits := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		hits[r.URL.Path]++
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "gospider-taskqueue")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queue.jsonl")
+
+	// 上一个进程租用了/9之后崩溃
+	q, err := OpenFileTaskQueue(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, q.Push(&TaskSubmission{SerializedRequest: SerializedRequest{URL: ts.URL + "/9"}, Handlers: []string{"page"}}))
+	_, err = q.Lease(200 * time.Millisecond)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Close())
+
+	q, err = OpenFileTaskQueue(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer q.Close()
+	s := NewSpider(WithDeduplicate(), WithTaskQueue(q, 2, time.Second))
+	s.Logging = false
+	var page Handler
+	page = func(ctx *Context) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(ctx.Req.URL.Path, "/"))
+		if n < 3 {
+			ctx.AddTask(goreq.Get(fmt.Sprintf("%s/%d", ts.URL, n+1)), page)
+			ctx.AddTask(goreq.Get(fmt.Sprintf("%s/%d", ts.URL, n+1)), page)
+		}
+	}
+	s.RegisterHandler("page", page)
+	s.SeedTask(goreq.Get(ts.URL+"/0"), page)
+	s.Wait()
+
+	assert.Equal(t, map[string]int{"/0": 1, "/1": 1, "/2": 1, "/3": 1, "/9": 1}, hits)
+	pending, leased, err := q.Len()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, pending)
+	assert.Equal(t, 0, leased)
+	assert.Equal(t, int64(5), s.Status.FinishedTask)
+}
+
+func TestWithTaskQueue_PushAfterDrain(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	s := NewSpider(WithTaskQueue(NewMemoryTaskQueue(), 2, time.Second))
+	s.Logging = false
+	lock := sync.Mutex{}
+	var pages []string
+	page := func(ctx *Context) {
+		lock.Lock()
+		pages = append(pages, ctx.Req.URL.Path)
+		lock.Unlock()
+	}
+	s.RegisterHandler("page", page)
+	s.SeedTask(goreq.Get(ts.URL+"/a"), page)
+	// 未注册的处理方法不进入队列，在队列取空之后加入新的任务
+	s.SeedTask(goreq.Get(ts.URL+"/slow"), func(ctx *Context) {
+		time.Sleep(300 * time.Millisecond)
+		ctx.AddTask(goreq.Get(ts.URL+"/b"), page)
+	})
+	s.Wait()
+
+	assert.ElementsMatch(t, []string{"/a", "/b"}, pages)
+	assert.Equal(t, int64(3), s.Status.FinishedTask)
+
+	// 再次Wait时同样处理队列中的任务
+	s.SeedTask(goreq.Get(ts.URL+"/c"), page)
+	s.Wait()
+	assert.ElementsMatch(t, []string{"/a", "/b", "/c"}, pages)
+}
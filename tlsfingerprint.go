@@ -0,0 +1,92 @@
+package gospider
+
+import (
+	"context"
+	"net"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// TLSFingerprint TLS ClientHello指纹(JA3)
+type TLSFingerprint int
+
+const (
+	FingerprintGo         TLSFingerprint = iota // Go标准库默认的ClientHello
+	FingerprintChrome                           // Chrome
+	FingerprintFirefox                          // Firefox
+	FingerprintSafari                           // iOS上的Safari
+	FingerprintRandomized                       // 随机的扩展和加密套件，每个连接都不同
+)
+
+func (f TLSFingerprint) helloID() utls.ClientHelloID {
+	switch f {
+	case FingerprintChrome:
+		return utls.HelloChrome_Auto
+	case FingerprintFirefox:
+		return utls.HelloFirefox_Auto
+	case FingerprintSafari:
+		return utls.HelloIOS_Auto
+	case FingerprintRandomized:
+		return utls.HelloRandomizedALPN
+	default:
+		return utls.HelloGolang
+	}
+}
+
+// dialUTLS 建立TCP连接并以fp的指纹进行TLS握手
+// ALPN只声明http/1.1：JA3不包含ALPN的内容，指纹不变，而net/http的自定义TLS连接不支持HTTP/2
+func dialUTLS(ctx context.Context, s *Spider, fp TLSFingerprint, network, addr string) (net.Conn, error) {
+	tr := s.httpTransport()
+	conn, err := tr.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	conf := &utls.Config{ServerName: host}
+	if tr.TLSClientConfig != nil {
+		conf.RootCAs = tr.TLSClientConfig.RootCAs
+		conf.InsecureSkipVerify = tr.TLSClientConfig.InsecureSkipVerify
+	}
+	uconn := utls.UClient(conn, conf, fp.helloID())
+	if err := uconn.BuildHandshakeState(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	for _, ext := range uconn.Extensions {
+		if alpn, ok := ext.(*utls.ALPNExtension); ok {
+			alpn.AlpnProtocols = []string{"http/1.1"}
+		}
+	}
+	if err := uconn.BuildHandshakeState(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	deadline := time.Now().Add(tr.TLSHandshakeTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = uconn.SetDeadline(deadline)
+	if err := uconn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	_ = uconn.SetDeadline(time.Time{})
+	return uconn, nil
+}
+
+// WithTLSFingerprint 使用uTLS模拟浏览器的TLS ClientHello指纹，很多反爬CDN会直接拦截Go默认的指纹
+// 根证书和InsecureSkipVerify取自transport的TLSClientConfig；通过HTTP代理访问HTTPS时net/http自行握手，指纹不生效
+func WithTLSFingerprint(fp TLSFingerprint) Extension {
+	return func(s *Spider) {
+		if fp == FingerprintGo {
+			return
+		}
+		s.httpTransport().DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialUTLS(ctx, s, fp, network, addr)
+		}
+	}
+}
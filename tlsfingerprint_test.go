@@ -0,0 +1,55 @@
+package gospider
+
+import (
+	"crypto/tls"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// hasGREASE ClientHello中是否有GREASE值，Go标准库不会发送，Chrome会
+func hasGREASE(suites []uint16) bool {
+	for _, c := range suites {
+		if c&0x0f0f == 0x0a0a && c>>8 == c&0xff {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWithTLSFingerprint(t *testing.T) {
+	lock := sync.Mutex{}
+	var suites []uint16
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("Hello"))
+	}))
+	ts.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			lock.Lock()
+			suites = hello.CipherSuites
+			lock.Unlock()
+			return nil, nil
+		},
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	for _, c := range []struct {
+		fp     TLSFingerprint
+		grease bool
+	}{{FingerprintGo, false}, {FingerprintChrome, true}} {
+		s := NewSpider(WithTLSFingerprint(c.fp))
+		s.Logging = false
+		s.httpTransport().TLSClientConfig = ts.Client().Transport.(*http.Transport).TLSClientConfig
+		resp, err := s.Client.Do(goreq.Get(ts.URL)).Resp()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "Hello", resp.Text)
+		}
+		lock.Lock()
+		assert.Equal(t, c.grease, hasGREASE(suites))
+		lock.Unlock()
+	}
+}
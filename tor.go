@@ -0,0 +1,118 @@
+package gospider
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zhshch2002/goreq"
+)
+
+// Tor 通过本地Tor的SOCKS代理发送请求，并通过控制端口切换线路
+type Tor struct {
+	SocksAddr   string        // SOCKS代理地址，默认127.0.0.1:9050
+	ControlAddr string        // 控制端口地址，如127.0.0.1:9051
+	Password    string        // 控制端口的密码(HashedControlPassword)
+	RotateEvery int64         // 每多少个请求切换一次线路，0为不自动切换
+	BanCodes    []int         // 返回这些状态码时切换线路，默认403和429
+	Timeout     time.Duration // 连接控制端口的超时，默认10s
+
+	lock  sync.Mutex // 同一时间只发送一个NEWNYM
+	count int64
+}
+
+// NewTor 创建Tor控制器
+func NewTor(controlAddr, password string) *Tor {
+	return &Tor{
+		SocksAddr:   "127.0.0.1:9050",
+		ControlAddr: controlAddr,
+		Password:    password,
+		BanCodes:    []int{http.StatusForbidden, http.StatusTooManyRequests},
+		Timeout:     10 * time.Second,
+	}
+}
+
+// NewCircuit 通过控制端口发送SIGNAL NEWNYM，之后的连接会使用新的线路
+func (t *Tor) NewCircuit() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	conn, err := net.DialTimeout("tcp", t.ControlAddr, t.Timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if t.Timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(t.Timeout))
+	}
+	r := bufio.NewReader(conn)
+	cmd := func(line string) error {
+		if _, err := fmt.Fprintf(conn, "%s\r\n", line); err != nil {
+			return err
+		}
+		reply, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(reply, "250") {
+			return fmt.Errorf("tor control: %s", strings.TrimSpace(reply))
+		}
+		return nil
+	}
+	if err := cmd(fmt.Sprintf("AUTHENTICATE %q", t.Password)); err != nil {
+		return err
+	}
+	if err := cmd("SIGNAL NEWNYM"); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprint(conn, "QUIT\r\n")
+	return nil
+}
+
+func (t *Tor) isBan(code int) bool {
+	for _, c := range t.BanCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// WithTor 通过本地Tor(SOCKS代理127.0.0.1:9050)发送所有请求，controlAddr和password用于切换线路
+// 需要自动切换线路或修改SOCKS地址时使用NewTor创建并配置后传给WithTorController
+func WithTor(controlAddr, password string) Extension {
+	return WithTorController(NewTor(controlAddr, password))
+}
+
+// WithTorController 通过t发送所有请求，按t的配置在一定数量的请求后或被封禁时切换线路
+// 也可以在处理方法中调用t.NewCircuit手动切换
+func WithTorController(t *Tor) Extension {
+	return func(s *Spider) {
+		s.Client.Use(func(c *goreq.Client, next goreq.Handler) goreq.Handler {
+			return func(req *goreq.Request) *goreq.Response {
+				if req.Err != nil {
+					return next(req)
+				}
+				setProxy(req, "socks5://"+t.SocksAddr)
+				resp := next(req)
+				rotate := false
+				if resp != nil && resp.Err == nil && resp.Response != nil && t.isBan(resp.StatusCode) {
+					rotate = true
+				}
+				if n := atomic.AddInt64(&t.count, 1); t.RotateEvery > 0 && n%t.RotateEvery == 0 {
+					rotate = true
+				}
+				if rotate {
+					if err := t.NewCircuit(); err != nil {
+						s.writeLog(nil, LogError, "tor new circuit error", "error", err, "spider", s.Name)
+					}
+				}
+				return resp
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package gospider
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// serveTestTorControl 模拟Tor控制端口，记录收到的NEWNYM数量
+func serveTestTorControl(t *testing.T, password string, newnym *int64) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				authed := false
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					line = strings.TrimSpace(line)
+					switch {
+					case line == "AUTHENTICATE "+strconv.Quote(password):
+						authed = true
+						_, _ = fmt.Fprint(conn, "250 OK\r\n")
+					case line == "SIGNAL NEWNYM" && authed:
+						atomic.AddInt64(newnym, 1)
+						_, _ = fmt.Fprint(conn, "250 OK\r\n")
+					case line == "QUIT":
+						_, _ = fmt.Fprint(conn, "250 closing connection\r\n")
+						return
+					default:
+						_, _ = fmt.Fprint(conn, "515 Authentication failed\r\n")
+					}
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+// serveTestSocks5 最简单的无认证SOCKS5代理，只支持CONNECT
+func serveTestSocks5(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 262)
+				if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+					return
+				}
+				_, _ = conn.Write([]byte{5, 0})
+				if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+					return
+				}
+				var host string
+				switch buf[3] {
+				case 1:
+					_, _ = io.ReadFull(conn, buf[:4])
+					host = net.IP(buf[:4]).String()
+				case 3:
+					_, _ = io.ReadFull(conn, buf[:1])
+					n := buf[0]
+					_, _ = io.ReadFull(conn, buf[:n])
+					host = string(buf[:n])
+				default:
+					return
+				}
+				_, _ = io.ReadFull(conn, buf[:2])
+				port := binary.BigEndian.Uint16(buf[:2])
+				target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+				if err != nil {
+					_, _ = conn.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer target.Close()
+				_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+				go func() {
+					_, _ = io.Copy(target, conn)
+				}()
+				_, _ = io.Copy(conn, target)
+			}()
+		}
+	}()
+	return l
+}
+
+func TestTor_NewCircuit(t *testing.T) {
+	var newnym int64
+	l := serveTestTorControl(t, "secret", &newnym)
+	defer l.Close()
+
+	assert.NoError(t, NewTor(l.Addr().String(), "secret").NewCircuit())
+	assert.Error(t, NewTor(l.Addr().String(), "wrong").NewCircuit())
+	assert.Equal(t, int64(1), atomic.LoadInt64(&newnym))
+}
+
+func TestWithTorController(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ban" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+		_, _ = fmt.Fprint(w, "Hello")
+	}))
+	defer ts.Close()
+
+	var newnym int64
+	control := serveTestTorControl(t, "secret", &newnym)
+	defer control.Close()
+	socks := serveTestSocks5(t)
+	defer socks.Close()
+
+	tor := NewTor(control.Addr().String(), "secret")
+	tor.SocksAddr = socks.Addr().String()
+	tor.RotateEvery = 2
+	s := NewSpider(WithTorController(tor))
+	s.Logging = false
+
+	for i := 0; i < 3; i++ {
+		resp, err := s.Client.Do(goreq.Get(ts.URL)).Resp()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "Hello", resp.Text)
+		}
+	}
+	assert.Equal(t, int64(1), atomic.LoadInt64(&newnym))
+	_ = s.Client.Do(goreq.Get(ts.URL + "/ban"))
+	assert.Equal(t, int64(2), atomic.LoadInt64(&newnym))
+}
@@ -0,0 +1,143 @@
+package gospider
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceMetaKey Task.Meta中保存链路追踪上下文(W3C Trace Context)的键
+const TraceMetaKey = "_trace"
+
+// WithTracing 启用OpenTelemetry链路追踪
+// 每个任务创建一个span，其下为请求(fetch)、每个处理方法和每个OnItem处理阶段创建子span，
+// 新任务会通过Task.Meta继承当前任务的追踪上下文。为此新任务的Meta会是父任务Meta的浅拷贝
+func WithTracing(tp trace.TracerProvider) Extension {
+	return func(s *Spider) {
+		s.tracing = &tracing{
+			tracer: tp.Tracer("github.com/gotodown/gospider"),
+			prop:   propagation.TraceContext{},
+		}
+		s.OnTask(func(ctx *Context, t *Task) *Task {
+			meta := make(map[string]interface{}, len(t.Meta)+1)
+			for k, v := range t.Meta {
+				meta[k] = v
+			}
+			delete(meta, TraceMetaKey)
+			if ctx.traceCtx != nil {
+				carrier := traceCarrier{}
+				s.tracing.prop.Inject(ctx.traceCtx, carrier)
+				meta[TraceMetaKey] = map[string]string(carrier)
+			}
+			t.Meta = meta
+			return t
+		})
+	}
+}
+
+// traceCarrier 实现propagation.TextMapCarrier
+type traceCarrier map[string]string
+
+func (c traceCarrier) Get(key string) string {
+	return c[key]
+}
+
+func (c traceCarrier) Set(key string, value string) {
+	c[key] = value
+}
+
+func (c traceCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+type tracing struct {
+	tracer trace.Tracer
+	prop   propagation.TextMapPropagator
+}
+
+// metaCarrier 从Meta中取出追踪上下文，兼容经过JSON序列化后的map[string]interface{}
+func metaCarrier(meta map[string]interface{}) traceCarrier {
+	carrier := traceCarrier{}
+	switch v := meta[TraceMetaKey].(type) {
+	case map[string]string:
+		for k, i := range v {
+			carrier[k] = i
+		}
+	case map[string]interface{}:
+		for k, i := range v {
+			if str, ok := i.(string); ok {
+				carrier[k] = str
+			}
+		}
+	}
+	return carrier
+}
+
+// startTask 为任务创建span并保存在ctx中，返回结束span的方法
+func (tr *tracing) startTask(ctx *Context) func() {
+	if tr == nil {
+		return func() {}
+	}
+	parent := tr.prop.Extract(context.Background(), metaCarrier(ctx.Meta))
+	var attrs []attribute.KeyValue
+	if ctx.Req != nil && ctx.Req.Request != nil {
+		attrs = append(attrs,
+			attribute.String("http.method", ctx.Req.Method),
+			attribute.String("http.url", ctx.Req.URL.String()),
+		)
+	}
+	c, span := tr.tracer.Start(parent, "task", trace.WithAttributes(attrs...))
+	ctx.traceCtx = c
+	return func() {
+		if ctx.Resp != nil && ctx.Resp.Response != nil {
+			span.SetAttributes(attribute.Int("http.status_code", ctx.Resp.StatusCode))
+		}
+		if ctx.IsAborted() {
+			span.SetAttributes(attribute.Bool("gospider.aborted", true))
+			if r := ctx.AbortReason(); r != "" {
+				span.SetAttributes(attribute.String("gospider.abort_reason", r))
+			}
+		}
+		span.End()
+	}
+}
+
+// start 在ctx的任务span下创建子span，返回结束子span的方法
+func (tr *tracing) start(ctx *Context, name string) func(err error) {
+	if tr == nil || ctx.traceCtx == nil {
+		return func(error) {}
+	}
+	_, span := tr.tracer.Start(ctx.traceCtx, name)
+	return func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// do 在名为"name #i"的子span中执行fn，fn中的panic会记录到span后继续抛出
+func (tr *tracing) do(ctx *Context, name string, i int, fn func()) {
+	if tr == nil || ctx.traceCtx == nil {
+		fn()
+		return
+	}
+	end := tr.start(ctx, fmt.Sprint(name, " #", i))
+	defer func() {
+		if err := recover(); err != nil {
+			end(fmt.Errorf("%v", err))
+			panic(err)
+		}
+	}()
+	fn()
+	end(nil)
+}
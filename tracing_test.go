@@ -0,0 +1,54 @@
+package gospider
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithTracing(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+
+	sr := tracetest.NewSpanRecorder()
+	s := NewSpider(WithTracing(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))))
+	s.Logging = false
+	s.OnItem(func(ctx *Context, i interface{}) interface{} {
+		return i
+	})
+	s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+		ctx.AddTask(goreq.Get(ts.URL+"/child"), func(ctx *Context) {
+			ctx.AddItem("item")
+		})
+	})
+	s.Wait()
+
+	spans := map[string][]sdktrace.ReadOnlySpan{}
+	for _, span := range sr.Ended() {
+		spans[span.Name()] = append(spans[span.Name()], span)
+	}
+	assert.Len(t, spans["task"], 2)
+	assert.Len(t, spans["fetch"], 2)
+	assert.Len(t, spans["handler #0"], 2)
+	assert.Len(t, spans["OnItem #0"], 1)
+
+	var parent, child sdktrace.ReadOnlySpan
+	for _, span := range spans["task"] {
+		if span.Parent().IsValid() {
+			child = span
+		} else {
+			parent = span
+		}
+	}
+	if assert.NotNil(t, parent) && assert.NotNil(t, child) {
+		assert.Equal(t, parent.SpanContext().TraceID(), child.SpanContext().TraceID())
+		assert.Equal(t, parent.SpanContext().SpanID(), child.Parent().SpanID())
+	}
+}
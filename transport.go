@@ -0,0 +1,106 @@
+package gospider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"time"
+
+	"github.com/zhshch2002/goreq"
+)
+
+// proxyKey 请求context中由gospider的扩展设置的代理，供Spider自定义的transport读取
+type proxyKey struct{}
+
+// setProxy 为请求设置代理，goreq内置的http.Client和Spider自定义的transport都会使用
+func setProxy(req *goreq.Request, proxy string) {
+	req.SetProxy(proxy)
+	req.Request = req.WithContext(context.WithValue(req.Context(), proxyKey{}, proxy))
+}
+
+// httpTransport 返回Spider自定义的transport，第一次调用时创建
+// 创建时会将Spider的Fetcher设置为使用该transport的HTTPFetcher(见useTransport)，请求不再经过goreq内置的http.Client，
+// 用于需要修改连接方式的扩展，如TLS指纹、DNS解析
+// 注意goreq的SetProxy、SetCheckRedirect/DisableRedirect对自定义transport无效，代理和重定向需通过gospider的扩展设置
+func (s *Spider) httpTransport() *http.Transport {
+	if s.transport == nil {
+		s.useTransport(newHTTPTransport())
+	}
+	return s.transport
+}
+
+// useTransport 使用t发送请求，Spider的Fetcher设置为使用t的HTTPFetcher
+// HTTPFetcher有自己的cookie jar，不再使用goreq内置的http.Client中的cookie(如之前登录得到的cookie)，
+// 多次调用时沿用同一个jar；已经通过WithFetcher设置了其他Fetcher时不替换，只输出错误日志，t只对会话(见WithSessions)生效
+func (s *Spider) useTransport(t *http.Transport) {
+	s.transport = t
+	if s.fetcher != nil && s.fetcher != Fetcher(s.transportFetcher) {
+		s.writeLog(nil, LogError, "custom fetcher in use, transport extension not applied", "spider", s.Name, "fetcher", fmt.Sprintf("%T", s.fetcher))
+		return
+	}
+	var j http.CookieJar
+	if s.transportFetcher != nil {
+		j = s.transportFetcher.Client.Jar
+	} else {
+		j, _ = cookiejar.New(nil)
+	}
+	s.transportFetcher = NewHTTPFetcher(&http.Client{
+		Jar:           j,
+		Transport:     s.roundTripper(t),
+		CheckRedirect: checkRedirect,
+	})
+	s.SetFetcher(s.transportFetcher)
+}
+
+// roundTripper Spider自定义的http.Client使用的RoundTripper，设置了WithDecompressionLimit时由gospider解压响应
+func (s *Spider) roundTripper(t *http.Transport) http.RoundTripper {
+	if s.inflate != nil {
+		return &inflateTransport{next: t, limit: s.inflate}
+	}
+	return t
+}
+
+// redirectKey 请求context中由gospider的扩展设置的重定向检查方法，供Spider自定义的transport读取
+type redirectKey struct{}
+
+// setCheckRedirect 为请求设置重定向检查方法，goreq内置的http.Client和Spider自定义的transport都会使用
+func setCheckRedirect(req *goreq.Request, fn func(req *http.Request, via []*http.Request) error) {
+	req.SetCheckRedirect(fn)
+	req.Request = req.WithContext(context.WithValue(req.Context(), redirectKey{}, fn))
+}
+
+// checkRedirect Spider自定义的http.Client的重定向检查，使用setCheckRedirect设置的方法，默认最多10次
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if fn, ok := req.Context().Value(redirectKey{}).(func(*http.Request, []*http.Request) error); ok && fn != nil {
+		return fn(req, via)
+	}
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	return nil
+}
+
+// newHTTPTransport 创建transport，代理从请求context中读取(见setProxy)
+func newHTTPTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	return &http.Transport{
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			if addr, ok := req.Context().Value(proxyKey{}).(string); ok && addr != "" {
+				return url.Parse(addr)
+			}
+			return nil, nil
+		},
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
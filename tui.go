@@ -0,0 +1,176 @@
+package gospider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TerminalUIOptions WithTerminalUI的配置
+type TerminalUIOptions struct {
+	Interval time.Duration // 刷新间隔，默认为500毫秒
+	Hosts    int           // host表格最多显示的行数(按任务数从多到少)，默认为10
+	Width    int           // 进度条的宽度(字符数)，默认为40
+}
+
+// WithTerminalUI 在终端w(为nil时为os.Stderr)上显示实时刷新的状态面板：进度条、任务和Item速度、错误数、
+// 次数最多的错误和各host的任务数表格，用于交互式运行；Wait开始时显示，每次Wait返回前刷新一次，关闭时停止刷新并保留在屏幕上
+// 面板使用ANSI控制字符原地刷新，与日志输出到同一终端时会互相覆盖，使用时可以关闭日志(Logging)或用SetLogger输出到文件
+func WithTerminalUI(w io.Writer, opts ...TerminalUIOptions) Extension {
+	return func(s *Spider) {
+		t := &terminalUI{w: w}
+		if len(opts) > 0 {
+			t.opts = opts[0]
+		}
+		if t.w == nil {
+			t.w = os.Stderr
+		}
+		if t.opts.Interval <= 0 {
+			t.opts.Interval = 500 * time.Millisecond
+		}
+		if t.opts.Hosts <= 0 {
+			t.opts.Hosts = 10
+		}
+		if t.opts.Width <= 0 {
+			t.opts.Width = 40
+		}
+		s.useExtension(t)
+	}
+}
+
+// terminalUI 终端状态面板，见WithTerminalUI
+type terminalUI struct {
+	s    *Spider
+	w    io.Writer
+	opts TerminalUIOptions
+	done chan struct{}
+
+	lock  sync.Mutex
+	lines int // 上一次输出的行数，刷新时先回到面板的第一行
+}
+
+// Init 记录爬虫
+func (t *terminalUI) Init(s *Spider) error {
+	t.s = s
+	return nil
+}
+
+// Start 开始定时刷新
+func (t *terminalUI) Start(ctx context.Context) {
+	t.done = make(chan struct{})
+	t.draw()
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(t.opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			t.draw()
+		}
+	}()
+}
+
+// Flush 输出Wait结束时的状态
+func (t *terminalUI) Flush() error {
+	t.draw()
+	return nil
+}
+
+// Close 停止刷新
+func (t *terminalUI) Close() error {
+	if t.done != nil {
+		<-t.done
+	}
+	return nil
+}
+
+// draw 清除上一次的面板并重新输出
+func (t *terminalUI) draw() {
+	lines := renderTerminalUI(t.s.Name, t.s.Status.Snapshot(), t.s.Status.TopErrors(3), t.opts)
+	buf := &strings.Builder{}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.lines > 0 {
+		fmt.Fprintf(buf, "\x1b[%dA", t.lines) // 光标上移到面板的第一行
+	}
+	buf.WriteString("\x1b[J") // 清除到屏幕末尾
+	for _, l := range lines {
+		buf.WriteString(l)
+		buf.WriteString("\x1b[K\n")
+	}
+	t.lines = len(lines)
+	_, _ = io.WriteString(t.w, buf.String())
+}
+
+// renderTerminalUI 状态面板的各行
+func renderTerminalUI(name string, ss StatusSnapshot, top []ErrorCount, opts TerminalUIOptions) []string {
+	filled := int(ss.Progress * float64(opts.Width))
+	if filled > opts.Width {
+		filled = opts.Width
+	}
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", opts.Width-filled)
+	eta := "-"
+	if ss.ETA > 0 {
+		eta = ss.ETA.Round(time.Second).String()
+	}
+	lines := []string{
+		fmt.Sprintf("[%s] %s %5.1f%%  tasks %d/%d  eta %s", name, bar, ss.Progress*100, ss.FinishedTask, ss.TotalTask, eta),
+		fmt.Sprintf("elapsed %s  tasks/sec %.1f  items/sec %.1f  items %d  downloaded %s",
+			ss.Elapsed.Round(time.Second), ss.ExecRate, ss.ItemRate, ss.TotalItem, formatBytes(ss.BytesDownloaded)),
+		fmt.Sprintf("errors req %d resp %d  retries %d  pending %d  abandoned %d",
+			ss.ReqErrors, ss.RespErrors, ss.Retries, ss.PendingTask, ss.AbandonedTask),
+	}
+	for _, e := range top {
+		lines = append(lines, fmt.Sprintf("  %6d× %s", e.Count, e.Error))
+	}
+
+	type hostRow struct {
+		host           string
+		tasks, blocked int64
+	}
+	var rows []hostRow
+	for h, n := range ss.HostTasks {
+		rows = append(rows, hostRow{h, n, ss.BlockedHosts[h]})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].tasks != rows[j].tasks {
+			return rows[i].tasks > rows[j].tasks
+		}
+		return rows[i].host < rows[j].host
+	})
+	if len(rows) == 0 {
+		return lines
+	}
+	lines = append(lines, fmt.Sprintf("%-40s %10s %10s", "host", "tasks", "blocked"))
+	for i, r := range rows {
+		if i == opts.Hosts {
+			lines = append(lines, fmt.Sprintf("... %d more hosts", len(rows)-opts.Hosts))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%-40s %10d %10d", r.host, r.tasks, r.blocked))
+	}
+	return lines
+}
+
+// formatBytes 以KB、MB等单位显示字节数
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,71 @@
+package gospider
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderTerminalUI(t *testing.T) {
+	ss := StatusSnapshot{
+		TotalTask:       4,
+		FinishedTask:    1,
+		TotalItem:       2,
+		BytesDownloaded: 1536,
+		RespErrors:      1,
+		ETA:             3 * time.Second,
+		Progress:        0.25,
+		HostTasks:       map[string]int64{"a.com": 1, "b.com": 3, "c.com": 2},
+		BlockedHosts:    map[string]int64{"b.com": 1},
+	}
+	lines := renderTerminalUI("test", ss, []ErrorCount{{Error: "boom", Count: 1}}, TerminalUIOptions{Hosts: 2, Width: 8})
+	assert.Equal(t, "[test] ██░░░░░░  25.0%  tasks 1/4  eta 3s", lines[0])
+	assert.Contains(t, lines[1], "downloaded 1.5 KB")
+	assert.Equal(t, "errors req 0 resp 1  retries 0  pending 0  abandoned 0", lines[2])
+	assert.Equal(t, "       1× boom", lines[3])
+	assert.Equal(t, []string{
+		fmt.Sprintf("%-40s %10s %10s", "host", "tasks", "blocked"),
+		fmt.Sprintf("%-40s %10d %10d", "b.com", 3, 1),
+		fmt.Sprintf("%-40s %10d %10d", "c.com", 2, 0),
+		"... 1 more hosts",
+	}, lines[4:])
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.0 KB", formatBytes(1024))
+	assert.Equal(t, "2.5 MB", formatBytes(5*1024*1024/2))
+}
+
+func TestWithTerminalUI(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+
+	buf := &bytes.Buffer{}
+	s := NewSpider(WithSynchronousMode(), WithTerminalUI(buf, TerminalUIOptions{Interval: 10 * time.Millisecond}))
+	s.Logging = false
+	for i := 0; i < 5; i++ {
+		s.SeedTask(goreq.Get(fmt.Sprintf("%s/%d", ts.URL, i)), func(ctx *Context) {})
+	}
+	s.Wait()
+	assert.NoError(t, s.Close())
+
+	out := buf.String()
+	// 第一次输出之后的每次刷新都先将光标移回面板的第一行
+	assert.True(t, strings.Count(out, "\x1b[5A") >= 1)
+	frames := strings.Split(out, "\x1b[J")
+	last := frames[len(frames)-1]
+	assert.Contains(t, last, "100.0%  tasks 5/5")
+	u, _ := url.Parse(ts.URL)
+	assert.Contains(t, last, fmt.Sprintf("%-40s %10d", u.Host, 5))
+}
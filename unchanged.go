@@ -0,0 +1,39 @@
+package gospider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+)
+
+// unchangedKey 内容哈希在存储中的键
+func unchangedKey(ctx *Context) string {
+	return "content " + ctx.Req.URL.String()
+}
+
+// WithSkipUnchanged 增量爬取时跳过内容未变化的页面
+// 记录每个URL规范化后的响应内容(合并空白字符，selector不为空时只取HTML中匹配元素的文本，用于排除广告、时间等无关部分)的哈希，
+// 再次爬取时内容相同则以"unchanged"为原因Abort(见OnAbort)，跳过之后的OnResp和任务的处理方法，任务仍算作已完成。
+// 哈希在任务的处理方法全部执行完后才更新，处理失败的页面下次仍会处理；只比较200响应
+// store保存哈希，使用持久化的存储(如DiskCacheStore)可以在多次运行之间保留
+func WithSkipUnchanged(store CacheStore, selector string) Extension {
+	return func(s *Spider) {
+		s.OnRespWithPriority(-50, func(ctx *Context) {
+			if ctx.Resp.StatusCode != http.StatusOK {
+				return
+			}
+			sum := sha256.Sum256([]byte(monitorContent(ctx, selector)))
+			hash := hex.EncodeToString(sum[:])
+			if old, ok := store.Get(unchangedKey(ctx)); ok && string(old) == hash {
+				ctx.AbortWithReason("unchanged")
+				return
+			}
+			ctx.bodyHash = hash
+		})
+		s.OnScraped(func(ctx *Context) {
+			if ctx.bodyHash != "" {
+				store.Set(unchangedKey(ctx), []byte(ctx.bodyHash))
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package gospider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithSkipUnchanged(t *testing.T) {
+	body := "<p>a</p>"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	store := NewMemoryCacheStore()
+	run := func(fail bool) (handled int, reason string) {
+		s := NewSpider(WithSynchronousMode(), WithSkipUnchanged(store, ""))
+		s.Logging = false
+		s.OnAbort(func(ctx *Context, r string) {
+			reason = r
+		})
+		s.SeedTask(goreq.Get(ts.URL), func(ctx *Context) {
+			handled++
+			if fail {
+				panic("parse error")
+			}
+		})
+		s.Wait()
+		assert.Equal(t, int64(1), s.Status.Snapshot().FinishedTask)
+		return
+	}
+
+	handled, _ := run(false)
+	assert.Equal(t, 1, handled)
+	handled, reason := run(false)
+	assert.Equal(t, 0, handled)
+	assert.Equal(t, "unchanged", reason)
+
+	body = "<p>a</p>\n\n"
+	handled, _ = run(false)
+	assert.Equal(t, 0, handled)
+
+	body = "<p>b</p>"
+	handled, _ = run(true)
+	assert.Equal(t, 1, handled)
+	handled, _ = run(false)
+	assert.Equal(t, 1, handled)
+	handled, _ = run(false)
+	assert.Equal(t, 0, handled)
+}
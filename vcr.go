@@ -0,0 +1,161 @@
+package gospider
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zhshch2002/goreq"
+)
+
+var (
+	// ErrCassetteMiss VCRReplay模式下请求没有录制的响应
+	ErrCassetteMiss = errors.New("no recorded response in cassette")
+)
+
+// VCRHeader WithVCR在回放的响应头中加入的标记，值为"replay"
+const VCRHeader = "X-Gospider-VCR"
+
+// VCRMode WithVCR的模式
+type VCRMode int
+
+const (
+	VCRRecordOnce VCRMode = iota // 有录制的响应时回放，否则发送请求并录制
+	VCRReplay                    // 只回放，没有录制的响应时返回ErrCassetteMiss，不发送请求，用于CI
+	VCRRecord                    // 总是发送请求并覆盖录制的响应
+)
+
+// cassetteEntry 录制的一次请求
+type cassetteEntry struct {
+	Key      string          `json:"key"` // GetRequestHash
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Response *cachedResponse `json:"response"`
+}
+
+// Cassette 保存录制的响应的文件，按GetRequestHash查找，每次录制后整体写回文件
+type Cassette struct {
+	Path string
+
+	lock    sync.Mutex
+	entries map[string]*cassetteEntry
+}
+
+// OpenCassette 打开录制文件，文件不存在时创建空的Cassette，在第一次录制时写入
+func OpenCassette(path string) (*Cassette, error) {
+	c := &Cassette{Path: path, entries: map[string]*cassetteEntry{}}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []*cassetteEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("cassette %s: %w", path, err)
+	}
+	for _, e := range entries {
+		c.entries[e.Key] = e
+	}
+	return c, nil
+}
+
+// Len 录制的请求数
+func (c *Cassette) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.entries)
+}
+
+func (c *Cassette) get(key string) (*cassetteEntry, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	e, ok := c.entries[key]
+	return e, ok
+}
+
+// record 录制一个响应并写回文件，条目按URL排序，便于在版本控制中比较
+func (c *Cassette) record(e *cassetteEntry) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries[e.Key] = e
+	entries := make([]*cassetteEntry, 0, len(c.entries))
+	for _, i := range c.entries {
+		entries = append(entries, i)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].URL != entries[j].URL {
+			return entries[i].URL < entries[j].URL
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(c.Path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	tmp := c.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.Path)
+}
+
+// WithVCR 录制真实的响应并在之后的运行中回放，便于开发解析代码和在CI中运行而不访问真实网站
+// 请求按GetRequestHash(URL、请求头、cookie、请求体)匹配，回放的响应头中带有VCRHeader；
+// 只录制成功收到的响应(包括4xx、5xx)，请求错误不录制
+func WithVCR(c *Cassette, mode VCRMode) Extension {
+	return func(s *Spider) {
+		s.Client.Use(func(cli *goreq.Client, next goreq.Handler) goreq.Handler {
+			return func(req *goreq.Request) *goreq.Response {
+				if req.Err != nil {
+					return next(req)
+				}
+				h := GetRequestHash(req)
+				key := hex.EncodeToString(h[:])
+				if mode != VCRRecord {
+					if e, ok := c.get(key); ok {
+						return e.Response.response(req, VCRHeader, "replay")
+					}
+				}
+				if mode == VCRReplay {
+					return &goreq.Response{
+						Req: req,
+						Err: fmt.Errorf("%w: %s %s", ErrCassetteMiss, req.Method, req.URL),
+					}
+				}
+				resp := next(req)
+				if resp == nil || resp.Err != nil || resp.Response == nil {
+					return resp
+				}
+				entry := &cachedResponse{
+					StatusCode: resp.StatusCode,
+					Proto:      resp.Proto,
+					Header:     resp.Header.Clone(),
+					Body:       resp.Body,
+					Time:       time.Now(),
+				}
+				if resp.Uncompressed {
+					entry.Header.Del("Content-Encoding")
+					entry.Header.Del("Content-Length")
+				}
+				if err := c.record(&cassetteEntry{Key: key, Method: req.Method, URL: req.URL.String(), Response: entry}); err != nil {
+					s.writeLog(nil, LogError, "vcr record error", "error", err, "spider", s.Name, "cassette", c.Path)
+				}
+				return resp
+			}
+		})
+	}
+}
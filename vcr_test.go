@@ -0,0 +1,99 @@
+package gospider
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestWithVCR(t *testing.T) {
+	lock := sync.Mutex{}
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		hits++
+		n := hits
+		lock.Unlock()
+		w.Header().Set("Content-Type", "text/plain")
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		fmt.Fprintf(w, "%s %d", r.URL.Path, n)
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "gospider-vcr")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cassettes", "site.json")
+
+	crawl := func(mode VCRMode, urls ...string) (map[string]string, []error) {
+		c, err := OpenCassette(path)
+		if !assert.NoError(t, err) {
+			return nil, nil
+		}
+		s := NewSpider(WithVCR(c, mode))
+		s.Logging = false
+		res := map[string]string{}
+		var errs []error
+		s.OnRespError(func(ctx *Context, err error) {
+			lock.Lock()
+			defer lock.Unlock()
+			errs = append(errs, err)
+		})
+		for _, u := range urls {
+			s.SeedTask(goreq.Get(ts.URL+u), func(ctx *Context) {
+				lock.Lock()
+				defer lock.Unlock()
+				res[ctx.Req.URL.Path] = fmt.Sprintf("%d %s %s", ctx.Resp.StatusCode, ctx.Resp.Text, ctx.Resp.Header.Get(VCRHeader))
+			})
+		}
+		s.Wait()
+		return res, errs
+	}
+
+	res, errs := crawl(VCRRecordOnce, "/a", "/missing")
+	assert.Empty(t, errs)
+	assert.Equal(t, 2, hits)
+	assert.Len(t, res, 2)
+	recorded := res["/a"]
+
+	res, errs = crawl(VCRReplay, "/a", "/missing")
+	assert.Empty(t, errs)
+	assert.Equal(t, 2, hits)
+	assert.Equal(t, recorded+"replay", res["/a"])
+	assert.Contains(t, res["/missing"], "404 /missing")
+
+	res, errs = crawl(VCRReplay, "/b")
+	assert.Equal(t, 2, hits)
+	assert.Empty(t, res)
+	if assert.Len(t, errs, 1) {
+		assert.True(t, errors.Is(errs[0], ErrCassetteMiss))
+	}
+
+	res, _ = crawl(VCRRecordOnce, "/a", "/b")
+	assert.Equal(t, 3, hits)
+	assert.Equal(t, recorded+"replay", res["/a"])
+	assert.Equal(t, "200 /b 3 ", res["/b"])
+
+	res, _ = crawl(VCRRecord, "/a")
+	assert.Equal(t, 4, hits)
+	assert.Equal(t, "200 /a 4 ", res["/a"])
+	c, err := OpenCassette(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, c.Len())
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{"), 0644))
+	_, err = OpenCassette(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,182 @@
+package gospider
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zhshch2002/goreq"
+)
+
+// warcWriter 以WARC 1.1格式写入记录，每条记录为一个独立的gzip member
+type warcWriter struct {
+	lock    sync.Mutex
+	w       io.Writer
+	started bool
+}
+
+// warcHeader WARC记录头中的一个字段，保持写入顺序
+type warcHeader struct {
+	key, value string
+}
+
+func newWARCRecordID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func warcDigest(b []byte) string {
+	sum := sha1.Sum(b)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// writeRecord 写入一条记录，调用时需持有锁
+func (ww *warcWriter) writeRecord(typ string, headers []warcHeader, block []byte) error {
+	buf := &bytes.Buffer{}
+	buf.WriteString("WARC/1.1\r\n")
+	buf.WriteString("WARC-Type: " + typ + "\r\n")
+	for _, h := range headers {
+		buf.WriteString(h.key + ": " + h.value + "\r\n")
+	}
+	buf.WriteString("WARC-Block-Digest: " + warcDigest(block) + "\r\n")
+	buf.WriteString("Content-Length: " + strconv.Itoa(len(block)) + "\r\n\r\n")
+	buf.Write(block)
+	buf.WriteString("\r\n\r\n")
+
+	gz := gzip.NewWriter(ww.w)
+	if _, err := gz.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// writeExchange 写入一次请求和响应，第一次写入前会先写入warcinfo记录
+func (ww *warcWriter) writeExchange(req *goreq.Request, resp *goreq.Response, date time.Time) error {
+	reqBlock, err := warcRequestBlock(req)
+	if err != nil {
+		return err
+	}
+	respBlock, payload := warcResponseBlock(resp)
+	uri := req.URL.String()
+	ds := date.UTC().Format(time.RFC3339)
+	respID := newWARCRecordID()
+
+	ww.lock.Lock()
+	defer ww.lock.Unlock()
+	if !ww.started {
+		info := []byte("software: gospider\r\nformat: WARC File Format 1.1\r\n")
+		if err := ww.writeRecord("warcinfo", []warcHeader{
+			{"WARC-Record-ID", newWARCRecordID()},
+			{"WARC-Date", ds},
+			{"Content-Type", "application/warc-fields"},
+		}, info); err != nil {
+			return err
+		}
+		ww.started = true
+	}
+	if err := ww.writeRecord("response", []warcHeader{
+		{"WARC-Record-ID", respID},
+		{"WARC-Date", ds},
+		{"WARC-Target-URI", uri},
+		{"Content-Type", "application/http;msgtype=response"},
+		{"WARC-Payload-Digest", warcDigest(payload)},
+	}, respBlock); err != nil {
+		return err
+	}
+	return ww.writeRecord("request", []warcHeader{
+		{"WARC-Record-ID", newWARCRecordID()},
+		{"WARC-Date", ds},
+		{"WARC-Target-URI", uri},
+		{"WARC-Concurrent-To", respID},
+		{"Content-Type", "application/http;msgtype=request"},
+	}, reqBlock)
+}
+
+// warcRequestBlock 还原HTTP请求报文
+func warcRequestBlock(req *goreq.Request) ([]byte, error) {
+	var body []byte
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		body, err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%s %s HTTP/1.1\r\n", req.Method, req.URL.RequestURI())
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	fmt.Fprintf(buf, "Host: %s\r\n", host)
+	h := req.Header.Clone()
+	h.Del("Host")
+	if len(body) > 0 {
+		h.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	_ = h.Write(buf)
+	buf.WriteString("\r\n")
+	buf.Write(body)
+	return buf.Bytes(), nil
+}
+
+// warcResponseBlock 还原HTTP响应报文，返回报文和响应体
+// 由http.Transport自动解压的响应体以解压后的形式保存，并修正相应的头
+func warcResponseBlock(resp *goreq.Response) ([]byte, []byte) {
+	buf := &bytes.Buffer{}
+	proto := resp.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	status := resp.Status
+	if status == "" {
+		status = strconv.Itoa(resp.StatusCode) + " " + http.StatusText(resp.StatusCode)
+	}
+	fmt.Fprintf(buf, "%s %s\r\n", proto, status)
+	h := resp.Header.Clone()
+	if resp.Uncompressed {
+		h.Del("Content-Encoding")
+		h.Set("Content-Length", strconv.Itoa(len(resp.Body)))
+	}
+	_ = h.Write(buf)
+	buf.WriteString("\r\n")
+	buf.Write(resp.Body)
+	return buf.Bytes(), resp.Body
+}
+
+// WithWARCWriter 以WARC 1.1格式(每条记录单独gzip压缩)将每次成功下载的请求和响应写入w
+// 写入的内容可以被标准的网页存档工具读取和回放
+func WithWARCWriter(w io.Writer) Extension {
+	ww := &warcWriter{w: w}
+	return func(s *Spider) {
+		s.Client.Use(func(c *goreq.Client, next goreq.Handler) goreq.Handler {
+			return func(req *goreq.Request) *goreq.Response {
+				date := time.Now()
+				resp := next(req)
+				if resp == nil || resp.Err != nil || resp.Response == nil {
+					return resp
+				}
+				if err := ww.writeExchange(req, resp, date); err != nil {
+					s.writeLog(nil, LogError, "WithWARCWriter Error", "error", err, "spider", s.Name, "url", req.URL.String())
+				}
+				return resp
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package gospider
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhshch2002/goreq"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strconv"
+	"testing"
+)
+
+type testWARCRecord struct {
+	Header textproto.MIMEHeader
+	Block  []byte
+}
+
+func readTestWARCRecords(t *testing.T, data []byte) []testWARCRecord {
+	var res []testWARCRecord
+	br := bytes.NewReader(data)
+	for br.Len() > 0 {
+		gz, err := gzip.NewReader(br)
+		if !assert.NoError(t, err) {
+			return res
+		}
+		gz.Multistream(false)
+		member, err := ioutil.ReadAll(gz)
+		assert.NoError(t, err)
+		r := textproto.NewReader(bufio.NewReader(bytes.NewReader(member)))
+		line, err := r.ReadLine()
+		assert.NoError(t, err)
+		assert.Equal(t, "WARC/1.1", line)
+		h, err := r.ReadMIMEHeader()
+		assert.NoError(t, err)
+		n, _ := strconv.Atoi(h.Get("Content-Length"))
+		block := make([]byte, n)
+		_, err = io.ReadFull(r.R, block)
+		assert.NoError(t, err)
+		tail, _ := ioutil.ReadAll(r.R)
+		assert.Equal(t, "\r\n\r\n", string(tail))
+		assert.Equal(t, warcDigest(block), h.Get("WARC-Block-Digest"))
+		res = append(res, testWARCRecord{Header: h, Block: block})
+	}
+	return res
+}
+
+func TestWithWARCWriter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = fmt.Fprintf(w, "Hello")
+	}))
+	defer ts.Close()
+
+	buf := &bytes.Buffer{}
+	s := NewSpider(WithWARCWriter(buf))
+	s.Logging = false
+	s.SeedTask(goreq.Get(ts.URL + "/a?b=c"))
+	s.SeedTask(goreq.Get("http://127.0.0.1:1/"))
+	s.Wait()
+
+	records := readTestWARCRecords(t, buf.Bytes())
+	if !assert.Len(t, records, 3) {
+		return
+	}
+	assert.Equal(t, "warcinfo", records[0].Header.Get("WARC-Type"))
+
+	resp := records[1]
+	assert.Equal(t, "response", resp.Header.Get("WARC-Type"))
+	assert.Equal(t, ts.URL+"/a?b=c", resp.Header.Get("WARC-Target-URI"))
+	assert.Equal(t, "application/http;msgtype=response", resp.Header.Get("Content-Type"))
+	assert.Equal(t, warcDigest([]byte("Hello")), resp.Header.Get("WARC-Payload-Digest"))
+	hr, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(resp.Block)), nil)
+	if assert.NoError(t, err) {
+		body, _ := ioutil.ReadAll(hr.Body)
+		assert.Equal(t, 200, hr.StatusCode)
+		assert.Equal(t, "Hello", string(body))
+	}
+
+	req := records[2]
+	assert.Equal(t, "request", req.Header.Get("WARC-Type"))
+	assert.Equal(t, resp.Header.Get("WARC-Record-ID"), req.Header.Get("WARC-Concurrent-To"))
+	rr, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(req.Block)))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "GET", rr.Method)
+		assert.Equal(t, "/a?b=c", rr.RequestURI)
+	}
+}